@@ -0,0 +1,114 @@
+package access
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// adminKey marks a context whose caller presented the admin token
+type adminKey struct{}
+
+// WithAdmin marks the caller as an administrator
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// IsAdmin reports whether the caller is an administrator
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+// identityKey carries the identity the auth hook established for the caller
+type identityKey struct{}
+
+// Identity is who a caller is, as established by the auth hook
+type Identity struct {
+	// Name identifies the caller, such as a user or service account
+	Name string
+	// Role is the policy role the caller's commands are checked against
+	// (empty = the policy's default role)
+	Role string
+}
+
+// WithIdentity records the caller's identity
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the caller's identity (zero without an auth hook)
+func IdentityFrom(ctx context.Context) Identity {
+	id, _ := ctx.Value(identityKey{}).(Identity)
+	return id
+}
+
+// Transports MCP clients reach the server over, and the gRPC API, whose
+// calls are run as tool calls too
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+	TransportGRPC  = "grpc"
+)
+
+// transportKey carries the transport a tool call came over
+type transportKey struct{}
+
+// WithTransport records the transport the caller came over
+func WithTransport(ctx context.Context, transport string) context.Context {
+	return context.WithValue(ctx, transportKey{}, transport)
+}
+
+// Transport returns the transport the caller came over (empty outside MCP
+// requests, such as for the HTTP API)
+func Transport(ctx context.Context) string {
+	transport, _ := ctx.Value(transportKey{}).(string)
+	return transport
+}
+
+// Client identifies the MCP connection a tool call came from (empty outside a tool call)
+func Client(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// BearerMatches reports whether the request presents token as
+// "Authorization: Bearer <token>". An empty token never matches.
+func BearerMatches(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// IsAdminRequest reports whether an HTTP request presents the admin token or
+// was granted admin rights by the auth hook
+func IsAdminRequest(r *http.Request, adminToken string) bool {
+	return IsAdmin(r.Context()) || BearerMatches(r, adminToken)
+}
+
+// HTTPContextFunc marks MCP requests carrying the admin token as coming from an
+// administrator. Rights granted by the auth hook are already in the request's context.
+func HTTPContextFunc(adminToken string) server.HTTPContextFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		ctx = WithTransport(ctx, TransportHTTP)
+		if BearerMatches(r, adminToken) {
+			return WithAdmin(ctx)
+		}
+		return ctx
+	}
+}
+
+// StdioContextFunc treats the stdio client as an administrator: it started
+// the server and already runs it as its own user
+func StdioContextFunc() server.StdioContextFunc {
+	return func(ctx context.Context) context.Context {
+		return WithAdmin(WithTransport(ctx, TransportStdio))
+	}
+}
@@ -0,0 +1,321 @@
+package artifact
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/logging"
+)
+
+// validID matches the IDs Save gives out, so a requested ID cannot name a
+// file outside the store
+var validID = regexp.MustCompile(`^[0-9a-f]{32}(\.[a-z0-9]+)?$`)
+
+// metaDir is the directory in the store holding each artifact's description
+const metaDir = "meta"
+
+// Artifact is a file kept in the store
+type Artifact struct {
+	// ID names the artifact; it is random, so knowing it grants access
+	ID       string `json:"id"`
+	Path     string `json:"-"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	// SHA256 is the hex checksum of the content
+	SHA256 string `json:"sha256,omitempty"`
+	// Name is the file name it is downloaded as, and Source the file it was
+	// collected from, for files a command produced
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source,omitempty"`
+	// Owner is the client whose call kept it, and Command and SessionID
+	// what produced it
+	Owner     string    `json:"owner,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Store keeps files for clients to download by ID: command output too large
+// to return in a tool result, and files commands produced. Each artifact's
+// description is kept next to it, so every server component sharing the
+// directory sees the same artifacts. Artifacts are removed once they are
+// older than the configured TTL.
+type Store struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	log      *slog.Logger
+}
+
+// New creates the artifact store
+func New(cfg *config.Config) *Store {
+	return &Store{
+		dir:      cfg.ArtifactDir,
+		ttl:      cfg.ArtifactTTL,
+		maxBytes: cfg.ArtifactMaxBytes,
+		log:      logging.For("artifact"),
+	}
+}
+
+// TTL returns how long artifacts are kept
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Save stores data as a new artifact. The ID ends in an extension matching
+// mimeType, so a saved file opens with the right program.
+func (s *Store) Save(data []byte, mimeType string) (Artifact, error) {
+	ext := ""
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	id, path, err := s.create(ext)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return Artifact{}, fmt.Errorf("failed to save artifact: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	a := s.describe(Artifact{ID: id, Path: path, MIMEType: mimeType, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	s.log.Info("Saved artifact", "id", id, "mime_type", mimeType, "bytes", len(data))
+	return a, nil
+}
+
+// SaveFile copies a file into the store as a new artifact described by a,
+// whose ID, path, type, size and checksum are filled in. Files over the
+// configured size limit are refused.
+func (s *Store) SaveFile(path string, a Artifact) (Artifact, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer src.Close()
+	return s.SaveOpened(src, a)
+}
+
+// SaveOpened is SaveFile for a file the caller has opened, such as one it
+// opened on behalf of another user. It does not close src.
+func (s *Store) SaveOpened(src *os.File, a Artifact) (Artifact, error) {
+	path := src.Name()
+	info, err := src.Stat()
+	if err != nil {
+		return Artifact{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return Artifact{}, fmt.Errorf("%s is not a regular file", path)
+	}
+	if s.maxBytes > 0 && info.Size() > s.maxBytes {
+		return Artifact{}, fmt.Errorf("%s is %d bytes, over the %d byte artifact limit", path, info.Size(), s.maxBytes)
+	}
+
+	if a.Name == "" {
+		a.Name = filepath.Base(path)
+	}
+	id, dest, err := s.create(strings.ToLower(filepath.Ext(a.Name)))
+	if err != nil {
+		return Artifact{}, err
+	}
+	dst, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to save artifact: %v", err)
+	}
+	hash := sha256.New()
+	// The file may grow while it is copied, so the limit is enforced again
+	limited := io.Reader(src)
+	if s.maxBytes > 0 {
+		limited = io.LimitReader(src, s.maxBytes+1)
+	}
+	size, err := io.Copy(io.MultiWriter(dst, hash), limited)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && s.maxBytes > 0 && size > s.maxBytes {
+		err = fmt.Errorf("%s grew over the %d byte artifact limit while it was copied", path, s.maxBytes)
+	}
+	if err != nil {
+		os.Remove(dest)
+		return Artifact{}, fmt.Errorf("failed to save artifact: %v", err)
+	}
+
+	a.ID, a.Path, a.Size, a.SHA256 = id, dest, size, hex.EncodeToString(hash.Sum(nil))
+	a.MIMEType = mime.TypeByExtension(filepath.Ext(a.Name))
+	if a.MIMEType == "" {
+		a.MIMEType = sniff(dest)
+	}
+	a = s.describe(a)
+	s.log.Info("Saved artifact", "id", id, "name", a.Name, "mime_type", a.MIMEType, "bytes", size)
+	return a, nil
+}
+
+// create prepares the store for a new artifact, returning its ID, which ends
+// in ext when that makes a valid ID, and path
+func (s *Store) create(ext string) (string, string, error) {
+	if err := os.MkdirAll(filepath.Join(s.dir, metaDir), 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create artifact directory: %v", err)
+	}
+	s.prune()
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+	if ext != "" && validID.MatchString(id+ext) {
+		id += ext
+	}
+	return id, filepath.Join(s.dir, id), nil
+}
+
+// describe records when a new artifact was created and expires, and writes
+// its description
+func (s *Store) describe(a Artifact) Artifact {
+	a.Created = time.Now().UTC()
+	a.Expires = a.Created.Add(s.ttl)
+	data, _ := json.Marshal(a)
+	if err := os.WriteFile(s.metaPath(a.ID), data, 0600); err != nil {
+		// The artifact is still served, only without its description
+		s.log.Warn("Failed to describe artifact", "id", a.ID, "error", err)
+	}
+	return a
+}
+
+// metaPath returns the path of an artifact's description
+func (s *Store) metaPath(id string) string {
+	return filepath.Join(s.dir, metaDir, id+".json")
+}
+
+// Get describes an artifact. Artifacts kept by an earlier version of the
+// server, which have no description, are described from their file.
+func (s *Store) Get(id string) (Artifact, error) {
+	if !validID.MatchString(id) {
+		return Artifact{}, fmt.Errorf("artifact not found: %s", id)
+	}
+	path := filepath.Join(s.dir, id)
+	info, err := os.Stat(path)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("artifact not found: %s", id)
+	}
+
+	var a Artifact
+	if data, err := os.ReadFile(s.metaPath(id)); err == nil && json.Unmarshal(data, &a) == nil {
+		a.Path = path
+	} else {
+		a = Artifact{ID: id, Path: path, Size: info.Size(), Created: info.ModTime().UTC(), Expires: info.ModTime().UTC().Add(s.ttl)}
+	}
+	if time.Now().After(a.Expires) {
+		return Artifact{}, fmt.Errorf("artifact not found: %s", id)
+	}
+	if a.MIMEType == "" {
+		if a.MIMEType = mime.TypeByExtension(filepath.Ext(id)); a.MIMEType == "" {
+			a.MIMEType = sniff(path)
+		}
+	}
+	return a, nil
+}
+
+// Open opens an artifact for reading
+func (s *Store) Open(id string) (*os.File, Artifact, error) {
+	a, err := s.Get(id)
+	if err != nil {
+		return nil, Artifact{}, err
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, Artifact{}, fmt.Errorf("artifact not found: %s", id)
+	}
+	return f, a, nil
+}
+
+// List returns the artifacts kept by a client's calls, or every artifact
+// when all is set, newest first
+func (s *Store) List(owner string, all bool) []Artifact {
+	s.prune()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+
+	var artifacts []Artifact
+	for _, entry := range entries {
+		if !validID.MatchString(entry.Name()) {
+			continue
+		}
+		a, err := s.Get(entry.Name())
+		if err != nil || (!all && a.Owner != owner) {
+			continue
+		}
+		artifacts = append(artifacts, a)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Created.After(artifacts[j].Created)
+	})
+	return artifacts
+}
+
+// Delete removes an artifact
+func (s *Store) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, id)); err != nil {
+		return fmt.Errorf("failed to delete artifact: %v", err)
+	}
+	os.Remove(s.metaPath(id))
+	s.log.Info("Deleted artifact", "id", id)
+	return nil
+}
+
+// prune removes expired artifacts, and descriptions left without theirs
+func (s *Store) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !validID.MatchString(entry.Name()) {
+			continue
+		}
+		if _, err := s.Get(entry.Name()); err == nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err == nil {
+			os.Remove(s.metaPath(entry.Name()))
+			s.log.Debug("Removed expired artifact", "id", entry.Name())
+		}
+	}
+
+	described, _ := os.ReadDir(filepath.Join(s.dir, metaDir))
+	for _, entry := range described {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if _, err := os.Lstat(filepath.Join(s.dir, id)); os.IsNotExist(err) {
+			os.Remove(filepath.Join(s.dir, metaDir, entry.Name()))
+		}
+	}
+}
+
+// sniff detects the type of a file from its first bytes
+func sniff(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	return http.DetectContentType(head[:n])
+}
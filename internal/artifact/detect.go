@@ -0,0 +1,163 @@
+package artifact
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxScanFiles bounds the files a snapshot records, so detecting new files
+// in a huge tree does not hold up every command
+const maxScanFiles = 20000
+
+// errTooMany stops a walk that reached maxScanFiles
+var errTooMany = errors.New("too many files")
+
+// skipDirs are dependency caches, whose files are never detected as
+// artifacts; hidden directories such as .git are skipped too
+var skipDirs = map[string]bool{"node_modules": true, "__pycache__": true, "vendor": true}
+
+// Snapshot records the files under a directory before a command runs, so
+// the files it creates or changes can be found afterwards
+type Snapshot struct {
+	dir   string
+	files map[string]fileState
+	// Complete is false when the tree had too many files to record
+	Complete bool
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Scan records the regular files under dir, leaving out hidden directories
+// and dependency caches
+func Scan(dir string) *Snapshot {
+	s := &Snapshot{dir: dir, files: make(map[string]fileState)}
+	s.Complete = walk(dir, func(path string, info fs.FileInfo) {
+		s.files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+	}) == nil
+	return s
+}
+
+// Changed returns the regular files under the snapshot's directory that were
+// created or changed since it was taken, sorted by path, and at most limit
+// of them. It also reports whether there were more.
+func (s *Snapshot) Changed(limit int) ([]string, bool) {
+	var changed []string
+	walk(s.dir, func(path string, info fs.FileInfo) {
+		before, existed := s.files[path]
+		if !existed || before.size != info.Size() || !before.modTime.Equal(info.ModTime()) {
+			changed = append(changed, path)
+		}
+	})
+	sort.Strings(changed)
+	if len(changed) > limit {
+		return changed[:limit], true
+	}
+	return changed, false
+}
+
+// walk calls fn for the regular files under dir, stopping with errTooMany
+// after maxScanFiles of them
+func walk(dir string, fn func(string, fs.FileInfo)) error {
+	count := 0
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories are left out rather than ending the walk
+			if d != nil && d.IsDir() && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(d.Name(), ".") || skipDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if count++; count > maxScanFiles {
+			return errTooMany
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fn(path, info)
+		return nil
+	})
+}
+
+// Match returns the regular files matching a glob pattern, relative to dir
+// unless it is absolute. "**" as a whole path element matches any number of
+// directories.
+func Match(dir, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	pattern = filepath.Clean(pattern)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	if !strings.Contains(pattern, "**") {
+		found, _ := filepath.Glob(pattern)
+		for _, path := range found {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				matches = append(matches, path)
+			}
+		}
+		return matches, nil
+	}
+
+	// The tree below the part before "**" is walked, matching whole paths
+	root := pattern[:strings.Index(pattern, "**")]
+	root = strings.TrimSuffix(root, string(filepath.Separator))
+	if root == "" {
+		root = string(filepath.Separator)
+	}
+	// A tree over maxScanFiles is only matched in part
+	walk(root, func(path string, _ fs.FileInfo) {
+		if matchDeep(pattern, path) {
+			matches = append(matches, path)
+		}
+	})
+	return matches, nil
+}
+
+// matchDeep matches a path against a pattern whose "**" elements stand for
+// any number of directories
+func matchDeep(pattern, path string) bool {
+	sep := string(filepath.Separator)
+	return matchParts(strings.Split(pattern, sep), strings.Split(path, sep))
+}
+
+func matchParts(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchParts(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
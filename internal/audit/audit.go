@@ -0,0 +1,306 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/logging"
+)
+
+// genesis is the previous hash of the first record
+var genesis = strings.Repeat("0", sha256.Size*2)
+
+// maxErrorText bounds the error text kept for a failed action
+const maxErrorText = 500
+
+// Actors recorded in the log
+const (
+	ActorAgent    = "agent"
+	ActorOperator = "operator"
+	// ActorServer is the server acting on its own, e.g. tearing down ended sessions
+	ActorServer = "server"
+)
+
+// Record is one audited action. Each record carries the hash of the one before
+// it, so altering, removing or reordering records breaks the chain.
+type Record struct {
+	Seq     uint64          `json:"seq"`
+	Time    time.Time       `json:"time"`
+	Actor   string          `json:"actor"`
+	Action  string          `json:"action"`
+	Session string          `json:"session_id,omitempty"`
+	Outcome string          `json:"outcome"`
+	Details json.RawMessage `json:"details,omitempty"`
+	Prev    string          `json:"prev"`
+	Hash    string          `json:"hash"`
+}
+
+// digest computes a record's hash over its encoding without the hash itself
+func (r Record) digest() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends hash-chained records to a file
+type Log struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+	last string
+	log  *slog.Logger
+}
+
+// Open opens the configured audit log, continuing the chain of any existing
+// records, or returns nil when auditing is disabled
+func Open(cfg *config.Config) (*Log, error) {
+	if cfg.AuditFile == "" {
+		return nil, nil
+	}
+
+	l := &Log{
+		path: cfg.AuditFile,
+		last: genesis,
+		log:  logging.For("audit"),
+	}
+
+	// Resume from the last record so the chain continues across restarts
+	if err := scan(l.path, func(r Record, err error) bool {
+		if err == nil {
+			l.seq = r.Seq
+			l.last = r.Hash
+		}
+		return true
+	}); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %v", l.path, err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", l.path, err)
+	}
+	l.file = file
+
+	return l, nil
+}
+
+// Append records an action. Failures to write are logged and mark the server
+// degraded rather than interrupting the action being audited.
+func (l *Log) Append(actor, action, sessionID, outcome string, details map[string]interface{}) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := Record{
+		Seq:     l.seq + 1,
+		Time:    time.Now().UTC(),
+		Actor:   actor,
+		Action:  action,
+		Session: sessionID,
+		Outcome: outcome,
+		Prev:    l.last,
+	}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err != nil {
+			l.fail(err)
+			return
+		}
+		r.Details = data
+	}
+
+	hash, err := r.digest()
+	if err != nil {
+		l.fail(err)
+		return
+	}
+	r.Hash = hash
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		l.fail(err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		l.fail(err)
+		return
+	}
+
+	l.seq = r.Seq
+	l.last = r.Hash
+	health.Clear("audit")
+}
+
+// fail reports a record that could not be written. The caller must hold l.mu.
+func (l *Log) fail(err error) {
+	l.log.Error("Failed to write audit record", "path", l.path, "error", err)
+	health.SetDegraded("audit", fmt.Sprintf("failed to write %s: %v", l.path, err))
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Verification is the outcome of checking the chain
+type Verification struct {
+	Valid   bool   `json:"valid"`
+	Path    string `json:"path"`
+	Records uint64 `json:"records"`
+	// Head is the hash of the last valid record, which can be kept elsewhere
+	// to detect the log being truncated or replaced later
+	Head string `json:"head"`
+	// Line and Error describe the first problem found
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Verify checks every record's hash and its link to the one before
+func (l *Log) Verify() Verification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	v := Verification{Valid: true, Path: l.path, Head: genesis}
+	line := 0
+	err := scan(l.path, func(r Record, err error) bool {
+		line++
+		switch {
+		case err != nil:
+			v.Error = fmt.Sprintf("malformed record: %v", err)
+		case r.Seq != v.Records+1:
+			v.Error = fmt.Sprintf("expected record %d, found %d", v.Records+1, r.Seq)
+		case r.Prev != v.Head:
+			v.Error = fmt.Sprintf("record %d does not follow the previous record", r.Seq)
+		default:
+			if hash, err := r.digest(); err != nil || hash != r.Hash {
+				v.Error = fmt.Sprintf("record %d has been altered", r.Seq)
+			}
+		}
+		if v.Error != "" {
+			v.Valid = false
+			v.Line = line
+			return false
+		}
+
+		v.Records = r.Seq
+		v.Head = r.Hash
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		v.Valid = false
+		v.Error = err.Error()
+	}
+
+	return v
+}
+
+// scan calls fn for each line of the log until it returns false
+func scan(path string, fn func(Record, error) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var r Record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if !fn(r, err) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// ToolMiddleware records every tool call with its arguments and outcome
+func (l *Log) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if l == nil {
+				return next(ctx, request)
+			}
+
+			details := make(map[string]interface{})
+			result, err := next(context.WithValue(ctx, detailsKey{}, details), request)
+
+			args := request.GetArguments()
+			details["arguments"] = args
+			if requestID := labels.RequestID(ctx); requestID != "" {
+				details["request_id"] = requestID
+			}
+			if identity := access.IdentityFrom(ctx).Name; identity != "" {
+				details["identity"] = identity
+			}
+			outcome := "ok"
+			switch {
+			case err != nil:
+				outcome = "error"
+				details["error"] = truncate(err.Error())
+			case result != nil && result.IsError:
+				outcome = "error"
+				if len(result.Content) > 0 {
+					if text, ok := result.Content[0].(mcp.TextContent); ok {
+						details["error"] = truncate(text.Text)
+					}
+				}
+			}
+
+			sessionID, _ := args["session_id"].(string)
+			l.Append(ActorAgent, request.Params.Name, sessionID, outcome, details)
+
+			return result, err
+		}
+	}
+}
+
+// detailsKey carries the details of the tool call being audited
+type detailsKey struct{}
+
+// Annotate adds a detail to the record of the tool call ctx belongs to. It does
+// nothing when the call is not audited.
+func Annotate(ctx context.Context, key string, value interface{}) {
+	if details, ok := ctx.Value(detailsKey{}).(map[string]interface{}); ok {
+		details[key] = value
+	}
+}
+
+// truncate shortens error text kept in a record
+func truncate(text string) string {
+	if len(text) > maxErrorText {
+		return text[:maxErrorText] + "..."
+	}
+	return text
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/backends"
+	"mcp-terminal-server/internal/config"
+)
+
+// maxResponseBytes bounds how much of a hook's answer is read
+const maxResponseBytes = 1 << 20
+
+// maxCacheEntries bounds the cache of allowed requests; it is emptied when full
+const maxCacheEntries = 10000
+
+// volatileHeaders change from one request of a client to the next without
+// saying anything about who it is, and are left out of cache keys
+var volatileHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Last-Event-Id":     true,
+	"Traceparent":       true,
+	"Tracestate":        true,
+	"Baggage":           true,
+	"X-Request-Id":      true,
+	"If-None-Match":     true,
+	"If-Modified-Since": true,
+	"Range":             true,
+}
+
+// Request is the metadata of an HTTP request a hook decides on. The body is
+// not included.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+	// Client is the remote address without its port
+	Client string `json:"client"`
+	// Headers holds every request header, with repeated values joined by ", "
+	Headers map[string]string `json:"headers"`
+}
+
+// Result is a hook's answer
+type Result struct {
+	Allow bool `json:"allow"`
+	// Identity names the caller in the audit log
+	Identity string `json:"identity"`
+	// Role is the policy role the caller's commands are checked against
+	Role string `json:"role"`
+	// Admin grants the caller the rights of the admin token
+	Admin bool `json:"admin"`
+	// Reason explains a denial to the caller
+	Reason string `json:"reason"`
+}
+
+// Hook authenticates requests. An error means no decision could be obtained,
+// and the request is refused.
+type Hook interface {
+	Authenticate(ctx context.Context, req Request) (Result, error)
+}
+
+// New returns the configured hook, or nil when authentication hooks are
+// disabled. A URL is called over HTTP; anything else is run as a command,
+// split into arguments at spaces.
+func New(cfg *config.Config) Hook {
+	target := strings.TrimSpace(cfg.AuthHook)
+	if target == "" {
+		return nil
+	}
+
+	var hook Hook
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		hook = &httpHook{url: target, timeout: cfg.AuthHookTimeout, client: &http.Client{}, breaker: backends.NewBreaker("auth hook", target, cfg.BreakerThreshold)}
+	} else {
+		hook = &commandHook{argv: strings.Fields(target), timeout: cfg.AuthHookTimeout}
+	}
+	if cfg.AuthHookCacheTTL > 0 {
+		hook = &cachedHook{hook: hook, ttl: cfg.AuthHookCacheTTL, entries: make(map[[sha256.Size]byte]cacheEntry)}
+	}
+	return hook
+}
+
+// FromHTTP collects the metadata of r that is passed to hooks
+func FromHTTP(r *http.Request) Request {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return Request{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Client:  client,
+		Headers: headers,
+	}
+}
+
+// decode reads a hook's answer
+func decode(data []byte) (Result, error) {
+	var result Result
+	if err := json.Unmarshal(bytes.TrimSpace(data), &result); err != nil {
+		return Result{}, fmt.Errorf("invalid hook answer %q: %v", truncate(data), err)
+	}
+	return result, nil
+}
+
+// truncate shortens a hook's output for error messages
+func truncate(data []byte) string {
+	const max = 200
+	text := strings.TrimSpace(string(data))
+	if len(text) > max {
+		return text[:max] + "..."
+	}
+	return text
+}
+
+// commandHook runs a command for each request, with the request as JSON on
+// its stdin, and reads the result as JSON from its stdout
+type commandHook struct {
+	argv    []string
+	timeout time.Duration
+}
+
+func (h *commandHook) Authenticate(ctx context.Context, req Request) (Result, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.argv[0], h.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Result{}, fmt.Errorf("auth hook %s failed: %v: %s", h.argv[0], err, truncate(stderr.Bytes()))
+	}
+	return decode(stdout.Bytes())
+}
+
+// httpHook POSTs each request as JSON to a URL and reads the result from the
+// response body. Once the URL keeps failing, requests are refused at once
+// with a *backends.Unavailable error until it answers again.
+type httpHook struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+	breaker *backends.Breaker
+}
+
+func (h *httpHook) Authenticate(ctx context.Context, req Request) (Result, error) {
+	if err := h.breaker.Allow(); err != nil {
+		return Result{}, err
+	}
+	result, err := h.call(ctx, req)
+	h.breaker.Done(err)
+	return result, err
+}
+
+// call makes one request to the hook
+func (h *httpHook) call(ctx context.Context, req Request) (Result, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return Result{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("auth hook returned %s: %s", resp.Status, truncate(data))
+	}
+	return decode(data)
+}
+
+// cachedHook remembers allowed requests for a while, so clients making many
+// calls do not wait for the hook each time. Denials are not cached, so a
+// client whose credentials were just fixed gets in at once.
+type cachedHook struct {
+	hook    Hook
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]cacheEntry
+}
+
+type cacheEntry struct {
+	result  Result
+	expires time.Time
+}
+
+func (h *cachedHook) Authenticate(ctx context.Context, req Request) (Result, error) {
+	key := cacheKey(req)
+
+	h.mu.Lock()
+	entry, ok := h.entries[key]
+	h.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.result, nil
+	}
+
+	result, err := h.hook.Authenticate(ctx, req)
+	if err != nil || !result.Allow {
+		return result, err
+	}
+
+	h.mu.Lock()
+	if len(h.entries) >= maxCacheEntries {
+		h.entries = make(map[[sha256.Size]byte]cacheEntry)
+	}
+	h.entries[key] = cacheEntry{result: result, expires: time.Now().Add(h.ttl)}
+	h.mu.Unlock()
+	return result, nil
+}
+
+// cacheKey hashes what a hook sees of a request, but for volatile headers, so
+// the cache does not answer for a request the hook might decide differently on
+func cacheKey(req Request) [sha256.Size]byte {
+	names := make([]string, 0, len(req.Headers))
+	for name := range req.Headers {
+		if !volatileHeaders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%s\x00%s\x00%s\x00", req.Method, req.Path, req.Query, req.Client)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s\x00%s\x00", name, req.Headers[name])
+	}
+	return sha256.Sum256([]byte(b.String()))
+}
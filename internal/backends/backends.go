@@ -0,0 +1,176 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/shells"
+)
+
+const (
+	// checkTimeout bounds one attempt to reach a backend
+	checkTimeout = 5 * time.Second
+	// firstBackoff is the wait before checking an unreachable backend again,
+	// doubled after each failed check up to maxBackoff
+	firstBackoff = time.Second
+	maxBackoff   = time.Minute
+)
+
+// Backend is a service the server depends on
+type Backend struct {
+	Name string
+	// Target is what is checked: a tcp://host:port, unix:///socket or
+	// http(s):// URL, or cmd:<command> run in the server's shell
+	Target string
+	check  func(ctx context.Context) error
+}
+
+// Parse reads a backend from "name=target", or a bare target named after
+// its host, socket or command
+func Parse(spec, shell string) (*Backend, error) {
+	name, target, named := strings.Cut(spec, "=")
+	if !named || strings.Contains(name, ":") {
+		name, target = "", spec
+	}
+	b := &Backend{Name: strings.TrimSpace(name), Target: strings.TrimSpace(target)}
+
+	if command, ok := strings.CutPrefix(b.Target, "cmd:"); ok {
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("%s: no command given", spec)
+		}
+		b.check = runs(shell, command)
+		if b.Name == "" {
+			b.Name = strings.Fields(command)[0]
+		}
+		return b, nil
+	}
+
+	u, err := url.Parse(b.Target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("%s: tcp targets need a port", spec)
+		}
+		b.check = dials("tcp", u.Host)
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("%s: unix targets need a socket path", spec)
+		}
+		b.check = dials("unix", u.Path)
+	case "http", "https":
+		b.check = answers(b.Target)
+	default:
+		return nil, fmt.Errorf("%s: target must be tcp://, unix://, http(s):// or cmd:", spec)
+	}
+	if b.Name == "" {
+		b.Name = u.Host
+		if u.Scheme == "unix" {
+			b.Name = u.Path
+		}
+	}
+	return b, nil
+}
+
+// Check starts verifying the required backends in the background. Until a
+// backend is reached it is reported unavailable, which keeps /readyz failing,
+// and checked again with exponential backoff.
+func Check(cfg *config.Config) {
+	log := logging.For("backends")
+	for _, spec := range cfg.RequiredBackends {
+		b, err := Parse(spec, cfg.Shell)
+		if err != nil {
+			log.Error("Invalid required backend", "error", err)
+			health.SetUnavailable("backend "+spec, err.Error())
+			continue
+		}
+		health.SetUnavailable(b.component(), "not checked yet")
+		go b.wait(log)
+	}
+}
+
+// component names the backend in the health reports
+func (b *Backend) component() string {
+	return "backend " + b.Name
+}
+
+// wait checks the backend until it is reached
+func (b *Backend) wait(log *slog.Logger) {
+	started := time.Now()
+	backoff := firstBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		err := b.check(ctx)
+		cancel()
+		if err == nil {
+			health.Clear(b.component())
+			log.Info("Required backend is reachable", "backend", b.Name, "target", b.Target, "attempts", attempt, "after", time.Since(started).Round(time.Millisecond).String())
+			return
+		}
+
+		health.SetUnavailable(b.component(), fmt.Sprintf("%s is unreachable after %d attempts: %v", b.Target, attempt, err))
+		log.Warn("Required backend is unreachable", "backend", b.Name, "target", b.Target, "attempt", attempt, "retry_in", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// dials checks that a connection can be opened
+func dials(network, address string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// answers checks that a URL answers with a status below 500
+func answers(target string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("answered %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// runs checks that a command exits with status 0
+func runs(shell, command string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		out, err := exec.CommandContext(ctx, shell, shells.For(shell).CommandArgs(command)...).CombinedOutput()
+		if err != nil {
+			if text := strings.TrimSpace(string(out)); text != "" {
+				if len(text) > 200 {
+					text = text[:200] + "..."
+				}
+				return fmt.Errorf("%v: %s", err, text)
+			}
+			return err
+		}
+		return nil
+	}
+}
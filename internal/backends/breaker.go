@@ -0,0 +1,128 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+)
+
+// Unavailable is the error of a call refused because the circuit of its
+// backend is open
+type Unavailable struct {
+	Backend string
+	// RetryAfter is how long until the backend is probed again
+	RetryAfter time.Duration
+}
+
+func (e *Unavailable) Error() string {
+	return fmt.Sprintf("backend %s unavailable, retry after %s", e.Backend, e.RetryAfter)
+}
+
+// Breaker fails calls to a remote backend fast once it has failed
+// threshold times in a row, instead of having every call wait for the
+// backend's timeout. While the circuit is open the backend is probed in the
+// background with exponential backoff, and calls go through again as soon
+// as a probe reaches it.
+type Breaker struct {
+	name      string
+	target    string
+	threshold int
+	probe     func(ctx context.Context) error
+	log       *slog.Logger
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	// nextProbe is when the open circuit's backend is probed next
+	nextProbe time.Time
+}
+
+// NewBreaker creates the breaker of the backend at an http(s) URL, which is
+// probed as required backends are. It returns nil, which lets every call
+// through, when threshold is 0.
+func NewBreaker(name, url string, threshold int) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Breaker{
+		name:      name,
+		target:    url,
+		threshold: threshold,
+		probe:     answers(url),
+		log:       logging.For("backends"),
+	}
+}
+
+// Allow returns an *Unavailable error when calls to the backend are to fail fast
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	return &Unavailable{Backend: b.name, RetryAfter: max(time.Until(b.nextProbe), 0).Round(time.Second)}
+}
+
+// Done records the outcome of a call. Calls given up by their caller say
+// nothing about the backend and are not counted.
+func (b *Breaker) Done(err error) {
+	if b == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.open || b.failures < b.threshold {
+		return
+	}
+	b.open = true
+	b.nextProbe = time.Now().Add(firstBackoff)
+	b.log.Warn("Backend keeps failing; failing calls fast", "backend", b.name, "target", b.target, "failures", b.failures, "error", err)
+	health.SetDegraded(b.component(), fmt.Sprintf("circuit open after %d failures: %v", b.failures, err))
+	go b.recover()
+}
+
+// component names the breaker in the health reports
+func (b *Breaker) component() string {
+	return "circuit " + b.name
+}
+
+// recover probes the backend of an open circuit until it answers, then closes
+// the circuit
+func (b *Breaker) recover() {
+	backoff := firstBackoff
+	for attempt := 1; ; attempt++ {
+		time.Sleep(backoff)
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		err := b.probe(ctx)
+		cancel()
+
+		b.mu.Lock()
+		if err == nil {
+			b.open = false
+			b.failures = 0
+			b.mu.Unlock()
+			health.Clear(b.component())
+			b.log.Info("Backend recovered; letting calls through", "backend", b.name, "target", b.target, "probes", attempt)
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+		b.nextProbe = time.Now().Add(backoff)
+		b.mu.Unlock()
+		b.log.Debug("Backend still unavailable", "backend", b.name, "target", b.target, "retry_in", backoff.String(), "error", err)
+	}
+}
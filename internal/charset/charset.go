@@ -0,0 +1,175 @@
+package charset
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Auto converts output that is not valid UTF-8 from the first of the
+// candidate encodings it reads sensibly in
+const Auto = "auto"
+
+// candidates are the encodings Auto tries, in order. Double-byte encodings
+// come first, as nearly any bytes read as windows-1252 (a superset of
+// Latin-1).
+var candidates = []string{"shift_jis", "gbk", "windows-1252"}
+
+// Validate checks an encoding name: Auto, or a name such as "shift_jis",
+// "gbk", "euc-kr", "latin1" or "utf-8"
+func Validate(name string) error {
+	_, err := lookup(name)
+	return err
+}
+
+// lookup returns the encoding of a name, nil for Auto and UTF-8
+func lookup(name string) (encoding.Encoding, error) {
+	if name == "" || name == Auto {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q (use auto or a name such as utf-8, shift_jis, gbk, euc-kr, big5 or latin1)", name)
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// Decoder converts the output of one command to valid UTF-8. Under Auto,
+// the encoding found for one piece of output is tried first for the next.
+type Decoder struct {
+	auto bool
+	enc  encoding.Encoding
+	// converted is the encoding output was converted from, and replaced is
+	// set when bytes that could not be decoded were replaced
+	converted string
+	replaced  bool
+}
+
+// NewDecoder returns a decoder for output in the named encoding, or Auto
+func NewDecoder(name string) (*Decoder, error) {
+	enc, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{auto: name == "" || name == Auto, enc: enc}, nil
+}
+
+// String converts output to valid UTF-8, replacing what cannot be decoded
+// with U+FFFD
+func (d *Decoder) String(s string) string {
+	if !d.auto {
+		if d.enc == nil {
+			return d.valid(s)
+		}
+		decoded, err := d.enc.NewDecoder().String(s)
+		if err != nil {
+			return d.valid(s)
+		}
+		if decoded != s {
+			d.converted, _ = htmlindex.Name(d.enc)
+		}
+		if strings.ContainsRune(decoded, utf8.RuneError) && !strings.ContainsRune(s, utf8.RuneError) {
+			d.replaced = true
+		}
+		return decoded
+	}
+
+	// UTF-8 with a stray broken byte, as where output was cut, stays UTF-8
+	if mostlyUTF8(s) {
+		return d.valid(s)
+	}
+	if d.enc != nil {
+		if decoded, ok := plausible(d.enc, s); ok {
+			return decoded
+		}
+	}
+	for _, name := range candidates {
+		enc, _ := htmlindex.Get(name)
+		if decoded, ok := plausible(enc, s); ok {
+			d.enc, d.converted = enc, name
+			return decoded
+		}
+	}
+	return d.valid(s)
+}
+
+// valid replaces the invalid UTF-8 in s
+func (d *Decoder) valid(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	d.replaced = true
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// Note describes what was done to the output for a result, or returns ""
+// when it was valid UTF-8
+func (d *Decoder) Note() string {
+	switch {
+	case d.converted != "" && d.replaced:
+		return fmt.Sprintf("converted from %s to UTF-8; bytes that could not be decoded were replaced with U+FFFD", d.converted)
+	case d.converted != "":
+		return fmt.Sprintf("converted from %s to UTF-8", d.converted)
+	case d.replaced:
+		return "output was not valid UTF-8; bytes that could not be decoded were replaced with U+FFFD (give encoding to convert it)"
+	}
+	return ""
+}
+
+// mostlyUTF8 reports whether s is UTF-8, but for a sequence cut off at its
+// end or a few broken bytes among many multi-byte characters. Text in other
+// encodings forms the odd valid sequence by chance, but few against many
+// invalid bytes.
+func mostlyUTF8(s string) bool {
+	// Only the last 3 bytes can be the start of a cut-off sequence
+	for i := len(s) - 1; i >= 0 && i >= len(s)-3; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				s = s[:i]
+			}
+			break
+		}
+	}
+
+	multiByte, invalid := 0, 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+		case size > 1:
+			multiByte++
+		}
+		i += size
+	}
+	return invalid == 0 || invalid*4 <= multiByte
+}
+
+// plausible decodes s, reporting whether the result reads like text: nothing
+// failed to decode, no C1 control characters, and not mostly half-width
+// katakana, which is what text in GBK or Big5 turns into as Shift_JIS
+func plausible(enc encoding.Encoding, s string) (string, bool) {
+	decoded, err := enc.NewDecoder().String(s)
+	if err != nil || strings.ContainsRune(decoded, utf8.RuneError) {
+		return "", false
+	}
+	nonASCII, halfwidth := 0, 0
+	for _, r := range decoded {
+		switch {
+		case r >= 0x80 && r <= 0x9f:
+			return "", false
+		case r >= 0xff61 && r <= 0xff9f:
+			halfwidth++
+		}
+		if r >= utf8.RuneSelf {
+			nonASCII++
+		}
+	}
+	return decoded, halfwidth*3 <= nonASCII
+}
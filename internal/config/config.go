@@ -3,49 +3,451 @@ package config
 import (
 	"flag"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
+
+	"mcp-terminal-server/internal/charset"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/sse"
 )
 
+// PathMapping pairs a directory as the server sees it (e.g. inside a container)
+// with the same directory as clients see it (e.g. on the host)
+type PathMapping struct {
+	Server string
+	Client string
+}
+
+// WarmShell is a profile, named by the shell sessions start with, and how many
+// idle shells of it to keep started
+type WarmShell struct {
+	Shell string
+	Count int
+}
+
 // Config holds the server configuration
 type Config struct {
 	DefaultTimeout time.Duration
-	Platform       string
-	Shell          string
-	HTTPMode       bool
-	Port           string
-	Host           string
-	Display        string
+	// KillGracePeriod is how long a timed-out command's processes have to exit
+	// after SIGTERM before they are killed with SIGKILL
+	KillGracePeriod time.Duration
+	Platform        string
+	Shell           string
+	HTTPMode        bool
+	// StdioMode serves MCP over stdio as well when HTTPMode is set, so the
+	// client that started the server and HTTP clients share its sessions
+	StdioMode bool
+	Port      string
+	Host      string
+	// UnixSocket serves HTTP on a Unix domain socket at this path instead of
+	// a TCP port, with UnixSocketMode as its permissions
+	UnixSocket     string
+	UnixSocketMode os.FileMode
+	// GRPCAddr serves the gRPC API on this TCP address, or on a Unix domain
+	// socket when given as unix:/path (empty = disabled)
+	GRPCAddr string
+	Display  string
+	// Workspace is the directory sessions and commands start in and relative
+	// paths are resolved against (empty = the server's directory). With
+	// WorkspaceSandbox "mount", commands on Linux can only write inside it;
+	// with "chroot" they see nothing of the host but it and the system
+	// directories. "none" only sets the starting directory.
+	Workspace        string
+	WorkspaceSandbox string
+	// Tenant labels every process the server starts as MCP_TENANT (empty = unset)
+	Tenant string
+
+	// LogLevel is "debug", "info", "warn" or "error"; commands are only logged in full at debug
+	LogLevel string
+	// LogFormat is "text" or "json"
+	LogFormat string
+
+	// ProgressInterval is how often progress notifications are sent for
+	// running commands when the client supplies a progress token (0 disables)
+	ProgressInterval time.Duration
+	// WatchMaxDuration caps how long one watch call may follow a file or command
+	WatchMaxDuration time.Duration
+	// WaitForTimeout is how long a command waits for its wait_for conditions
+	// unless the call says otherwise; WaitForMaxTimeout caps what calls ask for
+	WaitForTimeout    time.Duration
+	WaitForMaxTimeout time.Duration
+	// ScheduleMaxJobs caps the scheduled commands kept, finished ones
+	// included; ScheduleMaxResults caps the results kept for each
+	ScheduleMaxJobs    int
+	ScheduleMaxResults int
+
+	// IOReadBPS and IOWriteBPS are the disk throughput caps in bytes per
+	// second for spawned commands and shells, which calls may lower but not
+	// raise (0 = unlimited)
+	IOReadBPS  int64
+	IOWriteBPS int64
+	// CgroupRoot is the cgroup v2 directory under which per-command cgroups are created
+	CgroupRoot string
+	// IODevice overrides the MAJ:MIN block device that IO limits apply to
+	IODevice string
+	// CPUAffinity is the taskset-style CPU list ("0-3,6") commands are pinned
+	// to; calls may narrow it but not go outside it
+	CPUAffinity string
+	// Nice is the default scheduling niceness of spawned commands and shells,
+	// -20 to 19 (empty = the server's own); NiceMin and NiceMax bound the
+	// niceness calls may ask for
+	Nice    string
+	NiceMin int
+	NiceMax int
+	// IOClass is the default IO scheduling class, "realtime", "best-effort"
+	// or "idle" (empty = the server's own), with IOPriority the level within
+	// it from 0 (highest) to 7; IOClasses are the classes calls may ask for
+	IOClass    string
+	IOPriority int
+	IOClasses  []string
+
+	// MaxConcurrent caps commands executing at once across the server and
+	// MaxConcurrentPerSession caps those queued or running in one session (0 = unlimited)
+	MaxConcurrent           int
+	MaxConcurrentPerSession int
+	// HTTPRateLimit is the allowed HTTP requests per second per client (0 = unlimited)
+	// with bursts of up to HTTPRateBurst requests
+	HTTPRateLimit float64
+	HTTPRateBurst int
+	// HTTPCompress gzips HTTP responses of at least HTTPCompressMinBytes for
+	// clients that accept it
+	HTTPCompress         bool
+	HTTPCompressMinBytes int
+	// HTTPReadHeaderTimeout, HTTPReadTimeout and HTTPWriteTimeout bound reading
+	// a request's headers, reading the whole request and writing its response,
+	// and HTTPIdleTimeout how long a kept-alive connection waits for its next
+	// request (0 = unbounded). Event streams are exempt from the write timeout.
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	// HTTPMaxRequestDuration bounds how long the server works on one HTTP
+	// request, including the commands it runs (0 = unbounded); event streams
+	// are exempt
+	HTTPMaxRequestDuration time.Duration
+	// CORSAllowedOrigins lists origins browsers may call the HTTP endpoints from
+	// ("*" for any, empty = no cross-origin access)
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods and CORSAllowedHeaders are returned to preflight requests
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	// CORSAllowCredentials lets browsers send cookies and HTTP auth cross-origin
+	CORSAllowCredentials bool
+
+	// PathMappings translate between server-side and client-side paths
+	PathMappings []PathMapping
+	// ChownUID and ChownGID, when not -1, become the owner of files commands
+	// create under ChownPaths (defaulting to the server side of PathMappings)
+	ChownUID   int
+	ChownGID   int
+	ChownPaths []string
+
+	// SSEReplayEvents is how many recent events per session are kept for
+	// observers that reconnect with Last-Event-ID
+	SSEReplayEvents int
+	// SSEQueueSize is how many events of a session a stream client may fall
+	// behind, and SSELagPolicy what happens then: "drop-newest", "drop-oldest",
+	// "coalesce" or "disconnect"
+	SSEQueueSize int
+	SSELagPolicy string
+
+	// TranscriptMaxEntries and TranscriptMaxBytes bound the per-session command history
+	TranscriptMaxEntries int
+	TranscriptMaxBytes   int
+
+	// SessionIdleTimeout is how long a persistent session may go unused before
+	// it is closed (0 = never), checked every SessionCleanupInterval
+	SessionIdleTimeout     time.Duration
+	SessionCleanupInterval time.Duration
+	// MaxSessions and MaxSessionsPerClient cap the open persistent sessions in
+	// total and per MCP client (0 = unlimited)
+	MaxSessions          int
+	MaxSessionsPerClient int
+	// MaxPinnedSessions caps the sessions pinned to survive the idle timeout
+	// (0 = sessions cannot be pinned)
+	MaxPinnedSessions int
+	// SessionAutoRestart replaces the shell of a persistent session that
+	// exited, in the directory and environment it last had, instead of
+	// dropping the session
+	SessionAutoRestart bool
+	// SessionStateReport adds the environment variables a persistent
+	// session command changed to its result, next to its exit code and
+	// working directory
+	SessionStateReport bool
+	// SessionResyncRerun runs a persistent session command once more when its
+	// end marker was lost, as when it read the input the server typed after it
+	SessionResyncRerun bool
+	// ShellIntegration defines functions in the POSIX shells of persistent
+	// sessions that print the marks ending commands, framed by OSC 133
+	// sequences and carrying a nonce, so no command output can pass for them
+	ShellIntegration bool
+	// SessionBackend is where persistent sessions run their shells: "pipe"
+	// starts them as child processes, "tmux" in tmux sessions on the host,
+	// which users can attach to
+	SessionBackend string
+
+	// OutputRateLimit caps the output each persistent session passes on, in
+	// bytes per second (0 = unlimited). OutputRatePolicy is "pause", which
+	// stops reading so the command waits, or "drop", which discards the excess.
+	OutputRateLimit  int64
+	OutputRatePolicy string
+	// OutputTiming records when each line of a session command's output was
+	// printed, relative to the command's start: "off", "events" in output
+	// events only, or "transcript" in the stored transcript as well
+	OutputTiming string
+
+	// ResultFormat is how tool results are rendered unless a call asks for
+	// another: "plain" text, "markdown" with output in fenced code blocks, or
+	// "json"
+	ResultFormat string
+
+	// ResultVerbosity is how much surrounds command output in tool results
+	// unless a call asks for another: "minimal" (output and exit code only),
+	// "normal", or "debug" with the environment, wrapper and timing
+	ResultVerbosity string
+
+	// ToolSchemaVersion is the version of the tool schemas advertised to
+	// clients. Version 2 of execute_command takes its argument vector as
+	// "argv" and an "env" object; calls in the shape of version 1 still run,
+	// with a deprecation warning in the result.
+	ToolSchemaVersion int
+
+	// OutputEncoding is the character encoding of command output unless a
+	// call gives another: "auto" converts output that is not UTF-8 from the
+	// encoding it reads sensibly in, or a name such as "shift_jis" or "gbk"
+	OutputEncoding string
+
+	// WarmShells are started ahead of time and handed to new persistent
+	// sessions, so the first command does not wait for shell startup
+	WarmShells []WarmShell
+
+	// FileAllowedPaths restricts the file tools to these directory prefixes (empty = unrestricted)
+	FileAllowedPaths []string
+	// FileMaxReadBytes caps how much read_file returns in one call
+	FileMaxReadBytes int64
+	// FileMaxUploadBytes caps the size of HTTP uploads (0 = unlimited)
+	FileMaxUploadBytes int64
+
+	// BinaryOutputMaxBytes caps binary command output returned in a tool
+	// result; larger output is saved to ArtifactDir, where it is kept for
+	// ArtifactTTL
+	BinaryOutputMaxBytes int64
+	ArtifactDir          string
+	ArtifactTTL          time.Duration
+	// ArtifactMaxBytes caps each file a call keeps as an artifact (0 = unlimited)
+	ArtifactMaxBytes int64
+
+	// PolicyFile is a JSON file of command rules, roles and risk limits (empty = allow everything)
+	PolicyFile string
+	// ToolsFile is a JSON file of command templates exposed as tools of their
+	// own, such as deploy_staging (empty = none)
+	ToolsFile string
+	// ProfilesFile is a JSON file of named defaults (shell, directory,
+	// environment) MCP clients can select for their calls (empty = none)
+	ProfilesFile string
+	// PluginDir holds executables that provide tools of their own (empty = no plugins);
+	// a plugin call is killed after PluginTimeout
+	PluginDir     string
+	PluginTimeout time.Duration
+	// RequiredBackends are services the server's work depends on, such as
+	// "docker=unix:///var/run/docker.sock" or "registry=https://registry.local/v2/".
+	// They are checked from startup until reachable, and the server is not
+	// ready while one is not.
+	RequiredBackends []string
+	// TrapPaths are decoy files and directories that no legitimate task touches;
+	// any access raises an alert, sent to TrapWebhook when set. With TrapFreeze
+	// the access is refused and the session handed to an operator.
+	TrapPaths   []string
+	TrapFreeze  bool
+	TrapWebhook string
+	// WebhookURLs receive lifecycle events (commands finished, sessions
+	// created or expired, approvals requested), limited to WebhookEvents
+	// when set, signed with WebhookSecret when set, and retried up to
+	// WebhookRetries times
+	WebhookURLs    []string
+	WebhookEvents  []string
+	WebhookSecret  string
+	WebhookRetries int
+
+	// AuditFile is where hash-chained audit records are appended (empty = disabled)
+	AuditFile string
+	// ReceiptKeyFile is the Ed25519 private key (PKCS #8 PEM) that signs a
+	// receipt into the result of every command, created when missing (empty =
+	// no receipts)
+	ReceiptKeyFile string
+	// AdminToken authorises the admin endpoints as a bearer token (empty = admin endpoints disabled)
+	AdminToken string
+	// AuthHook authenticates every HTTP request: an http(s) URL the request's
+	// metadata is POSTed to, or a command that reads it on stdin (empty =
+	// disabled). Answers are awaited for up to AuthHookTimeout, and allowed
+	// requests are cached for AuthHookCacheTTL.
+	AuthHook         string
+	AuthHookTimeout  time.Duration
+	AuthHookCacheTTL time.Duration
+
+	// PolicyOPAURL is an OPA data API URL consulted for every command in addition
+	// to the policy file, with PolicyOPATimeout per query (empty = disabled)
+	PolicyOPAURL     string
+	PolicyOPATimeout time.Duration
+	// BreakerThreshold is how many failures in a row of a remote backend, the
+	// OPA server or an auth hook URL, make calls to it fail fast until a
+	// background probe reaches it again (0 = never)
+	BreakerThreshold int
+
+	// ReadOnly restricts commands to ReadOnlyCommands and refuses file writes and signals
+	ReadOnly bool
+	// ReadOnlyCommands are the programs, or program and subcommand such as
+	// "git status", that may run in read-only mode
+	ReadOnlyCommands []string
+
+	// Redact replaces secrets in tool results, session events, transcripts and
+	// logs, using built-in patterns plus one regular expression per line of
+	// RedactPatternsFile
+	Redact             bool
+	RedactPatternsFile string
+
+	// NetworkSummary samples the connections opened by each command's processes
+	// every NetworkSampleInterval and reports their destinations (Linux only)
+	NetworkSummary        bool
+	NetworkSampleInterval time.Duration
+
+	// DedupWindow is how soon after a state-changing command the same command,
+	// submitted again in the same session, needs confirming (0 = disabled)
+	DedupWindow time.Duration
+	// IdempotencyWindow is how long the result of a tool call made with an
+	// idempotency key is kept, to be returned again for a retry with the same
+	// key (0 = keys are ignored)
+	IdempotencyWindow time.Duration
+
+	// ShellHistory enables the shell_history tool, which shows agents the
+	// latest ShellHistoryMaxEntries commands of ShellHistoryFile (empty = the
+	// user's shell's history file) with secrets masked
+	ShellHistory           bool
+	ShellHistoryFile       string
+	ShellHistoryMaxEntries int
+
+	// ScratchpadMaxBytes bounds the keys and values of the scratchpad agents
+	// pass data through, in total (0 = no scratchpad tools), and
+	// ScratchpadMaxValueBytes each value. Entries expire after ScratchpadTTL
+	// unless set with a TTL of their own, which is at most ScratchpadMaxTTL.
+	ScratchpadMaxBytes      int
+	ScratchpadMaxValueBytes int
+	ScratchpadTTL           time.Duration
+	ScratchpadMaxTTL        time.Duration
 }
 
 // NewConfig creates a new configuration with defaults
 func NewConfig() *Config {
 	cfg := &Config{
-		DefaultTimeout: 30 * time.Second,
-		Platform:       runtime.GOOS,
-		HTTPMode:       false,
-		Port:           "8080",
-		Host:           "localhost",
-	}
+		DefaultTimeout:   30 * time.Second,
+		KillGracePeriod:  5 * time.Second,
+		PluginTimeout:    60 * time.Second,
+		Platform:         runtime.GOOS,
+		HTTPMode:         false,
+		Port:             "8080",
+		Host:             "localhost",
+		UnixSocketMode:   0600,
+		WorkspaceSandbox: "none",
+
+		ProgressInterval:      5 * time.Second,
+		WatchMaxDuration:      10 * time.Minute,
+		WaitForTimeout:        time.Minute,
+		WaitForMaxTimeout:     10 * time.Minute,
+		ScheduleMaxJobs:       100,
+		ScheduleMaxResults:    20,
+		CgroupRoot:            "/sys/fs/cgroup/mcp-terminal-server",
+		NiceMax:               19,
+		IOPriority:            4,
+		IOClasses:             []string{"best-effort", "idle"},
+		HTTPRateBurst:         20,
+		HTTPCompress:          true,
+		HTTPCompressMinBytes:  1024,
+		HTTPReadHeaderTimeout: 10 * time.Second,
+		HTTPIdleTimeout:       2 * time.Minute,
+		CORSAllowedMethods:    []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		CORSAllowedHeaders:    []string{"Content-Type", "Authorization", "Mcp-Session-Id", "Mcp-Protocol-Version", "Last-Event-ID"},
+		ChownUID:              -1,
+		ChownGID:              -1,
+
+		SSEReplayEvents:        1000,
+		SSEQueueSize:           256,
+		SSELagPolicy:           "drop-newest",
+		OutputRatePolicy:       "pause",
+		OutputTiming:           "off",
+		ResultFormat:           "plain",
+		ResultVerbosity:        "normal",
+		ToolSchemaVersion:      1,
+		OutputEncoding:         "auto",
+		SessionIdleTimeout:     30 * time.Minute,
+		SessionCleanupInterval: 5 * time.Minute,
+		SessionAutoRestart:     true,
+		SessionStateReport:     true,
+		SessionBackend:         "pipe",
+		MaxPinnedSessions:      5,
+		WebhookRetries:         5,
+		IdempotencyWindow:      10 * time.Minute,
+		TranscriptMaxEntries:   1000,
+		TranscriptMaxBytes:     1 << 20,
+		FileMaxReadBytes:       1 << 20,
+		FileMaxUploadBytes:     100 << 20,
+		BinaryOutputMaxBytes:   1 << 20,
+		ArtifactDir:            filepath.Join(os.TempDir(), "mcp-artifacts"),
+		ArtifactTTL:            time.Hour,
+		ArtifactMaxBytes:       100 << 20,
+		PolicyOPATimeout:       2 * time.Second,
+		BreakerThreshold:       5,
+		AuthHookTimeout:        5 * time.Second,
+		AuthHookCacheTTL:       30 * time.Second,
+		Redact:                 true,
+		ReadOnlyCommands: []string{
+			"ls", "cat", "head", "tail", "grep", "wc", "stat", "file", "tree", "pwd", "echo",
+			"du", "df", "ps", "whoami", "id", "uname", "which", "uptime",
+			"git status", "git log", "git diff", "git show",
+		},
+
+		NetworkSampleInterval:  100 * time.Millisecond,
+		ShellHistoryMaxEntries: 50,
 
-	switch cfg.Platform {
-	case "darwin", "linux":
-		cfg.Shell = "/bin/bash"
-	default:
-		cfg.Shell = "/bin/sh"
+		ScratchpadMaxBytes:      4 << 20,
+		ScratchpadMaxValueBytes: 64 << 10,
+		ScratchpadTTL:           time.Hour,
+		ScratchpadMaxTTL:        24 * time.Hour,
 	}
 
+	// bash cannot be assumed, as in Alpine containers
+	cfg.Shell = shells.Detect()
+
 	return cfg
 }
 
+// flagSettings are the settings given on the command line, which take
+// precedence over the environment
+type flagSettings struct {
+	stdio     bool
+	socket    string
+	workspace string
+	logLevel  string
+	logFormat string
+	readOnly  bool
+}
+
 // ParseFlags parses command line flags and environment variables
 func (c *Config) ParseFlags() {
 	var (
-		httpMode = flag.Bool("http", false, "Enable HTTP mode (StreamableHTTP transport)")
-		port     = flag.String("port", "8080", "Port for HTTP server")
-		host     = flag.String("host", "localhost", "Host for HTTP server")
-		help    = flag.Bool("help", false, "Show help")
+		httpMode  = flag.Bool("http", false, "Enable HTTP mode (StreamableHTTP transport)")
+		port      = flag.String("port", "8080", "Port for HTTP server")
+		host      = flag.String("host", "localhost", "Host for HTTP server")
+		socket    = flag.String("unix-socket", "", "Serve HTTP on this Unix domain socket instead of a TCP port")
+		workspace = flag.String("workspace", "", "Directory sessions start in and relative paths are resolved against")
+		logLevel  = flag.String("log-level", "", "Log level: debug, info, warn or error (default info)")
+		logFormat = flag.String("log-format", "", "Log format: text or json (default text)")
+		readOnly  = flag.Bool("read-only", false, "Only allow the read-only command list and refuse file writes")
+		stdio     = flag.Bool("stdio", false, "With --http, also serve MCP over stdio")
+		help      = flag.Bool("help", false, "Show help")
 	)
 	flag.Parse()
 
@@ -57,6 +459,70 @@ func (c *Config) ParseFlags() {
 	c.HTTPMode = *httpMode
 	c.Port = *port
 	c.Host = *host
+	c.parseEnv(flagSettings{
+		stdio:     *stdio,
+		socket:    *socket,
+		workspace: *workspace,
+		logLevel:  *logLevel,
+		logFormat: *logFormat,
+		readOnly:  *readOnly,
+	})
+}
+
+// ParseEnv reads the MCP_* environment variables without touching the
+// command line, for programs that embed the tools and have flags of their own
+func (c *Config) ParseEnv() {
+	c.parseEnv(flagSettings{})
+}
+
+// parseEnv reads the environment variables, with the settings given on the
+// command line taking precedence
+func (c *Config) parseEnv(f flagSettings) {
+	c.UnixSocket = os.Getenv("MCP_UNIX_SOCKET")
+	if f.socket != "" {
+		c.UnixSocket = f.socket
+	}
+	if c.UnixSocket != "" {
+		c.HTTPMode = true
+	}
+	c.GRPCAddr = os.Getenv("MCP_GRPC_ADDR")
+	c.StdioMode = f.stdio
+	if stdioStr := os.Getenv("MCP_STDIO"); stdioStr != "" && !f.stdio {
+		if stdio, err := strconv.ParseBool(stdioStr); err == nil {
+			c.StdioMode = stdio
+		}
+	}
+	c.Workspace = os.Getenv("MCP_WORKSPACE")
+	if f.workspace != "" {
+		c.Workspace = f.workspace
+	}
+	if c.Workspace != "" {
+		if abs, err := filepath.Abs(c.Workspace); err == nil {
+			c.Workspace = abs
+		}
+	}
+	if sandbox := os.Getenv("MCP_WORKSPACE_SANDBOX"); sandbox == "none" || sandbox == "mount" || sandbox == "chroot" {
+		c.WorkspaceSandbox = sandbox
+	}
+	if modeStr := os.Getenv("MCP_UNIX_SOCKET_MODE"); modeStr != "" {
+		if mode, err := strconv.ParseUint(modeStr, 8, 32); err == nil && mode <= 0777 {
+			c.UnixSocketMode = os.FileMode(mode)
+		}
+	}
+	c.ReadOnly = f.readOnly
+
+	// Logging is set up first so problems with the remaining settings are reported in the chosen format
+	c.LogLevel = os.Getenv("MCP_LOG_LEVEL")
+	if f.logLevel != "" {
+		c.LogLevel = f.logLevel
+	}
+	c.LogFormat = os.Getenv("MCP_LOG_FORMAT")
+	if f.logFormat != "" {
+		c.LogFormat = f.logFormat
+	}
+	if err := logging.Setup(c.LogLevel, c.LogFormat); err != nil {
+		logging.For("config").Warn("Ignoring logging settings", "error", err)
+	}
 
 	// Check for timeout environment variable
 	if timeoutStr := os.Getenv("MCP_COMMAND_TIMEOUT"); timeoutStr != "" {
@@ -64,6 +530,503 @@ func (c *Config) ParseFlags() {
 			c.DefaultTimeout = time.Duration(timeout) * time.Second
 		}
 	}
+	if tenant := os.Getenv("MCP_TENANT"); tenant != "" {
+		c.Tenant = tenant
+	}
+	if graceStr := os.Getenv("MCP_KILL_GRACE_SECONDS"); graceStr != "" {
+		if grace, err := strconv.Atoi(graceStr); err == nil && grace >= 0 {
+			c.KillGracePeriod = time.Duration(grace) * time.Second
+		}
+	}
+
+	// Check for progress notification interval environment variable
+	if intervalStr := os.Getenv("MCP_PROGRESS_INTERVAL"); intervalStr != "" {
+		if interval, err := strconv.Atoi(intervalStr); err == nil && interval >= 0 {
+			c.ProgressInterval = time.Duration(interval) * time.Second
+		}
+	}
+	if maxStr := os.Getenv("MCP_WATCH_MAX_SECONDS"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
+			c.WatchMaxDuration = time.Duration(max) * time.Second
+		}
+	}
+	if waitStr := os.Getenv("MCP_WAIT_FOR_TIMEOUT"); waitStr != "" {
+		if wait, err := strconv.Atoi(waitStr); err == nil && wait > 0 {
+			c.WaitForTimeout = time.Duration(wait) * time.Second
+		}
+	}
+	if maxStr := os.Getenv("MCP_WAIT_FOR_MAX_SECONDS"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
+			c.WaitForMaxTimeout = time.Duration(max) * time.Second
+		}
+	}
+
+	// Check for scheduler environment variables
+	if maxStr := os.Getenv("MCP_SCHEDULE_MAX_JOBS"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
+			c.ScheduleMaxJobs = max
+		}
+	}
+	if maxStr := os.Getenv("MCP_SCHEDULE_MAX_RESULTS"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
+			c.ScheduleMaxResults = max
+		}
+	}
+
+	// Check for IO throttling environment variables
+	if bpsStr := os.Getenv("MCP_IO_READ_BPS"); bpsStr != "" {
+		if bps, err := strconv.ParseInt(bpsStr, 10, 64); err == nil && bps >= 0 {
+			c.IOReadBPS = bps
+		}
+	}
+	if bpsStr := os.Getenv("MCP_IO_WRITE_BPS"); bpsStr != "" {
+		if bps, err := strconv.ParseInt(bpsStr, 10, 64); err == nil && bps >= 0 {
+			c.IOWriteBPS = bps
+		}
+	}
+	if cgroupRoot := os.Getenv("MCP_CGROUP_ROOT"); cgroupRoot != "" {
+		c.CgroupRoot = cgroupRoot
+	}
+	if device := os.Getenv("MCP_IO_DEVICE"); device != "" {
+		c.IODevice = device
+	}
+
+	// Check for CPU affinity environment variable
+	if cpus := os.Getenv("MCP_CPU_AFFINITY"); cpus != "" {
+		c.CPUAffinity = cpus
+	}
+
+	// Check for scheduling priority environment variables
+	if nice := os.Getenv("MCP_NICE"); nice != "" {
+		c.Nice = nice
+	}
+	if niceStr := os.Getenv("MCP_NICE_MIN"); niceStr != "" {
+		if nice, err := strconv.Atoi(niceStr); err == nil && nice >= -20 && nice <= 19 {
+			c.NiceMin = nice
+		}
+	}
+	if niceStr := os.Getenv("MCP_NICE_MAX"); niceStr != "" {
+		if nice, err := strconv.Atoi(niceStr); err == nil && nice >= -20 && nice <= 19 {
+			c.NiceMax = nice
+		}
+	}
+	if class := os.Getenv("MCP_IO_CLASS"); class != "" {
+		c.IOClass = class
+	}
+	if prioStr := os.Getenv("MCP_IO_PRIORITY"); prioStr != "" {
+		if prio, err := strconv.Atoi(prioStr); err == nil && prio >= 0 && prio <= 7 {
+			c.IOPriority = prio
+		}
+	}
+	if classes := os.Getenv("MCP_IO_CLASSES"); classes != "" {
+		c.IOClasses = splitList(classes)
+	}
+
+	// Check for concurrency and rate limit environment variables
+	if maxStr := os.Getenv("MCP_MAX_CONCURRENT"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.MaxConcurrent = max
+		}
+	}
+	if maxStr := os.Getenv("MCP_MAX_CONCURRENT_PER_SESSION"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.MaxConcurrentPerSession = max
+		}
+	}
+	if rateStr := os.Getenv("MCP_HTTP_RATE_LIMIT"); rateStr != "" {
+		if rate, err := strconv.ParseFloat(rateStr, 64); err == nil && rate >= 0 {
+			c.HTTPRateLimit = rate
+		}
+	}
+	if burstStr := os.Getenv("MCP_HTTP_RATE_BURST"); burstStr != "" {
+		if burst, err := strconv.Atoi(burstStr); err == nil && burst > 0 {
+			c.HTTPRateBurst = burst
+		}
+	}
+	if compressStr := os.Getenv("MCP_HTTP_COMPRESS"); compressStr != "" {
+		if compress, err := strconv.ParseBool(compressStr); err == nil {
+			c.HTTPCompress = compress
+		}
+	}
+	if minStr := os.Getenv("MCP_HTTP_COMPRESS_MIN_BYTES"); minStr != "" {
+		if min, err := strconv.Atoi(minStr); err == nil && min >= 0 {
+			c.HTTPCompressMinBytes = min
+		}
+	}
+	// HTTP timeouts are in seconds; 0 removes the bound
+	if timeoutStr := os.Getenv("MCP_HTTP_READ_HEADER_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout >= 0 {
+			c.HTTPReadHeaderTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if timeoutStr := os.Getenv("MCP_HTTP_READ_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout >= 0 {
+			c.HTTPReadTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if timeoutStr := os.Getenv("MCP_HTTP_WRITE_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout >= 0 {
+			c.HTTPWriteTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if timeoutStr := os.Getenv("MCP_HTTP_IDLE_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout >= 0 {
+			c.HTTPIdleTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if durationStr := os.Getenv("MCP_HTTP_MAX_REQUEST_DURATION"); durationStr != "" {
+		if duration, err := strconv.Atoi(durationStr); err == nil && duration >= 0 {
+			c.HTTPMaxRequestDuration = time.Duration(duration) * time.Second
+		}
+	}
+
+	// Check for CORS environment variables; lists are comma-separated
+	if origins := os.Getenv("MCP_CORS_ORIGINS"); origins != "" {
+		c.CORSAllowedOrigins = splitList(origins)
+	}
+	if methods := os.Getenv("MCP_CORS_METHODS"); methods != "" {
+		c.CORSAllowedMethods = splitList(methods)
+	}
+	if headers := os.Getenv("MCP_CORS_HEADERS"); headers != "" {
+		c.CORSAllowedHeaders = splitList(headers)
+	}
+	if credStr := os.Getenv("MCP_CORS_CREDENTIALS"); credStr != "" {
+		if cred, err := strconv.ParseBool(credStr); err == nil {
+			c.CORSAllowCredentials = cred
+		}
+	}
+
+	// Check for path mapping environment variable, e.g. "/workspace=/home/user/project,/data=/srv/data"
+	if pathMap := os.Getenv("MCP_PATH_MAP"); pathMap != "" {
+		c.PathMappings = parsePathMappings(pathMap)
+	}
+
+	// Check for ownership mapping environment variables
+	if uidStr := os.Getenv("MCP_CHOWN_UID"); uidStr != "" {
+		if uid, err := strconv.Atoi(uidStr); err == nil && uid >= 0 {
+			c.ChownUID = uid
+		}
+	}
+	if gidStr := os.Getenv("MCP_CHOWN_GID"); gidStr != "" {
+		if gid, err := strconv.Atoi(gidStr); err == nil && gid >= 0 {
+			c.ChownGID = gid
+		}
+	}
+	if chownPaths := os.Getenv("MCP_CHOWN_PATHS"); chownPaths != "" {
+		c.ChownPaths = filepath.SplitList(chownPaths)
+	}
+
+	if replayStr := os.Getenv("MCP_SSE_REPLAY_EVENTS"); replayStr != "" {
+		if replay, err := strconv.Atoi(replayStr); err == nil && replay >= 0 {
+			c.SSEReplayEvents = replay
+		}
+	}
+	if queueStr := os.Getenv("MCP_SSE_QUEUE_SIZE"); queueStr != "" {
+		if queue, err := strconv.Atoi(queueStr); err == nil && queue > 0 {
+			c.SSEQueueSize = queue
+		}
+	}
+	if policy := os.Getenv("MCP_SSE_LAG_POLICY"); policy != "" {
+		if _, err := sse.ParsePolicy(policy); err == nil {
+			c.SSELagPolicy = policy
+		}
+	}
+
+	// Check for transcript bound environment variables
+	if maxStr := os.Getenv("MCP_TRANSCRIPT_MAX_ENTRIES"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.TranscriptMaxEntries = max
+		}
+	}
+	if maxStr := os.Getenv("MCP_TRANSCRIPT_MAX_BYTES"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.TranscriptMaxBytes = max
+		}
+	}
+	if warm := os.Getenv("MCP_WARM_SHELLS"); warm != "" {
+		c.WarmShells = parseWarmShells(warm)
+	}
+
+	// Check for output rate limit environment variables
+	if rateStr := os.Getenv("MCP_OUTPUT_RATE_LIMIT"); rateStr != "" {
+		if rate, err := strconv.ParseInt(rateStr, 10, 64); err == nil && rate >= 0 {
+			c.OutputRateLimit = rate
+		}
+	}
+	if policy := os.Getenv("MCP_OUTPUT_RATE_POLICY"); policy == "pause" || policy == "drop" {
+		c.OutputRatePolicy = policy
+	}
+	if timing := os.Getenv("MCP_OUTPUT_TIMING"); timing == "off" || timing == "events" || timing == "transcript" {
+		c.OutputTiming = timing
+	}
+
+	// Check for result format environment variable
+	if format := os.Getenv("MCP_RESULT_FORMAT"); format == "plain" || format == "markdown" || format == "json" {
+		c.ResultFormat = format
+	}
+	if verbosity := os.Getenv("MCP_RESULT_VERBOSITY"); verbosity == "minimal" || verbosity == "normal" || verbosity == "debug" {
+		c.ResultVerbosity = verbosity
+	}
+	if versionStr := os.Getenv("MCP_TOOL_SCHEMA_VERSION"); versionStr != "" {
+		if version, err := strconv.Atoi(versionStr); err == nil && version >= 1 && version <= 2 {
+			c.ToolSchemaVersion = version
+		}
+	}
+	if encoding := os.Getenv("MCP_OUTPUT_ENCODING"); encoding != "" && charset.Validate(encoding) == nil {
+		c.OutputEncoding = encoding
+	}
+
+	// Check for session lifecycle environment variables
+	if idleStr := os.Getenv("MCP_SESSION_IDLE_TIMEOUT"); idleStr != "" {
+		if idle, err := strconv.Atoi(idleStr); err == nil && idle >= 0 {
+			c.SessionIdleTimeout = time.Duration(idle) * time.Second
+		}
+	}
+	if intervalStr := os.Getenv("MCP_SESSION_CLEANUP_INTERVAL"); intervalStr != "" {
+		if interval, err := strconv.Atoi(intervalStr); err == nil && interval > 0 {
+			c.SessionCleanupInterval = time.Duration(interval) * time.Second
+		}
+	}
+	if maxStr := os.Getenv("MCP_MAX_SESSIONS"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.MaxSessions = max
+		}
+	}
+	if maxStr := os.Getenv("MCP_MAX_SESSIONS_PER_CLIENT"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.MaxSessionsPerClient = max
+		}
+	}
+	if maxStr := os.Getenv("MCP_MAX_PINNED_SESSIONS"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.MaxPinnedSessions = max
+		}
+	}
+	if restartStr := os.Getenv("MCP_SESSION_AUTO_RESTART"); restartStr != "" {
+		if restart, err := strconv.ParseBool(restartStr); err == nil {
+			c.SessionAutoRestart = restart
+		}
+	}
+	if reportStr := os.Getenv("MCP_SESSION_STATE_REPORT"); reportStr != "" {
+		if report, err := strconv.ParseBool(reportStr); err == nil {
+			c.SessionStateReport = report
+		}
+	}
+	if rerunStr := os.Getenv("MCP_SESSION_RESYNC_RERUN"); rerunStr != "" {
+		if rerun, err := strconv.ParseBool(rerunStr); err == nil {
+			c.SessionResyncRerun = rerun
+		}
+	}
+	if backend := os.Getenv("MCP_SESSION_BACKEND"); backend == "pipe" || backend == "tmux" {
+		c.SessionBackend = backend
+	}
+	if integrationStr := os.Getenv("MCP_SHELL_INTEGRATION"); integrationStr != "" {
+		if integration, err := strconv.ParseBool(integrationStr); err == nil {
+			c.ShellIntegration = integration
+		}
+	}
+
+	// Check for file tool environment variables
+	if allowed := os.Getenv("MCP_FILE_ALLOWED_PATHS"); allowed != "" {
+		c.FileAllowedPaths = filepath.SplitList(allowed)
+	}
+	if maxStr := os.Getenv("MCP_FILE_MAX_READ_BYTES"); maxStr != "" {
+		if max, err := strconv.ParseInt(maxStr, 10, 64); err == nil && max > 0 {
+			c.FileMaxReadBytes = max
+		}
+	}
+
+	if maxStr := os.Getenv("MCP_FILE_MAX_UPLOAD_BYTES"); maxStr != "" {
+		if max, err := strconv.ParseInt(maxStr, 10, 64); err == nil && max >= 0 {
+			c.FileMaxUploadBytes = max
+		}
+	}
+
+	// Check for binary output environment variables
+	if maxStr := os.Getenv("MCP_BINARY_OUTPUT_MAX_BYTES"); maxStr != "" {
+		if max, err := strconv.ParseInt(maxStr, 10, 64); err == nil && max >= 0 {
+			c.BinaryOutputMaxBytes = max
+		}
+	}
+	if dir := os.Getenv("MCP_ARTIFACT_DIR"); dir != "" {
+		c.ArtifactDir = dir
+	}
+	if ttlStr := os.Getenv("MCP_ARTIFACT_TTL"); ttlStr != "" {
+		if ttl, err := strconv.Atoi(ttlStr); err == nil && ttl > 0 {
+			c.ArtifactTTL = time.Duration(ttl) * time.Second
+		}
+	}
+	if maxStr := os.Getenv("MCP_ARTIFACT_MAX_BYTES"); maxStr != "" {
+		if max, err := strconv.ParseInt(maxStr, 10, 64); err == nil && max >= 0 {
+			c.ArtifactMaxBytes = max
+		}
+	}
+
+	if policyFile := os.Getenv("MCP_POLICY_FILE"); policyFile != "" {
+		c.PolicyFile = policyFile
+	}
+	if toolsFile := os.Getenv("MCP_TOOLS_FILE"); toolsFile != "" {
+		c.ToolsFile = toolsFile
+	}
+	if profilesFile := os.Getenv("MCP_PROFILES_FILE"); profilesFile != "" {
+		c.ProfilesFile = profilesFile
+	}
+	if pluginDir := os.Getenv("MCP_PLUGIN_DIR"); pluginDir != "" {
+		c.PluginDir = pluginDir
+	}
+	if timeoutStr := os.Getenv("MCP_PLUGIN_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout > 0 {
+			c.PluginTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if backends := os.Getenv("MCP_REQUIRED_BACKENDS"); backends != "" {
+		c.RequiredBackends = splitList(backends)
+	}
+	// Check for audit and admin environment variables
+	if auditFile := os.Getenv("MCP_AUDIT_FILE"); auditFile != "" {
+		c.AuditFile = auditFile
+	}
+	if keyFile := os.Getenv("MCP_RECEIPT_KEY_FILE"); keyFile != "" {
+		c.ReceiptKeyFile = keyFile
+	}
+	if adminToken := os.Getenv("MCP_ADMIN_TOKEN"); adminToken != "" {
+		c.AdminToken = adminToken
+	}
+	c.AuthHook = os.Getenv("MCP_AUTH_HOOK")
+	if timeoutStr := os.Getenv("MCP_AUTH_HOOK_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout > 0 {
+			c.AuthHookTimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if ttlStr := os.Getenv("MCP_AUTH_HOOK_CACHE_SECONDS"); ttlStr != "" {
+		if ttl, err := strconv.Atoi(ttlStr); err == nil && ttl >= 0 {
+			c.AuthHookCacheTTL = time.Duration(ttl) * time.Second
+		}
+	}
+
+	// Check for trap path environment variables
+	if trapPaths := os.Getenv("MCP_TRAP_PATHS"); trapPaths != "" {
+		c.TrapPaths = filepath.SplitList(trapPaths)
+	}
+	if freezeStr := os.Getenv("MCP_TRAP_FREEZE"); freezeStr != "" {
+		if freeze, err := strconv.ParseBool(freezeStr); err == nil {
+			c.TrapFreeze = freeze
+		}
+	}
+	if webhook := os.Getenv("MCP_TRAP_WEBHOOK"); webhook != "" {
+		c.TrapWebhook = webhook
+	}
+
+	// Check for lifecycle webhook environment variables
+	if urls := os.Getenv("MCP_WEBHOOK_URLS"); urls != "" {
+		c.WebhookURLs = splitList(urls)
+	}
+	if webhookEvents := os.Getenv("MCP_WEBHOOK_EVENTS"); webhookEvents != "" {
+		c.WebhookEvents = splitList(webhookEvents)
+	}
+	if secret := os.Getenv("MCP_WEBHOOK_SECRET"); secret != "" {
+		c.WebhookSecret = secret
+	}
+	if retriesStr := os.Getenv("MCP_WEBHOOK_RETRIES"); retriesStr != "" {
+		if retries, err := strconv.Atoi(retriesStr); err == nil && retries >= 0 {
+			c.WebhookRetries = retries
+		}
+	}
+
+	// Check for redaction environment variables
+	if redactStr := os.Getenv("MCP_REDACT"); redactStr != "" {
+		if redact, err := strconv.ParseBool(redactStr); err == nil {
+			c.Redact = redact
+		}
+	}
+	if patternsFile := os.Getenv("MCP_REDACT_PATTERNS_FILE"); patternsFile != "" {
+		c.RedactPatternsFile = patternsFile
+	}
+
+	// Check for network summary environment variables
+	if summaryStr := os.Getenv("MCP_NETWORK_SUMMARY"); summaryStr != "" {
+		if summary, err := strconv.ParseBool(summaryStr); err == nil {
+			c.NetworkSummary = summary
+		}
+	}
+	if intervalStr := os.Getenv("MCP_NETWORK_SAMPLE_MS"); intervalStr != "" {
+		if interval, err := strconv.Atoi(intervalStr); err == nil && interval > 0 {
+			c.NetworkSampleInterval = time.Duration(interval) * time.Millisecond
+		}
+	}
+
+	// Check for the duplicate command guard environment variable
+	if windowStr := os.Getenv("MCP_DEDUP_WINDOW_SECONDS"); windowStr != "" {
+		if window, err := strconv.Atoi(windowStr); err == nil && window >= 0 {
+			c.DedupWindow = time.Duration(window) * time.Second
+		}
+	}
+	if windowStr := os.Getenv("MCP_IDEMPOTENCY_WINDOW_SECONDS"); windowStr != "" {
+		if window, err := strconv.Atoi(windowStr); err == nil && window >= 0 {
+			c.IdempotencyWindow = time.Duration(window) * time.Second
+		}
+	}
+
+	// Check for shell history environment variables
+	if historyStr := os.Getenv("MCP_SHELL_HISTORY"); historyStr != "" {
+		if history, err := strconv.ParseBool(historyStr); err == nil {
+			c.ShellHistory = history
+		}
+	}
+	if historyFile := os.Getenv("MCP_SHELL_HISTORY_FILE"); historyFile != "" {
+		c.ShellHistoryFile = historyFile
+	}
+	if maxStr := os.Getenv("MCP_SHELL_HISTORY_MAX_ENTRIES"); maxStr != "" {
+		if maxEntries, err := strconv.Atoi(maxStr); err == nil && maxEntries > 0 {
+			c.ShellHistoryMaxEntries = maxEntries
+		}
+	}
+
+	// Check for scratchpad environment variables
+	if maxStr := os.Getenv("MCP_SCRATCHPAD_MAX_BYTES"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max >= 0 {
+			c.ScratchpadMaxBytes = max
+		}
+	}
+	if maxStr := os.Getenv("MCP_SCRATCHPAD_MAX_VALUE_BYTES"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
+			c.ScratchpadMaxValueBytes = max
+		}
+	}
+	if ttlStr := os.Getenv("MCP_SCRATCHPAD_TTL"); ttlStr != "" {
+		if ttl, err := strconv.Atoi(ttlStr); err == nil && ttl > 0 {
+			c.ScratchpadTTL = time.Duration(ttl) * time.Second
+		}
+	}
+	if ttlStr := os.Getenv("MCP_SCRATCHPAD_MAX_TTL"); ttlStr != "" {
+		if ttl, err := strconv.Atoi(ttlStr); err == nil && ttl > 0 {
+			c.ScratchpadMaxTTL = time.Duration(ttl) * time.Second
+		}
+	}
+
+	// Check for read-only mode environment variables; the flag takes precedence
+	if readOnlyStr := os.Getenv("MCP_READ_ONLY"); readOnlyStr != "" && !f.readOnly {
+		if readOnly, err := strconv.ParseBool(readOnlyStr); err == nil {
+			c.ReadOnly = readOnly
+		}
+	}
+	if commands := os.Getenv("MCP_READ_ONLY_COMMANDS"); commands != "" {
+		c.ReadOnlyCommands = splitList(commands)
+	}
+
+	if opaURL := os.Getenv("MCP_POLICY_OPA_URL"); opaURL != "" {
+		c.PolicyOPAURL = opaURL
+	}
+	if timeoutStr := os.Getenv("MCP_POLICY_OPA_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout > 0 {
+			c.PolicyOPATimeout = time.Duration(timeout) * time.Second
+		}
+	}
+	if thresholdStr := os.Getenv("MCP_BREAKER_THRESHOLD"); thresholdStr != "" {
+		if threshold, err := strconv.Atoi(thresholdStr); err == nil && threshold >= 0 {
+			c.BreakerThreshold = threshold
+		}
+	}
 
 	// Check for custom shell environment variable
 	if shell := os.Getenv("MCP_SHELL"); shell != "" {
@@ -74,4 +1037,47 @@ func (c *Config) ParseFlags() {
 	if display := os.Getenv("DISPLAY"); display != "" {
 		c.Display = display
 	}
-}
\ No newline at end of file
+}
+
+// parsePathMappings parses "server=client" pairs separated by commas, skipping malformed entries
+func parsePathMappings(spec string) []PathMapping {
+	var mappings []PathMapping
+	for _, entry := range strings.Split(spec, ",") {
+		server, client, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !filepath.IsAbs(server) || !filepath.IsAbs(client) {
+			logging.For("config").Warn("Ignoring invalid path mapping", "entry", entry)
+			continue
+		}
+		mappings = append(mappings, PathMapping{
+			Server: filepath.Clean(server),
+			Client: filepath.Clean(client),
+		})
+	}
+	return mappings
+}
+
+// parseWarmShells parses "shell=count" pairs separated by commas, skipping malformed entries
+func parseWarmShells(spec string) []WarmShell {
+	var shells []WarmShell
+	for _, entry := range strings.Split(spec, ",") {
+		shell, countStr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		count, err := strconv.Atoi(countStr)
+		if !ok || shell == "" || err != nil || count <= 0 {
+			logging.For("config").Warn("Ignoring invalid warm shell", "entry", entry)
+			continue
+		}
+		shells = append(shells, WarmShell{Shell: shell, Count: count})
+	}
+	return shells
+}
+
+// splitList splits a comma-separated list, dropping blank entries
+func splitList(spec string) []string {
+	var items []string
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
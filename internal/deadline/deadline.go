@@ -0,0 +1,28 @@
+package deadline
+
+import (
+	"context"
+	"time"
+)
+
+// budgetKey carries the time by which the work on a request should be done
+type budgetKey struct{}
+
+// With bounds the work on a request to budget. Commands started for it are
+// given timeouts that end within the budget, while ctx itself is cancelled
+// only grace later, leaving time to stop them and answer with their partial
+// output.
+func With(ctx context.Context, budget, grace time.Duration) (context.Context, context.CancelFunc) {
+	ends := time.Now().Add(budget)
+	ctx = context.WithValue(ctx, budgetKey{}, ends)
+	return context.WithDeadline(ctx, ends.Add(grace))
+}
+
+// Timeout shortens a command's timeout to the budget of the request ctx
+// belongs to, if it has one
+func Timeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if ends, ok := ctx.Value(budgetKey{}).(time.Time); ok {
+		return max(min(timeout, time.Until(ends).Round(time.Millisecond)), 0)
+	}
+	return timeout
+}
@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/logging"
+)
+
+// maxEntries bounds the commands remembered; the oldest are forgotten first
+const maxEntries = 10000
+
+// Guard catches the same state-changing command being submitted twice in
+// quick succession, as an agent retrying a call it believes failed does. The
+// repeat is refused unless confirmed, so a migration or resource creation is
+// not applied twice by accident.
+type Guard struct {
+	window time.Duration
+	log    *slog.Logger
+
+	mu sync.Mutex
+	// last maps a scope and command to when the command was last let through
+	last map[string]time.Time
+}
+
+// New creates the guard, or returns nil when it is disabled
+func New(cfg *config.Config) *Guard {
+	if cfg.DedupWindow <= 0 {
+		return nil
+	}
+	return &Guard{
+		window: cfg.DedupWindow,
+		log:    logging.For("dedup"),
+		last:   make(map[string]time.Time),
+	}
+}
+
+// Check records command as submitted in scope, such as a session. When the
+// same command was let through in that scope within the window and the call
+// is not confirmed, it is refused instead and Check returns how long ago the
+// earlier submission was.
+func (g *Guard) Check(scope, command string, confirmed bool) (time.Duration, bool) {
+	if g == nil {
+		return 0, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.prune(now)
+
+	key := scope + "\x00" + strings.TrimSpace(command)
+	if at, ok := g.last[key]; ok && !confirmed {
+		ago := now.Sub(at)
+		g.log.Info("Refused repeated command", "scope", scope, logging.Command(command), "previous_ago", ago.Round(time.Millisecond))
+		return ago, true
+	}
+
+	g.last[key] = now
+	return 0, false
+}
+
+// prune forgets commands that have left the window, and the oldest ones when
+// too many are remembered
+func (g *Guard) prune(now time.Time) {
+	for key, at := range g.last {
+		if now.Sub(at) >= g.window {
+			delete(g.last, key)
+		}
+	}
+
+	for len(g.last) >= maxEntries {
+		var oldest string
+		var oldestAt time.Time
+		for key, at := range g.last {
+			if oldest == "" || at.Before(oldestAt) {
+				oldest, oldestAt = key, at
+			}
+		}
+		delete(g.last, oldest)
+	}
+}
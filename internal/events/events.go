@@ -0,0 +1,218 @@
+package events
+
+import "time"
+
+// Version is the schema version carried by every payload. It changes only
+// when a field is removed or changes meaning; fields may be added within a
+// version, so consumers should ignore fields they do not know.
+const Version = 1
+
+// Event types, as sent in the SSE "event:" field
+const (
+	TypeCommand    = "command"
+	TypeOutput     = "output"
+	TypeExit       = "exit"
+	TypeAnnotation = "annotation"
+	TypeControl    = "control"
+	TypeAlert      = "alert"
+	TypeExpired    = "session_expired"
+	TypeRestarted  = "shell_restarted"
+	TypeClosed     = "closed"
+	TypeReset      = "reset"
+	TypeLagged     = "lagged"
+	// TypeScheduledRun is delivered on the scheduler's stream, not a session's
+	TypeScheduledRun = "scheduled_run"
+	// TypeTrap is delivered to the trap webhook rather than over SSE
+	TypeTrap = "trap"
+	// These are delivered to the lifecycle webhooks rather than over SSE
+	TypeCommandCompleted  = "command_completed"
+	TypeCommandFailed     = "command_failed"
+	TypeSessionCreated    = "session_created"
+	TypeApprovalRequested = "approval_requested"
+)
+
+// Command is published when a command is sent to a session
+type Command struct {
+	Version int       `json:"version" description:"Schema version of the payload"`
+	Command string    `json:"command" description:"The command line as typed"`
+	By      string    `json:"by" description:"Who ran it: agent or operator"`
+	Started time.Time `json:"started" description:"When the command was sent to the shell"`
+}
+
+// Output is published for each line a command prints
+type Output struct {
+	Version  int    `json:"version" description:"Schema version of the payload"`
+	Line     string `json:"line" description:"One line of output, without the newline"`
+	OffsetMS *int64 `json:"offset_ms,omitempty" description:"Milliseconds from the command's start to the line, when output timing is enabled"`
+}
+
+// Exit is published when a command finishes or times out
+type Exit struct {
+	Version    int    `json:"version" description:"Schema version of the payload"`
+	Seq        int    `json:"seq" description:"Sequence number of the command in the session's history"`
+	Command    string `json:"command" description:"The command line"`
+	ExitCode   int    `json:"exit_code" description:"Exit status, or -1 when unknown"`
+	TimedOut   bool   `json:"timed_out" description:"Whether the command was still running when its timeout expired"`
+	DurationMS int64  `json:"duration_ms" description:"Run time in milliseconds"`
+}
+
+// Annotation is published when a note is attached to a session's history
+type Annotation struct {
+	Version int       `json:"version" description:"Schema version of the payload"`
+	After   int       `json:"after" description:"Sequence number of the command the note follows"`
+	Author  string    `json:"author" description:"Who wrote the note"`
+	Text    string    `json:"text" description:"The note"`
+	Time    time.Time `json:"time" description:"When the note was added"`
+}
+
+// Control is published when control of a session changes hands or is requested
+type Control struct {
+	Version    int    `json:"version" description:"Schema version of the payload"`
+	Action     string `json:"action" description:"What happened: requested, granted, taken or frozen"`
+	By         string `json:"by" description:"Who acted: agent or operator"`
+	Controller string `json:"controller" description:"Who holds control now"`
+	Requested  string `json:"requested" description:"Who is waiting for control, if anyone"`
+	Frozen     string `json:"frozen" description:"Why the session is frozen, if it is"`
+}
+
+// Alert is published when a command in the session touches a trap path
+type Alert struct {
+	Version int    `json:"version" description:"Schema version of the payload"`
+	Path    string `json:"path" description:"The trap path that was accessed"`
+	Command string `json:"command" description:"The command that accessed it"`
+}
+
+// Expired is published when a session is closed for having been idle too long,
+// just before its closed event
+type Expired struct {
+	Version     int       `json:"version" description:"Schema version of the payload"`
+	SessionID   string    `json:"session_id" description:"The session that expired"`
+	LastUsed    time.Time `json:"last_used" description:"When the session last ran a command"`
+	IdleSeconds int64     `json:"idle_seconds" description:"How long the session had been idle"`
+}
+
+// Restarted is published when a session's shell had exited and was replaced
+// by a new one before the next command
+type Restarted struct {
+	Version int    `json:"version" description:"Schema version of the payload"`
+	OldPID  int    `json:"old_pid" description:"Process ID of the shell that exited"`
+	NewPID  int    `json:"new_pid" description:"Process ID of the new shell"`
+	Status  string `json:"status" description:"How the old shell ended, e.g. 'exit status 0' or 'signal: killed'"`
+	Cwd     string `json:"cwd" description:"Working directory the new shell started in"`
+}
+
+// Closed is the last event of a session
+type Closed struct {
+	Version   int    `json:"version" description:"Schema version of the payload"`
+	SessionID string `json:"session_id" description:"The session that closed"`
+}
+
+// Reset precedes replayed events when some of those a reconnecting client
+// missed are no longer buffered
+type Reset struct {
+	Version         int    `json:"version" description:"Schema version of the payload"`
+	LastEventID     uint64 `json:"last_event_id" description:"The last event the client had seen"`
+	OldestAvailable uint64 `json:"oldest_available" description:"ID of the oldest event still buffered"`
+}
+
+// Lagged reports events a client read too slowly to receive
+type Lagged struct {
+	Version      int    `json:"version" description:"Schema version of the payload"`
+	Dropped      int    `json:"dropped" description:"How many events were dropped"`
+	FirstDropped uint64 `json:"first_dropped" description:"ID of the first dropped event"`
+	LastDropped  uint64 `json:"last_dropped" description:"ID of the last dropped event"`
+	TotalDropped int    `json:"total_dropped" description:"How many events the client has lost since it connected"`
+	Policy       string `json:"policy" description:"What the server does when the client falls behind: drop-newest, drop-oldest, coalesce or disconnect"`
+}
+
+// ScheduledRun is published when a scheduled command has run
+type ScheduledRun struct {
+	Version    int        `json:"version" description:"Schema version of the payload"`
+	JobID      string     `json:"job_id" description:"The scheduled job"`
+	Run        int        `json:"run" description:"Number of the run, counting from 1"`
+	Command    string     `json:"command" description:"The command line"`
+	Started    time.Time  `json:"started" description:"When the run started"`
+	DurationMS int64      `json:"duration_ms" description:"Run time in milliseconds"`
+	ExitCode   int        `json:"exit_code" description:"Exit status, or -1 when the command did not run or was killed"`
+	TimedOut   bool       `json:"timed_out" description:"Whether the command was stopped by its timeout"`
+	Killed     string     `json:"killed,omitempty" description:"What ended a command that did not exit by itself, such as a signal"`
+	Output     string     `json:"output" description:"Combined stdout and stderr, truncated to the last 64 KiB"`
+	Error      string     `json:"error,omitempty" description:"Why the command did not run, such as a policy denial"`
+	Next       *time.Time `json:"next,omitempty" description:"When the job runs next, for recurring jobs"`
+}
+
+// Trap is posted to the trap webhook when a trap path is accessed
+type Trap struct {
+	Version   int       `json:"version" description:"Schema version of the payload"`
+	Path      string    `json:"path" description:"The trap path that was accessed"`
+	Source    string    `json:"source" description:"How it was accessed: command or file"`
+	Tool      string    `json:"tool,omitempty" description:"The tool or endpoint that made the access"`
+	Command   string    `json:"command,omitempty" description:"The command, for command accesses"`
+	SessionID string    `json:"session_id,omitempty" description:"The session the command ran in"`
+	Time      time.Time `json:"time" description:"When the access happened"`
+}
+
+// CommandFinished is posted to the lifecycle webhooks when a command exits,
+// as command_completed, or as command_failed when it exited non-zero or
+// timed out
+type CommandFinished struct {
+	Version    int    `json:"version" description:"Schema version of the payload"`
+	SessionID  string `json:"session_id,omitempty" description:"The session the command ran in; empty for one-off commands"`
+	Command    string `json:"command" description:"The command line"`
+	ExitCode   int    `json:"exit_code" description:"Exit status, or -1 when unknown"`
+	TimedOut   bool   `json:"timed_out" description:"Whether the command was still running when its timeout expired"`
+	DurationMS int64  `json:"duration_ms" description:"Run time in milliseconds"`
+}
+
+// SessionCreated is posted to the lifecycle webhooks when a persistent
+// session is created or adopted
+type SessionCreated struct {
+	Version   int    `json:"version" description:"Schema version of the payload"`
+	SessionID string `json:"session_id" description:"The new session"`
+	Shell     string `json:"shell" description:"The session's shell"`
+	PID       int    `json:"pid" description:"Process ID of the shell"`
+	Owner     string `json:"owner" description:"The MCP client that owns the session"`
+	Name      string `json:"name,omitempty" description:"The session's name, if given"`
+	Adopted   string `json:"adopted,omitempty" description:"The terminal an adopted session is attached to"`
+}
+
+// ApprovalRequested is posted to the lifecycle webhooks when a command is
+// refused until the caller confirms it, so a human can weigh in
+type ApprovalRequested struct {
+	Version  int    `json:"version" description:"Schema version of the payload"`
+	Tool     string `json:"tool" description:"The tool the command was given to"`
+	Command  string `json:"command" description:"The command awaiting confirmation"`
+	Reason   string `json:"reason" description:"Why the policy asks for confirmation"`
+	Role     string `json:"role" description:"The policy role of the caller"`
+	Identity string `json:"identity,omitempty" description:"The caller, as established by the auth hook"`
+}
+
+// Kind describes one event type
+type Kind struct {
+	Type        string
+	Description string
+	// Transport is "sse", "webhook" or "sse, webhook"
+	Transport string
+	Payload   interface{}
+}
+
+// Kinds lists every event type
+var Kinds = []Kind{
+	{TypeCommand, "A command was sent to the session", "sse", Command{}},
+	{TypeOutput, "A line of command output", "sse", Output{}},
+	{TypeExit, "A command finished or timed out", "sse", Exit{}},
+	{TypeAnnotation, "A note was attached to the session's history", "sse", Annotation{}},
+	{TypeControl, "Control of the session changed hands or was requested", "sse", Control{}},
+	{TypeAlert, "A command touched a trap path", "sse", Alert{}},
+	{TypeExpired, "The session was closed for having been idle too long", "sse, webhook", Expired{}},
+	{TypeRestarted, "The session's shell had exited and was replaced", "sse", Restarted{}},
+	{TypeClosed, "The session closed; no events follow", "sse", Closed{}},
+	{TypeReset, "Some missed events are no longer buffered; reload the session's state", "sse", Reset{}},
+	{TypeLagged, "Events were dropped because the client read too slowly", "sse", Lagged{}},
+	{TypeScheduledRun, "A scheduled command ran", "sse", ScheduledRun{}},
+	{TypeTrap, "A trap path was accessed", "webhook", Trap{}},
+	{TypeCommandCompleted, "A command exited with status 0", "webhook", CommandFinished{}},
+	{TypeCommandFailed, "A command exited non-zero or timed out", "webhook", CommandFinished{}},
+	{TypeSessionCreated, "A persistent session was created or adopted", "webhook", SessionCreated{}},
+	{TypeApprovalRequested, "A command was refused until the caller confirms it", "webhook", ApprovalRequested{}},
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaDialect is the JSON Schema version the schemas are written in
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema document describing every event payload, with
+// one definition per event type under "$defs"
+func Schema() map[string]interface{} {
+	defs := make(map[string]interface{}, len(Kinds))
+	for _, kind := range Kinds {
+		schema := objectSchema(reflect.TypeOf(kind.Payload))
+		schema["description"] = kind.Description
+		schema["x-transport"] = kind.Transport
+		defs[kind.Type] = schema
+	}
+
+	return map[string]interface{}{
+		"$schema": schemaDialect,
+		"title":   "MCP Terminal Server events",
+		"version": Version,
+		"$defs":   defs,
+	}
+}
+
+// objectSchema describes a payload struct from its JSON and description tags
+func objectSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		property := typeSchema(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		if name == "version" {
+			property["const"] = Version
+		}
+		properties[name] = property
+
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// typeSchema describes a field type
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return objectSchema(t)
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	}
+	return map[string]interface{}{}
+}
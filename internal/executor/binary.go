@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Output types of execute_command: detect binary output, or force it to be
+// treated as text or as binary
+const (
+	OutputAuto   = "auto"
+	OutputText   = "text"
+	OutputBinary = "binary"
+)
+
+// outputURI names binary output embedded in a result
+const outputURI = "terminal://output"
+
+// isBinary reports whether output is binary data rather than text, going by
+// the control bytes text does not contain
+func isBinary(output string) bool {
+	return !strings.HasPrefix(http.DetectContentType([]byte(output)), "text/") || strings.ContainsRune(output, 0)
+}
+
+// binaryOutput returns binary output as image or embedded resource content,
+// with a note standing in for the output in the result text. Output over the
+// size cap is saved to the artifact store instead and only the note returned.
+func (e *Executor) binaryOutput(data []byte) (string, mcp.Content) {
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+
+	if int64(len(data)) > e.config.BinaryOutputMaxBytes {
+		a, err := e.artifacts.Save(data, mimeType)
+		if err != nil {
+			e.log.Warn("Failed to save binary output", "error", err)
+			return fmt.Sprintf("[binary output: %d bytes of %s, over the %d byte limit and not saved: %v]",
+				len(data), mimeType, e.config.BinaryOutputMaxBytes, err), nil
+		}
+		return fmt.Sprintf("[binary output: %d bytes of %s, over the %d byte limit; saved as artifact %s at %s, download with GET /artifacts/%s]",
+			len(data), mimeType, e.config.BinaryOutputMaxBytes, a.ID, e.paths.ToClient(a.Path), a.ID), nil
+	}
+
+	note := fmt.Sprintf("[binary output: %d bytes of %s, attached]", len(data), mimeType)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if strings.HasPrefix(mimeType, "image/") {
+		return note, mcp.NewImageContent(encoded, mimeType)
+	}
+	return note, mcp.NewEmbeddedResource(mcp.BlobResourceContents{URI: outputURI, MIMEType: mimeType, Blob: encoded})
+}
@@ -2,96 +2,482 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/artifact"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/charset"
 	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/deadline"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/limits"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/metrics"
+	"mcp-terminal-server/internal/netwatch"
+	"mcp-terminal-server/internal/ownership"
+	"mcp-terminal-server/internal/pathmap"
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/progress"
+	"mcp-terminal-server/internal/receipt"
+	"mcp-terminal-server/internal/render"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/tracing"
+	"mcp-terminal-server/internal/webhook"
+	"mcp-terminal-server/internal/workspace"
 )
 
 // Executor handles non-persistent command execution
 type Executor struct {
-	config *config.Config
+	config    *config.Config
+	limiter   *limits.Limiter
+	paths     *pathmap.Map
+	owner     *ownership.Fixer
+	net       *netwatch.Watcher
+	artifacts *artifact.Store
+	workspace *workspace.Workspace
+	log       *slog.Logger
 }
 
 // New creates a new executor
 func New(cfg *config.Config) *Executor {
+	paths := pathmap.New(cfg)
 	return &Executor{
-		config: cfg,
+		config:    cfg,
+		limiter:   limits.New(cfg),
+		paths:     paths,
+		owner:     ownership.New(cfg, paths),
+		net:       netwatch.New(cfg),
+		artifacts: artifact.New(cfg),
+		workspace: workspace.New(cfg),
+		log:       logging.For("executor"),
 	}
 }
 
-// Execute executes a command in a non-persistent manner
-func (e *Executor) Execute(request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	args := request.GetArguments()
+// invocation is a command and how to run it, resolved from tool arguments
+type invocation struct {
+	command string
+	// argv runs the command without a shell when the call gave 'args'
+	argv []string
+	// env is added to the environment of the command when the call gave 'env'
+	env []string
+	// encoding is the character encoding the output is converted from
+	encoding      string
+	shell         string
+	workingDir    string
+	timeout       time.Duration
+	captureStderr bool
+	outputType    string
+	spec          limits.Spec
+	// mergedOutput adds stdout and stderr interleaved to separately captured output
+	mergedOutput bool
+	// script is run from a file when the call gave 'script', with command
+	// holding its text. A script starting with #! runs with interpreter.
+	script      bool
+	interpreter []string
+	// scriptPath is the file the script is written to just before it runs
+	scriptPath string
+}
 
-	command, ok := args["command"].(string)
-	if !ok || command == "" {
-		return mcp.NewToolResultError("Command is required"), nil
+// resolve reads the command and its settings from tool arguments, returning an
+// error result when they are invalid
+func (e *Executor) resolve(args map[string]interface{}) (*invocation, *mcp.CallToolResult) {
+	command, _ := args["command"].(string)
+	_, hasExecArgs := args["exec_args"]
+	_, hasArgv := args["argv"]
+	vector := "exec_args"
+	if hasArgv {
+		vector = "argv"
+	}
+	script, hasScript := Script(args)
+	switch {
+	case hasArgv && hasExecArgs:
+		return nil, mcp.NewToolResultError("Give either argv or exec_args")
+	case hasScript && (command != "" || hasExecArgs || hasArgv):
+		return nil, mcp.NewToolResultError("Give either script or command")
+	case command != "" && (hasExecArgs || hasArgv):
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Give either command or %s", vector))
+	case command == "" && !hasExecArgs && !hasArgv && !hasScript:
+		return nil, mcp.NewToolResultError("Command is required")
+	case hasScript && strings.TrimSpace(script) == "":
+		return nil, mcp.NewToolResultError("Script is empty")
+	}
+	argv, hasArgs := Argv(args)
+	if (hasExecArgs || hasArgv) && !hasArgs {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("%s must start with the program to run", vector))
+	}
+	env, err := Env(args)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid env: %v", err))
+	}
+
+	if e.config.Platform != "darwin" && e.config.Platform != "linux" {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Platform %s not supported", e.config.Platform))
+	}
+
+	inv := &invocation{
+		command:  command,
+		env:      env,
+		encoding: e.config.OutputEncoding,
+		timeout:  e.config.DefaultTimeout,
+		shell:    e.config.Shell,
 	}
 
 	// Get timeout
-	timeout := e.config.DefaultTimeout
 	if timeoutArg, ok := args["timeout"].(float64); ok && timeoutArg > 0 {
-		timeout = time.Duration(timeoutArg) * time.Second
+		inv.timeout = time.Duration(timeoutArg) * time.Second
 	}
 
-	// Get shell
-	shell := e.config.Shell
+	// Get shell, checked before anything is run with it
 	if shellArg, ok := args["shell"].(string); ok && shellArg != "" {
-		shell = shellArg
+		if hasArgs {
+			return nil, mcp.NewToolResultError("A command given with argv, args or exec_args runs without a shell; leave out shell")
+		}
+		if _, err := shells.Validate(shellArg); err != nil {
+			return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid shell: %v", err))
+		}
+		inv.shell = shellArg
+	}
+
+	// A script starting with #! runs with the interpreter it names, whatever
+	// the shell, as if the file were executed but without it needing to be
+	// executable
+	if hasScript {
+		inv.command, inv.script = script, true
+		if line, ok := strings.CutPrefix(strings.SplitN(script, "\n", 2)[0], "#!"); ok {
+			// As on Linux, everything after the interpreter is one argument
+			interpreter, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if interpreter == "" {
+				return nil, mcp.NewToolResultError("The #! line of the script names no interpreter")
+			}
+			inv.interpreter = []string{interpreter}
+			if arg = strings.TrimSpace(arg); arg != "" {
+				inv.interpreter = append(inv.interpreter, arg)
+			}
+			inv.shell = strings.Join(inv.interpreter, " ")
+		}
+	}
+
+	// A command with args is shown as the shell line that would run the same argv
+	if hasArgs {
+		inv.argv = argv
+		inv.command = shells.For(inv.shell).Join(argv)
+		inv.shell = noShell
 	}
 
 	// Get capture_stderr option
-	captureStderr := false
 	if captureStderrArg, ok := args["capture_stderr"].(bool); ok {
-		captureStderr = captureStderrArg
+		inv.captureStderr = captureStderrArg
+	}
+	if merged, ok := args["merged_output"].(bool); ok && merged {
+		if !inv.captureStderr {
+			return nil, mcp.NewToolResultError("merged_output needs capture_stderr")
+		}
+		inv.mergedOutput = true
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	// Get output type
+	inv.outputType = OutputAuto
+	if outputTypeArg, ok := args["output_type"].(string); ok && outputTypeArg != "" {
+		if outputTypeArg != OutputAuto && outputTypeArg != OutputText && outputTypeArg != OutputBinary {
+			return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid output type: %s (use auto, text or binary)", outputTypeArg))
+		}
+		inv.outputType = outputTypeArg
+	}
 
-	// Execute command
-	var cmd *exec.Cmd
-	switch e.config.Platform {
-	case "darwin", "linux":
-		cmd = exec.CommandContext(ctx, shell, "-c", command)
-	default:
-		return mcp.NewToolResultError(fmt.Sprintf("Platform %s not supported", e.config.Platform)), nil
+	// Get output encoding
+	if encodingArg, ok := args["encoding"].(string); ok && encodingArg != "" {
+		if err := charset.Validate(encodingArg); err != nil {
+			return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid encoding: %v", err))
+		}
+		inv.encoding = encodingArg
+	}
+
+	// Get working directory, given in the client's view of the filesystem and
+	// relative to the workspace, which is also the default
+	inv.workingDir = e.workspace.Dir()
+	if cwdArg, ok := args["cwd"].(string); ok && cwdArg != "" {
+		inv.workingDir = e.workspace.Abs(e.paths.ToServer(cwdArg))
+		if info, err := os.Stat(inv.workingDir); err != nil || !info.IsDir() {
+			return nil, mcp.NewToolResultError(fmt.Sprintf("Working directory does not exist: %s", cwdArg))
+		}
+	}
+	if err := e.workspace.Check(inv.workingDir); err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid working directory: %v", err))
+	}
+
+	// Get resource limits
+	spec, err := e.limiter.SpecFromArgs(args)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid resource limits: %v", err))
+	}
+	inv.spec = spec
+
+	return inv, nil
+}
+
+// noShell stands for the shell of commands run from an argument vector
+const noShell = "none (argv)"
+
+// Argv returns the argument vector of a call that gave its command as a
+// program and arguments, to run without a shell: either all of them in
+// 'argv' or 'exec_args', or the program in 'command' and its arguments in
+// 'args'. Numbers are accepted as they read. It returns false when the call
+// gave neither.
+func Argv(args map[string]interface{}) ([]string, bool) {
+	for _, key := range []string{"argv", "exec_args"} {
+		if items, ok := args[key].([]interface{}); ok {
+			argv := words(items)
+			return argv, len(argv) > 0 && argv[0] != ""
+		}
 	}
 
-	// Set up environment variables
-	cmd.Env = os.Environ() // Start with current environment
+	items, ok := args["args"].([]interface{})
+	command, _ := args["command"].(string)
+	if !ok || command == "" {
+		return nil, false
+	}
+	return append([]string{command}, words(items)...), true
+}
+
+// Env returns the variables a call gave in 'env', an object of names and
+// values, as NAME=value entries sorted by name. Numbers and booleans are
+// accepted as they read.
+func Env(args map[string]interface{}) ([]string, error) {
+	given, ok := args["env"]
+	if !ok || given == nil {
+		return nil, nil
+	}
+	vars, ok := given.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("env must be an object of variable names and values")
+	}
+
+	env := make([]string, 0, len(vars))
+	for name, value := range vars {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return nil, fmt.Errorf("invalid variable name %q", name)
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return nil, fmt.Errorf("the value of %s must be a string", name)
+		}
+		env = append(env, name+"="+fmt.Sprint(value))
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// Script returns the script a call gave, as one block of text or as its
+// lines. It returns false when the call gave none.
+func Script(args map[string]interface{}) (string, bool) {
+	switch script := args["script"].(type) {
+	case string:
+		return script, true
+	case []interface{}:
+		return strings.Join(words(script), "\n"), true
+	}
+	return "", false
+}
+
+// words converts the items of an argument list to strings
+func words(items []interface{}) []string {
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		} else {
+			list = append(list, fmt.Sprint(item))
+		}
+	}
+	return list
+}
+
+// commandLine returns the argv an invocation runs: its own, the shell or
+// interpreter running the script file, or the shell running the command
+func (inv *invocation) commandLine() []string {
+	switch {
+	case inv.argv != nil:
+		return inv.argv
+	case inv.script:
+		path := inv.scriptPath
+		if path == "" {
+			path = "<script file>"
+		}
+		if inv.interpreter != nil {
+			return append(slices.Clone(inv.interpreter), path)
+		}
+		return append([]string{inv.shell}, shells.For(inv.shell).ScriptArgs(path)...)
+	}
+	return append([]string{inv.shell}, shells.For(inv.shell).CommandArgs(inv.command)...)
+}
+
+// writeScript writes the script of an invocation to a file of its own, and
+// returns a function removing it. The file is put in the workspace when
+// commands are sandboxed, as they do not see the server's temporary directory.
+func (e *Executor) writeScript(inv *invocation) (func(), error) {
+	dir := ""
+	if e.workspace.Sandboxed() {
+		dir = e.workspace.Dir()
+	}
+	ext := ""
+	if inv.interpreter == nil {
+		ext = shells.For(inv.shell).ScriptExt()
+	}
+	f, err := os.CreateTemp(dir, ".mcp-script-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+	script := inv.command
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	_, err = f.WriteString(script)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	inv.scriptPath = f.Name()
+	return func() { os.Remove(f.Name()) }, nil
+}
+
+// environ returns the environment commands run with, including what the
+// profile of the calling client adds
+func (e *Executor) environ(ctx context.Context) []string {
+	env := os.Environ() // Start with current environment
 	if e.config.Display != "" {
 		// Add or update DISPLAY variable
-		cmd.Env = append(cmd.Env, "DISPLAY="+e.config.Display)
+		env = append(env, "DISPLAY="+e.config.Display)
+	}
+	return append(env, profiles.Env(ctx)...)
+}
+
+// Execute executes a command in a non-persistent manner
+func (e *Executor) Execute(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	inv, invalid := e.resolve(request.GetArguments())
+	if invalid != nil {
+		return invalid, nil
 	}
+	command, shell, timeout, captureStderr := inv.command, inv.shell, inv.timeout, inv.captureStderr
+
+	// A bound on the whole request, such as the HTTP server's, shortens the timeout
+	timeout = deadline.Timeout(ctx, timeout)
+	// The command is stopped when it times out, and when the call is
+	// abandoned, as when an HTTP client disconnects
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if inv.script {
+		remove, err := e.writeScript(inv)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to write script: %v", err)), nil
+		}
+		defer remove()
+	}
+
+	// Execute command
+	argv := inv.commandLine()
+	cmd := exec.CommandContext(execCtx, argv[0], argv[1:]...)
+	cmd.Dir = inv.workingDir
+	cmd.Env = labels.Environ(append(e.environ(ctx), inv.env...), e.config.Tenant, "", labels.RequestID(ctx))
+	process.RunAs(cmd, profiles.User(ctx))
+	process.Group(cmd, e.config.KillGracePeriod)
+	if err := e.workspace.Confine(cmd); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to start command: %v", err)), nil
+	}
+
+	// Output is also fed to the progress reporter, if the client asked for
+	// one, and to a caller streaming it
+	reporter := progress.FromContext(ctx)
+	live := liveFrom(ctx)
 
 	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
+	stdoutWriter := io.MultiWriter(&stdout, reporter, live.stdout)
+	cmd.Stdout = stdoutWriter
 
+	var merged *mergedWriter
 	if captureStderr {
-		cmd.Stderr = &stderr
+		cmd.Stderr = io.MultiWriter(&stderr, reporter, live.stderr)
+		if inv.mergedOutput {
+			merged = &mergedWriter{}
+			cmd.Stdout = io.MultiWriter(stdoutWriter, merged)
+			cmd.Stderr = io.MultiWriter(&stderr, reporter, live.stderr, merged)
+		}
 	} else {
-		cmd.Stderr = &stdout
+		cmd.Stderr = stdoutWriter
 	}
 
-	err := cmd.Run()
+	_, span := tracing.StartCommand(ctx, command, "")
+
+	started := time.Now()
+	handle, err := e.limiter.Start(cmd, inv.spec)
+	if err != nil {
+		span.RecordError(err)
+		tracing.EndCommand(span, -1, time.Since(started), false)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to start command: %v", err)), nil
+	}
+
+	watch := e.net.Watch(cmd.Process.Pid)
+	reporter.Start(timeout)
+	err = cmd.Wait()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The command finished but left processes behind holding its output open
+		err = nil
+	}
+	reporter.Stop()
+	network := watch.Stop()
+	handle.Release()
+	e.owner.Fix(started)
+
+	elapsed := time.Since(started)
+	timedOut := execCtx.Err() == context.DeadlineExceeded
+	cancelled := ctx.Err() == context.Canceled
+	tracing.EndCommand(span, cmd.ProcessState.ExitCode(), elapsed, timedOut)
+	e.log.Info("Command finished", logging.Command(command), "shell", shell,
+		"exit_code", cmd.ProcessState.ExitCode(), "duration_ms", elapsed.Milliseconds(), "timed_out", timedOut, "cancelled", cancelled)
+	metrics.Record("", command, elapsed, cmd.ProcessState.ExitCode(), timedOut, false)
+	webhook.Command(events.CommandFinished{Command: command, ExitCode: cmd.ProcessState.ExitCode(), TimedOut: timedOut, DurationMS: elapsed.Milliseconds()})
+	receipt.Record(ctx, receipt.Command{Command: command, ExitCode: cmd.ProcessState.ExitCode(), TimedOut: timedOut, Started: started, Finished: started.Add(elapsed)})
+
+	// Binary output is attached to the result rather than shown as text,
+	// which is converted to UTF-8
+	output := stdout.String()
+	var attachment mcp.Content
+	decoder, _ := charset.NewDecoder(inv.encoding)
+	if output != "" && (inv.outputType == OutputBinary || (inv.outputType == OutputAuto && isBinary(output))) {
+		output, attachment = e.binaryOutput([]byte(output))
+	} else {
+		output = e.paths.ToClient(decoder.String(output))
+	}
 
 	result := map[string]interface{}{
-		"stdout":          stdout.String(),
+		"stdout":          output,
 		"platform":        e.config.Platform,
 		"shell":           shell,
 		"timeout_seconds": timeout.Seconds(),
 		"command":         command,
+		"timed_out":       timedOut,
 	}
 
 	if captureStderr {
-		result["stderr"] = stderr.String()
+		result["stderr"] = e.paths.ToClient(decoder.String(stderr.String()))
 	}
 
 	if err != nil {
@@ -103,6 +489,203 @@ func (e *Executor) Execute(request mcp.CallToolRequest) (*mcp.CallToolResult, er
 		result["exit_code"] = 0
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Command executed.\nOutput: %s\nExit Code: %v\nPlatform: %s\nShell: %s",
-		result["stdout"], result["exit_code"], result["platform"], result["shell"])), nil
-}
\ No newline at end of file
+	// Output captured apart from stderr follows the summary in blocks of its own
+	outputField := fmt.Sprintf("Output: %s", result["stdout"])
+	partialField := fmt.Sprintf("Output (partial): %s", result["stdout"])
+	var streams []string
+	if captureStderr {
+		streams = []string{render.StreamStdout, render.StreamStderr}
+		if merged != nil && attachment == nil {
+			streams = append(streams, render.StreamMerged)
+		}
+		outputField = "Streams: " + strings.Join(streams, ", ")
+		partialField = "Streams (partial): " + strings.Join(streams, ", ")
+	}
+
+	text := fmt.Sprintf("Command executed.\n%s\nExit Code: %v\nPlatform: %s\nShell: %s",
+		outputField, result["exit_code"], result["platform"], result["shell"])
+	if timedOut {
+		// The partial output lets the caller decide whether to retry with a
+		// longer timeout or go on with what it has
+		text = fmt.Sprintf("Command timed out after %s; its processes were stopped.\n%s\nExit Code: %v\nTimed Out: true\nElapsed: %s\nPlatform: %s\nShell: %s",
+			timeout, partialField, result["exit_code"], elapsed.Round(time.Millisecond), result["platform"], result["shell"])
+	}
+	if cancelled {
+		// Nobody is waiting for the result, but the audit log still records it
+		text = fmt.Sprintf("Command cancelled after %s because the call was abandoned; its processes were stopped.\n%s\nExit Code: %v\nPlatform: %s\nShell: %s",
+			elapsed.Round(time.Millisecond), partialField, result["exit_code"], result["platform"], result["shell"])
+	}
+	if summary := handle.Summary(); summary != "" {
+		text += "\nLimits: " + summary
+	}
+	if note := decoder.Note(); note != "" {
+		text += "\nEncoding: " + note
+	}
+	if watch != nil {
+		text += "\nNetwork: " + network.String()
+		audit.Annotate(ctx, "network", network)
+	}
+	if render.Debug(ctx) {
+		text += e.debugDetails(inv, cmd, started, elapsed)
+	}
+
+	res := mcp.NewToolResultText(text)
+	if timedOut || cancelled {
+		res = mcp.NewToolResultError(text)
+	}
+	for _, stream := range streams {
+		switch stream {
+		case render.StreamStdout:
+			render.AddStream(res, stream, output)
+		case render.StreamStderr:
+			render.AddStream(res, stream, result["stderr"].(string))
+		case render.StreamMerged:
+			render.AddStream(res, stream, e.paths.ToClient(decoder.String(merged.String())))
+		}
+	}
+	if attachment != nil {
+		res.Content = append(res.Content, attachment)
+	}
+	return res, nil
+}
+
+// debugDetails describes how a command was run, for results asked for at
+// debug verbosity
+func (e *Executor) debugDetails(inv *invocation, cmd *exec.Cmd, started time.Time, elapsed time.Duration) string {
+	workingDir := cmd.Dir
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+	argv, _ := json.Marshal(cmd.Args)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nCommand: %s\nArgv: %s\nWorking Directory: %s\nTimeout: %s\nCapture Stderr: %v\nStarted: %s\nDuration: %s\nEnvironment: %s",
+		inv.command, argv, e.paths.ToClient(workingDir), inv.timeout, inv.captureStderr,
+		started.UTC().Format(time.RFC3339Nano), elapsed.Round(time.Millisecond), render.Environment(cmd.Env))
+	if e.workspace.Sandboxed() {
+		fmt.Fprintf(&b, "\nSandbox: %s", e.workspace.Sandbox())
+	}
+	return b.String()
+}
+
+// Run runs a short command on behalf of another tool, such as watch, with the
+// server's shell and default limits, and the environment and user of the
+// profile in ctx. It returns the combined output and the exit code, and an
+// error, along with the output, when the command did not exit by itself.
+func (e *Executor) Run(ctx context.Context, command string) (string, int, error) {
+	cmd := exec.CommandContext(ctx, e.config.Shell, shells.For(e.config.Shell).CommandArgs(command)...)
+	cmd.Dir = e.workspace.Dir()
+	cmd.Env = labels.Environ(e.environ(ctx), e.config.Tenant, "", labels.RequestID(ctx))
+	process.RunAs(cmd, profiles.User(ctx))
+	process.Group(cmd, e.config.KillGracePeriod)
+	if err := e.workspace.Confine(cmd); err != nil {
+		return "", -1, err
+	}
+
+	var buf strings.Builder
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	handle, err := e.limiter.Start(cmd, e.limiter.Defaults())
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to start command: %v", err)
+	}
+	err = cmd.Wait()
+	handle.Release()
+
+	decoder, _ := charset.NewDecoder(e.config.OutputEncoding)
+	output := e.paths.ToClient(decoder.String(buf.String()))
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil, ctx.Err() != nil:
+		// A command cut short by ctx is the caller's to report
+	case errors.As(err, &exitErr) && exitErr.Exited():
+		// A non-zero exit code is the command's own result
+	default:
+		// Killed by a signal, its cgroup among others, or never waited for
+		return output, -1, fmt.Errorf("command did not finish: %w", err)
+	}
+	return output, cmd.ProcessState.ExitCode(), nil
+}
+
+// DryRun reports how a command would be run, resolved exactly as Execute
+// would, without running it
+func (e *Executor) DryRun(ctx context.Context, request mcp.CallToolRequest) *mcp.CallToolResult {
+	inv, invalid := e.resolve(request.GetArguments())
+	if invalid != nil {
+		return invalid
+	}
+
+	workingDir := inv.workingDir
+	if workingDir == "" {
+		// Commands inherit the server's working directory
+		workingDir, _ = os.Getwd()
+	}
+	argv, _ := json.Marshal(inv.commandLine())
+
+	env := append(e.environ(ctx), inv.env...)
+	sort.Strings(env)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run: nothing was executed.\nCommand: %s\nArgv: %s\nShell: %s\nWorking directory: %s\nTimeout: %s\nCapture stderr: %v\n",
+		inv.command, argv, inv.shell, workingDir, inv.timeout, inv.captureStderr)
+	if summary := inv.spec.String(); summary != "" {
+		fmt.Fprintf(&b, "Limits: %s\n", summary)
+	}
+	if u := profiles.User(ctx); u != nil {
+		fmt.Fprintf(&b, "User: %s (uid %d)\n", u.Name, u.UID)
+	}
+	if e.workspace.Sandboxed() {
+		fmt.Fprintf(&b, "Sandbox: %s (workspace %s)\n", e.workspace.Sandbox(), e.workspace.Dir())
+	}
+	fmt.Fprintf(&b, "Environment (%d variables):\n", len(env))
+	for _, v := range env {
+		fmt.Fprintf(&b, "  %s\n", v)
+	}
+
+	return mcp.NewToolResultText(b.String())
+}
+
+// liveKey carries the writers a caller streams a command's output to
+type liveKey struct{}
+
+// liveOutput is where a command's output goes as it is read
+type liveOutput struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// WithLiveOutput returns a context whose command also writes its output to
+// stdout and stderr as it is read, raw, for callers that stream it. Unless
+// stderr is captured separately, both streams go to stdout.
+func WithLiveOutput(ctx context.Context, stdout, stderr io.Writer) context.Context {
+	return context.WithValue(ctx, liveKey{}, liveOutput{stdout: stdout, stderr: stderr})
+}
+
+// liveFrom returns the live output writers of ctx, discarding when there are none
+func liveFrom(ctx context.Context) liveOutput {
+	live, ok := ctx.Value(liveKey{}).(liveOutput)
+	if !ok {
+		return liveOutput{stdout: io.Discard, stderr: io.Discard}
+	}
+	return live
+}
+
+// mergedWriter collects stdout and stderr together in the order they are
+// read from the command
+type mergedWriter struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (m *mergedWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.buf.Write(p)
+}
+
+func (m *mergedWriter) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.buf.String()
+}
@@ -0,0 +1,369 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/ownership"
+	"mcp-terminal-server/internal/pathmap"
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/trap"
+	"mcp-terminal-server/internal/workspace"
+)
+
+// ErrAccessDenied is returned for paths outside the allowed prefixes
+var ErrAccessDenied = errors.New("access denied")
+
+// Entry describes one directory entry
+type Entry struct {
+	Name    string
+	IsDir   bool
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	// Target is set for symbolic links
+	Target string
+}
+
+// Service provides file access restricted to operator-configured path prefixes
+type Service struct {
+	allowed      []string
+	maxReadBytes int64
+	paths        *pathmap.Map
+	owner        *ownership.Fixer
+	traps        *trap.Detector
+	workspace    *workspace.Workspace
+	readOnly     bool
+	// user is who files are accessed as, or nil for the server's user
+	user *process.User
+}
+
+// New creates a file service from the configuration
+func New(cfg *config.Config) *Service {
+	paths := pathmap.New(cfg)
+	ws := workspace.New(cfg)
+
+	prefixes := cfg.FileAllowedPaths
+	if len(prefixes) == 0 && ws.Sandboxed() {
+		// Files outside a sandboxed workspace are out of reach of commands too
+		prefixes = []string{ws.Dir()}
+	}
+
+	var allowed []string
+	for _, prefix := range prefixes {
+		// Compare against resolved paths so symlinked prefixes still match
+		if resolved, err := filepath.EvalSymlinks(prefix); err == nil {
+			prefix = resolved
+		}
+		allowed = append(allowed, filepath.Clean(prefix))
+	}
+
+	return &Service{
+		allowed:      allowed,
+		maxReadBytes: cfg.FileMaxReadBytes,
+		paths:        paths,
+		workspace:    ws,
+		owner:        ownership.New(cfg, paths),
+		traps:        trap.New(cfg),
+		readOnly:     cfg.ReadOnly,
+	}
+}
+
+// As returns the service acting on behalf of u: it reads, writes and lists
+// only what u could itself, and what it creates belongs to u. A nil u is the
+// server's user.
+func (s *Service) As(u *process.User) *Service {
+	if u == nil {
+		return s
+	}
+	as := *s
+	as.user = u
+	return &as
+}
+
+// Resolve translates a client path to the server's view and checks that it is
+// inside an allowed prefix. Symbolic links are resolved first so they cannot be
+// used to escape the allowed directories. The path itself need not exist yet.
+func (s *Service) Resolve(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	// Relative paths are relative to the workspace, if there is one
+	path = s.workspace.Abs(s.paths.ToServer(path))
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %s: %v", path, err)
+	}
+
+	resolved, err := resolveExisting(normalized(abs))
+	if err != nil {
+		return "", err
+	}
+
+	if len(s.allowed) > 0 {
+		permitted := false
+		for _, prefix := range s.allowed {
+			if resolved == prefix || prefix == "/" || strings.HasPrefix(resolved, prefix+"/") {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return "", fmt.Errorf("%w: %s is outside the allowed paths", ErrAccessDenied, path)
+		}
+	}
+
+	if trapPath := s.traps.Path(resolved); trapPath != "" {
+		s.traps.Alert(trap.Trip{Path: trapPath, Source: "file"})
+		if s.traps.Freeze() {
+			return "", fmt.Errorf("%w: %s is protected", ErrAccessDenied, path)
+		}
+	}
+
+	return resolved, nil
+}
+
+// normalized returns path in the Unicode normalization form it exists in.
+// Clients usually send precomposed (NFC) text while some file systems, such
+// as macOS ones, store decomposed (NFD) names, so "café" typed by an agent
+// would otherwise not find a file created by a Mac. Paths that exist as given,
+// or in neither form, are returned unchanged.
+func normalized(path string) string {
+	if _, err := os.Lstat(path); err == nil || !os.IsNotExist(err) {
+		return path
+	}
+	for _, form := range []norm.Form{norm.NFC, norm.NFD} {
+		if alt := form.String(path); alt != path {
+			if _, err := os.Lstat(alt); err == nil {
+				return alt
+			}
+		}
+	}
+	return path
+}
+
+// resolveExisting evaluates symlinks in the longest existing ancestor of path
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	current := path
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to resolve %s: %v", path, err)
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path, nil
+		}
+		missing = append(missing, filepath.Base(current))
+		current = parent
+	}
+}
+
+// Read returns up to limit bytes of the file starting at offset (limit 0 means
+// the server maximum), the file size, and whether the content was cut short
+func (s *Service) Read(path string, offset, limit int64) ([]byte, int64, bool, error) {
+	resolved, err := s.Resolve(path)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	f, err := s.openFile(resolved, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if info.IsDir() {
+		return nil, 0, false, fmt.Errorf("%s is a directory", path)
+	}
+
+	if limit <= 0 || (s.maxReadBytes > 0 && limit > s.maxReadBytes) {
+		limit = s.maxReadBytes
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	var reader io.Reader = f
+	if limit > 0 {
+		reader = io.LimitReader(f, limit)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	truncated := offset+int64(len(data)) < info.Size()
+	return data, info.Size(), truncated, nil
+}
+
+// Write stores content at path, replacing or appending to the file. Missing
+// parent directories are created when createDirs is set.
+func (s *Service) Write(path string, content []byte, appendMode, createDirs bool) error {
+	_, err := s.write(path, bytes.NewReader(content), appendMode, createDirs)
+	return err
+}
+
+// WriteFrom streams r into path, replacing the file, and returns the bytes written
+func (s *Service) WriteFrom(path string, r io.Reader, createDirs bool) (int64, error) {
+	return s.write(path, r, false, createDirs)
+}
+
+// write copies r into the resolved path and hands the result to the
+// configured owner, unless it was written for a user
+func (s *Service) write(path string, r io.Reader, appendMode, createDirs bool) (int64, error) {
+	if s.readOnly {
+		return 0, fmt.Errorf("%w: the server is read-only", ErrAccessDenied)
+	}
+
+	resolved, err := s.Resolve(path)
+	if err != nil {
+		return 0, err
+	}
+
+	started := time.Now()
+
+	if createDirs {
+		mkdirAll := os.MkdirAll
+		if s.user != nil {
+			mkdirAll = s.user.MkdirAll
+		}
+		if err := mkdirAll(filepath.Dir(resolved), 0755); err != nil {
+			return 0, err
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := s.openFile(resolved, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+
+	// Files written for a user are already theirs
+	if s.user == nil {
+		s.owner.Fix(started)
+	}
+	return n, nil
+}
+
+// openFile opens a resolved path as the service's user
+func (s *Service) openFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if s.user != nil {
+		return s.user.OpenFile(path, flag, perm)
+	}
+	return os.OpenFile(path, flag, perm)
+}
+
+// Open opens a regular file for streaming reads
+func (s *Service) Open(path string) (*os.File, os.FileInfo, error) {
+	resolved, err := s.Resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := s.openFile(resolved, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	return f, info, nil
+}
+
+// List returns the entries of a directory sorted with directories first
+func (s *Service) List(path string, showHidden bool) ([]Entry, error) {
+	resolved, err := s.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := s.openFile(resolved, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	dirEntries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, d := range dirEntries {
+		if !showHidden && strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+
+		entry := Entry{
+			Name:    d.Name(),
+			IsDir:   d.IsDir(),
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			entry.Target, _ = os.Readlink(filepath.Join(resolved, d.Name()))
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/audit"
+)
+
+// RequireAdmin only lets requests through that present the admin token as
+// "Authorization: Bearer <token>" or that the auth hook granted admin rights.
+// Without either, admin endpoints are disabled.
+func RequireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if access.IsAdmin(r.Context()) {
+			next(w, r)
+			return
+		}
+		if token == "" {
+			writeError(w, http.StatusForbidden, "admin endpoints are disabled; set MCP_ADMIN_TOKEN")
+			return
+		}
+
+		if !access.BearerMatches(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// AuditHandler serves the audit log's admin endpoints
+type AuditHandler struct {
+	log *audit.Log
+}
+
+// NewAuditHandler creates the audit handler
+func NewAuditHandler(log *audit.Log) *AuditHandler {
+	return &AuditHandler{log: log}
+}
+
+// Verify handles GET /audit/verify, checking the hash chain of the whole log.
+// It responds 200 when the chain is intact and 409 when it has been tampered with.
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	if h.log == nil {
+		writeError(w, http.StatusNotFound, "audit log is disabled; set MCP_AUDIT_FILE")
+		return
+	}
+
+	v := h.log.Verify()
+	status := http.StatusOK
+	if !v.Valid {
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, v)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"net/http"
+
+	"mcp-terminal-server/internal/artifact"
+)
+
+// ArtifactHandler serves command output saved to the artifact store
+type ArtifactHandler struct {
+	artifacts *artifact.Store
+}
+
+// NewArtifactHandler creates the artifact download handler
+func NewArtifactHandler(store *artifact.Store) *ArtifactHandler {
+	return &ArtifactHandler{artifacts: store}
+}
+
+// Download handles GET /artifacts/{id} and GET /artifacts?id=... The ID is
+// random and only given to the caller whose call produced the artifact, so
+// it is all that is asked for. The artifact's checksum is sent as its ETag
+// and in a Digest header, so clients can verify what they downloaded.
+func (h *ArtifactHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		id = r.URL.Query().Get("id")
+	}
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "id query parameter is required")
+		return
+	}
+
+	f, a, err := h.artifacts.Open(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := a.Name
+	if name == "" {
+		name = a.ID
+	}
+	w.Header().Set("Content-Type", a.MIMEType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if a.SHA256 != "" {
+		w.Header().Set("ETag", `"`+a.SHA256+`"`)
+		if sum, err := hex.DecodeString(a.SHA256); err == nil {
+			w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+		}
+	}
+	http.ServeContent(w, r, a.ID, info.ModTime(), f)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/auth"
+	"mcp-terminal-server/internal/backends"
+	"mcp-terminal-server/internal/logging"
+)
+
+// Authenticate asks the auth hook about every request before it reaches an
+// endpoint. Denied requests get 403 with the hook's reason, or 401 when the
+// hook gave no identity; when the hook cannot be reached they get 503, with
+// Retry-After once its circuit is open. The identity, role and admin rights
+// of allowed requests travel on in the request's context to tool calls, the
+// policy and the audit log.
+func Authenticate(hook auth.Hook, next http.Handler) http.Handler {
+	if hook == nil {
+		return next
+	}
+
+	logger := logging.For("auth")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := hook.Authenticate(r.Context(), auth.FromHTTP(r))
+		var unavailable *backends.Unavailable
+		if errors.As(err, &unavailable) {
+			// The hook keeps failing, so the client is told when to come back
+			seconds := max(int(math.Ceil(unavailable.RetryAfter.Seconds())), 1)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"error":               "authentication is unavailable: " + err.Error(),
+				"backend":             unavailable.Backend,
+				"retry_after_seconds": seconds,
+			})
+			return
+		}
+		if err != nil {
+			logger.Warn("Auth hook failed", "path", r.URL.Path, "client", clientIP(r), "error", err)
+			writeError(w, http.StatusServiceUnavailable, "authentication is unavailable")
+			return
+		}
+
+		if !result.Allow {
+			reason := result.Reason
+			if reason == "" {
+				reason = "not authorized"
+			}
+			logger.Info("Auth hook denied request", "path", r.URL.Path, "client", clientIP(r), "identity", result.Identity, "reason", reason)
+			if result.Identity == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, reason)
+				return
+			}
+			writeError(w, http.StatusForbidden, reason)
+			return
+		}
+
+		ctx := access.WithIdentity(r.Context(), access.Identity{Name: result.Identity, Role: result.Role})
+		if result.Admin {
+			ctx = access.WithAdmin(ctx)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxBatchSize bounds the messages in one JSON-RPC batch
+const maxBatchSize = 100
+
+// batchEntry is the part of a batched message needed to route and answer it
+type batchEntry struct {
+	ID     *mcp.RequestId `json:"id"`
+	Method string         `json:"method"`
+}
+
+// Batch lets clients post JSON-RPC 2.0 batches to the MCP endpoint, such as
+// tools/list and several tools/call requests in one round trip. Each message
+// is passed to next on its own, in order, as if it had been posted alone, and
+// the responses are returned as one array in the same order. Notifications
+// get no response, and a message that fails gets an error object in its
+// place. Any notifications the server sends while handling a batched request
+// are dropped. Single messages pass straight through.
+func Batch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		trimmed := bytes.TrimSpace(body)
+		if len(trimmed) == 0 || trimmed[0] != '[' {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var messages []json.RawMessage
+		if err := json.Unmarshal(trimmed, &messages); err != nil {
+			writeJSON(w, http.StatusOK, mcp.NewJSONRPCError(mcp.NewRequestId(nil), mcp.PARSE_ERROR, "batch is not valid JSON", nil))
+			return
+		}
+		switch {
+		case len(messages) == 0:
+			writeJSON(w, http.StatusOK, mcp.NewJSONRPCError(mcp.NewRequestId(nil), mcp.INVALID_REQUEST, "batch is empty", nil))
+			return
+		case len(messages) > maxBatchSize:
+			writeJSON(w, http.StatusOK, mcp.NewJSONRPCError(mcp.NewRequestId(nil), mcp.INVALID_REQUEST, fmt.Sprintf("batch has %d messages, more than the %d allowed", len(messages), maxBatchSize), nil))
+			return
+		}
+
+		responses := make([]json.RawMessage, 0, len(messages))
+		for _, message := range messages {
+			if response := dispatch(next, r, message); response != nil {
+				responses = append(responses, response)
+			}
+		}
+
+		if len(responses) == 0 {
+			// Only notifications, which are acknowledged like single ones
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		writeJSON(w, http.StatusOK, responses)
+	})
+}
+
+// dispatch passes one batched message to next and returns its response, or
+// nil for a notification
+func dispatch(next http.Handler, r *http.Request, message json.RawMessage) json.RawMessage {
+	var entry batchEntry
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) == 0 || trimmed[0] != '{' || json.Unmarshal(trimmed, &entry) != nil {
+		return batchError(nil, mcp.INVALID_REQUEST, "batch entries must be JSON-RPC messages")
+	}
+	if entry.Method == string(mcp.MethodInitialize) {
+		// The session ID it creates could not be given to the rest of the batch
+		return batchError(entry.ID, mcp.INVALID_REQUEST, "initialize cannot be part of a batch")
+	}
+
+	sub := r.Clone(r.Context())
+	sub.Body = io.NopCloser(bytes.NewReader(trimmed))
+	sub.ContentLength = int64(len(trimmed))
+	sub.Header.Set("Content-Length", strconv.Itoa(len(trimmed)))
+
+	rec := &batchRecorder{header: make(http.Header), status: http.StatusOK}
+	next.ServeHTTP(rec, sub)
+
+	if entry.ID == nil {
+		return nil
+	}
+
+	if strings.HasPrefix(rec.header.Get("Content-Type"), "text/event-stream") {
+		if response := lastResponse(rec.body.Bytes()); response != nil {
+			return response
+		}
+	} else if rec.status == http.StatusOK && json.Valid(rec.body.Bytes()) {
+		return bytes.TrimSpace(rec.body.Bytes())
+	}
+
+	text := strings.TrimSpace(rec.body.String())
+	if text == "" {
+		text = http.StatusText(rec.status)
+	}
+	return batchError(entry.ID, mcp.INVALID_REQUEST, text)
+}
+
+// lastResponse finds the response among the events of a request that was
+// answered as an event stream, skipping the notifications sent before it
+func lastResponse(stream []byte) json.RawMessage {
+	var response json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var message struct {
+			ID     *mcp.RequestId  `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		data = strings.TrimSpace(data)
+		if json.Unmarshal([]byte(data), &message) == nil && message.ID != nil && (message.Result != nil || message.Error != nil) {
+			response = json.RawMessage(data)
+		}
+	}
+	return response
+}
+
+// batchError builds the error object answering a batched message
+func batchError(id *mcp.RequestId, code int, message string) json.RawMessage {
+	requestID := mcp.NewRequestId(nil)
+	if id != nil {
+		requestID = *id
+	}
+	data, _ := json.Marshal(mcp.NewJSONRPCError(requestID, code, message, nil))
+	return data
+}
+
+// batchRecorder captures the response to one batched message
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (b *batchRecorder) Header() http.Header {
+	return b.header
+}
+
+func (b *batchRecorder) WriteHeader(status int) {
+	if !b.wrote {
+		b.status = status
+		b.wrote = true
+	}
+}
+
+func (b *batchRecorder) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
+
+// Flush is a no-op: the batch is answered once every message is done
+func (b *batchRecorder) Flush() {}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mcp-terminal-server/internal/config"
+)
+
+// incompressibleTypes are content types that are streamed or already
+// compressed, and are sent as they are
+var incompressibleTypes = []string{
+	"text/event-stream",
+	"image/",
+	"audio/",
+	"video/",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-xz",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/vnd.rar",
+}
+
+// gzipWriters reuses compressors, which allocate large tables on first use
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// Compress gzips responses for clients that accept it once they reach
+// minBytes, so large command output and file downloads are not sent as
+// single uncompressed bodies. Compressed responses have no Content-Length and
+// are streamed in chunks as the handler writes them. Event streams, partial
+// content and already compressed types are passed through.
+func Compress(cfg *config.Config, next http.Handler) http.Handler {
+	if !cfg.HTTPCompress {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, minBytes: cfg.HTTPCompressMinBytes}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// to compress it: until minBytes have been written, the handler flushes, or
+// the headers show the response is not worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	minBytes int
+	status   int
+	buf      []byte
+	// started is set once the status and headers have been sent, and gz
+	// then when the body is compressed
+	started bool
+	gz      *gzip.Writer
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.started || c.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		// Informational responses go out as they are
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+	if !c.compressible() {
+		c.start(false)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.started {
+		if !c.compressible() {
+			c.start(false)
+		} else {
+			c.buf = append(c.buf, p...)
+			if len(c.buf) >= c.minBytes {
+				if err := c.start(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(p), nil
+		}
+	}
+
+	if c.gz != nil {
+		return c.gz.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far. A response still short of
+// minBytes is sent uncompressed, as the handler is streaming.
+func (c *compressWriter) Flush() {
+	if !c.started {
+		if c.status == 0 {
+			c.WriteHeader(http.StatusOK)
+		}
+		if !c.started {
+			c.start(c.compressible() && len(c.buf) >= c.minBytes)
+		}
+	}
+	if c.gz != nil {
+		c.gz.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// compressible reports whether the response, going by its status and
+// headers, may be compressed
+func (c *compressWriter) compressible() bool {
+	switch c.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// start sends the status and headers, and the body held back so far
+func (c *compressWriter) start(compress bool) error {
+	c.started = true
+	header := c.Header()
+	if compress {
+		if header.Get("Content-Type") == "" {
+			// Sniffing would see the compressed bytes
+			header.Set("Content-Type", http.DetectContentType(c.buf))
+		}
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		c.gz = gzipWriters.Get().(*gzip.Writer)
+		c.gz.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.gz != nil {
+		_, err := c.gz.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// close sends a response that stayed short of minBytes and finishes a
+// compressed one
+func (c *compressWriter) close() {
+	if !c.started && c.status != 0 {
+		c.start(false)
+	}
+	if c.gz != nil {
+		c.gz.Close()
+		c.gz.Reset(io.Discard)
+		gzipWriters.Put(c.gz)
+		c.gz = nil
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/host"
+	"mcp-terminal-server/internal/schedule"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/sse"
+)
+
+const (
+	// dashboardEvents is how many recent events the dashboard keeps
+	dashboardEvents = 100
+	// defaultDashboardEvents is how many of them a snapshot includes unless
+	// the client asks for another number
+	defaultDashboardEvents = 20
+)
+
+// recentEvent is an event of a session or scheduled job as the dashboard shows it
+type recentEvent struct {
+	Time  time.Time   `json:"time"`
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data"`
+}
+
+// dashboardJob is a scheduled command that has yet to finish
+type dashboardJob struct {
+	ID      string     `json:"id"`
+	Command string     `json:"command"`
+	Cron    string     `json:"cron,omitempty"`
+	Owner   string     `json:"owner"`
+	State   string     `json:"state"`
+	Next    *time.Time `json:"next,omitempty"`
+	Runs    int        `json:"runs"`
+}
+
+// DashboardHandler serves a snapshot of everything happening on the server,
+// so a UI can refresh with one request instead of several
+type DashboardHandler struct {
+	sessions  *session.Manager
+	scheduler *schedule.Scheduler
+	dir       string
+	started   time.Time
+
+	mu sync.Mutex
+	// recent holds the latest events, oldest first
+	recent []recentEvent
+}
+
+// NewDashboardHandler creates the dashboard handler, which starts following
+// the events of sessions and scheduled jobs right away
+func NewDashboardHandler(cfg *config.Config, sessions *session.Manager, scheduler *schedule.Scheduler) *DashboardHandler {
+	dir := cfg.Workspace
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	h := &DashboardHandler{
+		sessions:  sessions,
+		scheduler: scheduler,
+		dir:       dir,
+		started:   time.Now(),
+	}
+
+	// Only the latest events are shown, and a disconnect would end the follow
+	sessionEvents, _ := sessions.Subscribe(sse.Subscription{Policy: sse.DropOldest})
+	go h.follow(sessionEvents)
+	jobEvents, _ := scheduler.Subscribe(sse.Subscription{Policy: sse.DropOldest})
+	go h.follow(jobEvents)
+	return h
+}
+
+// follow records events as they are published. Output is left out, as a
+// busy session would push everything else out of the list.
+func (h *DashboardHandler) follow(ch <-chan sse.Event) {
+	for event := range ch {
+		if event.Type == events.TypeOutput {
+			continue
+		}
+		h.mu.Lock()
+		if len(h.recent) == dashboardEvents {
+			h.recent = h.recent[1:]
+		}
+		h.recent = append(h.recent, recentEvent{Time: time.Now().UTC(), Topic: event.Topic, Type: event.Type, Data: event.Data})
+		h.mu.Unlock()
+	}
+}
+
+// Snapshot handles GET /dashboard[?events=N]: the state of every session,
+// the scheduled jobs still to run, the last N events (default 20, at most
+// 100) and the load on the host
+func (h *DashboardHandler) Snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	limit := defaultDashboardEvents
+	if value := r.URL.Query().Get("events"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "events must be a number of events")
+			return
+		}
+		limit = min(n, dashboardEvents)
+	}
+
+	h.mu.Lock()
+	recent := append([]recentEvent{}, h.recent[max(0, len(h.recent)-limit):]...)
+	h.mu.Unlock()
+
+	jobs := []dashboardJob{}
+	for _, j := range h.scheduler.List("", true) {
+		if j.State != schedule.StateScheduled && j.State != schedule.StateRunning {
+			continue
+		}
+		job := dashboardJob{ID: j.ID, Command: j.Command, Cron: j.Cron, Owner: j.Owner, State: j.State, Runs: j.Runs}
+		if !j.Next.IsZero() {
+			job.Next = &j.Next
+		}
+		jobs = append(jobs, job)
+	}
+
+	problems := health.Degraded()
+	status := "ok"
+	switch {
+	case health.Blocked():
+		status = "unavailable"
+	case len(problems) > 0:
+		status = "degraded"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"time":           time.Now().UTC(),
+		"status":         status,
+		"uptime_seconds": int(time.Since(h.started).Seconds()),
+		"degraded":       problems,
+		"host":           host.Read(h.dir),
+		"sessions":       h.sessions.Summaries(),
+		"jobs":           jobs,
+		"events":         recent,
+	})
+}
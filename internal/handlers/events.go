@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mcp-terminal-server/internal/events"
+)
+
+// EventSchema handles GET /events/schema, the JSON Schema of every event payload
+func EventSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, events.Schema())
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/files"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+)
+
+// FileHandler serves streaming uploads and downloads with the same path
+// restrictions as the file tools. A request naming an MCP session in its
+// Mcp-Session-Id header is made under that client's profile, as its user.
+type FileHandler struct {
+	files          *files.Service
+	policy         *policy.Engine
+	profiles       *profiles.Store
+	maxUploadBytes int64
+}
+
+// NewFileHandler creates the upload/download handler
+func NewFileHandler(svc *files.Service, policyEngine *policy.Engine, profileStore *profiles.Store, maxUploadBytes int64) *FileHandler {
+	return &FileHandler{
+		files:          svc,
+		policy:         policyEngine,
+		profiles:       profileStore,
+		maxUploadBytes: maxUploadBytes,
+	}
+}
+
+// allowed checks that the caller's role, and the restrictions of its
+// profile, permit tool, writing an error response if not
+func (h *FileHandler) allowed(ctx context.Context, w http.ResponseWriter, tool string) bool {
+	d := h.policy.Evaluate(policy.Request{Tool: tool, Role: access.IdentityFrom(ctx).Role, Restrictions: profiles.Restrictions(ctx)})
+	if !d.Allowed {
+		writeError(w, http.StatusForbidden, "denied by policy: "+d.Reason)
+	}
+	return d.Allowed
+}
+
+// Upload handles POST/PUT /files/upload?path=...[&create_dirs=true].
+// The body is either the raw file content or a multipart form whose first file
+// part is stored; in the multipart case a path ending in "/" names a directory
+// and the part's filename is appended.
+func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "use POST or PUT")
+		return
+	}
+
+	target := r.URL.Query().Get("path")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	createDirs := r.URL.Query().Get("create_dirs") == "true"
+
+	// Uploads are writes, so the caller must be allowed write_file
+	ctx := h.profiles.RequestContext(r)
+	if !h.allowed(ctx, w, "write_file") {
+		return
+	}
+
+	if h.maxUploadBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadBytes)
+	}
+
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid multipart body: %v", err))
+			return
+		}
+
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "multipart body contains no file")
+				return
+			}
+			if part.FileName() != "" {
+				if strings.HasSuffix(target, "/") {
+					target += path.Base(part.FileName())
+				}
+				body = part
+				break
+			}
+		}
+	}
+
+	n, err := h.files.As(profiles.User(ctx)).WriteFrom(target, body, createDirs)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeFileError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":  target,
+		"bytes": n,
+	})
+}
+
+// Download handles GET /files/download?path=..., supporting range requests
+func (h *FileHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	target := r.URL.Query().Get("path")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+
+	ctx := h.profiles.RequestContext(r)
+	if !h.allowed(ctx, w, "read_file") {
+		return
+	}
+
+	f, info, err := h.files.As(profiles.User(ctx)).Open(target)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// writeFileError maps file service errors to HTTP statuses
+func writeFileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, files.ErrAccessDenied), errors.Is(err, os.ErrPermission):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
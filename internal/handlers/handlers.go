@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mcp-terminal-server/internal/artifact"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/auth"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/files"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/ratelimit"
+	"mcp-terminal-server/internal/receipt"
+	"mcp-terminal-server/internal/schedule"
+	"mcp-terminal-server/internal/session"
+)
+
+// New builds the HTTP handler serving the MCP endpoint and any auxiliary endpoints
+func New(cfg *config.Config, sessions *session.Manager, policyEngine *policy.Engine, auditLog *audit.Log, scheduler *schedule.Scheduler, receipts *receipt.Signer, profileStore *profiles.Store, mcpHandler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", Batch(mcpHandler))
+
+	fileHandler := NewFileHandler(files.New(cfg), policyEngine, profileStore, cfg.FileMaxUploadBytes)
+	mux.HandleFunc("/files/upload", fileHandler.Upload)
+	mux.HandleFunc("/files/download", fileHandler.Download)
+
+	artifactHandler := NewArtifactHandler(artifact.New(cfg))
+	mux.HandleFunc("/artifacts", artifactHandler.Download)
+	mux.HandleFunc("/artifacts/{id}", artifactHandler.Download)
+
+	observeHandler := NewObserveHandler(sessions, policyEngine, auditLog, cfg.DefaultTimeout)
+	mux.HandleFunc("/sessions/observe", observeHandler.Stream)
+	mux.HandleFunc("/sessions/history", observeHandler.History)
+	mux.HandleFunc("/sessions/control", observeHandler.Control)
+	mux.HandleFunc("/sessions/input", observeHandler.Input)
+	mux.HandleFunc("/sessions/annotate", observeHandler.Annotate)
+	mux.HandleFunc("/sessions/report", observeHandler.Report)
+
+	mux.HandleFunc("/events/schema", EventSchema)
+
+	scheduleHandler := NewScheduleHandler(scheduler)
+	mux.HandleFunc("/schedule/events", RequireAdmin(cfg.AdminToken, scheduleHandler.Stream))
+
+	policyHandler := NewPolicyHandler(policyEngine)
+	mux.HandleFunc("/policy/simulate", policyHandler.Simulate)
+
+	receiptHandler := NewReceiptHandler(receipts)
+	mux.HandleFunc("/receipts/key", receiptHandler.Key)
+	mux.HandleFunc("/receipts/verify", receiptHandler.Verify)
+
+	auditHandler := NewAuditHandler(auditLog)
+	mux.HandleFunc("/audit/verify", RequireAdmin(cfg.AdminToken, auditHandler.Verify))
+	mux.HandleFunc("/metrics", RequireAdmin(cfg.AdminToken, Metrics))
+	mux.HandleFunc("/metrics/prometheus", RequireAdmin(cfg.AdminToken, SessionMetrics(sessions)))
+
+	dashboardHandler := NewDashboardHandler(cfg, sessions, scheduler)
+	mux.HandleFunc("/dashboard", RequireAdmin(cfg.AdminToken, dashboardHandler.Snapshot))
+
+	// Clients are authenticated after the rate limit, so floods do not reach the hook
+	handler := Authenticate(auth.New(cfg), mux)
+	if cfg.HTTPRateLimit > 0 {
+		handler = RateLimit(ratelimit.NewTokenBucket(cfg.HTTPRateLimit, cfg.HTTPRateBurst), handler)
+	}
+
+	// Probes bypass the rate limit so a busy server is not restarted by its orchestrator
+	root := http.NewServeMux()
+	healthHandler := NewHealthHandler(cfg.Shell, sessions)
+	root.HandleFunc("GET /healthz", healthHandler.Healthz)
+	root.HandleFunc("GET /readyz", healthHandler.Readyz)
+	root.Handle("/", handler)
+
+	// Preflight requests are answered before reaching the rate limiter or endpoints
+	return Log(Trace(Deadline(cfg.HTTPMaxRequestDuration, cfg.KillGracePeriod, CORS(cfg, Compress(cfg, root)))))
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"os/exec"
+	"time"
+
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/session"
+)
+
+// HealthHandler serves liveness and readiness probes
+type HealthHandler struct {
+	shell    string
+	sessions *session.Manager
+	started  time.Time
+}
+
+// NewHealthHandler creates the probe handler
+func NewHealthHandler(shell string, sessions *session.Manager) *HealthHandler {
+	return &HealthHandler{
+		shell:    shell,
+		sessions: sessions,
+		started:  time.Now(),
+	}
+}
+
+// report describes the server's state for both probes
+func (h *HealthHandler) report() (map[string]interface{}, bool) {
+	shellPath, shellErr := exec.LookPath(h.shell)
+	problems := health.Degraded()
+
+	blocked := health.Blocked()
+	status := "ok"
+	switch {
+	case shellErr != nil || blocked:
+		status = "unavailable"
+	case len(problems) > 0:
+		status = "degraded"
+	}
+
+	shell := map[string]interface{}{
+		"name":      h.shell,
+		"available": shellErr == nil,
+	}
+	if shellErr != nil {
+		shell["error"] = shellErr.Error()
+	} else {
+		shell["path"] = shellPath
+	}
+
+	return map[string]interface{}{
+		"status":          status,
+		"uptime_seconds":  int(time.Since(h.started).Seconds()),
+		"shell":           shell,
+		"active_sessions": h.sessions.Count(),
+		"degraded":        problems,
+	}, shellErr == nil && !blocked
+}
+
+// Healthz handles GET /healthz. It answers 200 while the process is serving
+// requests; the body reports the same details as /readyz.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	report, _ := h.report()
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Readyz handles GET /readyz. It answers 503 when commands cannot be run
+// because the configured shell is missing, or while a required backend is
+// unreachable; a degraded server is still ready.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report, ready := h.report()
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
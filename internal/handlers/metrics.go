@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"mcp-terminal-server/internal/metrics"
+	"mcp-terminal-server/internal/session"
+)
+
+// Metrics handles GET /metrics, the command statistics of the last hour for
+// the whole server and each session
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, metrics.Snapshot(nil))
+}
+
+// sessionMetric is one per-session series family of /metrics/prometheus
+type sessionMetric struct {
+	name, kind, help string
+	// value returns the session's sample, or false to leave the session out
+	value func(session.Usage) (float64, bool)
+}
+
+var sessionMetrics = []sessionMetric{
+	{"mcp_session_commands_total", "counter", "Commands run in the session.", func(u session.Usage) (float64, bool) {
+		return float64(u.Commands), true
+	}},
+	{"mcp_session_command_seconds_total", "counter", "Wall-clock time the session's commands ran.", func(u session.Usage) (float64, bool) {
+		return u.WallTime.Seconds(), true
+	}},
+	{"mcp_session_cpu_seconds_total", "counter", "CPU time of the session's shells and everything they started.", func(u session.Usage) (float64, bool) {
+		return u.CPUTime.Seconds(), true
+	}},
+	{"mcp_session_output_bytes_total", "counter", "Bytes of output the session's commands produced.", func(u session.Usage) (float64, bool) {
+		return float64(u.OutputBytes), true
+	}},
+	{"mcp_session_last_failure_exit_code", "gauge", "Exit code of the session's latest command that exited non-zero (-1 for a timeout).", func(u session.Usage) (float64, bool) {
+		if u.LastFailure == nil {
+			return 0, false
+		}
+		return float64(u.LastFailure.ExitCode), true
+	}},
+	{"mcp_session_last_failure_timestamp_seconds", "gauge", "When the session's latest command that exited non-zero finished.", func(u session.Usage) (float64, bool) {
+		if u.LastFailure == nil {
+			return 0, false
+		}
+		return float64(u.LastFailure.Finished.UnixMilli()) / 1000, true
+	}},
+}
+
+// labelEscaper escapes label values for the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// SessionMetrics returns the handler of GET /metrics/prometheus, the resource
+// usage of each session in the Prometheus text format, so operators can alert
+// on runaway sessions
+func SessionMetrics(sessions *session.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+
+		usage := sessions.Usage()
+		ids := make([]string, 0, len(usage))
+		for id := range usage {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "# HELP mcp_sessions Open sessions.\n# TYPE mcp_sessions gauge\nmcp_sessions %d\n", len(ids))
+		for _, m := range sessionMetrics {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+			for _, id := range ids {
+				if value, ok := m.value(usage[id]); ok {
+					fmt.Fprintf(&b, "%s{session=\"%s\"} %g\n", m.name, labelEscaper.Replace(id), value)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(b.String()))
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"mcp-terminal-server/internal/deadline"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/ratelimit"
+	"mcp-terminal-server/internal/tracing"
+)
+
+// RateLimit rejects requests exceeding the per-client token bucket with 429 and a JSON body
+func RateLimit(limiter *ratelimit.TokenBucket, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if busy := limiter.Allow(clientIP(r)); busy != nil {
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(busy.RetryAfter.Seconds())))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, busy.JSON())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the remote address of the request without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Log records each request at debug level
+func Log(next http.Handler) http.Handler {
+	logger := logging.For("http")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		logger.Debug("Handled request", "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"client", clientIP(r), "duration_ms", time.Since(started).Milliseconds())
+	})
+}
+
+// streams are the paths whose GET requests are long-lived event streams
+var streams = map[string]bool{
+	"/mcp":              true,
+	"/sessions/observe": true,
+	"/schedule/events":  true,
+}
+
+// resultGrace is the time a request has past its maximum duration to stop its
+// commands and answer with their partial output
+const resultGrace = 5 * time.Second
+
+// Deadline bounds the work on each request to maxDuration through its
+// context, which the commands it runs inherit (0 = unbounded). Commands are
+// given killGrace on top to exit. Event streams are left to run until the
+// client goes away, and exempt from the server's write timeout.
+func Deadline(maxDuration, killGrace time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && streams[r.URL.Path] {
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if maxDuration <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := deadline.With(r.Context(), maxDuration, killGrace+resultGrace)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Trace wraps each request in a span, continuing any trace propagated by the client
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", clientIP(r)),
+			))
+		defer span.End()
+
+		if sessionID := r.Header.Get("Mcp-Session-Id"); sessionID != "" {
+			span.SetAttributes(attribute.String("mcp.transport.session.id", sessionID))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// statusRecorder captures the response status while still supporting streaming
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/report"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/sse"
+)
+
+// maxInputBytes caps the size of a command sent by an operator
+const maxInputBytes = 64 << 10
+
+// ObserveHandler gives observers access to a session's live output and
+// history, and lets operators take turns with the agent in controlling it.
+// Both are identified by the token from the session_manager 'observe' action;
+// observers can never send input.
+type ObserveHandler struct {
+	sessions       *session.Manager
+	policy         *policy.Engine
+	audit          *audit.Log
+	defaultTimeout time.Duration
+}
+
+// NewObserveHandler creates the observer handler
+func NewObserveHandler(sessions *session.Manager, policyEngine *policy.Engine, auditLog *audit.Log, defaultTimeout time.Duration) *ObserveHandler {
+	return &ObserveHandler{
+		sessions:       sessions,
+		policy:         policyEngine,
+		audit:          auditLog,
+		defaultTimeout: defaultTimeout,
+	}
+}
+
+// Stream handles GET /sessions/observe?token=...[&sessions=a,b|*][&types=output,exit][&lag_policy=...],
+// streaming session events. Several comma-separated tokens may be given to
+// follow their sessions together; a token granting every session follows all
+// of them. sessions narrows the stream and types limits it to some event types.
+// lag_policy overrides what happens when the client falls behind.
+// A reconnecting client's Last-Event-ID header (or last_event_id parameter)
+// replays what it missed. Streams of several sessions wrap each event as
+// {"topic": session ID, "data": ...}.
+func (h *ObserveHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	query := r.URL.Query()
+	sessions, err := h.sessions.Scope(splitList(query.Get("token")), splitList(query.Get("sessions")))
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	policy, err := lagPolicy(query.Get("lag_policy"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sub := sse.Subscription{Topics: sessions, Types: splitList(query.Get("types")), Policy: policy}
+
+	// A single session keeps the plain event format
+	if len(sessions) == 1 {
+		sub.Cursor = sse.ParseCursor(sse.LastEventID(r), sessions[0])
+		events, unsubscribe := h.sessions.Subscribe(sub)
+		defer unsubscribe()
+
+		sse.Serve(w, r, events, nil)
+		return
+	}
+
+	sub.Cursor = sse.ParseCursor(sse.LastEventID(r), "")
+	events, unsubscribe := h.sessions.Subscribe(sub)
+	defer unsubscribe()
+
+	cursor := sub.Cursor
+	if cursor == nil {
+		cursor = sse.Cursor{}
+	}
+	sse.Serve(w, r, events, cursor)
+}
+
+// splitList splits a comma-separated query parameter, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// lagPolicy reads a stream's lag_policy parameter; "" keeps the server's
+func lagPolicy(value string) (sse.Policy, error) {
+	if value == "" {
+		return "", nil
+	}
+	return sse.ParsePolicy(value)
+}
+
+// History handles GET /sessions/history?token=...[&from=N&limit=N], returning
+// the session's recorded commands with their output
+func (h *ObserveHandler) History(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	s, _, err := h.sessions.ObservedSession(r.URL.Query().Get("token"))
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	entries, more := s.Transcript.Page(from, limit)
+
+	commands := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		command := map[string]interface{}{
+			"seq":         e.Seq,
+			"command":     e.Command,
+			"output":      e.Output,
+			"exit_code":   e.ExitCode,
+			"timed_out":   e.TimedOut,
+			"started":     e.Started.Format(time.RFC3339Nano),
+			"duration_ms": e.Duration().Milliseconds(),
+		}
+		if len(e.LineOffsets) > 0 {
+			offsets := make([]int64, len(e.LineOffsets))
+			for i, offset := range e.LineOffsets {
+				offsets[i] = offset.Milliseconds()
+			}
+			command["line_offsets_ms"] = offsets
+		}
+		commands = append(commands, command)
+	}
+
+	notes := make([]map[string]interface{}, 0)
+	for _, n := range s.Transcript.Notes() {
+		notes = append(notes, map[string]interface{}{
+			"after":  n.After,
+			"author": n.Author,
+			"text":   n.Text,
+			"time":   n.Time.Format(time.RFC3339Nano),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"session_id": s.ID,
+		"shell":      s.Shell,
+		"commands":   commands,
+		"notes":      notes,
+		"more":       more,
+	})
+}
+
+// Report handles GET /sessions/report?token=...[&format=markdown|html],
+// returning the session compiled into a shareable report
+func (h *ObserveHandler) Report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	s, _, err := h.sessions.ObservedSession(r.URL.Query().Get("token"))
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	rep, err := h.sessions.Report(s.ID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	text, err := rep.Render(format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if format == report.FormatHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	}
+	io.WriteString(w, text)
+}
+
+// Annotate handles POST /sessions/annotate?token=...[&seq=N][&author=name],
+// attaching the request body as a note after command N (default the latest).
+// Both observers and operators may annotate, since notes never reach the shell.
+func (h *ObserveHandler) Annotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	s, role, err := h.sessions.ObservedSession(r.URL.Query().Get("token"))
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInputBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "note text is required")
+		return
+	}
+
+	after := -1
+	if seq, err := strconv.Atoi(r.URL.Query().Get("seq")); err == nil && seq >= 0 {
+		after = seq
+	}
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		author = role
+	}
+
+	note, err := h.sessions.Annotate(s.ID, after, author, text)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"session_id": s.ID,
+		"after":      note.After,
+		"author":     note.Author,
+	})
+}
+
+// Control handles POST /sessions/control?token=...&action=request|take|release
+// for operators. 'request' asks the agent to hand over control, 'take'
+// overrides it and 'release' hands control back to the agent.
+func (h *ObserveHandler) Control(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	s, ok := h.operatorSession(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	action := r.URL.Query().Get("action")
+	switch action {
+	case "request":
+		_, err = h.sessions.RequestControl(s.ID, session.ControllerOperator)
+	case "take":
+		err = h.sessions.TakeControl(s.ID)
+	case "release":
+		err = h.sessions.ReleaseControl(s.ID, session.ControllerOperator)
+	default:
+		writeError(w, http.StatusBadRequest, "action must be request, take or release")
+		return
+	}
+	if err != nil {
+		h.audit.Append(audit.ActorOperator, action+"_control", s.ID, "error", map[string]interface{}{"error": err.Error()})
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	h.audit.Append(audit.ActorOperator, action+"_control", s.ID, "ok", nil)
+
+	holder, requested, err := h.sessions.Controller(s.ID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"session_id": s.ID,
+		"controller": holder,
+		"requested":  requested,
+	})
+}
+
+// Input handles POST /sessions/input?token=...[&timeout=seconds], running the
+// request body as a command in the session on behalf of an operator holding control
+func (h *ObserveHandler) Input(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	s, ok := h.operatorSession(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInputBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	command := strings.TrimSpace(string(body))
+	if command == "" {
+		writeError(w, http.StatusBadRequest, "command is required")
+		return
+	}
+
+	decision := h.policy.Evaluate(policy.Request{Tool: "persistent_shell", Command: command, Role: session.RoleOperator, Target: s.ID})
+	if !decision.Allowed {
+		h.audit.Append(audit.ActorOperator, "input", s.ID, "denied", map[string]interface{}{"command": command, "reason": decision.Reason})
+		writeJSON(w, http.StatusForbidden, decision)
+		return
+	}
+
+	timeout := h.defaultTimeout
+	if seconds, err := strconv.Atoi(r.URL.Query().Get("timeout")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	result, err := h.sessions.ExecuteCommand(r.Context(), s.ID, command, timeout, session.Options{Controller: session.ControllerOperator}, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var text strings.Builder
+	for _, content := range result.Content {
+		if tc, ok := content.(mcp.TextContent); ok {
+			text.WriteString(tc.Text)
+		}
+	}
+
+	status, outcome := http.StatusOK, "ok"
+	if result.IsError {
+		status, outcome = http.StatusConflict, "error"
+	}
+	h.audit.Append(audit.ActorOperator, "input", s.ID, outcome, map[string]interface{}{"command": command})
+	writeJSON(w, status, map[string]interface{}{
+		"session_id": s.ID,
+		"result":     text.String(),
+		"is_error":   result.IsError,
+	})
+}
+
+// operatorSession resolves the request's token, writing an error response
+// unless it grants the operator role
+func (h *ObserveHandler) operatorSession(w http.ResponseWriter, r *http.Request) (*session.ShellSession, bool) {
+	s, role, err := h.sessions.ObservedSession(r.URL.Query().Get("token"))
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return nil, false
+	}
+	if role != session.RoleOperator {
+		writeError(w, http.StatusForbidden, "observer tokens are read-only")
+		return nil, false
+	}
+	return s, true
+}
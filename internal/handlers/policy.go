@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"mcp-terminal-server/internal/policy"
+)
+
+// PolicyHandler lets operators test commands against the policy
+type PolicyHandler struct {
+	engine *policy.Engine
+}
+
+// NewPolicyHandler creates the policy simulation handler
+func NewPolicyHandler(engine *policy.Engine) *PolicyHandler {
+	return &PolicyHandler{engine: engine}
+}
+
+// Simulate handles POST /policy/simulate with a JSON body
+// {"command": "...", "tool": "...", "role": "...", "session_id": "...", "cwd": "...", "confirm": false, "at": "<RFC 3339>"},
+// returning the decision and its full trace without running anything. "at"
+// checks the maintenance windows for another time than now.
+func (h *PolicyHandler) Simulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+
+	var req struct {
+		Command   string    `json:"command"`
+		Tool      string    `json:"tool"`
+		Role      string    `json:"role"`
+		SessionID string    `json:"session_id"`
+		Cwd       string    `json:"cwd"`
+		Confirm   bool      `json:"confirm"`
+		At        time.Time `json:"at"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInputBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.Command == "" {
+		writeError(w, http.StatusBadRequest, "command is required")
+		return
+	}
+	if req.Tool == "" {
+		req.Tool = "execute_command"
+	}
+
+	writeJSON(w, http.StatusOK, h.engine.Evaluate(policy.Request{Tool: req.Tool, Command: req.Command, Role: req.Role, Target: req.SessionID, Cwd: req.Cwd, Confirmed: req.Confirm, At: req.At}))
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"mcp-terminal-server/internal/receipt"
+)
+
+// maxReceiptBytes bounds a verification request, which may carry a whole
+// command result
+const maxReceiptBytes = 16 << 20
+
+// ReceiptHandler lets downstream systems check the receipts in command results
+type ReceiptHandler struct {
+	signer *receipt.Signer
+}
+
+// NewReceiptHandler creates the receipt handler
+func NewReceiptHandler(signer *receipt.Signer) *ReceiptHandler {
+	return &ReceiptHandler{signer: signer}
+}
+
+// Key handles GET /receipts/key, returning the public key receipts are signed
+// with, so they can be verified without asking the server
+func (h *ReceiptHandler) Key(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	if h.signer == nil {
+		writeError(w, http.StatusNotFound, "receipts are disabled; set MCP_RECEIPT_KEY_FILE")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"algorithm":  receipt.Algorithm,
+		"key_id":     h.signer.KeyID(),
+		"public_key": h.signer.PublicKey(),
+	})
+}
+
+// Verify handles POST /receipts/verify with a JSON body
+// {"receipt": {...}, "text": "..."}, where receipt is the one from a result's
+// _meta and the optional text is the result's text. It responds 200 with the
+// receipt's claims when the server signed it for that text, and 422 otherwise.
+func (h *ReceiptHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if h.signer == nil {
+		writeError(w, http.StatusNotFound, "receipts are disabled; set MCP_RECEIPT_KEY_FILE")
+		return
+	}
+
+	var req struct {
+		Receipt receipt.Receipt `json:"receipt"`
+		Text    *string         `json:"text"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReceiptBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	claims, err := h.signer.Verify(req.Receipt, req.Text)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"valid": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"valid": true, "claims": claims})
+}
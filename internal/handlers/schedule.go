@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"mcp-terminal-server/internal/schedule"
+	"mcp-terminal-server/internal/sse"
+)
+
+// ScheduleHandler streams the results of scheduled commands
+type ScheduleHandler struct {
+	scheduler *schedule.Scheduler
+}
+
+// NewScheduleHandler creates the scheduler handler
+func NewScheduleHandler(scheduler *schedule.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{scheduler: scheduler}
+}
+
+// Stream handles GET /schedule/events[?jobs=job-1,job-2][&lag_policy=...],
+// streaming a scheduled_run event each time a scheduled command runs. Events
+// are wrapped as {"topic": job ID, "data": ...}, and a reconnecting client's
+// Last-Event-ID header (or last_event_id parameter) replays what it missed.
+func (h *ScheduleHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	policy, err := lagPolicy(r.URL.Query().Get("lag_policy"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sub := sse.Subscription{
+		Topics: splitList(r.URL.Query().Get("jobs")),
+		Cursor: sse.ParseCursor(sse.LastEventID(r), ""),
+		Policy: policy,
+	}
+	events, unsubscribe := h.scheduler.Subscribe(sub)
+	defer unsubscribe()
+
+	cursor := sub.Cursor
+	if cursor == nil {
+		cursor = sse.Cursor{}
+	}
+	sse.Serve(w, r, events, cursor)
+}
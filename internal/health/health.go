@@ -0,0 +1,76 @@
+package health
+
+import (
+	"sort"
+	"sync"
+)
+
+// Components report degraded states here so the health endpoints can surface
+// them. A degraded server still serves requests, but with reduced function,
+// e.g. a default that failed to load and was ignored. A component that is
+// unavailable, such as a required backend that cannot be reached, makes the
+// server not ready.
+var (
+	mu       sync.RWMutex
+	degraded = make(map[string]Problem)
+)
+
+// Problem is one degraded component and why
+type Problem struct {
+	Component string `json:"component"`
+	Reason    string `json:"reason"`
+	// Blocking is set when the problem keeps the server from being ready
+	Blocking bool `json:"blocking,omitempty"`
+}
+
+// SetDegraded records that component is degraded, replacing any earlier reason
+func SetDegraded(component, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	degraded[component] = Problem{Component: component, Reason: reason}
+}
+
+// SetUnavailable records that component is unavailable, which keeps the
+// server from being ready until it is cleared
+func SetUnavailable(component, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	degraded[component] = Problem{Component: component, Reason: reason, Blocking: true}
+}
+
+// Clear records that component has recovered
+func Clear(component string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(degraded, component)
+}
+
+// Degraded returns the currently degraded components, ordered by name
+func Degraded() []Problem {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	problems := make([]Problem, 0, len(degraded))
+	for _, problem := range degraded {
+		problems = append(problems, problem)
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Component < problems[j].Component })
+
+	return problems
+}
+
+// Blocked reports whether an unavailable component keeps the server from being ready
+func Blocked() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, problem := range degraded {
+		if problem.Blocking {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package host
+
+import (
+	"os"
+	"runtime"
+)
+
+// Stats describes the load on the machine the server runs on. Figures the
+// platform does not expose are left zero.
+type Stats struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	CPUs     int    `json:"cpus"`
+	// Load is the 1, 5 and 15 minute load average
+	Load                 []float64 `json:"load,omitempty"`
+	MemoryTotalBytes     int64     `json:"memory_total_bytes,omitempty"`
+	MemoryAvailableBytes int64     `json:"memory_available_bytes,omitempty"`
+	// Disk figures are those of the filesystem holding the directory asked about
+	DiskTotalBytes int64 `json:"disk_total_bytes,omitempty"`
+	DiskFreeBytes  int64 `json:"disk_free_bytes,omitempty"`
+	UptimeSeconds  int64 `json:"uptime_seconds,omitempty"`
+}
+
+// Read returns the current stats, with the disk figures of the filesystem
+// holding dir
+func Read(dir string) Stats {
+	stats := Stats{OS: runtime.GOOS, CPUs: runtime.NumCPU()}
+	stats.Hostname, _ = os.Hostname()
+	read(&stats, dir)
+	return stats
+}
@@ -0,0 +1,50 @@
+package host
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// read fills in the figures Linux exposes in /proc and through statfs
+func read(stats *Stats, dir string) {
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil && len(strings.Fields(string(data))) >= 3 {
+		for _, field := range strings.Fields(string(data))[:3] {
+			load, _ := strconv.ParseFloat(field, 64)
+			stats.Load = append(stats.Load, load)
+		}
+	}
+
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			switch fields[0] {
+			case "MemTotal:":
+				stats.MemoryTotalBytes = kb * 1024
+			case "MemAvailable:":
+				stats.MemoryAvailableBytes = kb * 1024
+			}
+		}
+		f.Close()
+	}
+
+	if data, err := os.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			uptime, _ := strconv.ParseFloat(fields[0], 64)
+			stats.UptimeSeconds = int64(uptime)
+		}
+	}
+
+	var fs syscall.Statfs_t
+	if syscall.Statfs(dir, &fs) == nil {
+		stats.DiskTotalBytes = int64(fs.Blocks) * int64(fs.Bsize)
+		stats.DiskFreeBytes = int64(fs.Bavail) * int64(fs.Bsize)
+	}
+}
@@ -0,0 +1,212 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/logging"
+)
+
+const (
+	// Param is the tool call argument carrying an idempotency key
+	Param = "request_id"
+	// Header carries an idempotency key for the tool call in an HTTP request
+	Header = "Idempotency-Key"
+	// maxEntries bounds the results kept; the oldest are forgotten first
+	maxEntries = 10000
+)
+
+// Cache keeps the results of tool calls made with an idempotency key, so a
+// call retried after a lost response gets the first result back instead of
+// running again
+type Cache struct {
+	window time.Duration
+	log    *slog.Logger
+
+	mu sync.Mutex
+	// calls maps the caller and key to the call made with them
+	calls map[string]*call
+}
+
+// call is a tool call made with an idempotency key
+type call struct {
+	// fingerprint identifies the tool and arguments, so a key reused for
+	// another call is caught
+	fingerprint string
+	at          time.Time
+	// done is closed once result is set, or once the call failed without a
+	// result and may be made again
+	done   chan struct{}
+	result *mcp.CallToolResult
+}
+
+// New creates the cache, or returns nil when idempotency keys are disabled
+func New(cfg *config.Config) *Cache {
+	if cfg.IdempotencyWindow <= 0 {
+		return nil
+	}
+	return &Cache{
+		window: cfg.IdempotencyWindow,
+		log:    logging.For("idempotency"),
+		calls:  make(map[string]*call),
+	}
+}
+
+// AddParam adds the request_id argument to a tool's input schema
+func AddParam(tool *mcp.Tool) {
+	if tool.InputSchema.Properties == nil {
+		tool.InputSchema.Properties = make(map[string]interface{})
+	}
+	tool.InputSchema.Properties[Param] = map[string]interface{}{
+		"type":        "string",
+		"description": "Idempotency key, unique per intended call (optional): retrying a call with the same key returns the first call's result instead of running it again",
+	}
+}
+
+// headerKey carries the idempotency key of an HTTP request
+type headerKey struct{}
+
+// HTTPContextFunc adds the Idempotency-Key header of an MCP request to the
+// context next returns, for the tool call it carries
+func HTTPContextFunc(next server.HTTPContextFunc) server.HTTPContextFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		ctx = next(ctx, r)
+		if key := r.Header.Get(Header); key != "" {
+			ctx = context.WithValue(ctx, headerKey{}, key)
+		}
+		return ctx
+	}
+}
+
+// ToolMiddleware returns the kept result of a call retried with the same
+// idempotency key. A retry arriving while the first call still runs waits
+// for it. Keys are scoped to the caller's identity, or to its MCP session
+// when it has none.
+func (c *Cache) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			key, _ := request.GetArguments()[Param].(string)
+			if key == "" {
+				key, _ = ctx.Value(headerKey{}).(string)
+			}
+			if c == nil || key == "" {
+				return next(ctx, request)
+			}
+
+			// Without an identity, as when no auth hook is configured, the
+			// MCP session is all that tells callers apart
+			scope := "client:" + access.Client(ctx)
+			if identity := access.IdentityFrom(ctx).Name; identity != "" {
+				scope = "identity:" + identity
+			}
+			scope += "\x00" + key
+			fingerprint := fingerprintOf(request)
+			for {
+				c.mu.Lock()
+				now := time.Now()
+				c.prune(now)
+				first, ok := c.calls[scope]
+				if !ok {
+					first = &call{fingerprint: fingerprint, at: now, done: make(chan struct{})}
+					c.calls[scope] = first
+					c.mu.Unlock()
+					return c.run(ctx, request, scope, first, next)
+				}
+				c.mu.Unlock()
+
+				if first.fingerprint != fingerprint {
+					return mcp.NewToolResultError(fmt.Sprintf("Idempotency key %q was already used for a different call %s ago; use a new key for a new call", key, now.Sub(first.at).Round(time.Second))), nil
+				}
+				select {
+				case <-first.done:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				// A first call that failed without a result is made again
+				if first.result != nil {
+					c.log.Info("Returned result of repeated call", "tool", request.Params.Name, "key", key, "first_ago", now.Sub(first.at).Round(time.Millisecond))
+					return replay(first.result), nil
+				}
+			}
+		}
+	}
+}
+
+// run makes the first call with a key and keeps its result. The result of a
+// call abandoned by its client is not kept, so a retry runs it again.
+func (c *Cache) run(ctx context.Context, request mcp.CallToolRequest, scope string, first *call, next server.ToolHandlerFunc) (*mcp.CallToolResult, error) {
+	result, err := next(ctx, request)
+	if err != nil || result == nil || ctx.Err() == context.Canceled {
+		c.mu.Lock()
+		if c.calls[scope] == first {
+			delete(c.calls, scope)
+		}
+		c.mu.Unlock()
+	} else {
+		first.result = replay(result)
+	}
+	close(first.done)
+	return result, err
+}
+
+// prune forgets calls that have left the window, and the oldest ones when
+// too many are kept. Calls still running are kept. The caller must hold c.mu.
+func (c *Cache) prune(now time.Time) {
+	for scope, kept := range c.calls {
+		if now.Sub(kept.at) >= c.window && kept.finished() {
+			delete(c.calls, scope)
+		}
+	}
+
+	for len(c.calls) >= maxEntries {
+		var oldest string
+		var oldestAt time.Time
+		for scope, kept := range c.calls {
+			if oldest == "" || kept.at.Before(oldestAt) {
+				oldest, oldestAt = scope, kept.at
+			}
+		}
+		delete(c.calls, oldest)
+	}
+}
+
+// finished reports whether the call has returned
+func (k *call) finished() bool {
+	select {
+	case <-k.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// fingerprintOf identifies a call by its tool and arguments, leaving out the
+// idempotency key itself
+func fingerprintOf(request mcp.CallToolRequest) string {
+	args := make(map[string]interface{}, len(request.GetArguments()))
+	for name, value := range request.GetArguments() {
+		if name != Param {
+			args[name] = value
+		}
+	}
+	// Maps are encoded with sorted keys, so equal arguments encode the same
+	encoded, _ := json.Marshal(args)
+	return request.Params.Name + "\x00" + string(encoded)
+}
+
+// replay copies a result, so what later middlewares change in one copy does
+// not show in the kept result or in other copies
+func replay(result *mcp.CallToolResult) *mcp.CallToolResult {
+	copied := *result
+	copied.Content = append([]mcp.Content(nil), result.Content...)
+	return &copied
+}
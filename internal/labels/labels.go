@@ -0,0 +1,68 @@
+package labels
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/shells"
+)
+
+// Environment variables that label every process the server starts, so host
+// monitoring and audit records can attribute a process to the agent request
+// that created it
+const (
+	EnvSessionID = "MCP_SESSION_ID"
+	EnvRequestID = "MCP_REQUEST_ID"
+	EnvTenant    = "MCP_TENANT"
+)
+
+// requestKey carries the ID of the tool call being handled
+type requestKey struct{}
+
+// ToolMiddleware gives every tool call a fresh request ID. It must come before
+// the middlewares that record the ID, such as tracing and auditing.
+func ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return next(context.WithValue(ctx, requestKey{}, newID()), request)
+		}
+	}
+}
+
+// RequestID returns the ID of the tool call ctx belongs to ("" outside one)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestKey{}).(string)
+	return id
+}
+
+// newID returns a random request ID
+func newID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Environ appends the labels that are set to env
+func Environ(env []string, tenant, sessionID, requestID string) []string {
+	for _, label := range []struct{ name, value string }{
+		{EnvTenant, tenant},
+		{EnvSessionID, sessionID},
+		{EnvRequestID, requestID},
+	} {
+		if label.value != "" {
+			env = append(env, label.name+"="+label.value)
+		}
+	}
+	return env
+}
+
+// Exports returns a line, in the syntax of the shell profile describes, that
+// labels the commands a running shell starts from now on. An empty request ID
+// is exported too, so a command sent without one does not inherit the
+// previous request's.
+func Exports(profile shells.Profile, sessionID, requestID string) string {
+	return profile.Export(shells.Var{Name: EnvSessionID, Value: sessionID}, shells.Var{Name: EnvRequestID, Value: requestID}) + "\n"
+}
@@ -0,0 +1,351 @@
+package limits
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+)
+
+// warnOnce keeps invalid defaults from being reported by every limiter instance
+var warnOnce sync.Once
+
+// Spec describes the resource limits applied to a spawned command or shell
+type Spec struct {
+	// IOReadBPS and IOWriteBPS cap disk throughput in bytes per second (0 = unlimited)
+	IOReadBPS  int64
+	IOWriteBPS int64
+
+	// CPUs restricts the process and its children to these CPU cores (empty = no restriction)
+	CPUs []int
+
+	// Nice is the scheduling niceness, -20 to 19 (nil = the server's own)
+	Nice *int
+	// IOClass is the IO scheduling class, one of IOClassNames (empty = the
+	// server's own), and IOPriority the level within it, 0 (highest) to 7,
+	// which the idle class has none of
+	IOClass    string
+	IOPriority int
+}
+
+// IO scheduling classes, as ionice(1) names them
+const (
+	IOClassRealtime   = "realtime"
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// IOClassNames are the IO scheduling classes a spec can ask for
+var IOClassNames = []string{IOClassRealtime, IOClassBestEffort, IOClassIdle}
+
+// HasIO reports whether an IO throughput limit was requested
+func (s Spec) HasIO() bool {
+	return s.IOReadBPS > 0 || s.IOWriteBPS > 0
+}
+
+// String describes the requested limits, or returns "" when there are none
+func (s Spec) String() string {
+	var parts []string
+	if s.HasIO() {
+		parts = append(parts, "IO limit: "+describeIO(s))
+	}
+	if len(s.CPUs) > 0 {
+		parts = append(parts, "CPU affinity: "+formatCPUList(s.CPUs))
+	}
+	if s.HasPriority() {
+		parts = append(parts, "Priority: "+describePriority(s))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// HasPriority reports whether a CPU or IO scheduling priority was requested
+func (s Spec) HasPriority() bool {
+	return s.Nice != nil || s.IOClass != ""
+}
+
+// Limiter applies resource limits when starting processes
+type Limiter struct {
+	cgroupRoot string
+	ioDevice   string
+	defaults   Spec
+	// niceMin and niceMax bound the niceness calls may ask for, and
+	// ioClasses the IO scheduling classes
+	niceMin   int
+	niceMax   int
+	ioClasses []string
+}
+
+// New creates a limiter using the server-wide defaults from cfg
+func New(cfg *config.Config) *Limiter {
+	l := &Limiter{
+		cgroupRoot: cfg.CgroupRoot,
+		ioDevice:   cfg.IODevice,
+		defaults: Spec{
+			IOReadBPS:  cfg.IOReadBPS,
+			IOWriteBPS: cfg.IOWriteBPS,
+		},
+	}
+
+	// Invalid defaults are left out, as if they had not been configured
+	var invalid []string
+	cpus, err := ParseCPUList(cfg.CPUAffinity)
+	if err != nil {
+		invalid = append(invalid, fmt.Sprintf("default CPU affinity: %v", err))
+	}
+	l.defaults.CPUs = cpus
+
+	if cfg.Nice != "" {
+		if nice, err := strconv.Atoi(cfg.Nice); err != nil || nice < -20 || nice > 19 {
+			invalid = append(invalid, fmt.Sprintf("default niceness: %q is not a number from -20 to 19", cfg.Nice))
+		} else {
+			l.defaults.Nice = &nice
+		}
+	}
+	if cfg.IOClass != "" {
+		if !slices.Contains(IOClassNames, cfg.IOClass) {
+			invalid = append(invalid, fmt.Sprintf("default IO class: %q is not one of %s", cfg.IOClass, strings.Join(IOClassNames, ", ")))
+		} else {
+			l.defaults.IOClass, l.defaults.IOPriority = cfg.IOClass, cfg.IOPriority
+		}
+	}
+
+	l.niceMin, l.niceMax = cfg.NiceMin, cfg.NiceMax
+	for _, class := range cfg.IOClasses {
+		if !slices.Contains(IOClassNames, class) {
+			invalid = append(invalid, fmt.Sprintf("allowed IO classes: %q is not one of %s", class, strings.Join(IOClassNames, ", ")))
+			continue
+		}
+		l.ioClasses = append(l.ioClasses, class)
+	}
+
+	if len(invalid) > 0 {
+		warnOnce.Do(func() {
+			for _, problem := range invalid {
+				logging.For("limits").Warn("Ignoring invalid setting", "error", problem)
+			}
+			health.SetDegraded("limits", "invalid settings ignored: "+strings.Join(invalid, "; "))
+		})
+	}
+
+	return l
+}
+
+// Bounds returns the niceness calls may ask for, from lowest to highest,
+// and the IO scheduling classes
+func (l *Limiter) Bounds() (int, int, []string) {
+	return l.niceMin, l.niceMax, l.ioClasses
+}
+
+// Defaults returns the server-wide limits applied when a call asks for none
+func (l *Limiter) Defaults() Spec {
+	return l.defaults
+}
+
+// SpecFromArgs builds a spec from tool call arguments, falling back to the server defaults
+func (l *Limiter) SpecFromArgs(args map[string]interface{}) (Spec, error) {
+	spec := l.defaults
+
+	var err error
+	if spec.IOReadBPS, err = bytesPerSecond(args, "io_read_bps", l.defaults.IOReadBPS); err != nil {
+		return spec, err
+	}
+	if spec.IOWriteBPS, err = bytesPerSecond(args, "io_write_bps", l.defaults.IOWriteBPS); err != nil {
+		return spec, err
+	}
+
+	if cpusArg, ok := args["cpus"].(string); ok && cpusArg != "" {
+		cpus, err := ParseCPUList(cpusArg)
+		if err != nil {
+			return spec, err
+		}
+		// Calls choose among the configured cores, not around them
+		if allowed := l.defaults.CPUs; len(allowed) > 0 {
+			var outside []int
+			for _, cpu := range cpus {
+				if !slices.Contains(allowed, cpu) {
+					outside = append(outside, cpu)
+				}
+			}
+			if len(outside) > 0 {
+				return spec, fmt.Errorf("cpus %s are not among the allowed cores %s", formatCPUList(outside), formatCPUList(allowed))
+			}
+		}
+		spec.CPUs = cpus
+	}
+
+	if niceArg, ok := args["nice"].(float64); ok {
+		nice := int(niceArg)
+		if float64(nice) != niceArg || nice < l.niceMin || nice > l.niceMax {
+			return spec, fmt.Errorf("nice must be a whole number from %d to %d", l.niceMin, l.niceMax)
+		}
+		spec.Nice = &nice
+	}
+	if classArg, ok := args["io_class"].(string); ok && classArg != "" {
+		if !slices.Contains(l.ioClasses, classArg) {
+			return spec, fmt.Errorf("io_class must be one of %s", strings.Join(l.ioClasses, ", "))
+		}
+		spec.IOClass = classArg
+	}
+	if prioArg, ok := args["io_priority"].(float64); ok {
+		prio := int(prioArg)
+		if float64(prio) != prioArg || prio < 0 || prio > 7 {
+			return spec, fmt.Errorf("io_priority must be a whole number from 0 to 7")
+		}
+		// A level alone picks it within the best-effort class, the default of
+		// processes not given one
+		if spec.IOClass == "" {
+			if !slices.Contains(l.ioClasses, IOClassBestEffort) {
+				return spec, fmt.Errorf("io_priority needs an io_class, one of %s", strings.Join(l.ioClasses, ", "))
+			}
+			spec.IOClass = IOClassBestEffort
+		}
+		spec.IOPriority = prio
+	}
+
+	return spec, nil
+}
+
+// bytesPerSecond reads a throughput cap from the argument name, or returns
+// limit, the server's, when the call gives none. A server limit is a
+// ceiling: calls may lower it but not raise it or lift it.
+func bytesPerSecond(args map[string]interface{}, name string, limit int64) (int64, error) {
+	arg, ok := args[name].(float64)
+	if !ok {
+		return limit, nil
+	}
+	switch {
+	case arg < 0:
+		return 0, fmt.Errorf("%s must not be negative", name)
+	case limit > 0 && (arg == 0 || arg > float64(limit)):
+		return 0, fmt.Errorf("%s must be from 1 to %d, the server's limit", name, limit)
+	}
+	return int64(arg), nil
+}
+
+// ParseCPUList parses a taskset-style CPU list such as "0-3,6" into sorted, unique core numbers
+func ParseCPUList(list string) ([]int, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid CPU list %q: bad entry %q", list, part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil || end < start {
+				return nil, fmt.Errorf("invalid CPU list %q: bad range %q", list, part)
+			}
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			seen[cpu] = true
+		}
+	}
+
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+
+	return cpus, nil
+}
+
+// formatCPUList renders cores back into the compact "0-3,6" form
+func formatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// Handle tracks what was applied to a started process and the resources to release
+type Handle struct {
+	cgroupDir string
+	cgroupFD  *os.File
+	notes     []string
+	// thread is closed to let go of the thread that started the process
+	thread chan struct{}
+}
+
+// Summary describes the limits in effect, or "" when none were requested
+func (h *Handle) Summary() string {
+	if h == nil {
+		return ""
+	}
+	return strings.Join(h.notes, "; ")
+}
+
+// Release frees resources held for the process. It should be called once the process has exited.
+func (h *Handle) Release() {
+	if h == nil {
+		return
+	}
+
+	if h.cgroupFD != nil {
+		h.cgroupFD.Close()
+		h.cgroupFD = nil
+	}
+
+	if h.cgroupDir != "" {
+		// Fails if processes are still inside, which leaves the cgroup for the operator to inspect
+		os.Remove(h.cgroupDir)
+		h.cgroupDir = ""
+	}
+
+	if h.thread != nil {
+		close(h.thread)
+		h.thread = nil
+	}
+}
+
+// describePriority formats a scheduling priority for result summaries
+func describePriority(spec Spec) string {
+	var parts []string
+	if spec.Nice != nil {
+		parts = append(parts, fmt.Sprintf("nice %d", *spec.Nice))
+	}
+	switch spec.IOClass {
+	case "":
+	case IOClassIdle:
+		parts = append(parts, "IO class idle")
+	default:
+		parts = append(parts, fmt.Sprintf("IO class %s, level %d", spec.IOClass, spec.IOPriority))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeIO formats an IO limit for result summaries
+func describeIO(spec Spec) string {
+	rate := func(bps int64) string {
+		if bps <= 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d B/s", bps)
+	}
+	return fmt.Sprintf("read %s, write %s", rate(spec.IOReadBPS), rate(spec.IOWriteBPS))
+}
@@ -0,0 +1,254 @@
+//go:build linux
+
+package limits
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// ioprio_set(2) constants
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassRT    = 1
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioLowestBE   = 7
+)
+
+// ioprioClasses maps IO class names to their ioprio_set(2) class
+var ioprioClasses = map[string]int{
+	IOClassRealtime:   ioprioClassRT,
+	IOClassBestEffort: ioprioClassBE,
+	IOClassIdle:       ioprioClassIdle,
+}
+
+// Start starts cmd with spec applied.
+//
+// IO limits use a dedicated cgroup v2 with io.max set, entered atomically at
+// clone time. When cgroups cannot be used (no delegation, non-block
+// filesystem) the command falls back to the lowest best-effort IO priority.
+// CPU affinity is applied with sched_setaffinity before the fork, and the
+// niceness and IO scheduling class with setpriority and ioprio_set, which
+// on Linux apply to the calling thread.
+func (l *Limiter) Start(cmd *exec.Cmd, spec Spec) (*Handle, error) {
+	h := &Handle{}
+
+	// Thread attributes to set before forking, inherited by the child
+	var threadAttrs []func() error
+
+	if spec.HasIO() {
+		if err := l.enterIOCgroup(cmd, spec, h); err != nil && spec.IOClass != "" {
+			h.notes = append(h.notes, fmt.Sprintf("IO limit: cgroup unavailable (%v), only the requested IO class applies", err))
+		} else if err != nil {
+			h.notes = append(h.notes, fmt.Sprintf("IO limit: cgroup unavailable (%v), using lowest best-effort IO priority instead", err))
+			threadAttrs = append(threadAttrs, func() error {
+				prio := uintptr(ioprioClassBE<<ioprioClassShift | ioprioLowestBE)
+				if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prio); errno != 0 {
+					h.notes = append(h.notes, fmt.Sprintf("failed to lower IO priority: %v", errno))
+				}
+				return nil
+			})
+		} else {
+			h.notes = append(h.notes, fmt.Sprintf("IO limit: %s (cgroup %s)", describeIO(spec), h.cgroupDir))
+		}
+	}
+
+	if len(spec.CPUs) > 0 {
+		h.notes = append(h.notes, fmt.Sprintf("CPU affinity: %s", formatCPUList(spec.CPUs)))
+		threadAttrs = append(threadAttrs, func() error {
+			return setAffinity(spec.CPUs)
+		})
+	}
+
+	if spec.HasPriority() {
+		h.notes = append(h.notes, "Priority: "+describePriority(spec))
+		threadAttrs = append(threadAttrs, func() error {
+			return setPriority(spec)
+		})
+	}
+
+	if len(threadAttrs) == 0 {
+		if err := cmd.Start(); err != nil {
+			h.Release()
+			return nil, err
+		}
+		return h, nil
+	}
+
+	// Attributes set on the calling thread are inherited by the forked child. The
+	// thread is never unlocked, so the runtime discards it when the goroutine exits
+	// instead of reusing a thread with altered attributes. Until the handle is
+	// released it is kept, as a child set to die with the server gets its
+	// signal when the thread that started it exits.
+	errChan := make(chan error, 1)
+	h.thread = make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+
+		for _, apply := range threadAttrs {
+			if err := apply(); err != nil {
+				errChan <- err
+				return
+			}
+		}
+
+		errChan <- cmd.Start()
+		<-h.thread
+	}()
+
+	if err := <-errChan; err != nil {
+		h.Release()
+		return nil, err
+	}
+	return h, nil
+}
+
+// setAffinity pins the calling thread to cpus
+func setAffinity(cpus []int) error {
+	mask := make([]uint64, cpus[len(cpus)-1]/64+1)
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << (uint(cpu) % 64)
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return fmt.Errorf("failed to set CPU affinity to %s: %v", formatCPUList(cpus), errno)
+	}
+	return nil
+}
+
+// setPriority sets the niceness and IO scheduling class of the calling thread
+func setPriority(spec Spec) error {
+	if spec.Nice != nil {
+		// Lowering the niceness takes CAP_SYS_NICE
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *spec.Nice); err != nil {
+			return fmt.Errorf("failed to set niceness to %d: %v", *spec.Nice, err)
+		}
+	}
+	if spec.IOClass != "" {
+		class := ioprioClasses[spec.IOClass]
+		level := spec.IOPriority
+		if class == ioprioClassIdle {
+			level = 0
+		}
+		prio := uintptr(class<<ioprioClassShift | level)
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, prio); errno != 0 {
+			return fmt.Errorf("failed to set IO class to %s: %v", spec.IOClass, errno)
+		}
+	}
+	return nil
+}
+
+// enterIOCgroup creates a cgroup with io.max set and arranges for cmd to start inside it
+func (l *Limiter) enterIOCgroup(cmd *exec.Cmd, spec Spec, h *Handle) error {
+	device := l.ioDevice
+	if device == "" {
+		var err error
+		if device, err = blockDeviceFor(cmd.Dir); err != nil {
+			return err
+		}
+	}
+
+	if err := enableIOController(l.cgroupRoot); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp(l.cgroupRoot, "cmd-")
+	if err != nil {
+		return fmt.Errorf("failed to create cgroup: %v", err)
+	}
+
+	limit := fmt.Sprintf("%s rbps=%s wbps=%s", device, ioMax(spec.IOReadBPS), ioMax(spec.IOWriteBPS))
+	if err := os.WriteFile(filepath.Join(dir, "io.max"), []byte(limit), 0644); err != nil {
+		os.Remove(dir)
+		return fmt.Errorf("failed to set io.max: %v", err)
+	}
+
+	fd, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		return fmt.Errorf("failed to open cgroup: %v", err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+
+	h.cgroupDir = dir
+	h.cgroupFD = fd
+	return nil
+}
+
+// enableIOController creates root and enables the io controller for its children
+func enableIOController(root string) error {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup root: %v", err)
+	}
+
+	for _, dir := range []string{filepath.Dir(root), root} {
+		control := filepath.Join(dir, "cgroup.subtree_control")
+		current, err := os.ReadFile(control)
+		if err != nil {
+			return fmt.Errorf("cgroup v2 not available at %s: %v", dir, err)
+		}
+		if strings.Contains(" "+string(current)+" ", " io ") {
+			continue
+		}
+		if err := os.WriteFile(control, []byte("+io"), 0644); err != nil {
+			return fmt.Errorf("failed to enable io controller in %s: %v", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// blockDeviceFor returns the MAJ:MIN of the whole disk backing dir
+func blockDeviceFor(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return "", fmt.Errorf("failed to stat %s: %v", dir, err)
+	}
+
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	if major == 0 {
+		return "", fmt.Errorf("%s is not on a block device", dir)
+	}
+
+	device := fmt.Sprintf("%d:%d", major, minor)
+
+	// io.max only accepts whole disks, so resolve partitions to their parent
+	sysDir := filepath.Join("/sys/dev/block", device)
+	if _, err := os.Stat(filepath.Join(sysDir, "partition")); err == nil {
+		parent, err := os.ReadFile(filepath.Join(sysDir, "..", "dev"))
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve disk for partition %s: %v", device, err)
+		}
+		device = strings.TrimSpace(string(parent))
+	}
+
+	return device, nil
+}
+
+// ioMax formats a bytes-per-second value for io.max
+func ioMax(bps int64) string {
+	if bps <= 0 {
+		return "max"
+	}
+	return fmt.Sprintf("%d", bps)
+}
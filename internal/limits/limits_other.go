@@ -0,0 +1,30 @@
+//go:build !linux
+
+package limits
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Start starts cmd. Resource limits are only implemented on Linux, so requested
+// limits are reported as unsupported rather than silently dropped.
+func (l *Limiter) Start(cmd *exec.Cmd, spec Spec) (*Handle, error) {
+	h := &Handle{}
+
+	if spec.HasIO() {
+		h.notes = append(h.notes, fmt.Sprintf("IO limit: not supported on %s", runtime.GOOS))
+	}
+	if len(spec.CPUs) > 0 {
+		h.notes = append(h.notes, fmt.Sprintf("CPU affinity: not supported on %s", runtime.GOOS))
+	}
+	if spec.HasPriority() {
+		h.notes = append(h.notes, fmt.Sprintf("Priority: not supported on %s", runtime.GOOS))
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
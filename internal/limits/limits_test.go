@@ -0,0 +1,118 @@
+package limits
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSpecFromArgs(t *testing.T) {
+	l := &Limiter{
+		defaults:  Spec{IOReadBPS: 1000, CPUs: []int{0, 1, 2, 3}},
+		niceMin:   0,
+		niceMax:   19,
+		ioClasses: []string{IOClassBestEffort, IOClassIdle},
+	}
+	nice := func(n int) *int { return &n }
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want Spec
+		err  string
+	}{
+		{
+			name: "defaults",
+			args: map[string]interface{}{},
+			want: Spec{IOReadBPS: 1000, CPUs: []int{0, 1, 2, 3}},
+		},
+		{
+			name: "lower IO cap",
+			args: map[string]interface{}{"io_read_bps": float64(500), "io_write_bps": float64(2000)},
+			want: Spec{IOReadBPS: 500, IOWriteBPS: 2000, CPUs: []int{0, 1, 2, 3}},
+		},
+		{
+			name: "IO cap above the server's",
+			args: map[string]interface{}{"io_read_bps": float64(1001)},
+			err:  "io_read_bps must be from 1 to 1000",
+		},
+		{
+			name: "IO cap lifted",
+			args: map[string]interface{}{"io_read_bps": float64(0)},
+			err:  "io_read_bps must be from 1 to 1000",
+		},
+		{
+			name: "negative IO cap",
+			args: map[string]interface{}{"io_write_bps": float64(-1)},
+			err:  "io_write_bps must not be negative",
+		},
+		{
+			name: "cpus within the affinity",
+			args: map[string]interface{}{"cpus": "1,3"},
+			want: Spec{IOReadBPS: 1000, CPUs: []int{1, 3}},
+		},
+		{
+			name: "cpus outside the affinity",
+			args: map[string]interface{}{"cpus": "2-5"},
+			err:  "cpus 4-5 are not among the allowed cores 0-3",
+		},
+		{
+			name: "invalid cpus",
+			args: map[string]interface{}{"cpus": "x"},
+			err:  "x",
+		},
+		{
+			name: "nice",
+			args: map[string]interface{}{"nice": float64(10)},
+			want: Spec{IOReadBPS: 1000, CPUs: []int{0, 1, 2, 3}, Nice: nice(10)},
+		},
+		{
+			name: "nice below the bound",
+			args: map[string]interface{}{"nice": float64(-5)},
+			err:  "nice must be a whole number from 0 to 19",
+		},
+		{
+			name: "fractional nice",
+			args: map[string]interface{}{"nice": 1.5},
+			err:  "nice must be a whole number",
+		},
+		{
+			name: "io class",
+			args: map[string]interface{}{"io_class": "idle"},
+			want: Spec{IOReadBPS: 1000, CPUs: []int{0, 1, 2, 3}, IOClass: IOClassIdle},
+		},
+		{
+			name: "io class not allowed",
+			args: map[string]interface{}{"io_class": "realtime"},
+			err:  "io_class must be one of best-effort, idle",
+		},
+		{
+			name: "io priority alone is best-effort",
+			args: map[string]interface{}{"io_priority": float64(6)},
+			want: Spec{IOReadBPS: 1000, CPUs: []int{0, 1, 2, 3}, IOClass: IOClassBestEffort, IOPriority: 6},
+		},
+		{
+			name: "io priority out of range",
+			args: map[string]interface{}{"io_priority": float64(8)},
+			err:  "io_priority must be a whole number from 0 to 7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.SpecFromArgs(tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spec = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+)
+
+// Listen opens the listener the HTTP server accepts connections on: the Unix
+// domain socket when one is configured, otherwise the TCP host and port. It
+// also returns the address for the startup log.
+func Listen(cfg *config.Config) (net.Listener, string, error) {
+	if cfg.UnixSocket != "" {
+		l, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketMode)
+		return l, "unix:" + cfg.UnixSocket, err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, cfg.Port)
+	l, err := net.Listen("tcp", addr)
+	return l, addr, err
+}
+
+// ListenGRPC opens the listener of the gRPC API at cfg.GRPCAddr: a TCP
+// address, or a Unix domain socket given as unix:/path, which gets the
+// permissions of the HTTP socket. It also returns the address for the log.
+func ListenGRPC(cfg *config.Config) (net.Listener, string, error) {
+	if path, ok := strings.CutPrefix(cfg.GRPCAddr, "unix:"); ok {
+		l, err := listenUnix(path, cfg.UnixSocketMode)
+		return l, cfg.GRPCAddr, err
+	}
+
+	l, err := net.Listen("tcp", cfg.GRPCAddr)
+	return l, cfg.GRPCAddr, err
+}
+
+// listenUnix listens on a Unix domain socket that only gets mode as its
+// permissions, so no one else can connect while it is being set up. A socket
+// left behind by a server that did not shut down cleanly is replaced; one a
+// running server still listens on is not. The socket is removed when the
+// listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %v", path, err)
+		}
+	}
+
+	umask := syscall.Umask(int(0777 &^ mode.Perm()))
+	l, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		return nil, err
+	}
+
+	// The umask can only take permissions away
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %v", path, err)
+	}
+	return l, nil
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// level is shared by every handler so it can be checked when values are rendered
+var level = new(slog.LevelVar)
+
+// filter rewrites every logged string when set, to keep secrets out of the logs
+var filter atomic.Pointer[func(string) string]
+
+// Setup installs the default logger, writing to stderr as "text" or "json"
+// at the named level ("debug", "info", "warn" or "error"). Invalid settings
+// fall back to text at info and are reported in the returned error.
+func Setup(levelName, format string) error {
+	var errs []string
+
+	l := slog.LevelInfo
+	if levelName != "" {
+		if err := l.UnmarshalText([]byte(levelName)); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid log level %q", levelName))
+			l = slog.LevelInfo
+		}
+	}
+	level.Set(l)
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceAttr}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		errs = append(errs, fmt.Sprintf("invalid log format %q", format))
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// SetFilter passes every string and error logged from now on through fn
+func SetFilter(fn func(string) string) {
+	filter.Store(&fn)
+}
+
+// replaceAttr applies the filter to an attribute about to be written
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	fn := filter.Load()
+	if fn == nil {
+		return a
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue((*fn)(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue((*fn)(err.Error()))
+		}
+	}
+	return a
+}
+
+// For returns the logger of a subsystem such as "session" or "http"
+func For(subsystem string) *slog.Logger {
+	return slog.Default().With("subsystem", subsystem)
+}
+
+// DebugEnabled reports whether debug messages are logged
+func DebugEnabled() bool {
+	return level.Level() <= slog.LevelDebug
+}
+
+// CommandHash identifies a command without revealing its text
+func CommandHash(command string) string {
+	sum := sha256.Sum256([]byte(command))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Command returns a "command" attribute holding the full command at debug
+// level and only its hash and length otherwise, since commands may contain secrets
+func Command(command string) slog.Attr {
+	return slog.Any("command", commandValue(command))
+}
+
+// commandValue defers the redaction decision until the record is rendered
+type commandValue string
+
+func (c commandValue) LogValue() slog.Value {
+	if DebugEnabled() {
+		return slog.StringValue(string(c))
+	}
+	return slog.StringValue(fmt.Sprintf("[redacted sha256:%s, %d bytes]", CommandHash(string(c)), len(c)))
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Window is how far back the statistics reach
+	Window = time.Hour
+	// maxSamples bounds memory on very busy servers; the oldest samples go first
+	maxSamples = 100000
+	// topCommands is how many programs the statistics rank by time spent
+	topCommands = 5
+)
+
+// Commands finishing anywhere in the server are recorded here, so capacity can
+// be planned from what agents actually run
+var (
+	mu      sync.Mutex
+	samples []sample
+	started = time.Now()
+)
+
+// sample is one finished command
+type sample struct {
+	at        time.Time
+	session   string
+	program   string
+	duration  time.Duration
+	failed    bool
+	throttled bool
+}
+
+// Record counts a finished command. session is empty for one-off commands,
+// which count towards the global statistics only. throttled marks a command
+// whose output went over the session's output rate limit.
+func Record(session, command string, duration time.Duration, exitCode int, timedOut, throttled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	prune(now)
+	if len(samples) >= maxSamples {
+		samples = samples[1:]
+	}
+	samples = append(samples, sample{
+		at:        now,
+		session:   session,
+		program:   program(command),
+		duration:  duration,
+		failed:    exitCode != 0 || timedOut,
+		throttled: throttled,
+	})
+}
+
+// prune drops samples that have left the window
+func prune(now time.Time) {
+	cutoff := now.Add(-Window)
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].at.After(cutoff) })
+	samples = samples[i:]
+}
+
+// program names the program a command line starts with, skipping variable
+// assignments in front of it. Only the name is kept, so statistics never hold
+// arguments that might be sensitive.
+func program(command string) string {
+	for _, field := range strings.Fields(command) {
+		if strings.Contains(field, "=") {
+			continue
+		}
+		return filepath.Base(field)
+	}
+	return ""
+}
+
+// CommandTime is the time spent running one program
+type CommandTime struct {
+	Command string `json:"command"`
+	Count   int    `json:"count"`
+	TotalMS int64  `json:"total_ms"`
+}
+
+// Stats summarises the commands finished within the window
+type Stats struct {
+	Commands          int           `json:"commands"`
+	CommandsPerHour   float64       `json:"commands_per_hour"`
+	AverageDurationMS int64         `json:"average_duration_ms"`
+	FailureRate       float64       `json:"failure_rate"`
+	ThrottledCommands int           `json:"throttled_commands"`
+	TopCommands       []CommandTime `json:"top_commands"`
+}
+
+// Report holds the statistics of the whole server and of each session
+type Report struct {
+	WindowSeconds int              `json:"window_seconds"`
+	Global        Stats            `json:"global"`
+	Sessions      map[string]Stats `json:"sessions"`
+}
+
+// Snapshot computes the statistics of the last Window. Sessions for which
+// include returns false are left out of the per-session statistics but still
+// count towards the global ones; a nil include keeps every session.
+func Snapshot(include func(session string) bool) Report {
+	mu.Lock()
+	now := time.Now()
+	prune(now)
+	current := make([]sample, len(samples))
+	copy(current, samples)
+	mu.Unlock()
+
+	// Rates cover the time recorded so far, but no less than a minute so a
+	// fresh server does not extrapolate from its first command
+	covered := min(Window, now.Sub(started))
+	covered = max(covered, time.Minute)
+
+	bySession := make(map[string][]sample)
+	for _, s := range current {
+		if s.session != "" && (include == nil || include(s.session)) {
+			bySession[s.session] = append(bySession[s.session], s)
+		}
+	}
+
+	report := Report{
+		WindowSeconds: int(Window.Seconds()),
+		Global:        summarise(current, covered),
+		Sessions:      make(map[string]Stats, len(bySession)),
+	}
+	for session, list := range bySession {
+		report.Sessions[session] = summarise(list, covered)
+	}
+	return report
+}
+
+// summarise computes the statistics of a list of samples
+func summarise(list []sample, covered time.Duration) Stats {
+	stats := Stats{Commands: len(list), TopCommands: []CommandTime{}}
+	if len(list) == 0 {
+		return stats
+	}
+
+	var total time.Duration
+	failed := 0
+	programs := make(map[string]*CommandTime)
+	for _, s := range list {
+		total += s.duration
+		if s.failed {
+			failed++
+		}
+		if s.throttled {
+			stats.ThrottledCommands++
+		}
+		ct, ok := programs[s.program]
+		if !ok {
+			ct = &CommandTime{Command: s.program}
+			programs[s.program] = ct
+		}
+		ct.Count++
+		ct.TotalMS += s.duration.Milliseconds()
+	}
+
+	stats.CommandsPerHour = float64(len(list)) / covered.Hours()
+	stats.AverageDurationMS = (total / time.Duration(len(list))).Milliseconds()
+	stats.FailureRate = float64(failed) / float64(len(list))
+
+	for _, ct := range programs {
+		stats.TopCommands = append(stats.TopCommands, *ct)
+	}
+	sort.Slice(stats.TopCommands, func(i, j int) bool {
+		a, b := stats.TopCommands[i], stats.TopCommands[j]
+		if a.TotalMS != b.TotalMS {
+			return a.TotalMS > b.TotalMS
+		}
+		return a.Command < b.Command
+	})
+	if len(stats.TopCommands) > topCommands {
+		stats.TopCommands = stats.TopCommands[:topCommands]
+	}
+
+	return stats
+}
@@ -0,0 +1,167 @@
+package netwatch
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/logging"
+)
+
+// Destination is a remote endpoint a command connected to
+type Destination struct {
+	Proto string `json:"proto"`
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	// Connections counts the distinct connections seen to the endpoint
+	Connections int `json:"connections"`
+}
+
+// Summary lists the destinations of a command's connections, most used first
+type Summary []Destination
+
+// String formats the summary as e.g. "tcp 93.184.216.34:443 (2), udp 1.1.1.1:53 (1)"
+func (s Summary) String() string {
+	if len(s) == 0 {
+		return "no connections"
+	}
+	parts := make([]string, len(s))
+	for i, d := range s {
+		parts[i] = fmt.Sprintf("%s %s (%d)", d.Proto, net.JoinHostPort(d.Host, strconv.Itoa(d.Port)), d.Connections)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// connection identifies one socket, so it is counted once however often it is sampled
+type connection struct {
+	proto  string
+	local  string
+	remote string
+	inode  string
+}
+
+// Watcher samples the sockets held by commands' process trees. Connections
+// that open and close between two samples are missed, so the summary is a
+// lower bound.
+type Watcher struct {
+	interval time.Duration
+	log      *slog.Logger
+}
+
+// New creates a watcher, or returns nil when network summaries are disabled
+func New(cfg *config.Config) *Watcher {
+	if !cfg.NetworkSummary {
+		return nil
+	}
+
+	w := &Watcher{
+		interval: cfg.NetworkSampleInterval,
+		log:      logging.For("netwatch"),
+	}
+	if !supported {
+		w.log.Warn("Network summaries are only supported on Linux")
+		return nil
+	}
+	return w
+}
+
+// Watch follows the connections of a process and its descendants until Stop
+type Watch struct {
+	pid  int
+	stop chan struct{}
+	done chan struct{}
+
+	mu   sync.Mutex
+	seen map[connection]bool
+}
+
+// Watch starts sampling the connections of pid and the processes below it
+func (w *Watcher) Watch(pid int) *Watch {
+	if w == nil {
+		return nil
+	}
+
+	watch := &Watch{
+		pid:  pid,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		seen: make(map[connection]bool),
+	}
+	go func() {
+		defer close(watch.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			watch.sample()
+			select {
+			case <-watch.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return watch
+}
+
+// sample records the connections currently open in the process tree
+func (watch *Watch) sample() {
+	conns := sample(watch.pid)
+
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	for _, c := range conns {
+		watch.seen[c] = true
+	}
+}
+
+// Stop takes a last sample and returns the destinations seen
+func (watch *Watch) Stop() Summary {
+	if watch == nil {
+		return nil
+	}
+
+	close(watch.stop)
+	<-watch.done
+	watch.sample()
+
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+
+	counts := make(map[Destination]int)
+	for c := range watch.seen {
+		host, portStr, err := net.SplitHostPort(c.remote)
+		if err != nil {
+			continue
+		}
+		port, _ := strconv.Atoi(portStr)
+		counts[Destination{Proto: c.proto, Host: host, Port: port}]++
+	}
+
+	summary := make(Summary, 0, len(counts))
+	for d, n := range counts {
+		d.Connections = n
+		summary = append(summary, d)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		a, b := summary[i], summary[j]
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Proto < b.Proto
+	})
+	return summary
+}
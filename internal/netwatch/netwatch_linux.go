@@ -0,0 +1,128 @@
+//go:build linux
+
+package netwatch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mcp-terminal-server/internal/process"
+)
+
+// supported reports whether connections can be sampled on this platform
+const supported = true
+
+// socketTables are the /proc/<pid>/net tables read, by protocol
+var socketTables = []struct {
+	file  string
+	proto string
+}{
+	{"tcp", "tcp"},
+	{"tcp6", "tcp"},
+	{"udp", "udp"},
+	{"udp6", "udp"},
+}
+
+// sample returns the connected sockets held by pid and its descendants
+func sample(pid int) []connection {
+	pids := []int{pid}
+	if descendants, err := process.List(process.Filter{DescendantsOf: pid}); err == nil {
+		for _, p := range descendants {
+			pids = append(pids, p.PID)
+		}
+	}
+
+	// Socket inodes of every process in the tree
+	inodes := make(map[string]bool)
+	for _, p := range pids {
+		fdDir := fmt.Sprintf("/proc/%d/fd", p)
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			link, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+				inodes[strings.TrimSuffix(inode, "]")] = true
+			}
+		}
+	}
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	// The tables are per network namespace, so read them through the tree's root
+	var conns []connection
+	for _, table := range socketTables {
+		conns = append(conns, readTable(fmt.Sprintf("/proc/%d/net/%s", pid, table.file), table.proto, inodes)...)
+	}
+	return conns
+}
+
+// readTable parses a /proc/net socket table, keeping connected sockets whose
+// inode is in inodes
+func readTable(path, proto string, inodes map[string]bool) []connection {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var conns []connection
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !inodes[fields[9]] {
+			continue
+		}
+		remote, ok := parseAddr(fields[2])
+		if !ok {
+			// Listening or unconnected socket
+			continue
+		}
+		local, _ := parseAddr(fields[1])
+		conns = append(conns, connection{proto: proto, local: local, remote: remote, inode: fields[9]})
+	}
+	return conns
+}
+
+// parseAddr decodes a kernel "ADDR:PORT" pair. The address is printed as
+// 32-bit words in host byte order. Unspecified addresses and ports are rejected.
+func parseAddr(s string) (string, bool) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", false
+	}
+	raw, err := hex.DecodeString(addrHex)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", false
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil || port == 0 {
+		return "", false
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	if ip.IsUnspecified() {
+		return "", false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), true
+}
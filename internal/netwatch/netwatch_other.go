@@ -0,0 +1,11 @@
+//go:build !linux
+
+package netwatch
+
+// supported reports whether connections can be sampled on this platform
+const supported = false
+
+// sample is not implemented outside Linux
+func sample(pid int) []connection {
+	return nil
+}
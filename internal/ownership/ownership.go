@@ -0,0 +1,91 @@
+package ownership
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/pathmap"
+)
+
+// timestampSlack allows for file timestamps taken from the kernel's coarse clock
+// lagging slightly behind the time the command was started
+const timestampSlack = time.Second
+
+// Fixer hands files written by commands over to a configured owner. This matters
+// when the server runs in a container as root while its bind mounts belong to a
+// regular user on the host.
+type Fixer struct {
+	uid   int
+	gid   int
+	roots []string
+}
+
+// New creates a fixer, or returns nil when ownership mapping is disabled.
+// Without explicit roots, the server side of every path mapping is used.
+func New(cfg *config.Config, paths *pathmap.Map) *Fixer {
+	if cfg.ChownUID < 0 {
+		return nil
+	}
+
+	roots := cfg.ChownPaths
+	if len(roots) == 0 {
+		roots = paths.ServerRoots()
+	}
+
+	gid := cfg.ChownGID
+	if gid < 0 {
+		gid = cfg.ChownUID
+	}
+
+	return &Fixer{
+		uid:   cfg.ChownUID,
+		gid:   gid,
+		roots: roots,
+	}
+}
+
+// Fix chowns files under the configured roots that the server created or modified
+// since the given time. Files already owned by someone else are left alone.
+func (f *Fixer) Fix(since time.Time) {
+	if f == nil {
+		return
+	}
+
+	self := os.Geteuid()
+	since = since.Add(-timestampSlack)
+	changed := 0
+
+	for _, root := range f.roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			stat, ok := info.Sys().(*syscall.Stat_t)
+			if !ok || int(stat.Uid) != self || info.ModTime().Before(since) {
+				return nil
+			}
+
+			if err := os.Lchown(path, f.uid, f.gid); err != nil {
+				logging.For("ownership").Warn("Failed to change ownership", "path", path, "error", err)
+				return nil
+			}
+			changed++
+			return nil
+		})
+	}
+
+	if changed > 0 {
+		logging.For("ownership").Info("Changed ownership", "files", changed, "uid", f.uid, "gid", f.gid)
+	}
+}
@@ -0,0 +1,126 @@
+package pathmap
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mcp-terminal-server/internal/config"
+)
+
+// Map translates paths between the server's view of the filesystem (e.g. inside a
+// container) and the client's view (e.g. the host the bind mounts come from)
+type Map struct {
+	mappings []config.PathMapping
+}
+
+// New creates a path map from the configured mappings
+func New(cfg *config.Config) *Map {
+	mappings := append([]config.PathMapping(nil), cfg.PathMappings...)
+
+	// Longest prefixes first so nested mounts win over their parents
+	sort.Slice(mappings, func(i, j int) bool {
+		return len(mappings[i].Server) > len(mappings[j].Server)
+	})
+
+	return &Map{mappings: mappings}
+}
+
+// Empty reports whether no mappings are configured
+func (m *Map) Empty() bool {
+	return len(m.mappings) == 0
+}
+
+// ServerRoots returns the server-side directories covered by the mappings
+func (m *Map) ServerRoots() []string {
+	var roots []string
+	for _, mapping := range m.mappings {
+		roots = append(roots, mapping.Server)
+	}
+	return roots
+}
+
+// ToClient rewrites server-side paths appearing anywhere in text (e.g. command
+// output) to their client-side equivalents
+func (m *Map) ToClient(text string) string {
+	for _, mapping := range m.mappings {
+		text = replacePrefix(text, mapping.Server, mapping.Client)
+	}
+	return text
+}
+
+// ToServer translates a single client-side path (e.g. a cwd or file tool argument)
+// into the server's view. Paths outside every mapping are returned cleaned but unchanged.
+func (m *Map) ToServer(path string) string {
+	if path == "" {
+		return path
+	}
+
+	path = filepath.Clean(path)
+	best := -1
+	for i, mapping := range m.mappings {
+		if within(path, mapping.Client) && (best < 0 || len(mapping.Client) > len(m.mappings[best].Client)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return path
+	}
+
+	mapping := m.mappings[best]
+	return filepath.Join(mapping.Server, strings.TrimPrefix(path, mapping.Client))
+}
+
+// ToClientPath translates a single server-side path into the client's view
+func (m *Map) ToClientPath(path string) string {
+	if path == "" {
+		return path
+	}
+
+	path = filepath.Clean(path)
+	for _, mapping := range m.mappings {
+		if within(path, mapping.Server) {
+			return filepath.Join(mapping.Client, strings.TrimPrefix(path, mapping.Server))
+		}
+	}
+	return path
+}
+
+// within reports whether path is root itself or lies below it
+func within(path, root string) bool {
+	return path == root || root == "/" || strings.HasPrefix(path, root+"/")
+}
+
+// replacePrefix replaces occurrences of the path from that stand on their own,
+// i.e. are not part of a longer path component such as /workspace2 or /a/workspace
+func replacePrefix(text, from, to string) string {
+	if from == "" || !strings.Contains(text, from) {
+		return text
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(text, from)
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+
+		end := i + len(from)
+		before := i == 0 || !isPathChar(text[i-1]) && text[i-1] != '/'
+		after := end == len(text) || !isPathChar(text[end])
+
+		b.WriteString(text[:i])
+		if before && after {
+			b.WriteString(to)
+		} else {
+			b.WriteString(from)
+		}
+		text = text[end:]
+	}
+}
+
+// isPathChar reports whether c can continue a path component
+func isPathChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'
+}
@@ -0,0 +1,211 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/process"
+)
+
+const (
+	// describeTimeout bounds how long a plugin may take to describe its tools
+	describeTimeout = 5 * time.Second
+	// maxOutputBytes caps what is read from a plugin's stdout
+	maxOutputBytes = 4 << 20
+)
+
+// toolName matches the names plugins may give their tools
+var toolName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Tool is one tool provided by a plugin executable
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+
+	path    string
+	timeout time.Duration
+	grace   time.Duration
+}
+
+// Call is what a plugin receives on stdin when one of its tools is called
+type Call struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	// Identity and Role are the caller's, as established by the auth hook
+	Identity string `json:"identity,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// Result is what a plugin prints on stdout in answer to a call
+type Result struct {
+	Text string `json:"text"`
+	// Error, when set, makes the call fail with this message
+	Error string `json:"error,omitempty"`
+}
+
+// Discover asks every executable in the configured plugin directory which
+// tools it provides. A plugin that cannot describe itself is skipped and
+// reported, and the server marked degraded, so one broken plugin does not
+// keep the others from loading.
+func Discover(cfg *config.Config) []*Tool {
+	if cfg.PluginDir == "" {
+		return nil
+	}
+	log := logging.For("plugins")
+
+	entries, err := os.ReadDir(cfg.PluginDir)
+	if err != nil {
+		log.Error("Failed to read plugin directory", "path", cfg.PluginDir, "error", err)
+		health.SetDegraded("plugins", fmt.Sprintf("failed to read %s: %v", cfg.PluginDir, err))
+		return nil
+	}
+
+	var tools []*Tool
+	var failed []string
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		path := filepath.Join(cfg.PluginDir, entry.Name())
+		info, err := os.Stat(path)
+		if strings.HasPrefix(entry.Name(), ".") || err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+
+		described, err := describe(path)
+		if err != nil {
+			log.Error("Failed to load plugin", "path", path, "error", err)
+			failed = append(failed, entry.Name())
+			continue
+		}
+		for _, tool := range described {
+			if other, ok := seen[tool.Name]; ok {
+				log.Error("Skipping plugin tool defined twice", "tool", tool.Name, "path", path, "first", other)
+				failed = append(failed, entry.Name())
+				continue
+			}
+			seen[tool.Name] = path
+			tool.path, tool.timeout, tool.grace = path, cfg.PluginTimeout, cfg.KillGracePeriod
+			tools = append(tools, tool)
+		}
+		log.Info("Loaded plugin", "path", path, "tools", len(described))
+	}
+
+	if len(failed) > 0 {
+		health.SetDegraded("plugins", "failed to load "+strings.Join(failed, ", "))
+	}
+	return tools
+}
+
+// describe runs "<plugin> describe", which prints {"tools": [...]}
+func describe(path string) ([]*Tool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	stdout, err := run(ctx, path, "describe", nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var described struct {
+		Tools []*Tool `json:"tools"`
+	}
+	if err := json.Unmarshal(stdout, &described); err != nil {
+		return nil, fmt.Errorf("invalid description %q: %v", truncate(stdout), err)
+	}
+	if len(described.Tools) == 0 {
+		return nil, fmt.Errorf("the plugin describes no tools")
+	}
+	for _, tool := range described.Tools {
+		if !toolName.MatchString(tool.Name) {
+			return nil, fmt.Errorf("tool %q: name must be lowercase letters, digits and underscores", tool.Name)
+		}
+		if len(tool.InputSchema) == 0 {
+			tool.InputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		var schema map[string]interface{}
+		if err := json.Unmarshal(tool.InputSchema, &schema); err != nil || schema["type"] != "object" {
+			return nil, fmt.Errorf("tool %s: input_schema must be a JSON schema of type object", tool.Name)
+		}
+	}
+	return described.Tools, nil
+}
+
+// Call runs the plugin for one call of the tool: the call is written to its
+// stdin as JSON and the result read from its stdout. Output that is not a
+// JSON result is taken as the text of the result, so a plugin may simply
+// print its answer. A plugin that exits with an error fails the call.
+func (t *Tool) Call(ctx context.Context, call Call) (Result, error) {
+	input, err := json.Marshal(call)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	stdout, err := run(ctx, t.path, "call", input, t.grace)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Result{}, fmt.Errorf("plugin timed out after %s", t.timeout)
+		}
+		return Result{}, err
+	}
+
+	var result Result
+	if json.Unmarshal(stdout, &result) != nil {
+		return Result{Text: string(stdout)}, nil
+	}
+	return result, nil
+}
+
+// run runs a plugin with one argument and returns its stdout
+func run(ctx context.Context, path, action string, input []byte, grace time.Duration) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, action)
+	process.Group(cmd, grace)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &limitedWriter{w: &stdout, n: maxOutputBytes}
+	cmd.Stderr = &limitedWriter{w: &stderr, n: maxOutputBytes}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s %s failed: %v: %s", filepath.Base(path), action, err, truncate(stderr.Bytes()))
+	}
+	return bytes.TrimSpace(stdout.Bytes()), nil
+}
+
+// limitedWriter keeps the first n bytes written to it and discards the rest,
+// so a plugin printing without end cannot exhaust the server's memory
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if keep := min(len(p), l.n); keep > 0 {
+		l.w.Write(p[:keep])
+		l.n -= keep
+	}
+	return len(p), nil
+}
+
+// truncate shortens a plugin's output for error messages
+func truncate(data []byte) string {
+	const max = 200
+	text := strings.TrimSpace(string(data))
+	if len(text) > max {
+		return text[:max] + "..."
+	}
+	return text
+}
@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/user"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/backends"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+)
+
+// maxOPAResponseBytes bounds how much of an OPA response is read
+const maxOPAResponseBytes = 1 << 20
+
+// opaInput is the document sent to OPA as "input"
+type opaInput struct {
+	Tool    string `json:"tool"`
+	Command string `json:"command"`
+	Role    string `json:"role"`
+	// User is the account commands run as
+	User string `json:"user"`
+	// Target is the persistent session the command runs in (empty for one-off commands)
+	Target   string   `json:"target"`
+	Cwd      string   `json:"cwd"`
+	Risk     Risk     `json:"risk"`
+	RiskTags []string `json:"risk_tags"`
+}
+
+// opaDecision is what a policy may return: a boolean, or an object with an
+// "allow" field and an optional reason
+type opaDecision struct {
+	Allow   bool     `json:"allow"`
+	Reason  string   `json:"reason"`
+	Reasons []string `json:"reasons"`
+}
+
+// opaClient queries an OPA server's data API for decisions
+type opaClient struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+	user    string
+	breaker *backends.Breaker
+}
+
+// newOPAClient creates a client for a decision URL such as
+// http://localhost:8181/v1/data/terminal/decision, or returns nil when unset.
+// After threshold failed queries in a row, commands are denied at once until
+// OPA answers again.
+func newOPAClient(url string, timeout time.Duration, threshold int) *opaClient {
+	if url == "" {
+		return nil
+	}
+
+	name := ""
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	return &opaClient{
+		url:     url,
+		timeout: timeout,
+		client:  &http.Client{},
+		user:    name,
+		breaker: backends.NewBreaker("opa", url, threshold),
+	}
+}
+
+// decide asks OPA whether the request is allowed. The returned reason explains
+// a denial; errors mean no decision could be obtained.
+func (o *opaClient) decide(req Request, c Classification, role string) (bool, string, error) {
+	input := opaInput{
+		Tool:     req.Tool,
+		Command:  req.Command,
+		Role:     role,
+		User:     o.user,
+		Target:   req.Target,
+		Cwd:      req.Cwd,
+		Risk:     c.Risk,
+		RiskTags: c.Tags,
+	}
+	if input.RiskTags == nil {
+		input.RiskTags = []string{}
+	}
+
+	body, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return false, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOPAResponseBytes))
+	if err != nil {
+		return false, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("OPA returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return false, "", fmt.Errorf("failed to decode OPA response: %v", err)
+	}
+	if len(envelope.Result) == 0 {
+		return false, "the OPA policy is undefined for this input", nil
+	}
+
+	var allow bool
+	if err := json.Unmarshal(envelope.Result, &allow); err == nil {
+		return allow, "denied by OPA policy", nil
+	}
+
+	var decision opaDecision
+	if err := json.Unmarshal(envelope.Result, &decision); err != nil {
+		return false, "", fmt.Errorf("OPA result must be a boolean or an object with \"allow\", got %s", envelope.Result)
+	}
+	reason := decision.Reason
+	if reason == "" && len(decision.Reasons) > 0 {
+		reason = strings.Join(decision.Reasons, "; ")
+	}
+	if reason == "" {
+		reason = "denied by OPA policy"
+	}
+	return decision.Allow, reason, nil
+}
+
+// evaluate adds the OPA stage to a decision. OPA being unreachable denies the
+// command, so an outage cannot silently bypass the organization's policy.
+func (o *opaClient) evaluate(d *Decision, req Request, c Classification) {
+	if err := o.breaker.Allow(); err != nil {
+		retryAt := time.Now().Add(err.(*backends.Unavailable).RetryAfter)
+		d.Trace = append(d.Trace, Step{Stage: "opa", Name: o.url, Result: "deny", Detail: err.Error()})
+		d.deny("the OPA policy could not be evaluated: " + err.Error())
+		if d.RetryAt == nil || retryAt.After(*d.RetryAt) {
+			d.RetryAt = &retryAt
+		}
+		return
+	}
+	allow, reason, err := o.decide(req, c, d.Role)
+	o.breaker.Done(err)
+	if err != nil {
+		logging.For("policy").Error("OPA query failed", "url", o.url, "error", err)
+		health.SetDegraded("opa", fmt.Sprintf("failed to query %s: %v", o.url, err))
+		d.Trace = append(d.Trace, Step{Stage: "opa", Name: o.url, Result: "deny", Detail: err.Error()})
+		d.deny("the OPA policy could not be evaluated")
+		return
+	}
+	health.Clear("opa")
+
+	if !allow {
+		d.Trace = append(d.Trace, Step{Stage: "opa", Name: o.url, Result: "deny", Detail: reason})
+		d.deny(reason)
+		return
+	}
+	d.Trace = append(d.Trace, Step{Stage: "opa", Name: o.url, Result: "allow"})
+}
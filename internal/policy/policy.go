@@ -0,0 +1,659 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+)
+
+// Rule allows or denies commands matching a regular expression
+type Rule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	// Action is "allow" or "deny"
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	// Tools limits the rule to these tools (empty = every tool that runs commands)
+	Tools []string `json:"tools,omitempty"`
+	// Hint and Alternatives tell an agent whose command the rule denies what
+	// to do instead, so it can correct itself rather than retry
+	Hint         string        `json:"hint,omitempty"`
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Alternative is a tool or command to use in place of a denied command
+type Alternative struct {
+	Tool        string `json:"tool,omitempty"`
+	Command     string `json:"command,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Role is what a caller may do
+type Role struct {
+	// Tools lists the tools the role may call (empty = all but shell_history,
+	// which must be listed)
+	Tools []string `json:"tools,omitempty"`
+	// MaxRisk overrides the policy's risk ceiling for the role
+	MaxRisk *Risk `json:"max_risk,omitempty"`
+	// ReadOnly limits the role to the read-only command list, as read-only
+	// mode does for the whole server
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// explicitTools are only permitted to roles that list them, since they show
+// agents what the user did rather than what the agent did
+var explicitTools = []string{"shell_history"}
+
+// Transports a policy can give a role of their own
+const (
+	TransportStdio = access.TransportStdio
+	TransportHTTP  = access.TransportHTTP
+	TransportGRPC  = access.TransportGRPC
+)
+
+// Policy is the operator-supplied command policy
+type Policy struct {
+	// Default is "allow" or "deny" for commands no rule matches
+	Default string `json:"default"`
+	// MaxRisk is the highest classified risk that is allowed
+	MaxRisk Risk `json:"max_risk"`
+	// DefaultRole applies to callers that do not identify a role
+	DefaultRole string          `json:"default_role"`
+	Roles       map[string]Role `json:"roles,omitempty"`
+	// TransportRoles applies instead of DefaultRole to callers on a transport,
+	// "stdio", "http" or "grpc", e.g. full access for the local agent and a read-only
+	// role for HTTP clients
+	TransportRoles map[string]string `json:"transport_roles,omitempty"`
+	// Rules are checked in order and the first match decides
+	Rules []Rule `json:"rules,omitempty"`
+	// DefaultHint tells an agent what to do when no rule allows its command
+	// under a default of "deny"
+	DefaultHint string `json:"default_hint,omitempty"`
+	// Windows refuse commands during maintenance windows, whatever the rules say
+	Windows []Window `json:"windows,omitempty"`
+}
+
+// defaultPolicy allows everything, so a server without a policy file behaves as before
+func defaultPolicy() *Policy {
+	return &Policy{
+		Default:     "allow",
+		MaxRisk:     RiskCritical,
+		DefaultRole: "agent",
+	}
+}
+
+// parse decodes and validates a policy file
+func parse(data []byte) (*Policy, error) {
+	p := defaultPolicy()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	if p.Default != "allow" && p.Default != "deny" {
+		return nil, fmt.Errorf("default must be \"allow\" or \"deny\", got %q", p.Default)
+	}
+	if len(p.Roles) > 0 {
+		if _, ok := p.Roles[p.DefaultRole]; !ok {
+			return nil, fmt.Errorf("default role %q is not defined", p.DefaultRole)
+		}
+	}
+	for transport, role := range p.TransportRoles {
+		if transport != TransportStdio && transport != TransportHTTP && transport != TransportGRPC {
+			return nil, fmt.Errorf("transport_roles: transport must be %q, %q or %q, got %q", TransportStdio, TransportHTTP, TransportGRPC, transport)
+		}
+		if _, ok := p.Roles[role]; len(p.Roles) > 0 && !ok {
+			return nil, fmt.Errorf("transport_roles: role %q for %s is not defined", role, transport)
+		}
+	}
+	if err := compileRules(p.Rules); err != nil {
+		return nil, err
+	}
+	for i := range p.Windows {
+		window := &p.Windows[i]
+		if window.Name == "" {
+			window.Name = fmt.Sprintf("window %d", i+1)
+		}
+		if err := window.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", window.Name, err)
+		}
+	}
+
+	return p, nil
+}
+
+// compileRules validates rules and compiles their patterns, naming the
+// rules that have no name after their position
+func compileRules(rules []Rule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Action != "allow" && rule.Action != "deny" {
+			return fmt.Errorf("%s: action must be \"allow\" or \"deny\", got %q", rule.Name, rule.Action)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", rule.Name, err)
+		}
+		rule.re = re
+		for _, alt := range rule.Alternatives {
+			if alt.Tool == "" && alt.Command == "" {
+				return fmt.Errorf("%s: each alternative needs a tool or a command", rule.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Restrictions narrow what the policy allows for some callers, such as the
+// clients using an execution profile. They can deny commands the policy
+// allows, but never allow one it denies.
+type Restrictions struct {
+	// Name says whose restrictions they are in decisions, e.g. "profile ci"
+	Name string `json:"-"`
+	// ReadOnly limits commands to the read-only command list
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Rules are checked in order and the first match decides; a command they
+	// allow is still checked against the policy's own rules. Tools that run no
+	// command, such as read_file, are decided by the first rule listing them.
+	Rules []Rule `json:"rules,omitempty"`
+	// Default is "allow" or "deny" for commands no rule matches (empty = allow)
+	Default string `json:"default,omitempty"`
+	// DefaultHint tells an agent what to do when no rule allows its command
+	// under a default of "deny"
+	DefaultHint string `json:"default_hint,omitempty"`
+}
+
+// Compile validates the restrictions and compiles their rules
+func (r *Restrictions) Compile() error {
+	if r.Default != "" && r.Default != "allow" && r.Default != "deny" {
+		return fmt.Errorf("default must be \"allow\" or \"deny\", got %q", r.Default)
+	}
+	return compileRules(r.Rules)
+}
+
+// Request is something a caller wants to do
+type Request struct {
+	Tool string
+	// Command is empty when only the tool call itself is checked
+	Command string
+	// Role is the caller's role (empty = the role of the caller's transport,
+	// or the policy's default role)
+	Role string
+	// Transport is how the caller reached the server (empty = over HTTP when
+	// the server serves it, over stdio otherwise)
+	Transport string
+	// Target is the persistent session the command runs in, and Cwd its
+	// requested working directory; both are only passed on to OPA
+	Target string
+	Cwd    string
+	// Confirmed is set when the call confirms a command a maintenance window
+	// asks to be confirmed
+	Confirmed bool
+	// At is when the command will run, for the maintenance windows (zero = now)
+	At time.Time
+	// Restrictions are checked before the policy's own rules (nil = none)
+	Restrictions *Restrictions
+}
+
+// Step is one stage of a decision
+type Step struct {
+	// Stage is "role", "read-only", "restriction", "rule", "default", "risk",
+	// "window" or "opa"
+	Stage  string `json:"stage"`
+	Name   string `json:"name,omitempty"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Decision is the outcome of evaluating a request, with every stage that contributed
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	Role    string `json:"role"`
+	Risk    Risk   `json:"risk"`
+	Source  string `json:"policy_source"`
+	Trace   []Step `json:"trace"`
+	// RetryAt is when the maintenance windows refusing the request close
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+	// Hint and Alternatives come from the rule that denied the command
+	Hint         string        `json:"hint,omitempty"`
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+}
+
+// deny records the first reason a request is refused
+func (d *Decision) deny(reason string) {
+	if d.Allowed {
+		d.Allowed = false
+		d.Reason = reason
+	}
+}
+
+// String renders the decision and its trace for display
+func (d Decision) String() string {
+	var b strings.Builder
+
+	verdict := "ALLOWED"
+	if !d.Allowed {
+		verdict = "DENIED"
+	}
+	fmt.Fprintf(&b, "Decision: %s\n", verdict)
+	if d.Reason != "" {
+		fmt.Fprintf(&b, "Reason: %s\n", d.Reason)
+	}
+	if d.RetryAt != nil {
+		fmt.Fprintf(&b, "Retry at: %s\n", d.RetryAt.Format(time.RFC3339))
+	}
+	b.WriteString(d.Suggestions())
+	fmt.Fprintf(&b, "Role: %s\nRisk: %s\nPolicy: %s\nTrace:\n", d.Role, d.Risk, d.Source)
+	for i, step := range d.Trace {
+		fmt.Fprintf(&b, "  %d. [%s]", i+1, step.Stage)
+		if step.Name != "" {
+			fmt.Fprintf(&b, " %s", step.Name)
+		}
+		fmt.Fprintf(&b, ": %s", step.Result)
+		if step.Detail != "" {
+			fmt.Fprintf(&b, " - %s", step.Detail)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Suggestions renders the hint and alternatives of a denial as lines to
+// show the agent, or "" when the policy gives none
+func (d Decision) Suggestions() string {
+	var b strings.Builder
+	if d.Hint != "" {
+		fmt.Fprintf(&b, "Hint: %s\n", d.Hint)
+	}
+	if len(d.Alternatives) > 0 {
+		b.WriteString("Alternatives:\n")
+	}
+	for _, alt := range d.Alternatives {
+		b.WriteString("  -")
+		if alt.Tool != "" {
+			fmt.Fprintf(&b, " tool %s", alt.Tool)
+		}
+		if alt.Command != "" {
+			fmt.Fprintf(&b, " `%s`", alt.Command)
+		}
+		if alt.Description != "" {
+			fmt.Fprintf(&b, ": %s", alt.Description)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Engine evaluates requests against the policy file, reloading it when it changes
+type Engine struct {
+	path string
+	// transport is how requests that do not say reach the server: "http"
+	// when it serves HTTP, "stdio" otherwise
+	transport string
+	opa       *opaClient
+	readOnly  *readOnly
+	// safe recognises read-only commands whether or not read-only mode is on
+	safe *readOnly
+
+	mu      sync.Mutex
+	policy  *Policy
+	modTime time.Time
+	// lastErr keeps a persistent load failure from being logged on every request
+	lastErr string
+}
+
+// New creates an engine for the configured policy file. A file that fails to
+// load denies every command until it is fixed, and marks the server degraded.
+func New(cfg *config.Config) *Engine {
+	e := &Engine{
+		path:      cfg.PolicyFile,
+		transport: TransportStdio,
+		opa:       newOPAClient(cfg.PolicyOPAURL, cfg.PolicyOPATimeout, cfg.BreakerThreshold),
+		readOnly:  newReadOnly(cfg.ReadOnly, cfg.ReadOnlyCommands),
+		safe:      newReadOnly(true, cfg.ReadOnlyCommands),
+		policy:    defaultPolicy(),
+	}
+	if cfg.HTTPMode {
+		e.transport = TransportHTTP
+	}
+	if e.path != "" {
+		e.policy = unloadedPolicy()
+		e.current()
+	}
+	return e
+}
+
+// unloadedPolicy denies every command until the configured policy file loads
+func unloadedPolicy() *Policy {
+	p := defaultPolicy()
+	p.Default = "deny"
+	p.Rules = []Rule{{
+		Name:    "policy not loaded",
+		Action:  "deny",
+		Reason:  "the policy file has not loaded; see /readyz",
+		Pattern: "",
+		re:      regexp.MustCompile(""),
+	}}
+	return p
+}
+
+// current returns the policy, reloading the file if it changed. When a reload
+// fails the last good policy stays in effect.
+func (e *Engine) current() *Policy {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.path == "" {
+		return e.policy
+	}
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		e.fail(err)
+		return e.policy
+	}
+	if info.ModTime().Equal(e.modTime) {
+		return e.policy
+	}
+	e.modTime = info.ModTime()
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		e.fail(err)
+		return e.policy
+	}
+	p, err := parse(data)
+	if err != nil {
+		e.fail(err)
+		return e.policy
+	}
+
+	e.policy = p
+	e.lastErr = ""
+	health.Clear("policy")
+	logging.For("policy").Info("Loaded policy", "path", e.path, "rules", len(p.Rules), "roles", len(p.Roles), "windows", len(p.Windows))
+
+	return e.policy
+}
+
+// fail reports a policy file that could not be loaded. The caller must hold e.mu.
+func (e *Engine) fail(err error) {
+	reason := fmt.Sprintf("failed to load %s: %v", e.path, err)
+	if reason == e.lastErr {
+		return
+	}
+	e.lastErr = reason
+	logging.For("policy").Error("Failed to load policy", "path", e.path, "error", err)
+	health.SetDegraded("policy", reason)
+}
+
+// source describes where the policy in effect came from
+func (e *Engine) source() string {
+	source := e.path
+	if source == "" {
+		source = "built-in default (allow all)"
+	}
+	if e.readOnly != nil {
+		source += " + read-only mode"
+	}
+	if e.opa != nil {
+		source += " + OPA " + e.opa.url
+	}
+	return source
+}
+
+// ReadOnly reports whether the server is in read-only mode
+func (e *Engine) ReadOnly() bool {
+	return e.readOnly != nil
+}
+
+// RoleReadOnly reports whether a caller with the given role (empty = the
+// transport's or default role) is limited to read-only commands
+func (e *Engine) RoleReadOnly(role, transport string) bool {
+	p := e.current()
+	return p.Roles[e.roleOf(p, role, transport)].ReadOnly
+}
+
+// transportOf resolves the transport a request came over
+func (e *Engine) transportOf(transport string) string {
+	if transport != "" {
+		return transport
+	}
+	return e.transport
+}
+
+// roleOf resolves the role a request is evaluated as
+func (e *Engine) roleOf(p *Policy, role, transport string) string {
+	if role != "" {
+		return role
+	}
+	if role := p.TransportRoles[e.transportOf(transport)]; role != "" {
+		return role
+	}
+	return p.DefaultRole
+}
+
+// Mutating reports whether a command may change state, that is whether it
+// runs anything outside the read-only command list
+func (e *Engine) Mutating(command string) bool {
+	return e.safe.check(command) != ""
+}
+
+// Evaluate decides whether a request is allowed. Every stage is evaluated so
+// the trace is complete even when an early stage denies the request.
+func (e *Engine) Evaluate(req Request) Decision {
+	p := e.current()
+
+	d := Decision{
+		Allowed: true,
+		Role:    e.roleOf(p, req.Role, req.Transport),
+		Source:  e.source(),
+	}
+
+	// Role-based access to tools
+	maxRisk := p.MaxRisk
+	roleReadOnly := false
+	if len(p.Roles) > 0 {
+		via := ""
+		if transport := e.transportOf(req.Transport); req.Role == "" && p.TransportRoles[transport] != "" {
+			via = fmt.Sprintf(" (role of %s clients)", transport)
+		}
+		role, ok := p.Roles[d.Role]
+		switch {
+		case !ok:
+			d.Trace = append(d.Trace, Step{Stage: "role", Name: d.Role, Result: "deny", Detail: "role is not defined" + via})
+			d.deny(fmt.Sprintf("role %s is not defined", d.Role))
+		case len(role.Tools) == 0 && slices.Contains(explicitTools, req.Tool):
+			d.Trace = append(d.Trace, Step{Stage: "role", Name: d.Role, Result: "deny", Detail: fmt.Sprintf("tool %s must be listed in the role's tools%s", req.Tool, via)})
+			d.deny(fmt.Sprintf("role %s does not list %s", d.Role, req.Tool))
+		case len(role.Tools) > 0 && !slices.Contains(role.Tools, req.Tool):
+			d.Trace = append(d.Trace, Step{Stage: "role", Name: d.Role, Result: "deny", Detail: fmt.Sprintf("tool %s is not permitted (allowed: %s)%s", req.Tool, strings.Join(role.Tools, ", "), via)})
+			d.deny(fmt.Sprintf("role %s may not use %s", d.Role, req.Tool))
+		default:
+			d.Trace = append(d.Trace, Step{Stage: "role", Name: d.Role, Result: "allow", Detail: fmt.Sprintf("tool %s is permitted%s", req.Tool, via)})
+		}
+		if ok && role.MaxRisk != nil {
+			maxRisk = *role.MaxRisk
+		}
+		roleReadOnly = role.ReadOnly
+	}
+
+	// Read-only mode, which applies whatever the policy file says, or else a
+	// read-only role
+	if e.readOnly != nil {
+		e.readOnly.evaluate(&d, req, "the server")
+	} else if roleReadOnly {
+		e.safe.evaluate(&d, req, "role "+d.Role)
+	}
+
+	// Restrictions of the caller, which can only deny
+	if req.Restrictions != nil {
+		e.restrict(&d, req)
+	}
+
+	if req.Command == "" {
+		return d
+	}
+
+	// Command rules, first match wins
+	matched := false
+	for _, rule := range p.Rules {
+		if len(rule.Tools) > 0 && !slices.Contains(rule.Tools, req.Tool) {
+			d.Trace = append(d.Trace, Step{Stage: "rule", Name: rule.Name, Result: "skip", Detail: "does not apply to " + req.Tool})
+			continue
+		}
+		if !rule.re.MatchString(req.Command) {
+			d.Trace = append(d.Trace, Step{Stage: "rule", Name: rule.Name, Result: "no match"})
+			continue
+		}
+
+		matched = true
+		d.Trace = append(d.Trace, Step{Stage: "rule", Name: rule.Name, Result: rule.Action, Detail: fmt.Sprintf("matched /%s/", rule.Pattern)})
+		if rule.Action == "deny" {
+			reason := rule.Reason
+			if reason == "" {
+				reason = "matched rule " + rule.Name
+			}
+			d.deny(reason)
+			d.Hint, d.Alternatives = rule.Hint, rule.Alternatives
+		}
+		break
+	}
+	if !matched {
+		d.Trace = append(d.Trace, Step{Stage: "default", Result: p.Default, Detail: "no rule matched"})
+		if p.Default == "deny" {
+			d.deny("no rule allows this command")
+			d.Hint = p.DefaultHint
+		}
+	}
+
+	// Risk classification
+	c := Classify(req.Command)
+	d.Risk = c.Risk
+	detail := "no risky patterns"
+	if len(c.Reasons) > 0 {
+		detail = strings.Join(c.Reasons, "; ")
+	}
+	if c.Risk > maxRisk {
+		d.Trace = append(d.Trace, Step{Stage: "risk", Name: c.Risk.String(), Result: "deny", Detail: fmt.Sprintf("%s; above the %s limit", detail, maxRisk)})
+		d.deny(fmt.Sprintf("%s risk exceeds the %s limit", c.Risk, maxRisk))
+	} else {
+		d.Trace = append(d.Trace, Step{Stage: "risk", Name: c.Risk.String(), Result: "allow", Detail: fmt.Sprintf("%s; within the %s limit", detail, maxRisk)})
+	}
+
+	// Maintenance windows
+	at := req.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	evaluateWindows(&d, p.Windows, req, c.Risk, at)
+
+	// External policy, which must also allow the command
+	if e.opa != nil {
+		e.opa.evaluate(&d, req, c)
+	}
+
+	return d
+}
+
+// restrict evaluates the restrictions of a request's caller
+func (e *Engine) restrict(d *Decision, req Request) {
+	r := req.Restrictions
+	who := r.Name
+	if r.ReadOnly {
+		e.safe.evaluate(d, req, who)
+	}
+
+	if req.Command == "" {
+		// Without a command only the rules listing the tool apply, whatever
+		// their pattern, and the default does not
+		for _, rule := range r.Rules {
+			if !slices.Contains(rule.Tools, req.Tool) {
+				continue
+			}
+			d.Trace = append(d.Trace, Step{Stage: "restriction", Name: rule.Name, Result: rule.Action, Detail: fmt.Sprintf("applies to %s of %s", req.Tool, who)})
+			if rule.Action == "deny" {
+				reason := rule.Reason
+				if reason == "" {
+					reason = fmt.Sprintf("%s forbids %s", who, req.Tool)
+				}
+				d.deny(reason)
+				d.Hint, d.Alternatives = rule.Hint, rule.Alternatives
+			}
+			return
+		}
+		return
+	}
+
+	for _, rule := range r.Rules {
+		if len(rule.Tools) > 0 && !slices.Contains(rule.Tools, req.Tool) {
+			d.Trace = append(d.Trace, Step{Stage: "restriction", Name: rule.Name, Result: "skip", Detail: "does not apply to " + req.Tool})
+			continue
+		}
+		if !rule.re.MatchString(req.Command) {
+			d.Trace = append(d.Trace, Step{Stage: "restriction", Name: rule.Name, Result: "no match"})
+			continue
+		}
+
+		d.Trace = append(d.Trace, Step{Stage: "restriction", Name: rule.Name, Result: rule.Action, Detail: fmt.Sprintf("matched /%s/ of %s", rule.Pattern, who)})
+		if rule.Action == "deny" {
+			reason := rule.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("matched rule %s of %s", rule.Name, who)
+			}
+			d.deny(reason)
+			d.Hint, d.Alternatives = rule.Hint, rule.Alternatives
+		}
+		return
+	}
+	if r.Default == "deny" {
+		d.Trace = append(d.Trace, Step{Stage: "restriction", Result: "deny", Detail: fmt.Sprintf("no rule of %s matched", who)})
+		d.deny(fmt.Sprintf("no rule of %s allows this command", who))
+		d.Hint = r.DefaultHint
+	}
+}
+
+// ToolFilter hides the tools the caller's role may not use from the tool list
+func (e *Engine) ToolFilter() server.ToolFilterFunc {
+	return func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+		role, transport := access.IdentityFrom(ctx).Role, access.Transport(ctx)
+		allowed := make([]mcp.Tool, 0, len(tools))
+		for _, tool := range tools {
+			if e.Evaluate(Request{Tool: tool.Name, Role: role, Transport: transport}).Allowed {
+				allowed = append(allowed, tool)
+			}
+		}
+		return allowed
+	}
+}
+
+// ToolMiddleware refuses tool calls the caller's role does not permit
+func (e *Engine) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if d := e.Evaluate(Request{Tool: request.Params.Name, Role: access.IdentityFrom(ctx).Role, Transport: access.Transport(ctx)}); !d.Allowed {
+				return mcp.NewToolResultError(fmt.Sprintf("Denied by policy: %s", d.Reason)), nil
+			}
+			return next(ctx, request)
+		}
+	}
+}
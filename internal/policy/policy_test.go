@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mcp-terminal-server/internal/config"
+)
+
+const testPolicy = `{
+  "default": "allow",
+  "default_role": "agent",
+  "roles": {
+    "agent": {},
+    "reader": {"tools": ["execute_command", "read_file"], "read_only": true}
+  },
+  "rules": [
+    {"name": "no-shutdown", "pattern": "^shutdown\\b", "action": "deny", "reason": "shutting down is not allowed"},
+    {"name": "shell-only", "tools": ["persistent_shell"], "pattern": "^top\\b", "action": "deny"}
+  ]
+}`
+
+// newTestEngine returns an engine for the policy file contents
+func newTestEngine(t *testing.T, contents string) *Engine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.NewConfig()
+	cfg.PolicyFile = path
+	return New(cfg)
+}
+
+func TestEvaluate(t *testing.T) {
+	e := newTestEngine(t, testPolicy)
+	compiled := func(r *Restrictions) *Restrictions {
+		if err := r.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	restricted := compiled(&Restrictions{
+		Name:     "profile ci",
+		ReadOnly: true,
+		Rules: []Rule{
+			{Name: "no-make", Pattern: `^make\b`, Action: "deny", Reason: "make is not allowed here"},
+			{Name: "no-listing", Tools: []string{"list_directory"}, Pattern: ".*", Action: "deny"},
+		},
+	})
+	denyByDefault := compiled(&Restrictions{
+		Name:    "profile python",
+		Rules:   []Rule{{Name: "python", Pattern: `^python3?\b`, Action: "allow"}},
+		Default: "deny",
+	})
+
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+		reason  string
+	}{
+		{
+			name:    "allowed by default",
+			req:     Request{Tool: "execute_command", Command: "ls -la"},
+			allowed: true,
+		},
+		{
+			name:   "denied by rule",
+			req:    Request{Tool: "execute_command", Command: "shutdown now"},
+			reason: "shutting down is not allowed",
+		},
+		{
+			name:    "rule for another tool",
+			req:     Request{Tool: "execute_command", Command: "top -b -n1"},
+			allowed: true,
+		},
+		{
+			name:   "rule for the tool",
+			req:    Request{Tool: "persistent_shell", Command: "top"},
+			reason: "matched rule shell-only",
+		},
+		{
+			name:   "undefined role",
+			req:    Request{Tool: "execute_command", Command: "ls", Role: "nobody"},
+			reason: "role nobody is not defined",
+		},
+		{
+			name:   "tool outside the role",
+			req:    Request{Tool: "write_file", Role: "reader"},
+			reason: "role reader may not use write_file",
+		},
+		{
+			name:    "read-only role running a listed command",
+			req:     Request{Tool: "execute_command", Command: "git status", Role: "reader"},
+			allowed: true,
+		},
+		{
+			name:   "read-only role running an unlisted command",
+			req:    Request{Tool: "execute_command", Command: "rm -rf build", Role: "reader"},
+			reason: "rm is not in the read-only command list",
+		},
+		{
+			name:   "restriction rule",
+			req:    Request{Tool: "execute_command", Command: "ls && make", Restrictions: restricted},
+			reason: "make is not in the read-only command list",
+		},
+		{
+			name:   "restriction rule without read-only",
+			req:    Request{Tool: "execute_command", Command: "make all", Restrictions: compiled(&Restrictions{Name: "profile ci", Rules: restricted.Rules})},
+			reason: "make is not allowed here",
+		},
+		{
+			name:   "read-only restrictions refuse write_file",
+			req:    Request{Tool: "write_file", Restrictions: restricted},
+			reason: "profile ci is read-only; write_file is disabled",
+		},
+		{
+			name:   "restriction rule listing a tool without commands",
+			req:    Request{Tool: "list_directory", Restrictions: restricted},
+			reason: "profile ci forbids list_directory",
+		},
+		{
+			name:    "restrictions allow other tools without commands",
+			req:     Request{Tool: "read_file", Restrictions: restricted},
+			allowed: true,
+		},
+		{
+			name:    "restrictions allowing a command",
+			req:     Request{Tool: "execute_command", Command: "python3 app.py", Restrictions: denyByDefault},
+			allowed: true,
+		},
+		{
+			name:   "restrictions denying by default",
+			req:    Request{Tool: "execute_command", Command: "node app.js", Restrictions: denyByDefault},
+			reason: "no rule of profile python allows this command",
+		},
+		{
+			name:    "restriction default ignores tools without commands",
+			req:     Request{Tool: "read_file", Restrictions: denyByDefault},
+			allowed: true,
+		},
+		{
+			name:   "restrictions cannot allow what the policy denies",
+			req:    Request{Tool: "execute_command", Command: "shutdown now", Restrictions: compiled(&Restrictions{Rules: []Rule{{Name: "all", Pattern: ".*", Action: "allow"}}})},
+			reason: "shutting down is not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := e.Evaluate(tt.req)
+			if d.Allowed != tt.allowed {
+				t.Fatalf("allowed = %v, want %v (reason %q)", d.Allowed, tt.allowed, d.Reason)
+			}
+			if !strings.Contains(d.Reason, tt.reason) {
+				t.Errorf("reason = %q, want one containing %q", d.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateUnloadedPolicy(t *testing.T) {
+	e := newTestEngine(t, "{not json")
+	d := e.Evaluate(Request{Tool: "execute_command", Command: "ls"})
+	if d.Allowed {
+		t.Fatal("a policy file that fails to load must deny commands")
+	}
+}
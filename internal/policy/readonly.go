@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// readOnlyTools are tools that only change state and are refused in read-only mode
+var readOnlyTools = []string{"write_file"}
+
+// harmlessRedirects are redirections that write nothing
+var harmlessRedirects = regexp.MustCompile(`\d?>\s*/dev/null|\d?>&\d`)
+
+// commandSeparators split a command line into the simple commands it runs
+var commandSeparators = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// writingOptions are options that make programs of the read-only list write
+// files or run other programs. A command using one is refused whatever entry
+// it matches. Long options also match as "--option=value", short ones with
+// their value attached.
+var writingOptions = map[string][]string{
+	// --output writes the diff or log to a file, --ext-diff and -c run a
+	// diff program of the caller's choosing
+	"git":  {"--output", "-o", "--ext-diff", "-c", "--config-env"},
+	"tree": {"-o"},
+	"file": {"-C", "--compile"},
+}
+
+// readOnly allows only commands from a fixed list. The check is deliberately
+// conservative: anything it cannot see through, such as command substitution
+// or a redirect into a file, is refused.
+type readOnly struct {
+	// commands are the allowed entries split into words, e.g. ["git", "status"]
+	commands [][]string
+}
+
+// newReadOnly creates the read-only check, or returns nil when the mode is off
+func newReadOnly(enabled bool, commands []string) *readOnly {
+	if !enabled {
+		return nil
+	}
+
+	r := &readOnly{}
+	for _, command := range commands {
+		if words := strings.Fields(command); len(words) > 0 {
+			r.commands = append(r.commands, words)
+		}
+	}
+	return r
+}
+
+// check returns why a command is not read-only, or "" when it is
+func (r *readOnly) check(command string) string {
+	stripped := harmlessRedirects.ReplaceAllString(command, "")
+	switch {
+	case strings.Contains(stripped, ">"):
+		return "output redirection may write files"
+	case strings.Contains(stripped, "$(") || strings.Contains(stripped, "`") || strings.Contains(stripped, "<("):
+		return "command substitution is not allowed"
+	}
+
+	for _, segment := range commandSeparators.Split(stripped, -1) {
+		words := strings.Fields(segment)
+		if len(words) == 0 {
+			continue
+		}
+		if !r.allows(words) {
+			return fmt.Sprintf("%s is not in the read-only command list", words[0])
+		}
+		if option := writingOption(words); option != "" {
+			return fmt.Sprintf("%s %s may write files or run other programs", words[0], option)
+		}
+	}
+	return ""
+}
+
+// allows reports whether a simple command starts with an allowed entry
+func (r *readOnly) allows(words []string) bool {
+	for _, allowed := range r.commands {
+		if len(words) >= len(allowed) && slices.Equal(words[:len(allowed)], allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// writingOption returns the first of a simple command's words that is one of
+// its program's writing options, or ""
+func writingOption(words []string) string {
+	options := writingOptions[words[0]]
+	for _, word := range words[1:] {
+		for _, option := range options {
+			switch {
+			case word == option, strings.HasPrefix(word, option+"="):
+				return option
+			case !strings.HasPrefix(option, "--") && !strings.HasPrefix(word, "--") && strings.HasPrefix(word, option):
+				// A short option with its value attached
+				return option
+			}
+		}
+	}
+	return ""
+}
+
+// evaluate adds the read-only stage to a decision; who names what is
+// read-only in the reason, "the server" or a role
+func (r *readOnly) evaluate(d *Decision, req Request, who string) {
+	if req.Command == "" {
+		if slices.Contains(readOnlyTools, req.Tool) {
+			d.Trace = append(d.Trace, Step{Stage: "read-only", Name: req.Tool, Result: "deny", Detail: "tool modifies files"})
+			d.deny(fmt.Sprintf("%s is read-only; %s is disabled", who, req.Tool))
+		}
+		return
+	}
+
+	if reason := r.check(req.Command); reason != "" {
+		d.Trace = append(d.Trace, Step{Stage: "read-only", Result: "deny", Detail: reason})
+		d.deny(who + " is read-only: " + reason)
+		return
+	}
+	d.Trace = append(d.Trace, Step{Stage: "read-only", Result: "allow", Detail: "every command is in the read-only list"})
+}
@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyCheck(t *testing.T) {
+	r := newReadOnly(true, []string{"ls", "cat", "grep", "git status", "git log", "git diff", "tree"})
+
+	tests := []struct {
+		command string
+		// reason is part of why the command is refused, or "" when it is allowed
+		reason string
+	}{
+		{"ls -la", ""},
+		{"git status --short", ""},
+		{"cat a.txt | grep foo", ""},
+		{"ls && git log -n 5; cat README.md", ""},
+		{"ls 2>/dev/null", ""},
+		{"grep foo bar 2>&1", ""},
+		{"rm -rf build", "rm is not in the read-only command list"},
+		{"git push", "git is not in the read-only command list"},
+		{"ls; rm a", "rm is not in the read-only command list"},
+		{"cat a > b", "output redirection may write files"},
+		{"cat a >> b", "output redirection may write files"},
+		{"cat $(which ls)", "command substitution is not allowed"},
+		{"cat `which ls`", "command substitution is not allowed"},
+		{"diff <(ls a) <(ls b)", "command substitution is not allowed"},
+		{"git diff --output=patch.diff", "git --output may write files"},
+		{"git log -c core.pager=sh", "git -c may write files"},
+		{"tree -o listing.txt", "tree -o may write files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			reason := r.check(tt.command)
+			switch {
+			case tt.reason == "" && reason != "":
+				t.Errorf("check(%q) = %q, want it allowed", tt.command, reason)
+			case tt.reason != "" && !strings.Contains(reason, tt.reason):
+				t.Errorf("check(%q) = %q, want one containing %q", tt.command, reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestWritingOption(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"git log --oneline", ""},
+		{"git diff --output patch", "--output"},
+		{"git diff --output=patch", "--output"},
+		{"git diff --ext-diff", "--ext-diff"},
+		{"git -c core.pager=sh log", "-c"},
+		{"git -ccore.pager=sh log", "-c"},
+		{"git --config-env=core.pager=PAGER log", "--config-env"},
+		{"git log --color", ""},
+		{"tree -o out.txt", "-o"},
+		{"tree -ofile", "-o"},
+		{"file -C -m magic", "-C"},
+		{"file --compile", "--compile"},
+		{"ls -o", ""},
+		{"cat --output", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := writingOption(strings.Fields(tt.command)); got != tt.want {
+				t.Errorf("writingOption(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Risk is how much damage a command could do
+type Risk int
+
+// Risk levels, ordered
+const (
+	RiskNone Risk = iota
+	RiskLow
+	RiskMedium
+	RiskHigh
+	RiskCritical
+)
+
+var riskNames = []string{"none", "low", "medium", "high", "critical"}
+
+func (r Risk) String() string {
+	if r < RiskNone || r > RiskCritical {
+		return fmt.Sprintf("risk(%d)", int(r))
+	}
+	return riskNames[r]
+}
+
+// ParseRisk converts a risk name to a level
+func ParseRisk(name string) (Risk, error) {
+	for i, n := range riskNames {
+		if strings.EqualFold(name, n) {
+			return Risk(i), nil
+		}
+	}
+	return RiskNone, fmt.Errorf("unknown risk level: %s", name)
+}
+
+// MarshalJSON encodes the risk by name
+func (r Risk) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON decodes a risk name
+func (r *Risk) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	risk, err := ParseRisk(name)
+	if err != nil {
+		return err
+	}
+	*r = risk
+	return nil
+}
+
+// classifier flags a kind of risky command
+type classifier struct {
+	// tag is a short identifier for external policies to match on
+	tag     string
+	name    string
+	risk    Risk
+	pattern *regexp.Regexp
+}
+
+// word matches the start of a command word, after the start of the line, a
+// separator or a wrapper such as sudo
+const word = `(?:^|[;&|(\x60]\s*|\$\(\s*|\b(?:sudo|env|nohup|exec|xargs)\s+)`
+
+// classifiers are checked in order; a command's risk is the highest that matches
+var classifiers = []classifier{
+	{"wipe-root", "recursive delete of a root or home directory", RiskCritical, regexp.MustCompile(word + `rm\s+(?:-\S+\s+)*-\S*[rR]\S*\s+(?:-\S+\s+)*(?:/|/\*|~/?|\$HOME/?)(?:\s|$)`)},
+	{"mkfs", "filesystem creation", RiskCritical, regexp.MustCompile(word + `mkfs(?:\.\w+)?\b`)},
+	{"raw-disk-write", "raw write to a block device", RiskCritical, regexp.MustCompile(`\bdd\b.*\bof=/dev/(?:sd|nvme|hd|vd|xvd|disk|mmcblk)|>\s*/dev/(?:sd|nvme|hd|vd|xvd|disk|mmcblk)`)},
+	{"fork-bomb", "fork bomb", RiskCritical, regexp.MustCompile(`:\s*\(\s*\)\s*\{\s*:\s*\|\s*:\s*&\s*\}`)},
+	{"root-permissions", "recursive permission change on the root directory", RiskCritical, regexp.MustCompile(word + `ch(?:mod|own)\s+(?:-\S+\s+)*-\S*R\S*\s+\S+\s+/(?:\s|$)`)},
+	{"privilege-escalation", "privilege escalation", RiskHigh, regexp.MustCompile(word + `(?:sudo|su|doas)\b`)},
+	{"remote-script", "remote script piped to a shell", RiskHigh, regexp.MustCompile(`\b(?:curl|wget)\b[^|]*\|\s*(?:sudo\s+)?(?:ba|z|da)?sh\b`)},
+	{"power", "system power state change", RiskHigh, regexp.MustCompile(word + `(?:shutdown|reboot|halt|poweroff)\b|\bsystemctl\s+(?:reboot|poweroff|halt)\b`)},
+	{"kill-all", "signal to every process", RiskHigh, regexp.MustCompile(word + `kill\s+(?:-\S+\s+)*-1\b`)},
+	{"recursive-delete", "recursive forced delete", RiskHigh, regexp.MustCompile(word + `rm\s+(?:-\S+\s+)*-(?:\S*[rR]\S*f|\S*f\S*[rR])`)},
+	{"force-push", "force push", RiskHigh, regexp.MustCompile(`\bgit\s+push\b.*(?:--force\b|\s-f\b)`)},
+	{"firewall", "firewall flush", RiskHigh, regexp.MustCompile(word + `(?:iptables|ip6tables|nft)\s+.*(?:-F\b|flush\b)`)},
+	{"delete", "file deletion", RiskMedium, regexp.MustCompile(word + `(?:rm|rmdir|shred|unlink)\b`)},
+	{"packages", "package installation or removal", RiskMedium, regexp.MustCompile(word + `(?:apt(?:-get)?|yum|dnf|apk|brew|pacman|zypper)\s+(?:install|remove|purge|erase|upgrade|add|del)\b|\b(?:pip3?|npm|gem|cargo)\s+(?:install|uninstall)\b`)},
+	{"services", "service management", RiskMedium, regexp.MustCompile(word + `(?:systemctl|service|launchctl)\s+`)},
+	{"signal", "process signalling", RiskMedium, regexp.MustCompile(word + `(?:kill|pkill|killall)\b`)},
+	{"permissions", "permission or ownership change", RiskMedium, regexp.MustCompile(word + `(?:chmod|chown|chgrp)\b`)},
+	{"discard-changes", "discarding version control changes", RiskMedium, regexp.MustCompile(`\bgit\s+(?:reset\s+--hard|clean\s+-\S*f|checkout\s+--\s)`)},
+	{"containers", "container removal", RiskMedium, regexp.MustCompile(`\b(?:docker|podman)\s+(?:rm|rmi|system\s+prune|volume\s+rm)\b`)},
+	{"network", "network transfer", RiskLow, regexp.MustCompile(word + `(?:curl|wget|scp|rsync|ssh|nc|ncat)\b`)},
+	{"overwrite", "file overwrite by redirection", RiskLow, regexp.MustCompile(`[^>&0-9]>\s*[^&>\s]|^>\s*\S`)},
+	{"move-copy", "file move or copy", RiskLow, regexp.MustCompile(word + `(?:mv|cp|ln)\b`)},
+}
+
+// Classification is the outcome of classifying a command
+type Classification struct {
+	Risk Risk
+	// Reasons names every classifier that matched, highest risk first
+	Reasons []string
+	// Tags are the short identifiers of the matching classifiers
+	Tags []string
+}
+
+// Classify estimates the risk of a command from built-in patterns
+func Classify(command string) Classification {
+	var c Classification
+	for _, cl := range classifiers {
+		if cl.pattern.MatchString(command) {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("%s (%s)", cl.name, cl.risk))
+			c.Tags = append(c.Tags, cl.tag)
+			if cl.risk > c.Risk {
+				c.Risk = cl.risk
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,232 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dayNames are the accepted names of weekdays, indexed by time.Weekday
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Window is a recurring or one-off period during which some commands are
+// refused, or only run when the call confirms them, such as business hours
+// on production hosts
+type Window struct {
+	Name string `json:"name"`
+	// Days the window opens on, as mon, tue, ... (empty = every day)
+	Days []string `json:"days,omitempty"`
+	// Start and End are the daily opening hours as HH:MM; an End before Start
+	// closes the window the next day (both empty = all day)
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Timezone is the IANA zone the hours are in (empty = the server's)
+	Timezone string `json:"timezone,omitempty"`
+	// From and Until bound the window as RFC 3339 times (optional)
+	From  *time.Time `json:"from,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+
+	// MinRisk and Pattern select the commands the window applies to: those
+	// classified at least MinRisk, or matching Pattern (neither = all commands)
+	MinRisk *Risk  `json:"min_risk,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// Tools limits the window to these tools (empty = every tool that runs commands)
+	Tools []string `json:"tools,omitempty"`
+	// Action is "deny" or "confirm"
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+
+	days       []time.Weekday
+	start, end time.Duration
+	daily      bool
+	loc        *time.Location
+	re         *regexp.Regexp
+}
+
+// compile validates a window and prepares it for matching
+func (w *Window) compile() error {
+	if w.Action != "deny" && w.Action != "confirm" {
+		return fmt.Errorf("action must be \"deny\" or \"confirm\", got %q", w.Action)
+	}
+
+	for _, day := range w.Days {
+		i := slices.Index(dayNames, strings.ToLower(day[:min(3, len(day))]))
+		if i < 0 {
+			return fmt.Errorf("unknown day %q", day)
+		}
+		w.days = append(w.days, time.Weekday(i))
+	}
+
+	if (w.Start == "") != (w.End == "") {
+		return fmt.Errorf("give both start and end, or neither")
+	}
+	if w.Start != "" {
+		var err error
+		if w.start, err = clock(w.Start); err != nil {
+			return fmt.Errorf("invalid start: %v", err)
+		}
+		if w.end, err = clock(w.End); err != nil {
+			return fmt.Errorf("invalid end: %v", err)
+		}
+		w.daily = true
+	}
+
+	w.loc = time.Local
+	if w.Timezone != "" {
+		loc, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %v", err)
+		}
+		w.loc = loc
+	}
+
+	if w.Pattern != "" {
+		re, err := regexp.Compile(w.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		w.re = re
+	}
+	return nil
+}
+
+// clock parses a time of day as HH:MM
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// covers reports whether the window applies to a request
+func (w *Window) covers(req Request, risk Risk) bool {
+	if len(w.Tools) > 0 && !slices.Contains(w.Tools, req.Tool) {
+		return false
+	}
+	if w.MinRisk == nil && w.re == nil {
+		return true
+	}
+	return (w.MinRisk != nil && risk >= *w.MinRisk) || (w.re != nil && w.re.MatchString(req.Command))
+}
+
+// closes returns when the window that is open at now closes, or false when
+// it is not open. A window open until further notice closes at the zero time.
+func (w *Window) closes(now time.Time) (time.Time, bool) {
+	if (w.From != nil && now.Before(*w.From)) || (w.Until != nil && !now.Before(*w.Until)) {
+		return time.Time{}, false
+	}
+
+	var end time.Time
+	if w.daily {
+		var ok bool
+		if end, ok = w.dailyEnd(now.In(w.loc)); !ok {
+			return time.Time{}, false
+		}
+	} else if len(w.days) > 0 {
+		local := now.In(w.loc)
+		if !slices.Contains(w.days, local.Weekday()) {
+			return time.Time{}, false
+		}
+		end = midnight(local).AddDate(0, 0, 1)
+	}
+
+	if w.Until != nil && (end.IsZero() || w.Until.Before(end)) {
+		end = *w.Until
+	}
+	return end, true
+}
+
+// dailyEnd returns when today's opening hours end, or those that started the
+// day before and run past midnight, if local is within them
+func (w *Window) dailyEnd(local time.Time) (time.Time, bool) {
+	today := midnight(local)
+	for _, opened := range []time.Time{today, today.AddDate(0, 0, -1)} {
+		if len(w.days) > 0 && !slices.Contains(w.days, opened.Weekday()) {
+			continue
+		}
+		start := opened.Add(w.start)
+		end := opened.Add(w.end)
+		if w.end <= w.start {
+			end = opened.AddDate(0, 0, 1).Add(w.end)
+		}
+		if !local.Before(start) && local.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// midnight returns the start of t's day in its location
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// describe summarises when the window is open
+func (w *Window) describe() string {
+	var parts []string
+	if len(w.Days) > 0 {
+		parts = append(parts, strings.Join(w.Days, ","))
+	}
+	if w.daily {
+		parts = append(parts, w.Start+"-"+w.End)
+	}
+	if len(parts) > 0 {
+		parts = append(parts, w.loc.String())
+	}
+	if w.From != nil {
+		parts = append(parts, "from "+w.From.Format(time.RFC3339))
+	}
+	if w.Until != nil {
+		parts = append(parts, "until "+w.Until.Format(time.RFC3339))
+	}
+	if len(parts) == 0 {
+		return "always"
+	}
+	return strings.Join(parts, " ")
+}
+
+// evaluateWindows refuses commands covered by an open window, unless the
+// window only asks for confirmation and the request is confirmed. The
+// decision says when the agent can retry.
+func evaluateWindows(d *Decision, windows []Window, req Request, risk Risk, now time.Time) {
+	for _, w := range windows {
+		if !w.covers(req, risk) {
+			d.Trace = append(d.Trace, Step{Stage: "window", Name: w.Name, Result: "skip", Detail: "does not apply to this command"})
+			continue
+		}
+		end, open := w.closes(now)
+		if !open {
+			d.Trace = append(d.Trace, Step{Stage: "window", Name: w.Name, Result: "skip", Detail: "closed (" + w.describe() + ")"})
+			continue
+		}
+
+		until := "until further notice"
+		if !end.IsZero() {
+			left := max(end.Sub(now).Round(time.Minute), time.Minute)
+			until = fmt.Sprintf("until %s (in %s)", end.Format(time.RFC3339), strings.TrimSuffix(left.String(), "0s"))
+		}
+		if w.Action == "confirm" && req.Confirmed {
+			d.Trace = append(d.Trace, Step{Stage: "window", Name: w.Name, Result: "allow", Detail: "open " + until + "; confirmed"})
+			continue
+		}
+
+		reason := w.Reason
+		if reason == "" {
+			reason = "maintenance window " + w.Name + " is open"
+		}
+		d.Trace = append(d.Trace, Step{Stage: "window", Name: w.Name, Result: "deny", Detail: "open " + until})
+		if w.Action == "confirm" {
+			d.deny(fmt.Sprintf("%s %s; call again with confirm set to true to run it anyway", reason, until))
+		} else if end.IsZero() {
+			d.deny(fmt.Sprintf("%s %s", reason, until))
+		} else {
+			d.deny(fmt.Sprintf("%s %s; retry after that", reason, until))
+		}
+		if !end.IsZero() && (d.RetryAt == nil || end.After(*d.RetryAt)) {
+			d.RetryAt = &end
+		}
+	}
+}
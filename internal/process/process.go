@@ -0,0 +1,498 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Process is a snapshot of one running process
+type Process struct {
+	PID      int
+	PPID     int
+	User     string
+	Name     string
+	Command  string
+	State    string
+	RSSBytes int64
+	CPUTime  time.Duration
+	// ChildCPUTime is the CPU time of children the process has waited for,
+	// where the platform exposes it
+	ChildCPUTime time.Duration
+	Started      time.Time
+	// Cwd is only filled in by Get, and only where the platform exposes it
+	Cwd string
+}
+
+// Filter selects processes in List. Empty fields match everything.
+type Filter struct {
+	// Name matches a substring of the process name or command line
+	Name string
+	User string
+	// DescendantsOf keeps only processes below this PID (0 = no restriction)
+	DescendantsOf int
+}
+
+// List returns the processes matching filter, ordered by PID
+func List(filter Filter) ([]Process, error) {
+	all, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var parents map[int]int
+	if filter.DescendantsOf > 0 {
+		parents = make(map[int]int, len(all))
+		for _, p := range all {
+			parents[p.PID] = p.PPID
+		}
+	}
+
+	var matched []Process
+	for _, p := range all {
+		if filter.Name != "" && !strings.Contains(p.Name, filter.Name) && !strings.Contains(p.Command, filter.Name) {
+			continue
+		}
+		if filter.User != "" && p.User != filter.User {
+			continue
+		}
+		if filter.DescendantsOf > 0 && !descends(p.PID, filter.DescendantsOf, parents) {
+			continue
+		}
+		matched = append(matched, p)
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].PID < matched[j].PID })
+	return matched, nil
+}
+
+// descends reports whether pid is below ancestor in the process tree
+func descends(pid, ancestor int, parents map[int]int) bool {
+	for seen := 0; pid > 1 && seen < len(parents); seen++ {
+		ppid, ok := parents[pid]
+		if !ok {
+			return false
+		}
+		if ppid == ancestor {
+			return true
+		}
+		pid = ppid
+	}
+	return false
+}
+
+// TreeCPU returns the CPU time used so far by each of roots and everything
+// below it: the running processes as well as the children already waited for
+func TreeCPU(roots ...int) (map[int]time.Duration, error) {
+	all, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int]int, len(all))
+	for _, p := range all {
+		parents[p.PID] = p.PPID
+	}
+
+	used := make(map[int]time.Duration, len(roots))
+	for _, root := range roots {
+		for _, p := range all {
+			if p.PID == root || descends(p.PID, root, parents) {
+				used[root] += p.CPUTime + p.ChildCPUTime
+			}
+		}
+	}
+	return used, nil
+}
+
+// Get returns details of a single process
+func Get(pid int) (*Process, error) {
+	return lookup(pid)
+}
+
+// Children returns the PIDs of the direct children of pid
+func Children(pid int) ([]int, error) {
+	all, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var children []int
+	for _, p := range all {
+		if p.PPID == pid {
+			children = append(children, p.PID)
+		}
+	}
+	sort.Ints(children)
+	return children, nil
+}
+
+// signals are the signal names accepted by ParseSignal
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"CONT": syscall.SIGCONT,
+	"STOP": syscall.SIGSTOP,
+}
+
+// ParseSignal converts a signal name such as "TERM" or "SIGKILL" to a signal
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unsupported signal: %s", name)
+}
+
+// Kill sends sig to pid, or to its whole process group when group is set.
+// The init process and the server itself are refused.
+func Kill(pid int, sig syscall.Signal, group bool) error {
+	if pid <= 1 {
+		return fmt.Errorf("refusing to signal PID %d", pid)
+	}
+	if pid == os.Getpid() {
+		return fmt.Errorf("refusing to signal the server itself")
+	}
+
+	target := pid
+	if group {
+		pgid, err := syscall.Getpgid(pid)
+		if err != nil {
+			return fmt.Errorf("failed to find process group of %d: %v", pid, err)
+		}
+		if pgid == syscall.Getpgrp() {
+			return fmt.Errorf("refusing to signal the server's own process group")
+		}
+		target = -pgid
+	}
+
+	if err := syscall.Kill(target, sig); err != nil {
+		return fmt.Errorf("failed to send %v to %d: %v", sig, pid, err)
+	}
+	return nil
+}
+
+// User is an account commands run as in place of the server's
+type User struct {
+	Name   string
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+	Home   string
+}
+
+// LookupUser finds a user by name or numeric ID
+func LookupUser(name string) (*User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric ID", name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric group ID", name)
+	}
+
+	found := &User{Name: u.Username, UID: uint32(uid), GID: uint32(gid), Home: u.HomeDir}
+	// Without its supplementary groups the user would keep the server's
+	groupIDs, _ := u.GroupIds()
+	for _, id := range groupIDs {
+		if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+			found.Groups = append(found.Groups, uint32(g))
+		}
+	}
+	return found, nil
+}
+
+// RunAs makes cmd run as u, which takes the server running as root. HOME,
+// USER and LOGNAME are set to u's when cmd has an environment of its own, so
+// it must be called after that is set. A nil u leaves cmd alone.
+func RunAs(cmd *exec.Cmd, u *User) {
+	if u == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: u.UID, Gid: u.GID, Groups: u.Groups}
+	if cmd.Env != nil {
+		cmd.Env = append(cmd.Env, "HOME="+u.Home, "USER="+u.Name, "LOGNAME="+u.Name)
+	}
+}
+
+// Kill is Kill on behalf of u, which may only signal processes it runs as;
+// with group set, every process in the group must be u's
+func (u *User) Kill(pid int, sig syscall.Signal, group bool) error {
+	targets := []int{pid}
+	if group {
+		pgid, err := syscall.Getpgid(pid)
+		if err != nil {
+			return fmt.Errorf("failed to find process group of %d: %v", pid, err)
+		}
+		all, err := List(Filter{})
+		if err != nil {
+			return err
+		}
+		for _, p := range all {
+			if g, err := syscall.Getpgid(p.PID); err == nil && g == pgid && p.PID != pid {
+				targets = append(targets, p.PID)
+			}
+		}
+	}
+
+	for i, target := range targets {
+		p, err := Get(target)
+		if err != nil {
+			if i > 0 {
+				// Exited since the group was listed
+				continue
+			}
+			return err
+		}
+		if p.User != u.Name && p.User != strconv.FormatUint(uint64(u.UID), 10) {
+			return fmt.Errorf("process %d belongs to %s, not user %s", target, p.User, u.Name)
+		}
+	}
+	return Kill(pid, sig, group)
+}
+
+// Open opens a file for reading on behalf of u, such as one u's commands
+// produced, refusing it unless u could read it itself. path must be absolute
+// with its symlinks resolved: it is opened a directory at a time and symlinks
+// anywhere in it are refused, so one u swaps in cannot lead the server to a
+// file u cannot read. Permissions are judged by the mode bits alone.
+func (u *User) Open(path string) (*os.File, error) {
+	return u.OpenFile(path, os.O_RDONLY, 0)
+}
+
+// OpenFile is Open with the flags and permissions of os.OpenFile. Opening for
+// writing needs write access; a file it creates, which needs write access to
+// the directory, is given to u.
+func (u *User) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%s is not an absolute path", path)
+	}
+	parent := filepath.Dir(filepath.Clean(path))
+	dir, err := u.openDir(parent, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(dir)
+	if err := u.check(dir, parent, 1); err != nil {
+		return nil, err
+	}
+
+	access := uint32(4)
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_WRONLY:
+		access = 2
+	case os.O_RDWR:
+		access = 6
+	}
+
+	name := filepath.Base(path)
+	fd, err := unix.Openat(dir, name, flag&^(os.O_CREATE|os.O_EXCL|os.O_TRUNC)|unix.O_NOFOLLOW|unix.O_CLOEXEC|unix.O_NONBLOCK, 0)
+	switch {
+	case err == nil:
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			unix.Close(fd)
+			return nil, &os.PathError{Op: "open", Path: path, Err: unix.EEXIST}
+		}
+		if err := u.check(fd, path, access); err != nil {
+			unix.Close(fd)
+			return nil, err
+		}
+		if flag&os.O_TRUNC != 0 {
+			if err := unix.Ftruncate(fd, 0); err != nil {
+				unix.Close(fd)
+				return nil, &os.PathError{Op: "truncate", Path: path, Err: err}
+			}
+		}
+	case errors.Is(err, unix.ENOENT) && flag&os.O_CREATE != 0:
+		if err := u.check(dir, parent, 2); err != nil {
+			return nil, err
+		}
+		fd, err = unix.Openat(dir, name, flag|os.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC|unix.O_NONBLOCK, uint32(perm.Perm()))
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		if err := unix.Fchown(fd, int(u.UID), int(u.GID)); err != nil {
+			unix.Close(fd)
+			return nil, &os.PathError{Op: "chown", Path: path, Err: err}
+		}
+	case errors.Is(err, unix.ELOOP):
+		return nil, fmt.Errorf("%s leads through a symlink", path)
+	default:
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// MkdirAll creates the directory path and any missing parents on behalf of
+// u, as os.MkdirAll does, where u could create them itself; the directories
+// it creates are given to u. Symlinks in path are refused as by Open.
+func (u *User) MkdirAll(path string, perm os.FileMode) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%s is not an absolute path", path)
+	}
+	fd, err := u.openDir(filepath.Clean(path), true, perm)
+	if err != nil {
+		return err
+	}
+	unix.Close(fd)
+	return nil
+}
+
+// openDir opens the directory path a component at a time, each directory on
+// the way searchable by u, creating the missing ones for u when mkdir is set
+func (u *User) openDir(path string, mkdir bool, perm os.FileMode) (int, error) {
+	fd, err := unix.Open("/", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: "/", Err: err}
+	}
+
+	at := "/"
+	for _, name := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if err := u.check(fd, at, 1); err != nil {
+			unix.Close(fd)
+			return -1, err
+		}
+		const flags = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+		next, err := unix.Openat(fd, name, flags, 0)
+		if errors.Is(err, unix.ENOENT) && mkdir {
+			if err := u.check(fd, at, 2); err != nil {
+				unix.Close(fd)
+				return -1, err
+			}
+			err = unix.Mkdirat(fd, name, uint32(perm.Perm()))
+			if err == nil {
+				err = unix.Fchownat(fd, name, int(u.UID), int(u.GID), unix.AT_SYMLINK_NOFOLLOW)
+			}
+			if err == nil || errors.Is(err, unix.EEXIST) {
+				next, err = unix.Openat(fd, name, flags, 0)
+			}
+		}
+		unix.Close(fd)
+		at = filepath.Join(at, name)
+		if errors.Is(err, unix.ELOOP) {
+			return -1, fmt.Errorf("%s is a symlink", at)
+		}
+		if err != nil {
+			return -1, &os.PathError{Op: "open", Path: at, Err: err}
+		}
+		fd = next
+	}
+	return fd, nil
+}
+
+// check returns an error unless u has the access in perm (4 read, 2 write,
+// 1 search) to the open file fd at path
+func (u *User) check(fd int, path string, perm uint32) error {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	mode := uint32(st.Mode)
+	switch {
+	case u.UID == 0:
+		return nil
+	case st.Uid == u.UID:
+		mode >>= 6
+	case st.Gid == u.GID || slices.Contains(u.Groups, st.Gid):
+		mode >>= 3
+	}
+	for i, what := range []string{"readable", "writable", "searchable"} {
+		if bit := uint32(4 >> i); perm&bit != 0 && mode&bit == 0 {
+			return fmt.Errorf("%w: %s is not %s by user %s", os.ErrPermission, path, what, u.Name)
+		}
+	}
+	return nil
+}
+
+// stopPoll is how often Stop checks whether the processes have exited
+const stopPoll = 50 * time.Millisecond
+
+// Group starts cmd in a process group of its own and makes cancelling its
+// context stop the whole group: SIGTERM first, then SIGKILL to whatever is
+// left once grace has passed. Killing only the shell, as exec.CommandContext
+// does, would leave the commands it started running.
+func Group(cmd *exec.Cmd, grace time.Duration) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	DieWithServer(cmd)
+
+	cmd.Cancel = func() error {
+		// The command leads its group, so -pid addresses every process in it
+		pgid := cmd.Process.Pid
+		if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+			if errors.Is(err, syscall.ESRCH) {
+				return os.ErrProcessDone
+			}
+			return err
+		}
+		time.AfterFunc(grace, func() { syscall.Kill(-pgid, syscall.SIGKILL) })
+		return nil
+	}
+	// Output pipes held by processes that escaped the group are closed a
+	// little after the SIGKILL, so waiting for the command cannot hang
+	cmd.WaitDelay = grace + time.Second
+}
+
+// Stop sends SIGTERM to the processes list returns and, once grace has
+// passed, SIGKILL to those still running, listing them again so processes
+// started in the meantime are caught too. It returns as soon as none are left
+// and reports how many processes had to be killed.
+func Stop(list func() []int, grace time.Duration) int {
+	pids := list()
+	if len(pids) == 0 {
+		return 0
+	}
+	for _, pid := range pids {
+		syscall.Kill(pid, syscall.SIGTERM)
+	}
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		time.Sleep(stopPoll)
+		if len(list()) == 0 {
+			return 0
+		}
+	}
+
+	killed := 0
+	for _, pid := range list() {
+		if syscall.Kill(pid, syscall.SIGKILL) == nil {
+			killed++
+		}
+	}
+	return killed
+}
@@ -0,0 +1,175 @@
+//go:build linux
+
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// clockTicks is USER_HZ, which is 100 on every supported Linux architecture
+const clockTicks = 100
+
+var (
+	bootTimeOnce sync.Once
+	bootTime     time.Time
+
+	userNamesMu sync.Mutex
+	userNames   = make(map[string]string)
+)
+
+// snapshot reads every process from /proc
+func snapshot() ([]Process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %v", err)
+	}
+
+	var processes []Process
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// Processes may exit while the snapshot is taken
+		if p, err := read(pid); err == nil {
+			processes = append(processes, *p)
+		}
+	}
+	return processes, nil
+}
+
+// lookup reads one process including its working directory
+func lookup(pid int) (*Process, error) {
+	p, err := read(pid)
+	if err != nil {
+		return nil, err
+	}
+	p.Cwd, _ = os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	return p, nil
+}
+
+// read parses /proc/<pid>/stat, status and cmdline
+func read(pid int) (*Process, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("process not found: %d", pid)
+		}
+		return nil, err
+	}
+
+	// The name is in parentheses and may itself contain spaces or parentheses
+	line := string(stat)
+	open, close := strings.IndexByte(line, '('), strings.LastIndexByte(line, ')')
+	if open < 0 || close < open {
+		return nil, fmt.Errorf("malformed stat for %d", pid)
+	}
+	fields := strings.Fields(line[close+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("malformed stat for %d", pid)
+	}
+
+	p := &Process{
+		PID:   pid,
+		Name:  line[open+1 : close],
+		State: fields[0],
+	}
+	p.PPID, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	p.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	cutime, _ := strconv.ParseInt(fields[13], 10, 64)
+	cstime, _ := strconv.ParseInt(fields[14], 10, 64)
+	p.ChildCPUTime = time.Duration(cutime+cstime) * time.Second / clockTicks
+	if startTicks, err := strconv.ParseInt(fields[19], 10, 64); err == nil {
+		p.Started = boot().Add(time.Duration(startTicks) * time.Second / clockTicks)
+	}
+	if rssPages, err := strconv.ParseInt(fields[21], 10, 64); err == nil {
+		p.RSSBytes = rssPages * int64(os.Getpagesize())
+	}
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.Command = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	if p.Command == "" {
+		// Kernel threads have no command line
+		p.Command = "[" + p.Name + "]"
+	}
+
+	p.User = owner(dir)
+	return p, nil
+}
+
+// owner returns the name of the real user of the process in dir
+func owner(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "Uid:" {
+			return userName(fields[1])
+		}
+	}
+	return ""
+}
+
+// userName resolves a UID to a user name, falling back to the number
+func userName(uid string) string {
+	userNamesMu.Lock()
+	defer userNamesMu.Unlock()
+
+	if name, ok := userNames[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	userNames[uid] = name
+	return name
+}
+
+// boot returns the system boot time from /proc/stat
+func boot() time.Time {
+	bootTimeOnce.Do(func() {
+		data, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if secs, ok := strings.CutPrefix(line, "btime "); ok {
+				if n, err := strconv.ParseInt(strings.TrimSpace(secs), 10, 64); err == nil {
+					bootTime = time.Unix(n, 0)
+				}
+				return
+			}
+		}
+	})
+	return bootTime
+}
+
+// DieWithServer has the kernel kill cmd when the server exits, however it
+// exits, so a server that is killed outright leaves no shells behind
+func DieWithServer(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
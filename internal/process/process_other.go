@@ -0,0 +1,83 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// psFormat lists the columns read from ps; command is last because it contains spaces
+const psFormat = "pid=,ppid=,user=,state=,rss=,time=,etime=,command="
+
+// snapshot lists every process using ps
+func snapshot() ([]Process, error) {
+	return ps("-ax")
+}
+
+// lookup lists a single process using ps. The working directory is not available.
+func lookup(pid int) (*Process, error) {
+	processes, err := ps("-p", strconv.Itoa(pid))
+	if err != nil || len(processes) == 0 {
+		return nil, fmt.Errorf("process not found: %d", pid)
+	}
+	return &processes[0], nil
+}
+
+// ps runs ps with the given selection arguments and parses its output
+func ps(selection ...string) ([]Process, error) {
+	out, err := exec.Command("ps", append(selection, "-ww", "-o", psFormat)...).Output()
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("failed to run ps: %v", err)
+	}
+
+	now := time.Now()
+	var processes []Process
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+
+		p := Process{
+			User:    fields[2],
+			State:   fields[3],
+			Command: strings.Join(fields[7:], " "),
+		}
+		p.PID, _ = strconv.Atoi(fields[0])
+		p.PPID, _ = strconv.Atoi(fields[1])
+		if rssKB, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+			p.RSSBytes = rssKB * 1024
+		}
+		p.CPUTime = parseClock(fields[5])
+		p.Started = now.Add(-parseClock(fields[6])).Truncate(time.Second)
+		p.Name = filepath.Base(fields[7])
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+// parseClock parses ps durations of the form [[dd-]hh:]mm:ss[.cc]
+func parseClock(s string) time.Duration {
+	var days int
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		days, _ = strconv.Atoi(d)
+		s = rest
+	}
+
+	var total time.Duration
+	for _, part := range strings.Split(s, ":") {
+		seconds, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + time.Duration(seconds*float64(time.Second))
+	}
+	return total + time.Duration(days)*24*time.Hour
+}
+
+// DieWithServer does nothing where the kernel cannot tie a process's life
+// to the server's; such processes are only stopped when the server shuts
+// down cleanly
+func DieWithServer(cmd *exec.Cmd) {}
@@ -0,0 +1,467 @@
+package profiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/limits"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/shells"
+)
+
+// profileName matches the names profiles may be given
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// defaulted lists the arguments a profile fills in for each tool
+var defaulted = map[string][]string{
+	"execute_command":  {"shell", "cwd", "timeout", "io_read_bps", "io_write_bps", "cpus", "nice", "io_class", "io_priority"},
+	"persistent_shell": {"shell", "cwd", "timeout", "io_read_bps", "io_write_bps", "cpus", "nice", "io_class", "io_priority"},
+	"schedule_command": {"timeout"},
+}
+
+// selectable are the tools whose calls can pick a profile of their own with
+// a profile argument
+var selectable = map[string]bool{"execute_command": true, "persistent_shell": true}
+
+// Profile is a named set of defaults for the calls of an MCP client, so it
+// need not repeat its shell, directory and environment on every call. An
+// operator can also use one as a safe preset, restricting what the calls
+// may run and locking its settings in place.
+type Profile struct {
+	Name string `json:"-"`
+	// Shell, Cwd and Timeout (seconds) are used by calls that do not give their own
+	Shell   string  `json:"shell,omitempty"`
+	Cwd     string  `json:"cwd,omitempty"`
+	Timeout float64 `json:"timeout,omitempty"`
+	// IOReadBPS, IOWriteBPS, CPUs, Nice, IOClass and IOPriority are the
+	// resource limits and scheduling priority of calls that do not give
+	// their own, as for the arguments of the same names
+	IOReadBPS  int64  `json:"io_read_bps,omitempty"`
+	IOWriteBPS int64  `json:"io_write_bps,omitempty"`
+	CPUs       string `json:"cpus,omitempty"`
+	Nice       *int   `json:"nice,omitempty"`
+	IOClass    string `json:"io_class,omitempty"`
+	IOPriority *int   `json:"io_priority,omitempty"`
+	// Env is added to the environment of one-off commands and new sessions
+	Env map[string]string `json:"env,omitempty"`
+	// User is who one-off commands and new sessions run as, by name or ID,
+	// which takes the server running as root
+	User string `json:"user,omitempty"`
+	// Policy narrows what the policy allows the commands of calls using the
+	// profile; it can deny commands but never allow ones the policy denies
+	Policy *policy.Restrictions `json:"policy,omitempty"`
+	// Locked keeps calls to the profile's settings: arguments overriding
+	// them are refused, and a client using it cannot switch to another
+	Locked bool `json:"locked,omitempty"`
+	// Teardown are commands run when a persistent session created with the
+	// profile closes, expires or is closed by the server shutting down, each
+	// given TeardownTimeout seconds
+	Teardown        []string `json:"teardown,omitempty"`
+	TeardownTimeout float64  `json:"teardown_timeout,omitempty"`
+	// Clients are the clientInfo names of MCP clients given the profile when
+	// they initialize
+	Clients []string `json:"clients,omitempty"`
+
+	// runAs is User, looked up when the profiles are loaded
+	runAs *process.User
+}
+
+// file is the layout of the profiles file
+type file struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Store holds the configured profiles and which one each MCP client uses
+type Store struct {
+	profiles map[string]Profile
+	// byClientInfo maps a clientInfo name to the profile it selects
+	byClientInfo map[string]string
+	log          *slog.Logger
+
+	mu sync.Mutex
+	// selected maps an MCP client to the profile its calls use
+	selected map[string]string
+}
+
+// Load reads the profiles file, or returns nil when none is configured
+func Load(cfg *config.Config) (*Store, error) {
+	if cfg.ProfilesFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(cfg.ProfilesFile)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	s := &Store{
+		profiles:     make(map[string]Profile, len(f.Profiles)),
+		byClientInfo: make(map[string]string),
+		log:          logging.For("profiles"),
+		selected:     make(map[string]string),
+	}
+	for name, p := range f.Profiles {
+		if err := p.validate(name, cfg); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", name, err)
+		}
+		for _, client := range p.Clients {
+			if other, ok := s.byClientInfo[client]; ok {
+				return nil, fmt.Errorf("client %q is given to profiles %q and %q", client, other, name)
+			}
+			s.byClientInfo[client] = name
+		}
+		p.Name = name
+		s.profiles[name] = p
+	}
+	return s, nil
+}
+
+// validate checks a profile's settings, looking up its user and compiling
+// its policy
+func (p *Profile) validate(name string, cfg *config.Config) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("name must be letters, digits, '.', '_' and '-'")
+	}
+	if name == "none" {
+		return fmt.Errorf("the name none is reserved")
+	}
+	if p.Shell != "" {
+		if _, err := shells.Validate(p.Shell); err != nil {
+			return err
+		}
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if p.IOReadBPS < 0 || p.IOWriteBPS < 0 {
+		return fmt.Errorf("io_read_bps and io_write_bps must not be negative")
+	}
+	if cfg.IOReadBPS > 0 && p.IOReadBPS > cfg.IOReadBPS {
+		return fmt.Errorf("io_read_bps must be at most %d, the server's limit", cfg.IOReadBPS)
+	}
+	if cfg.IOWriteBPS > 0 && p.IOWriteBPS > cfg.IOWriteBPS {
+		return fmt.Errorf("io_write_bps must be at most %d, the server's limit", cfg.IOWriteBPS)
+	}
+	if p.CPUs != "" {
+		cpus, err := limits.ParseCPUList(p.CPUs)
+		if err != nil {
+			return fmt.Errorf("invalid cpus: %v", err)
+		}
+		allowed, _ := limits.ParseCPUList(cfg.CPUAffinity)
+		for _, cpu := range cpus {
+			if len(allowed) > 0 && !slices.Contains(allowed, cpu) {
+				return fmt.Errorf("cpus must be among the allowed cores %s", cfg.CPUAffinity)
+			}
+		}
+	}
+	// Calls are held to the configured bounds, and so are profiles
+	if p.Nice != nil && (*p.Nice < cfg.NiceMin || *p.Nice > cfg.NiceMax) {
+		return fmt.Errorf("nice must be from %d to %d", cfg.NiceMin, cfg.NiceMax)
+	}
+	if p.IOClass != "" && (!slices.Contains(limits.IOClassNames, p.IOClass) || !slices.Contains(cfg.IOClasses, p.IOClass)) {
+		return fmt.Errorf("io_class must be one of %s", strings.Join(cfg.IOClasses, ", "))
+	}
+	if p.IOPriority != nil && (*p.IOPriority < 0 || *p.IOPriority > 7) {
+		return fmt.Errorf("io_priority must be from 0 to 7")
+	}
+	for key := range p.Env {
+		if !shells.ValidName(key) {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+	}
+	for _, command := range p.Teardown {
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("teardown commands must not be empty")
+		}
+	}
+	if p.TeardownTimeout < 0 {
+		return fmt.Errorf("teardown_timeout must not be negative")
+	}
+	if p.User != "" {
+		u, err := process.LookupUser(p.User)
+		if err != nil {
+			return err
+		}
+		if euid := os.Geteuid(); euid != 0 && int(u.UID) != euid {
+			return fmt.Errorf("running commands as %s takes the server running as root", u.Name)
+		}
+		// The sandbox helper sets up its mounts after the switch, without the
+		// privileges to
+		if cfg.WorkspaceSandbox != "none" {
+			return fmt.Errorf("user cannot be combined with the %s workspace sandbox", cfg.WorkspaceSandbox)
+		}
+		if cfg.SessionBackend == "tmux" {
+			return fmt.Errorf("user cannot be combined with the tmux session backend")
+		}
+		p.runAs = u
+	}
+	if p.Policy != nil {
+		if err := p.Policy.Compile(); err != nil {
+			return fmt.Errorf("policy: %v", err)
+		}
+		p.Policy.Name = "profile " + name
+	}
+	return nil
+}
+
+// Names returns the names of the profiles, sorted
+func (s *Store) Names() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.profiles))
+	for name := range s.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Use makes the calls of client use the named profile, or no profile when
+// name is empty
+func (s *Store) Use(client, name string) (Profile, error) {
+	if name == "" {
+		s.mu.Lock()
+		delete(s.selected, client)
+		s.mu.Unlock()
+		return Profile{}, nil
+	}
+
+	p, ok := s.profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(s.Names(), ", "))
+	}
+	s.mu.Lock()
+	s.selected[client] = name
+	s.mu.Unlock()
+	s.log.Info("Client switched profile", "client", client, "profile", name)
+	return p, nil
+}
+
+// Current returns the profile the calls of client use, if any
+func (s *Store) Current(client string) (Profile, bool) {
+	if s == nil {
+		return Profile{}, false
+	}
+	s.mu.Lock()
+	name, ok := s.selected[client]
+	s.mu.Unlock()
+	if !ok {
+		return Profile{}, false
+	}
+	p, ok := s.profiles[name]
+	return p, ok
+}
+
+// Hooks gives a client initializing with a clientInfo name listed by a
+// profile that profile
+func (s *Store) Hooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	if s == nil {
+		return hooks
+	}
+	hooks.AddAfterInitialize(func(ctx context.Context, id any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
+		name, ok := s.byClientInfo[message.Params.ClientInfo.Name]
+		if !ok {
+			return
+		}
+		s.Use(access.Client(ctx), name)
+	})
+	return hooks
+}
+
+// profileKey carries the profile of the client making a tool call
+type profileKey struct{}
+
+// Get returns the named profile
+func (s *Store) Get(name string) (Profile, bool) {
+	if s == nil {
+		return Profile{}, false
+	}
+	p, ok := s.profiles[name]
+	return p, ok
+}
+
+// ToolMiddleware fills in the arguments a call leaves out from its profile,
+// which is the one it names or else its client's, and passes the profile on
+// for its environment, user and policy
+func (s *Store) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			p, ok := s.Current(access.Client(ctx))
+			if name, _ := request.GetArguments()["profile"].(string); name != "" && selectable[request.Params.Name] {
+				if ok && p.Locked && name != p.Name {
+					return mcp.NewToolResultError(fmt.Sprintf("This connection is locked to profile %s", p.Name)), nil
+				}
+				if p, ok = s.Get(name); !ok {
+					return mcp.NewToolResultError(fmt.Sprintf("Unknown profile %q (available: %s)", name, strings.Join(s.Names(), ", "))), nil
+				}
+			}
+			if !ok {
+				return next(ctx, request)
+			}
+			ctx = context.WithValue(ctx, profileKey{}, p)
+
+			keys := defaulted[request.Params.Name]
+			if len(keys) == 0 {
+				return next(ctx, request)
+			}
+			args := make(map[string]interface{}, len(request.GetArguments())+len(keys))
+			for key, value := range request.GetArguments() {
+				args[key] = value
+			}
+			for _, key := range keys {
+				if _, given := args[key]; given {
+					if p.Locked && p.sets(key) {
+						return mcp.NewToolResultError(fmt.Sprintf("Profile %s is locked; its %s cannot be overridden", p.Name, key)), nil
+					}
+					continue
+				}
+				switch key {
+				case "shell":
+					// A shell cannot be combined with an argument vector
+					_, hasArgs := args["args"]
+					_, hasExecArgs := args["exec_args"]
+					_, hasArgv := args["argv"]
+					if p.Shell != "" && !hasArgs && !hasExecArgs && !hasArgv {
+						args[key] = p.Shell
+					}
+				case "cwd":
+					if p.Cwd != "" {
+						args[key] = p.Cwd
+					}
+				case "timeout":
+					if p.Timeout > 0 {
+						args[key] = p.Timeout
+					}
+				case "io_read_bps":
+					if p.IOReadBPS > 0 {
+						args[key] = float64(p.IOReadBPS)
+					}
+				case "io_write_bps":
+					if p.IOWriteBPS > 0 {
+						args[key] = float64(p.IOWriteBPS)
+					}
+				case "cpus":
+					if p.CPUs != "" {
+						args[key] = p.CPUs
+					}
+				case "nice":
+					if p.Nice != nil {
+						args[key] = float64(*p.Nice)
+					}
+				case "io_class":
+					if p.IOClass != "" {
+						args[key] = p.IOClass
+					}
+				case "io_priority":
+					if p.IOPriority != nil {
+						args[key] = float64(*p.IOPriority)
+					}
+				}
+			}
+			if env, _ := args["env"].(map[string]interface{}); p.Locked {
+				for name := range env {
+					if _, fixed := p.Env[name]; fixed {
+						return mcp.NewToolResultError(fmt.Sprintf("Profile %s is locked; its %s variable cannot be overridden", p.Name, name)), nil
+					}
+				}
+			}
+			request.Params.Arguments = args
+			return next(ctx, request)
+		}
+	}
+}
+
+// sets reports whether the profile gives a value for an argument it fills in
+func (p Profile) sets(key string) bool {
+	switch key {
+	case "shell":
+		return p.Shell != ""
+	case "cwd":
+		return p.Cwd != ""
+	case "timeout":
+		return p.Timeout > 0
+	case "io_read_bps":
+		return p.IOReadBPS > 0
+	case "io_write_bps":
+		return p.IOWriteBPS > 0
+	case "cpus":
+		return p.CPUs != ""
+	case "nice":
+		return p.Nice != nil
+	case "io_class":
+		return p.IOClass != ""
+	case "io_priority":
+		return p.IOPriority != nil
+	}
+	return false
+}
+
+// Env returns the environment the profile of a tool call adds, as
+// NAME=value entries
+func Env(ctx context.Context) []string {
+	p, _ := ctx.Value(profileKey{}).(Profile)
+	env := make([]string, 0, len(p.Env))
+	for key, value := range p.Env {
+		env = append(env, key+"="+value)
+	}
+	slices.Sort(env)
+	return env
+}
+
+// User returns who the commands of a tool call run as under its profile,
+// or nil for the server's user
+func User(ctx context.Context) *process.User {
+	p, _ := ctx.Value(profileKey{}).(Profile)
+	return p.runAs
+}
+
+// Restrictions returns what the profile of a tool call denies beyond the
+// policy, or nil
+func Restrictions(ctx context.Context) *policy.Restrictions {
+	p, _ := ctx.Value(profileKey{}).(Profile)
+	return p.Policy
+}
+
+// NewContext returns a context carrying p as the profile of a tool call, for
+// work done on its behalf after the call, such as scheduled commands
+func NewContext(ctx context.Context, p Profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, p)
+}
+
+// RequestContext returns the context of an HTTP request, carrying the
+// profile of the MCP client whose session the request names in its
+// Mcp-Session-Id header, for endpoints that do what tools do
+func (s *Store) RequestContext(r *http.Request) context.Context {
+	if client := r.Header.Get("Mcp-Session-Id"); client != "" {
+		if p, ok := s.Current(client); ok {
+			return NewContext(r.Context(), p)
+		}
+	}
+	return r.Context()
+}
+
+// FromContext returns the profile of the client making a tool call, if it has one
+func FromContext(ctx context.Context) (Profile, bool) {
+	p, ok := ctx.Value(profileKey{}).(Profile)
+	return p, ok
+}
@@ -0,0 +1,249 @@
+package profiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/policy"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.IOReadBPS = 1000
+	cfg.CPUAffinity = "0-3"
+	cfg.NiceMin, cfg.NiceMax = 0, 19
+	cfg.IOClasses = []string{"best-effort", "idle"}
+	number := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		profile Profile
+		// err is part of the error, or "" when the profile is valid
+		err string
+	}{
+		{name: "dev", profile: Profile{Cwd: "/srv", IOReadBPS: 500, CPUs: "1-2", Nice: number(5), IOClass: "idle"}},
+		{name: "bad name!", err: "name must be letters"},
+		{name: "none", err: "the name none is reserved"},
+		{name: "p", profile: Profile{Timeout: -1}, err: "timeout must not be negative"},
+		{name: "p", profile: Profile{IOWriteBPS: -1}, err: "must not be negative"},
+		{name: "p", profile: Profile{IOReadBPS: 2000}, err: "io_read_bps must be at most 1000"},
+		{name: "p", profile: Profile{CPUs: "2-5"}, err: "cpus must be among the allowed cores 0-3"},
+		{name: "p", profile: Profile{CPUs: "x"}, err: "invalid cpus"},
+		{name: "p", profile: Profile{Nice: number(-5)}, err: "nice must be from 0 to 19"},
+		{name: "p", profile: Profile{IOClass: "realtime"}, err: "io_class must be one of best-effort, idle"},
+		{name: "p", profile: Profile{IOPriority: number(8)}, err: "io_priority must be from 0 to 7"},
+		{name: "p", profile: Profile{Env: map[string]string{"1BAD": "x"}}, err: "invalid environment variable name"},
+		{name: "p", profile: Profile{Teardown: []string{" "}}, err: "teardown commands must not be empty"},
+		{name: "p", profile: Profile{Policy: &policy.Restrictions{Default: "maybe"}}, err: "policy: default must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.err, func(t *testing.T) {
+			err := tt.profile.validate(tt.name, cfg)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+const testProfiles = `{
+  "profiles": {
+    "locked": {"cwd": "/srv/prod", "env": {"STAGE": "prod"}, "locked": true, "policy": {"read_only": true}},
+    "dev": {"cwd": "/srv/dev", "timeout": 60}
+  }
+}`
+
+func TestToolMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(testProfiles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.NewConfig()
+	cfg.ProfilesFile = path
+	store, err := Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// selected is the profile of the connection, "" for none
+		selected string
+		tool     string
+		args     map[string]interface{}
+		// err is part of the error the call is refused with, if it is
+		err string
+		// want are the arguments the tool is called with, and profile the
+		// profile it is called under
+		want    map[string]interface{}
+		profile string
+	}{
+		{
+			name:    "no profile",
+			tool:    "execute_command",
+			args:    map[string]interface{}{"command": "ls"},
+			want:    map[string]interface{}{"command": "ls"},
+			profile: "",
+		},
+		{
+			name:     "fills in defaults",
+			selected: "dev",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls"},
+			want:     map[string]interface{}{"command": "ls", "cwd": "/srv/dev", "timeout": float64(60)},
+			profile:  "dev",
+		},
+		{
+			name:     "arguments override an unlocked profile",
+			selected: "dev",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "cwd": "/tmp"},
+			want:     map[string]interface{}{"command": "ls", "cwd": "/tmp", "timeout": float64(60)},
+			profile:  "dev",
+		},
+		{
+			name:     "profile argument picks another profile",
+			selected: "dev",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "profile": "locked"},
+			want:     map[string]interface{}{"command": "ls", "profile": "locked", "cwd": "/srv/prod"},
+			profile:  "locked",
+		},
+		{
+			name:     "profile argument is ignored by other tools",
+			selected: "dev",
+			tool:     "read_file",
+			args:     map[string]interface{}{"path": "a", "profile": "locked"},
+			want:     map[string]interface{}{"path": "a", "profile": "locked"},
+			profile:  "dev",
+		},
+		{
+			name: "unknown profile",
+			tool: "execute_command",
+			args: map[string]interface{}{"command": "ls", "profile": "prod"},
+			err:  `Unknown profile "prod" (available: dev, locked)`,
+		},
+		{
+			name:     "locked profile fills in defaults",
+			selected: "locked",
+			tool:     "persistent_shell",
+			args:     map[string]interface{}{"command": "ls", "timeout": float64(5)},
+			want:     map[string]interface{}{"command": "ls", "cwd": "/srv/prod", "timeout": float64(5)},
+			profile:  "locked",
+		},
+		{
+			name:     "locked profile refuses overrides",
+			selected: "locked",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "cwd": "/tmp"},
+			err:      "Profile locked is locked; its cwd cannot be overridden",
+		},
+		{
+			name:     "locked profile refuses its environment being overridden",
+			selected: "locked",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "env": map[string]interface{}{"STAGE": "dev"}},
+			err:      "Profile locked is locked; its STAGE variable cannot be overridden",
+		},
+		{
+			name:     "locked profile allows other variables",
+			selected: "locked",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "env": map[string]interface{}{"DEBUG": "1"}},
+			want:     map[string]interface{}{"command": "ls", "cwd": "/srv/prod", "env": map[string]interface{}{"DEBUG": "1"}},
+			profile:  "locked",
+		},
+		{
+			name:     "locked connection cannot switch profiles",
+			selected: "locked",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "profile": "dev"},
+			err:      "This connection is locked to profile locked",
+		},
+		{
+			name:     "locked connection may name its own profile",
+			selected: "locked",
+			tool:     "execute_command",
+			args:     map[string]interface{}{"command": "ls", "profile": "locked"},
+			want:     map[string]interface{}{"command": "ls", "profile": "locked", "cwd": "/srv/prod"},
+			profile:  "locked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Calls outside an MCP session are made by the client ""
+			if _, err := store.Use("", tt.selected); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				got     map[string]interface{}
+				profile string
+			)
+			handler := store.ToolMiddleware()(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				got = request.GetArguments()
+				if p, ok := FromContext(ctx); ok {
+					profile = p.Name
+				}
+				return mcp.NewToolResultText("ok"), nil
+			})
+
+			var request mcp.CallToolRequest
+			request.Params.Name = tt.tool
+			request.Params.Arguments = tt.args
+			result, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.err != "" {
+				if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, tt.err) {
+					t.Fatalf("result = %+v, want an error containing %q", result.Content, tt.err)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error: %+v", result.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("arguments = %v, want %v", got, tt.want)
+			}
+			if profile != tt.profile {
+				t.Errorf("profile = %q, want %q", profile, tt.profile)
+			}
+		})
+	}
+}
+
+func TestRestrictions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(testProfiles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.NewConfig()
+	cfg.ProfilesFile = path
+	store, err := Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Restrictions(context.Background()) != nil {
+		t.Error("a call without a profile has restrictions")
+	}
+	p, _ := store.Get("locked")
+	restrictions := Restrictions(NewContext(context.Background(), p))
+	if restrictions == nil || !restrictions.ReadOnly || restrictions.Name != "profile locked" {
+		t.Errorf("restrictions = %+v, want the read-only ones of profile locked", restrictions)
+	}
+}
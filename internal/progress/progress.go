@@ -0,0 +1,210 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/redact"
+)
+
+// maxLastLineLength bounds the last output line included in notifications
+const maxLastLineLength = 200
+
+// Reporter periodically emits MCP progress notifications for a running command.
+// A nil *Reporter is valid and does nothing, so callers never need to check.
+type Reporter struct {
+	ctx      context.Context
+	server   *server.MCPServer
+	token    mcp.ProgressToken
+	interval time.Duration
+	total    time.Duration
+	redact   *redact.Redactor
+
+	mu       sync.Mutex
+	bytes    int64
+	lastLine string
+	partial  []byte
+	started  time.Time
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type contextKey struct{}
+
+// NewReporter creates a reporter for a tool call. It returns nil when the client
+// did not ask for progress, the interval is disabled, or there is no MCP server
+// to deliver notifications through. Output lines quoted in notifications are
+// passed through redactor.
+func NewReporter(ctx context.Context, request mcp.CallToolRequest, interval time.Duration, redactor *redact.Redactor) *Reporter {
+	if interval <= 0 || request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return nil
+	}
+
+	return &Reporter{
+		ctx:      ctx,
+		server:   srv,
+		token:    request.Params.Meta.ProgressToken,
+		interval: interval,
+		redact:   redactor,
+	}
+}
+
+// WithReporter returns a context carrying the reporter
+func WithReporter(ctx context.Context, r *Reporter) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the reporter stored in ctx, or nil
+func FromContext(ctx context.Context) *Reporter {
+	r, _ := ctx.Value(contextKey{}).(*Reporter)
+	return r
+}
+
+// Start begins emitting notifications every interval until Stop is called.
+// total is the command timeout and is reported as the progress total.
+func (r *Reporter) Start(total time.Duration) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.started = time.Now()
+	r.total = total
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	r.mu.Unlock()
+
+	go r.run()
+}
+
+// Stop ends notifications and waits for the reporting goroutine to exit
+func (r *Reporter) Stop() {
+	if r == nil || r.stop == nil {
+		return
+	}
+
+	close(r.stop)
+	<-r.done
+}
+
+// Write records output so it can be summarised in the next notification.
+// It implements io.Writer and never fails.
+func (r *Reporter) Write(p []byte) (int, error) {
+	if r == nil {
+		return len(p), nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bytes += int64(len(p))
+	data := append(r.partial, p...)
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		complete := bytes.TrimRight(data[:i], "\r\n")
+		if j := bytes.LastIndexByte(complete, '\n'); j >= 0 {
+			complete = complete[j+1:]
+		}
+		if len(bytes.TrimSpace(complete)) > 0 {
+			r.lastLine = truncate(r.redact.String(string(complete)))
+		}
+		data = data[i+1:]
+	}
+	if len(data) > maxLastLineLength {
+		data = data[len(data)-maxLastLineLength:]
+	}
+	r.partial = append([]byte(nil), data...)
+
+	return len(p), nil
+}
+
+// Send emits a notification carrying message right away, such as new output a
+// client is waiting for, in addition to the periodic ones
+func (r *Reporter) Send(message string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	elapsed := time.Since(r.started)
+	total := r.total
+	r.mu.Unlock()
+
+	params := map[string]any{
+		"progressToken":   r.token,
+		"progress":        elapsed.Seconds(),
+		"message":         r.redact.String(message),
+		"elapsed_seconds": elapsed.Seconds(),
+	}
+	if total > 0 {
+		params["total"] = total.Seconds()
+	}
+
+	_ = r.server.SendNotificationToClient(r.ctx, "notifications/progress", params)
+}
+
+// run is the notification loop
+func (r *Reporter) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.notify()
+		case <-r.stop:
+			return
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// notify sends a single progress notification with the current counters
+func (r *Reporter) notify() {
+	r.mu.Lock()
+	elapsed := time.Since(r.started)
+	outputBytes := r.bytes
+	lastLine := r.lastLine
+	r.mu.Unlock()
+
+	message := fmt.Sprintf("Running for %s, %d bytes of output", elapsed.Round(time.Second), outputBytes)
+	if lastLine != "" {
+		message += fmt.Sprintf(", last line: %s", lastLine)
+	}
+
+	params := map[string]any{
+		"progressToken":   r.token,
+		"progress":        elapsed.Seconds(),
+		"message":         message,
+		"output_bytes":    outputBytes,
+		"elapsed_seconds": elapsed.Seconds(),
+		"last_line":       lastLine,
+	}
+	if r.total > 0 {
+		params["total"] = r.total.Seconds()
+	}
+
+	// Notifications are best effort; a client that cannot receive them still gets the result
+	_ = r.server.SendNotificationToClient(r.ctx, "notifications/progress", params)
+}
+
+// truncate shortens a line to maxLastLineLength characters
+func truncate(line string) string {
+	runes := []rune(line)
+	if len(runes) <= maxLastLineLength {
+		return line
+	}
+	return string(runes[:maxLastLineLength]) + "..."
+}
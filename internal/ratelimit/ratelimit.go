@@ -0,0 +1,218 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxBuckets bounds the number of per-client buckets kept in memory
+const maxBuckets = 1024
+
+// BusyError is returned when a limit is exhausted. It is meant to be shown to
+// clients as a structured "busy, retry later" response.
+type BusyError struct {
+	// Scope names the limit that was hit, e.g. "global", "session" or "http"
+	Scope      string
+	Limit      float64
+	RetryAfter time.Duration
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("server busy: %s limit of %g reached, retry after %.0fs", e.Scope, e.Limit, math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// JSON renders the error as a structured payload
+func (e *BusyError) JSON() string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"error":               "busy",
+		"scope":               e.Scope,
+		"limit":               e.Limit,
+		"retry_after_seconds": math.Ceil(e.RetryAfter.Seconds()),
+		"message":             e.Error(),
+	})
+	return string(data)
+}
+
+// Concurrency caps the number of commands executing at once, both in total and per key (session)
+type Concurrency struct {
+	mu        sync.Mutex
+	global    int
+	perKey    int
+	active    int
+	perActive map[string]int
+}
+
+// NewConcurrency creates a limiter. A limit of 0 means unlimited.
+func NewConcurrency(global, perKey int) *Concurrency {
+	return &Concurrency{
+		global:    global,
+		perKey:    perKey,
+		perActive: make(map[string]int),
+	}
+}
+
+// Acquire reserves a slot for key ("" for commands not tied to a session).
+// The returned release function must be called when the command finishes.
+func (c *Concurrency) Acquire(key string) (func(), *BusyError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.global > 0 && c.active >= c.global {
+		return nil, &BusyError{Scope: "global", Limit: float64(c.global), RetryAfter: time.Second}
+	}
+	if key != "" && c.perKey > 0 && c.perActive[key] >= c.perKey {
+		return nil, &BusyError{Scope: "session", Limit: float64(c.perKey), RetryAfter: time.Second}
+	}
+
+	c.active++
+	if key != "" {
+		c.perActive[key]++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.active--
+			if key != "" {
+				if c.perActive[key]--; c.perActive[key] <= 0 {
+					delete(c.perActive, key)
+				}
+			}
+		})
+	}, nil
+}
+
+// TokenBucket is a per-client token bucket rate limiter
+type TokenBucket struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket allows rate requests per second per client with bursts of up to burst requests
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow consumes a token for client, or returns a BusyError saying when to retry
+func (t *TokenBucket) Allow(client string) *BusyError {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	b, exists := t.buckets[client]
+	if !exists {
+		if len(t.buckets) >= maxBuckets {
+			t.prune(now)
+		}
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[client] = b
+	}
+
+	b.tokens = math.Min(t.burst, b.tokens+now.Sub(b.last).Seconds()*t.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / t.rate * float64(time.Second))
+		return &BusyError{Scope: "http", Limit: t.rate, RetryAfter: wait}
+	}
+
+	b.tokens--
+	return nil
+}
+
+// prune drops buckets that have refilled completely, as they carry no state
+func (t *TokenBucket) prune(now time.Time) {
+	for client, b := range t.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*t.rate >= t.burst {
+			delete(t.buckets, client)
+		}
+	}
+}
+
+// Throughput caps a stream of bytes, such as a session's output, to a rate in
+// bytes per second, with bursts of up to one second's worth
+type Throughput struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewThroughput creates a cap of rate bytes per second, or returns nil when
+// rate is 0 or less. A nil Throughput lets everything through.
+func NewThroughput(rate int64) *Throughput {
+	if rate <= 0 {
+		return nil
+	}
+	return &Throughput{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// refill adds the tokens earned since the last call. The caller must hold t.mu.
+func (t *Throughput) refill() {
+	now := time.Now()
+	t.tokens = math.Min(t.rate, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+}
+
+// Wait takes n bytes from the cap and returns how long the caller should
+// pause for the stream to stay within it
+func (t *Throughput) Wait(n int) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refill()
+	t.tokens -= float64(n)
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
+
+// Allow takes n bytes from the cap if they fit and reports whether they did.
+// A chunk larger than a burst fits once the cap is full.
+func (t *Throughput) Allow(n int) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refill()
+	need := math.Min(float64(n), t.rate)
+	if t.tokens < need {
+		return false
+	}
+	t.tokens -= need
+	return true
+}
+
+// Rate returns the cap in bytes per second
+func (t *Throughput) Rate() int64 {
+	if t == nil {
+		return 0
+	}
+	return int64(t.rate)
+}
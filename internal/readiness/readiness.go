@@ -0,0 +1,202 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// pollInterval is the wait between checks of a condition that is not met
+	pollInterval = 500 * time.Millisecond
+	// checkTimeout bounds one check of a condition
+	checkTimeout = 2 * time.Second
+)
+
+// Sources answers the conditions on what the server itself runs and serves.
+// A nil function leaves its kind of condition unsupported.
+type Sources struct {
+	// Resolve translates a client path to the server's, checking it may be read
+	Resolve func(path string) (string, error)
+	// Session reports whether a command is running in a session
+	Session func(id string) (bool, error)
+	// Job reports whether a scheduled job has finished
+	Job func(id string) (bool, error)
+}
+
+// Condition is something a command waits for before it runs
+type Condition struct {
+	// Spec is the condition as given, e.g. "port:3000"
+	Spec  string
+	check func(ctx context.Context) error
+}
+
+// String returns the condition as given
+func (c *Condition) String() string {
+	return c.Spec
+}
+
+// Parse reads a condition: "port:<port>" or "tcp://host:port" for a port
+// accepting connections, "unix:///socket" for a socket, "file:<path>" for a
+// file that exists, an http(s):// URL answering with a success status,
+// "session:<id>" for a session running no command and "job:<id>" for a
+// scheduled job that finished
+func Parse(spec string, src Sources) (*Condition, error) {
+	spec = strings.TrimSpace(spec)
+	c := &Condition{Spec: spec}
+
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "port":
+		address := target
+		if !strings.Contains(target, ":") {
+			address = net.JoinHostPort("localhost", target)
+		}
+		if _, port, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("%s: %v", spec, err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("%s: invalid port %q", spec, port)
+		}
+		c.check = dials("tcp", address)
+		return c, nil
+	case "file":
+		if src.Resolve == nil {
+			return nil, fmt.Errorf("%s: file conditions are not supported", spec)
+		}
+		path, err := src.Resolve(target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", spec, err)
+		}
+		c.check = exists(path)
+		return c, nil
+	case "session":
+		if src.Session == nil || target == "" {
+			return nil, fmt.Errorf("%s: session conditions need a session ID", spec)
+		}
+		c.check = func(ctx context.Context) error {
+			running, err := src.Session(target)
+			if err != nil {
+				return err
+			}
+			if running {
+				return fmt.Errorf("a command is running in session %s", target)
+			}
+			return nil
+		}
+		return c, nil
+	case "job":
+		if src.Job == nil {
+			return nil, fmt.Errorf("%s: scheduled jobs are disabled", spec)
+		}
+		if target == "" {
+			return nil, fmt.Errorf("%s: no job ID given", spec)
+		}
+		c.check = func(ctx context.Context) error {
+			finished, err := src.Job(target)
+			if err != nil {
+				return err
+			}
+			if !finished {
+				return fmt.Errorf("scheduled job %s has not finished", target)
+			}
+			return nil
+		}
+		return c, nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("%s: tcp conditions need a port", spec)
+		}
+		c.check = dials("tcp", u.Host)
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("%s: unix conditions need a socket path", spec)
+		}
+		c.check = dials("unix", u.Path)
+	case "http", "https":
+		c.check = healthy(spec)
+	default:
+		return nil, fmt.Errorf("%s: a condition must be port:, file:, session:, job:, tcp://, unix:// or an http(s):// URL", spec)
+	}
+	return c, nil
+}
+
+// Wait checks the conditions in turn until each is met, giving up once
+// timeout has passed or ctx is done. It returns how long it waited.
+func Wait(ctx context.Context, conditions []*Condition, timeout time.Duration) (time.Duration, error) {
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, c := range conditions {
+		for {
+			checkCtx, cancelCheck := context.WithTimeout(ctx, checkTimeout)
+			err := c.check(checkCtx)
+			cancelCheck()
+			if err == nil {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return time.Since(started), fmt.Errorf("%s was not met within %s: %v", c, timeout, err)
+				}
+				return time.Since(started), fmt.Errorf("stopped waiting for %s: %v", c, ctx.Err())
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+	return time.Since(started), nil
+}
+
+// dials checks that a connection can be opened
+func dials(network, address string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// healthy checks that a URL answers with a status below 400
+func healthy(target string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("answered %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// exists checks that a file exists
+func exists(path string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := os.Stat(path)
+		return err
+	}
+}
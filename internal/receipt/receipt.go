@@ -0,0 +1,284 @@
+package receipt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/logging"
+)
+
+// Version is the version of the receipt claims
+const Version = 1
+
+// Algorithm is how receipts are signed
+const Algorithm = "ed25519"
+
+// MetaKey is where a signed receipt is put in the _meta of a tool result
+const MetaKey = "receipt"
+
+// Claims is what a receipt vouches for about one command
+type Claims struct {
+	Version int    `json:"version"`
+	KeyID   string `json:"key_id"`
+	Tool    string `json:"tool"`
+	// SessionID is the persistent session the command ran in, if any
+	SessionID string `json:"session_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// CommandSHA256 is the hash of the command as it was run
+	CommandSHA256 string `json:"command_sha256"`
+	// OutputSHA256 is the hash of the text of the result as the client
+	// received it, the text contents joined by newlines
+	OutputSHA256 string    `json:"output_sha256"`
+	ExitCode     int       `json:"exit_code"`
+	TimedOut     bool      `json:"timed_out,omitempty"`
+	Started      time.Time `json:"started"`
+	Finished     time.Time `json:"finished"`
+	Signed       time.Time `json:"signed"`
+}
+
+// Receipt is signed claims. The signature covers the payload bytes as they
+// are, so verifiers need not reproduce the server's JSON encoding.
+type Receipt struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	// Payload is the claims as JSON, base64-encoded
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// Command is a command a tool ran, as reported by the tool
+type Command struct {
+	Command   string
+	SessionID string
+	ExitCode  int
+	TimedOut  bool
+	Started   time.Time
+	Finished  time.Time
+}
+
+// Signer signs receipts for the results of commands with the server's key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+	log   *slog.Logger
+}
+
+// Load reads the configured signing key, creating it when the file does not
+// exist yet, or returns nil when receipts are disabled
+func Load(cfg *config.Config) (*Signer, error) {
+	if cfg.ReceiptKeyFile == "" {
+		return nil, nil
+	}
+	s := &Signer{log: logging.For("receipt")}
+
+	data, err := os.ReadFile(cfg.ReceiptKeyFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if s.key, err = create(cfg.ReceiptKeyFile); err != nil {
+			return nil, err
+		}
+		s.log.Info("Created receipt signing key", "path", cfg.ReceiptKeyFile)
+	case err != nil:
+		return nil, err
+	default:
+		if s.key, err = parse(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", cfg.ReceiptKeyFile, err)
+		}
+	}
+	s.keyID = KeyID(s.key.Public().(ed25519.PublicKey))
+	s.log.Info("Signing command receipts", "key_id", s.keyID)
+	return s, nil
+}
+
+// create generates a key and writes it to path, readable by the server's user only
+func create(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// parse reads a PKCS #8 Ed25519 private key in PEM, as written by
+// "openssl genpkey -algorithm ed25519"
+func parse(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("expected a PEM \"PRIVATE KEY\" block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the key is not an Ed25519 key")
+	}
+	return key, nil
+}
+
+// KeyID identifies a public key by the first 16 hex digits of the SHA-256
+// of its PKIX encoding
+func KeyID(key ed25519.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PublicKey returns the public key receipts are verified with, in PEM
+func (s *Signer) PublicKey() string {
+	der, _ := x509.MarshalPKIXPublicKey(s.key.Public())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// KeyID returns the ID of the signing key
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign signs claims about a command
+func (s *Signer) Sign(claims Claims) (Receipt, error) {
+	claims.Version = Version
+	claims.KeyID = s.keyID
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{
+		Algorithm: Algorithm,
+		KeyID:     s.keyID,
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+	}, nil
+}
+
+// Verify checks a receipt's signature against the server's key and returns
+// its claims. When text is given, it must be the result text the receipt was
+// issued for.
+func (s *Signer) Verify(r Receipt, text *string) (Claims, error) {
+	if r.Algorithm != Algorithm {
+		return Claims{}, fmt.Errorf("unsupported algorithm %q", r.Algorithm)
+	}
+	if r.KeyID != s.keyID {
+		return Claims{}, fmt.Errorf("receipt was signed with key %s, not this server's %s", r.KeyID, s.keyID)
+	}
+	payload, err := base64.StdEncoding.DecodeString(r.Payload)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid payload: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	if !ed25519.Verify(s.key.Public().(ed25519.PublicKey), payload, signature) {
+		return Claims{}, fmt.Errorf("signature does not match")
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, fmt.Errorf("invalid payload: %v", err)
+	}
+	if text != nil && Hash(*text) != claims.OutputSHA256 {
+		return claims, fmt.Errorf("the text is not the output the receipt was issued for")
+	}
+	return claims, nil
+}
+
+// Hash returns the hex SHA-256 of text
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// commandKey carries the command the tool call being handled ran
+type commandKey struct{}
+
+// Record reports the command the tool call ctx belongs to ran, so its result
+// gets a receipt. It does nothing when receipts are disabled.
+func Record(ctx context.Context, command Command) {
+	if p, ok := ctx.Value(commandKey{}).(*Command); ok {
+		*p = command
+	}
+}
+
+// ToolMiddleware puts a signed receipt in the _meta of the results of tool
+// calls that ran a command. It runs outside the result rendering, so the
+// receipt covers the text the client receives.
+func (s *Signer) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if s == nil {
+				return next(ctx, request)
+			}
+
+			var command Command
+			result, err := next(context.WithValue(ctx, commandKey{}, &command), request)
+			if result == nil || command.Started.IsZero() {
+				return result, err
+			}
+
+			receipt, signErr := s.Sign(Claims{
+				Tool:          request.Params.Name,
+				SessionID:     command.SessionID,
+				RequestID:     labels.RequestID(ctx),
+				CommandSHA256: Hash(command.Command),
+				OutputSHA256:  Hash(Text(result)),
+				ExitCode:      command.ExitCode,
+				TimedOut:      command.TimedOut,
+				Started:       command.Started.UTC(),
+				Finished:      command.Finished.UTC(),
+				Signed:        time.Now().UTC(),
+			})
+			if signErr != nil {
+				s.log.Error("Failed to sign receipt", "tool", request.Params.Name, "error", signErr)
+				return result, err
+			}
+			if result.Meta == nil {
+				result.Meta = make(map[string]any)
+			}
+			result.Meta[MetaKey] = receipt
+			return result, err
+		}
+	}
+}
+
+// Text returns the text a receipt's output hash covers: the text contents of
+// a result joined by newlines
+func Text(result *mcp.CallToolResult) string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,203 @@
+package redact
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+)
+
+// warnOnce keeps a bad patterns file from being reported by every redactor instance
+var warnOnce sync.Once
+
+// builtins are the secrets recognised without configuration. Where a pattern
+// has a group named "secret", only that group is replaced, so the context
+// that identifies the secret stays readable.
+var builtins = []struct {
+	name    string
+	pattern string
+}{
+	{"aws-access-key", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{"aws-secret-key", `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`},
+	{"bearer-token", `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]{8,}=*)`},
+	{"private-key", `-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z0-9 ]*PRIVATE KEY-----|\z)`},
+	{"github-token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{50,})\b`},
+	{"slack-token", `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+}
+
+// privateKeyBegin and privateKeyEnd delimit a private key spread over lines
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY-----`)
+)
+
+// rule is one pattern and the name shown in its place
+type rule struct {
+	name string
+	re   *regexp.Regexp
+	// secret is the index of the "secret" group, or 0 to replace the whole match
+	secret int
+}
+
+// Redactor replaces secrets in text with "[REDACTED:<name>]"
+type Redactor struct {
+	rules []rule
+}
+
+// New creates a redactor with the built-in patterns and those of the
+// configured patterns file, or returns nil when redaction is disabled.
+// Invalid custom patterns are skipped and reported.
+func New(cfg *config.Config) *Redactor {
+	if !cfg.Redact {
+		return nil
+	}
+
+	r := &Redactor{}
+	for _, b := range builtins {
+		r.add(b.name, regexp.MustCompile(b.pattern))
+	}
+
+	if cfg.RedactPatternsFile != "" {
+		patterns, err := readPatterns(cfg.RedactPatternsFile)
+		for _, pattern := range patterns {
+			re, compileErr := regexp.Compile(pattern)
+			if compileErr != nil {
+				err = fmt.Errorf("invalid pattern %q: %v", pattern, compileErr)
+				continue
+			}
+			r.add("custom", re)
+		}
+		if err != nil {
+			warnOnce.Do(func() {
+				logging.For("redact").Warn("Problem with redaction patterns", "path", cfg.RedactPatternsFile, "error", err)
+				health.SetDegraded("redact", fmt.Sprintf("%s: %v", cfg.RedactPatternsFile, err))
+			})
+		}
+	}
+
+	return r
+}
+
+// readPatterns reads one regular expression per line, skipping blank lines
+// and lines starting with #
+func readPatterns(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// add appends a rule
+func (r *Redactor) add(name string, re *regexp.Regexp) {
+	secret := re.SubexpIndex("secret")
+	if secret < 0 {
+		secret = 0
+	}
+	r.rules = append(r.rules, rule{name: name, re: re, secret: secret})
+}
+
+// String returns text with every secret replaced
+func (r *Redactor) String(text string) string {
+	if r == nil {
+		return text
+	}
+
+	for _, rule := range r.rules {
+		placeholder := "[REDACTED:" + rule.name + "]"
+		if rule.secret == 0 {
+			text = rule.re.ReplaceAllLiteralString(text, placeholder)
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range rule.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*rule.secret], m[2*rule.secret+1]
+			if start < 0 {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(placeholder)
+			last = end
+		}
+		if last > 0 {
+			b.WriteString(text[last:])
+			text = b.String()
+		}
+	}
+	return text
+}
+
+// Lines redacts output that arrives one line at a time. Secrets spanning
+// lines, such as private keys, are recognised by remembering where a key began.
+type Lines struct {
+	r     *Redactor
+	inKey bool
+}
+
+// Lines returns a filter for one stream of lines
+func (r *Redactor) Lines() *Lines {
+	return &Lines{r: r}
+}
+
+// Line returns the redacted form of the next line
+func (l *Lines) Line(line string) string {
+	if l.r == nil {
+		return line
+	}
+
+	if l.inKey {
+		if loc := privateKeyEnd.FindStringIndex(line); loc != nil {
+			l.inKey = false
+			return "[REDACTED:private-key]" + l.r.String(line[loc[1]:])
+		}
+		return "[REDACTED:private-key]"
+	}
+
+	if loc := privateKeyBegin.FindStringIndex(line); loc != nil && !privateKeyEnd.MatchString(line[loc[1]:]) {
+		l.inKey = true
+		return l.r.String(line[:loc[0]]) + "[REDACTED:private-key]"
+	}
+	return l.r.String(line)
+}
+
+// ToolMiddleware redacts the text of every tool result before it reaches the client
+func (r *Redactor) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, request)
+			if r == nil || result == nil {
+				return result, err
+			}
+
+			for i, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok {
+					text.Text = r.String(text.Text)
+					result.Content[i] = text
+				}
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Result formats
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// Param is the tool argument that picks the format of one call's result
+const Param = "result_format"
+
+// fieldLine matches a "Key: value" line of a result. Keys are short and
+// capitalised, so sentences that contain a colon stay text.
+var fieldLine = regexp.MustCompile(`^([A-Z][A-Za-z0-9 ()/._-]{0,39}):(?: (.*))?$`)
+
+// blockEnds start the fields that follow command output in a result
+var blockEnds = []string{"Exit Code: ", "Timed Out: "}
+
+// kind says how a handler's result text is laid out
+type kind int
+
+const (
+	// kindFields is a summary followed by "Key: value" lines, the default
+	kindFields kind = iota
+	// kindRaw is content such as a file or a transcript, kept as it is
+	kindRaw
+	// kindDocument is already formatted, such as a report, and left alone
+	kindDocument
+)
+
+// kindKey carries the kind of the result of the tool call being handled
+type kindKey struct{}
+
+// Raw marks the result of the tool call ctx belongs to as raw content, such as
+// a file, which is shown as it is rather than read as fields
+func Raw(ctx context.Context) {
+	mark(ctx, kindRaw)
+}
+
+// Document marks the result of the tool call ctx belongs to as a document in a
+// format of its own, such as a report, which is passed on unchanged
+func Document(ctx context.Context) {
+	mark(ctx, kindDocument)
+}
+
+func mark(ctx context.Context, k kind) {
+	if p, ok := ctx.Value(kindKey{}).(*kind); ok {
+		*p = k
+	}
+}
+
+// Valid reports whether format is a known result format
+func Valid(format string) bool {
+	return format == FormatPlain || format == FormatMarkdown || format == FormatJSON
+}
+
+// AddParam adds the result_format argument to a tool's input schema
+func AddParam(tool *mcp.Tool) {
+	if tool.InputSchema.Properties == nil {
+		tool.InputSchema.Properties = make(map[string]interface{})
+	}
+	tool.InputSchema.Properties[Param] = map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{FormatPlain, FormatMarkdown, FormatJSON},
+		"description": "Format of the result: plain text, markdown with output in fenced code blocks, or json (optional, defaults to server setting)",
+	}
+	addVerbosityParam(tool)
+}
+
+// ToolMiddleware renders the text of every tool result in the format and
+// verbosity the call asks for with the result_format and verbosity arguments,
+// or in defaultFormat and defaultVerbosity
+func ToolMiddleware(defaultFormat, defaultVerbosity string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			format := defaultFormat
+			if f, _ := request.GetArguments()[Param].(string); f != "" {
+				if !Valid(f) {
+					return mcp.NewToolResultError(fmt.Sprintf("Unknown result format: %s (use plain, markdown or json)", f)), nil
+				}
+				format = f
+			}
+			verbosity := defaultVerbosity
+			if v, _ := request.GetArguments()[VerbosityParam].(string); v != "" {
+				if !ValidVerbosity(v) {
+					return mcp.NewToolResultError(fmt.Sprintf("Unknown verbosity: %s (use minimal, normal or debug)", v)), nil
+				}
+				verbosity = v
+			}
+
+			k := kindFields
+			ctx = context.WithValue(ctx, verbosityKey{}, verbosity)
+			result, err := next(context.WithValue(ctx, kindKey{}, &k), request)
+			minimal := verbosity == VerbosityMinimal && k == kindFields
+			if result == nil || (format == FormatPlain && !minimal) || k == kindDocument {
+				return result, err
+			}
+
+			streams := streamsOf(result)
+			for i, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok && !isStream(streams, i) {
+					if minimal {
+						text.Text = Minimal(text.Text)
+					}
+					text.Text = Text(format, text.Text, k == kindRaw, result.IsError)
+					result.Content[i] = text
+				}
+			}
+			return result, err
+		}
+	}
+}
+
+// part is a piece of a result: a field, or text when key is ""
+type part struct {
+	key   string
+	value string
+	// block is set for command output, which may span lines
+	block bool
+}
+
+// Text renders the plain text of a result in format. Raw text is kept whole
+// instead of being read as fields.
+func Text(format, text string, raw, isError bool) string {
+	parts := []part{{value: text}}
+	if !raw {
+		parts = parse(text)
+	}
+
+	switch format {
+	case FormatMarkdown:
+		return markdown(parts, raw)
+	case FormatJSON:
+		return jsonText(parts, isError)
+	}
+	return text
+}
+
+// parse splits a result into text and fields. A field holding command output
+// runs until the field that follows output, so output lines that look like
+// fields stay part of it.
+func parse(text string) []part {
+	var parts []part
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := fieldLine.FindStringSubmatch(lines[i])
+		if m == nil || strings.Count(m[1], " ") > 2 || (m[2] == "" && !isBlock(m[1])) {
+			if n := len(parts); n > 0 && parts[n-1].key == "" {
+				parts[n-1].value += "\n" + lines[i]
+			} else {
+				parts = append(parts, part{value: lines[i]})
+			}
+			continue
+		}
+
+		p := part{key: m[1], value: m[2], block: isBlock(m[1]) && slices.ContainsFunc(lines[i+1:], endsBlock)}
+		if p.block {
+			for i+1 < len(lines) && !endsBlock(lines[i+1]) {
+				i++
+				p.value += "\n" + lines[i]
+			}
+			p.value = strings.TrimRight(p.value, "\n")
+		}
+		parts = append(parts, p)
+	}
+
+	// Blank lines around text carry no meaning once it is laid out again
+	kept := parts[:0]
+	for _, p := range parts {
+		if p.key == "" {
+			if p.value = strings.Trim(p.value, "\n"); p.value == "" {
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// isBlock reports whether a field may hold command output
+func isBlock(key string) bool {
+	return key == "Output" || strings.HasPrefix(key, "Output ") || key == "Stderr"
+}
+
+// endsBlock reports whether line starts a field that follows command output
+func endsBlock(line string) bool {
+	for _, prefix := range blockEnds {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// markdown lays out a result with fields as a list and output, raw content
+// and multi-line text in fenced code blocks
+func markdown(parts []part, raw bool) string {
+	var b strings.Builder
+	inList := false
+	for i, p := range parts {
+		item := p.key != "" && !p.block && !strings.Contains(p.value, "\n")
+		if i > 0 {
+			if item && inList {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		inList = item
+
+		switch {
+		case item:
+			fmt.Fprintf(&b, "- **%s:** %s", p.key, p.value)
+		case p.key != "":
+			if p.value == "" {
+				fmt.Fprintf(&b, "**%s:** _(none)_", p.key)
+				continue
+			}
+			fmt.Fprintf(&b, "**%s:**\n\n%s", p.key, fence(p.value))
+		case raw || (strings.Contains(p.value, "\n") && !isList(p.value)):
+			b.WriteString(fence(p.value))
+		default:
+			b.WriteString(p.value)
+		}
+	}
+	return b.String()
+}
+
+// isList reports whether text is a Markdown list, perhaps below a line
+// ending in a colon
+func isList(text string) bool {
+	lines := strings.Split(text, "\n")
+	if strings.HasSuffix(lines[0], ":") {
+		lines = lines[1:]
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "- ") {
+			return false
+		}
+	}
+	return true
+}
+
+// fence puts text in a fenced code block, with a fence longer than any run
+// of backticks in the text
+func fence(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	marks := strings.Repeat("`", max(3, longest+1))
+	return marks + "\n" + strings.TrimRight(text, "\n") + "\n" + marks
+}
+
+// jsonText lays out a result as a JSON object: text under "text", each field
+// under its key in snake case, and "error" for failed calls. Numbers and
+// booleans are decoded; a key that repeats holds a list of its values.
+func jsonText(parts []part, isError bool) string {
+	obj := make(map[string]interface{})
+	var text []string
+	for _, p := range parts {
+		if p.key == "" {
+			text = append(text, p.value)
+			continue
+		}
+
+		key, value := snakeCase(p.key), decode(p.value)
+		switch prev := obj[key].(type) {
+		case nil:
+			obj[key] = value
+		case []interface{}:
+			obj[key] = append(prev, value)
+		default:
+			obj[key] = []interface{}{prev, value}
+		}
+	}
+	if len(text) > 0 {
+		obj["text"] = strings.Join(text, "\n")
+	}
+	if isError {
+		obj["error"] = true
+	}
+
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"error": true, "text": %q}`, err.Error())
+	}
+	return string(data)
+}
+
+// snakeCase turns a field key such as "Output (partial)" into "output_partial"
+func snakeCase(key string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(strings.ToLower(key), func(c rune) bool {
+		return (c < 'a' || c > 'z') && (c < '0' || c > '9')
+	}) {
+		if b.Len() > 0 {
+			b.WriteString("_")
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+// decode returns a field value as a number or boolean when it is one
+func decode(value string) interface{} {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package render
+
+import (
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Output streams a content block of a result may hold
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	// StreamMerged is stdout and stderr interleaved in the order they were written
+	StreamMerged = "merged"
+)
+
+// StreamsMeta is the key in the _meta of a result listing, for each of its
+// content blocks in order, the output stream the block holds, or "" for
+// blocks that hold none
+const StreamsMeta = "streams"
+
+// AddStream appends a block holding one stream of a command's output to
+// result. Stream blocks are passed on as they are, whatever the result's
+// format, so the output stays clean to diff or display.
+func AddStream(result *mcp.CallToolResult, stream, text string) {
+	audience := []mcp.Role{mcp.RoleAssistant, mcp.RoleUser}
+	if stream == StreamMerged {
+		// The separate streams already serve the model; this view is for people
+		audience = []mcp.Role{mcp.RoleUser}
+	}
+	block := mcp.NewTextContent(text)
+	block.Annotations = &mcp.Annotations{Audience: audience}
+
+	streams := streamsOf(result)
+	for len(streams) < len(result.Content) {
+		streams = append(streams, "")
+	}
+	result.Content = append(result.Content, block)
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta[StreamsMeta] = append(streams, stream)
+}
+
+// streamsOf returns the streams of the content blocks of result
+func streamsOf(result *mcp.CallToolResult) []string {
+	streams, _ := result.Meta[StreamsMeta].([]string)
+	return streams
+}
+
+// isStream reports whether the content block at i holds command output
+func isStream(streams []string, i int) bool {
+	return i < len(streams) && streams[i] != ""
+}
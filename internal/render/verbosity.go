@@ -0,0 +1,86 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Result verbosities
+const (
+	// VerbosityMinimal keeps only the output and exit code of command results
+	VerbosityMinimal = "minimal"
+	// VerbosityNormal is the full summary of a result, the default
+	VerbosityNormal = "normal"
+	// VerbosityDebug adds how a command was run: its environment, wrapper and timing
+	VerbosityDebug = "debug"
+)
+
+// VerbosityParam is the tool argument that picks the verbosity of one call's result
+const VerbosityParam = "verbosity"
+
+// minimalFields are the fields of a command result kept at minimal verbosity,
+// besides its output
+var minimalFields = []string{"Exit Code", "Timed Out"}
+
+// verbosityKey carries the verbosity of the tool call being handled
+type verbosityKey struct{}
+
+// ValidVerbosity reports whether verbosity is a known result verbosity
+func ValidVerbosity(verbosity string) bool {
+	return verbosity == VerbosityMinimal || verbosity == VerbosityNormal || verbosity == VerbosityDebug
+}
+
+// Verbosity returns the verbosity the result of the tool call ctx belongs to
+// is wanted in
+func Verbosity(ctx context.Context) string {
+	if v, ok := ctx.Value(verbosityKey{}).(string); ok {
+		return v
+	}
+	return VerbosityNormal
+}
+
+// Debug reports whether the tool call ctx belongs to asked for debug details
+func Debug(ctx context.Context) bool {
+	return Verbosity(ctx) == VerbosityDebug
+}
+
+// addVerbosityParam adds the verbosity argument to a tool's input schema
+func addVerbosityParam(tool *mcp.Tool) {
+	tool.InputSchema.Properties[VerbosityParam] = map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{VerbosityMinimal, VerbosityNormal, VerbosityDebug},
+		"description": "How much surrounds a command's output: minimal (output and exit code only), normal, or debug (adds environment, wrapper and timing details) (optional, defaults to server setting)",
+	}
+}
+
+// Minimal cuts a command result down to its output, exit code and whether it
+// timed out. Results without an exit code, such as listings, are kept whole.
+func Minimal(text string) string {
+	parts := parse(text)
+	if !slices.ContainsFunc(parts, func(p part) bool { return p.key == "Exit Code" }) {
+		return text
+	}
+
+	var lines []string
+	for _, p := range parts {
+		if isBlock(p.key) || slices.Contains(minimalFields, p.key) {
+			lines = append(lines, strings.TrimRight(p.key+": "+p.value, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Environment describes an environment for debug details by the names of its
+// variables, leaving out their values as they may hold secrets
+func Environment(names []string) string {
+	names = slices.Clone(names)
+	for i, name := range names {
+		names[i], _, _ = strings.Cut(name, "=")
+	}
+	slices.Sort(names)
+	return fmt.Sprintf("%d variables: %s", len(names), strings.Join(names, ", "))
+}
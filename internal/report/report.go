@@ -0,0 +1,232 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/transcript"
+)
+
+// excerptLines is how many lines are kept from each end of a long output
+const excerptLines = 15
+
+// Formats accepted by Render
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Session identifies what a report covers
+type Session struct {
+	ID      string
+	Shell   string
+	Created time.Time
+}
+
+// Command is one command in a report, with its output cut to an excerpt
+type Command struct {
+	transcript.Entry
+	Excerpt string
+	// Omitted is the number of output lines left out of the excerpt
+	Omitted int
+	Notes   []transcript.Note
+}
+
+// Failed reports whether the command timed out or exited non-zero
+func (c Command) Failed() bool {
+	return c.TimedOut || c.ExitCode != 0
+}
+
+// Status describes how the command ended
+func (c Command) Status() string {
+	if c.TimedOut {
+		return "timed out"
+	}
+	return fmt.Sprintf("exit %d", c.ExitCode)
+}
+
+// Report summarizes a session's work for handing off to a human
+type Report struct {
+	Session   Session
+	Generated time.Time
+	Commands  []Command
+	// Notes precede the first command in the report
+	Notes    []transcript.Note
+	Failures []Command
+	// Busy is the total time spent running commands
+	Busy time.Duration
+}
+
+// New compiles a report from a session's transcript entries and notes
+func New(session Session, entries []transcript.Entry, notes []transcript.Note) *Report {
+	r := &Report{
+		Session:   session,
+		Generated: time.Now(),
+	}
+
+	bySeq := make(map[int][]transcript.Note)
+	for _, n := range notes {
+		if len(entries) > 0 && n.After < entries[0].Seq {
+			r.Notes = append(r.Notes, n)
+			continue
+		}
+		bySeq[n.After] = append(bySeq[n.After], n)
+	}
+
+	for _, e := range entries {
+		c := Command{Entry: e, Notes: bySeq[e.Seq]}
+		c.Excerpt, c.Omitted = excerpt(e.Output)
+		r.Commands = append(r.Commands, c)
+		r.Busy += e.Duration()
+		if c.Failed() {
+			r.Failures = append(r.Failures, c)
+		}
+	}
+
+	return r
+}
+
+// excerpt keeps the first and last lines of a long output and returns how many were dropped
+func excerpt(output string) (string, int) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) <= 2*excerptLines {
+		return strings.TrimRight(output, "\n"), 0
+	}
+
+	omitted := len(lines) - 2*excerptLines
+	kept := append(append([]string(nil), lines[:excerptLines]...), fmt.Sprintf("... %d lines omitted ...", omitted))
+	kept = append(kept, lines[len(lines)-excerptLines:]...)
+	return strings.Join(kept, "\n"), omitted
+}
+
+// Span returns the time from the first command's start to the last one's end
+func (r *Report) Span() time.Duration {
+	if len(r.Commands) == 0 {
+		return 0
+	}
+	return r.Commands[len(r.Commands)-1].Finished.Sub(r.Commands[0].Started)
+}
+
+// Render formats the report as Markdown or HTML
+func (r *Report) Render(format string) (string, error) {
+	switch format {
+	case "", FormatMarkdown:
+		return r.Markdown(), nil
+	case FormatHTML:
+		return r.HTML()
+	default:
+		return "", fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// Markdown renders the report as Markdown
+func (r *Report) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Session report: %s\n\n", r.Session.ID)
+	fmt.Fprintf(&b, "- Shell: %s\n", r.Session.Shell)
+	fmt.Fprintf(&b, "- Session created: %s\n", r.Session.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Report generated: %s\n", r.Generated.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Commands: %d (%d failed)\n", len(r.Commands), len(r.Failures))
+	fmt.Fprintf(&b, "- Time running commands: %s over %s\n\n", round(r.Busy), round(r.Span()))
+
+	if len(r.Failures) > 0 {
+		b.WriteString("## Diagnostics\n\n")
+		for _, c := range r.Failures {
+			fmt.Fprintf(&b, "- #%d `%s`: %s after %s\n", c.Seq, inlineCode(c.Command), c.Status(), round(c.Duration()))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Commands\n\n")
+	writeMarkdownNotes(&b, r.Notes)
+	if len(r.Commands) == 0 {
+		b.WriteString("No commands were recorded.\n")
+	}
+	for _, c := range r.Commands {
+		fmt.Fprintf(&b, "### #%d %s (%s, %s)\n\n", c.Seq, c.Started.Format(time.RFC3339), c.Status(), round(c.Duration()))
+		fmt.Fprintf(&b, "```sh\n%s\n```\n\n", c.Command)
+		if c.Excerpt != "" {
+			fence := "```"
+			for strings.Contains(c.Excerpt, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "%s\n%s\n%s\n\n", fence, c.Excerpt, fence)
+		}
+		writeMarkdownNotes(&b, c.Notes)
+	}
+
+	return b.String()
+}
+
+// writeMarkdownNotes renders notes as block quotes
+func writeMarkdownNotes(b *strings.Builder, notes []transcript.Note) {
+	for _, n := range notes {
+		fmt.Fprintf(b, "> **Note from %s** (%s): %s\n\n", n.Author, n.Time.Format(time.RFC3339), strings.ReplaceAll(n.Text, "\n", "\n> "))
+	}
+}
+
+// inlineCode makes a command safe to show in single backticks
+func inlineCode(command string) string {
+	command = strings.ReplaceAll(command, "\n", "; ")
+	return strings.ReplaceAll(command, "`", "'")
+}
+
+// round shortens durations for display
+func round(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(100 * time.Millisecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"round": round,
+	"time":  func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Session report: {{.Session.ID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+pre { background: #f4f4f4; padding: 0.6em; overflow-x: auto; }
+.failed { color: #b00; }
+.note { border-left: 3px solid #48c; padding-left: 0.6em; color: #345; }
+</style>
+</head>
+<body>
+<h1>Session report: {{.Session.ID}}</h1>
+<ul>
+<li>Shell: {{.Session.Shell}}</li>
+<li>Session created: {{time .Session.Created}}</li>
+<li>Report generated: {{time .Generated}}</li>
+<li>Commands: {{len .Commands}} ({{len .Failures}} failed)</li>
+<li>Time running commands: {{round .Busy}} over {{round .Span}}</li>
+</ul>
+{{if .Failures}}<h2>Diagnostics</h2>
+<ul>
+{{range .Failures}}<li class="failed">#{{.Seq}} <code>{{.Command}}</code>: {{.Status}} after {{round .Duration}}</li>
+{{end}}</ul>
+{{end}}<h2>Commands</h2>
+{{range .Notes}}<p class="note"><strong>Note from {{.Author}}</strong> ({{time .Time}}): {{.Text}}</p>
+{{end}}{{if not .Commands}}<p>No commands were recorded.</p>
+{{end}}{{range .Commands}}<h3{{if .Failed}} class="failed"{{end}}>#{{.Seq}} {{time .Started}} ({{.Status}}, {{round .Duration}})</h3>
+<pre><code>$ {{.Command}}</code></pre>
+{{if .Excerpt}}<pre>{{.Excerpt}}</pre>
+{{end}}{{range .Notes}}<p class="note"><strong>Note from {{.Author}}</strong> ({{time .Time}}): {{.Text}}</p>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// HTML renders the report as a standalone HTML page
+func (r *Report) HTML() (string, error) {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, r); err != nil {
+		return "", fmt.Errorf("failed to render report: %v", err)
+	}
+	return b.String(), nil
+}
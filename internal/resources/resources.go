@@ -0,0 +1,299 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/metrics"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/sse"
+	"mcp-terminal-server/internal/transcript"
+)
+
+const (
+	uriPrefix     = "terminal://sessions/"
+	uriSuffix     = "/transcript"
+	transcriptURI = uriPrefix + "{id}" + uriSuffix
+	metricsURI    = "terminal://metrics"
+)
+
+// watched are the session events that change a transcript resource or the
+// list of resources
+var watched = []string{events.TypeCommand, events.TypeExit, events.TypeAnnotation, events.TypeControl, events.TypeClosed}
+
+// Service publishes each persistent session's transcript and the server's
+// command metrics as MCP resources, and tells subscribed clients when a
+// transcript changes. mcp-go does not handle resources/subscribe itself, so
+// the transports hand those requests to Subscribe and Unsubscribe (see
+// Handler and Stdio).
+type Service struct {
+	sessions *session.Manager
+	server   *server.MCPServer
+	log      *slog.Logger
+
+	mu sync.Mutex
+	// listed are the sessions registered as resources
+	listed map[string]bool
+	// subscribers maps a resource URI to the MCP client sessions following it
+	subscribers map[string]map[string]bool
+}
+
+// New creates the resource service for the sessions of sm
+func New(sm *session.Manager) *Service {
+	return &Service{
+		sessions:    sm,
+		log:         logging.For("resources"),
+		listed:      make(map[string]bool),
+		subscribers: make(map[string]map[string]bool),
+	}
+}
+
+// Register adds the metrics resource and the transcript resource template to
+// s, and keeps a resource per live session registered as sessions come and go
+func (svc *Service) Register(s *server.MCPServer) {
+	svc.server = s
+
+	s.AddResource(mcp.NewResource(metricsURI, "Command metrics",
+		mcp.WithResourceDescription("Commands per hour, average duration, failure rate and the programs taking the most time over the last hour, for the whole server and each of your sessions"),
+		mcp.WithMIMEType("application/json"),
+	), svc.readMetrics)
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate(transcriptURI, "Session transcript",
+		mcp.WithTemplateDescription("Commands run in a persistent shell session, with their output and notes"),
+		mcp.WithTemplateMIMEType("text/plain"),
+	), svc.read)
+
+	// A disconnect would end the watch for good
+	ch, _ := svc.sessions.Subscribe(sse.Subscription{Types: watched, Policy: sse.DropNewest})
+	go svc.watch(ch)
+}
+
+// URI returns the transcript resource URI of a session
+func URI(sessionID string) string {
+	return uriPrefix + url.PathEscape(sessionID) + uriSuffix
+}
+
+// sessionFromURI returns the session a transcript resource URI names
+func sessionFromURI(uri string) (string, bool) {
+	rest, ok := strings.CutPrefix(uri, uriPrefix)
+	if !ok {
+		return "", false
+	}
+	escaped, ok := strings.CutSuffix(rest, uriSuffix)
+	if !ok || escaped == "" || strings.Contains(escaped, "/") {
+		return "", false
+	}
+	sessionID, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", false
+	}
+	return sessionID, true
+}
+
+// watch registers sessions on their first event, removes them when they
+// close and notifies the subscribers of a transcript that changed
+func (svc *Service) watch(ch <-chan sse.Event) {
+	for event := range ch {
+		sessionID := event.Topic
+		uri := URI(sessionID)
+
+		if event.Type == events.TypeClosed {
+			svc.notify(uri)
+			svc.remove(sessionID)
+			continue
+		}
+
+		svc.add(sessionID)
+		if event.Type == events.TypeExit || event.Type == events.TypeAnnotation {
+			svc.notify(uri)
+		}
+	}
+}
+
+// add registers a session's transcript resource unless it already is
+func (svc *Service) add(sessionID string) {
+	svc.mu.Lock()
+	if svc.listed[sessionID] {
+		svc.mu.Unlock()
+		return
+	}
+	svc.listed[sessionID] = true
+	svc.mu.Unlock()
+
+	svc.server.AddResource(mcp.NewResource(URI(sessionID), fmt.Sprintf("Session %s transcript", sessionID),
+		mcp.WithResourceDescription(fmt.Sprintf("Commands run in persistent shell session %s, with their output and notes", sessionID)),
+		mcp.WithMIMEType("text/plain"),
+	), svc.read)
+	svc.log.Debug("Registered resource", "session_id", sessionID)
+}
+
+// remove withdraws a closed session's resource and drops its subscribers
+func (svc *Service) remove(sessionID string) {
+	svc.mu.Lock()
+	listed := svc.listed[sessionID]
+	delete(svc.listed, sessionID)
+	delete(svc.subscribers, URI(sessionID))
+	svc.mu.Unlock()
+
+	if listed {
+		svc.server.RemoveResource(URI(sessionID))
+		svc.log.Debug("Removed resource", "session_id", sessionID)
+	}
+}
+
+// authorize checks that a client may read or follow a session's transcript
+func (svc *Service) authorize(uri, client string, admin bool) (string, error) {
+	sessionID, ok := sessionFromURI(uri)
+	if !ok {
+		return "", fmt.Errorf("unknown resource: %s", uri)
+	}
+	if err := svc.sessions.Authorize(sessionID, client, "", admin); err != nil {
+		return "", err
+	}
+	if !svc.sessions.Exists(sessionID) {
+		return "", fmt.Errorf("session not found: %s", sessionID)
+	}
+	return sessionID, nil
+}
+
+// read renders a session's transcript for resources/read
+func (svc *Service) read(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	sessionID, err := svc.authorize(uri, access.Client(ctx), access.IsAdmin(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := svc.sessions.GetTranscript(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      uri,
+		MIMEType: "text/plain",
+		Text:     render(sessionID, t),
+	}}, nil
+}
+
+// readMetrics returns the command statistics for resources/read. Clients
+// other than administrators see only their own sessions.
+func (svc *Service) readMetrics(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	var include func(string) bool
+	if !access.IsAdmin(ctx) {
+		client := access.Client(ctx)
+		include = func(sessionID string) bool { return svc.sessions.Owns(sessionID, client) }
+	}
+
+	data, err := json.MarshalIndent(metrics.Snapshot(include), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metrics: %v", err)
+	}
+
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}, nil
+}
+
+// render writes out every command a transcript holds, each followed by its notes
+func render(sessionID string, t *transcript.Transcript) string {
+	notes := make(map[int][]transcript.Note)
+	for _, n := range t.Notes() {
+		notes[n.After] = append(notes[n.After], n)
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Transcript for session %s:\n", sessionID)
+	writeNotes := func(after int) {
+		for _, n := range notes[after] {
+			fmt.Fprintf(&result, "  [note by %s at %s] %s\n", n.Author, n.Time.Format(time.RFC3339), n.Text)
+		}
+		delete(notes, after)
+	}
+
+	// Notes attached to commands that have been trimmed away come first
+	entries := t.Entries()
+	var earlier []int
+	for after := range notes {
+		if len(entries) == 0 || after < entries[0].Seq {
+			earlier = append(earlier, after)
+		}
+	}
+	sort.Ints(earlier)
+	for _, after := range earlier {
+		writeNotes(after)
+	}
+	for _, e := range entries {
+		status := fmt.Sprintf("exit %d", e.ExitCode)
+		if e.TimedOut {
+			status = "timed out"
+		}
+		fmt.Fprintf(&result, "--- #%d [%s] %s (%s) ---\n$ %s\n%s",
+			e.Seq, e.Started.Format(time.RFC3339), status, e.Duration().Round(time.Millisecond), e.Command, e.TimedOutput())
+		writeNotes(e.Seq)
+	}
+
+	return result.String()
+}
+
+// Subscribe makes client follow a transcript resource. Updates are sent as
+// notifications/resources/updated until it unsubscribes or the session closes.
+func (svc *Service) Subscribe(uri, client string, admin bool) error {
+	if _, err := svc.authorize(uri, client, admin); err != nil {
+		return err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	if svc.subscribers[uri] == nil {
+		svc.subscribers[uri] = make(map[string]bool)
+	}
+	svc.subscribers[uri][client] = true
+	svc.log.Debug("Subscribed to resource", "uri", uri, "client", client)
+
+	return nil
+}
+
+// Unsubscribe stops client following a resource
+func (svc *Service) Unsubscribe(uri, client string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	delete(svc.subscribers[uri], client)
+	if len(svc.subscribers[uri]) == 0 {
+		delete(svc.subscribers, uri)
+	}
+}
+
+// notify tells the subscribers of a resource that it changed. Clients that
+// are not connected at the moment miss the notification.
+func (svc *Service) notify(uri string) {
+	svc.mu.Lock()
+	clients := make([]string, 0, len(svc.subscribers[uri]))
+	for client := range svc.subscribers[uri] {
+		clients = append(clients, client)
+	}
+	svc.mu.Unlock()
+
+	for _, client := range clients {
+		err := svc.server.SendNotificationToSpecificClient(client, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+		if err != nil {
+			svc.log.Debug("Failed to notify subscriber", "uri", uri, "client", client, "error", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package resources
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/access"
+)
+
+const (
+	methodSubscribe   = "resources/subscribe"
+	methodUnsubscribe = "resources/unsubscribe"
+
+	// stdioClient is the MCP session ID mcp-go gives the stdio client
+	stdioClient = "stdio"
+)
+
+// subscriptionRequest is a resources/subscribe or resources/unsubscribe request
+type subscriptionRequest struct {
+	ID     *mcp.RequestId `json:"id"`
+	Method string         `json:"method"`
+	Params struct {
+		URI string `json:"uri"`
+	} `json:"params"`
+}
+
+// parseSubscription returns message as a subscription request, or false for
+// any other message
+func parseSubscription(message []byte) (subscriptionRequest, bool) {
+	var req subscriptionRequest
+	if err := json.Unmarshal(message, &req); err != nil || req.ID == nil {
+		return req, false
+	}
+	return req, req.Method == methodSubscribe || req.Method == methodUnsubscribe
+}
+
+// answer handles a subscription request and returns the JSON-RPC response
+func (svc *Service) answer(req subscriptionRequest, client string, admin bool) []byte {
+	var response any = mcp.NewJSONRPCResponse(*req.ID, mcp.Result{})
+	switch {
+	case client == "":
+		response = mcp.NewJSONRPCError(*req.ID, mcp.INVALID_PARAMS, "subscriptions need an MCP session", nil)
+	case req.Method == methodUnsubscribe:
+		svc.Unsubscribe(req.Params.URI, client)
+	default:
+		if err := svc.Subscribe(req.Params.URI, client, admin); err != nil {
+			response = mcp.NewJSONRPCError(*req.ID, mcp.INVALID_PARAMS, err.Error(), nil)
+		}
+	}
+
+	data, _ := json.Marshal(response)
+	return data
+}
+
+// Handler answers subscription requests posted to the streamable HTTP
+// endpoint and passes every other request on to next. Updates reach a client
+// through its GET stream on the endpoint.
+func (svc *Service) Handler(adminToken string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		req, ok := parseSubscription(body)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(svc.answer(req, r.Header.Get("Mcp-Session-Id"), access.IsAdminRequest(r, adminToken)))
+	})
+}
+
+// Stdio answers subscription requests read from in and passes every other
+// message on through the returned reader. The stdio client is an
+// administrator, as for tool calls. Responses go to out; the server must
+// write through the returned writer so that messages never interleave.
+func (svc *Service) Stdio(in io.Reader, out io.Writer) (io.Reader, io.Writer) {
+	pr, pw := io.Pipe()
+	w := &lockedWriter{w: out}
+
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if req, ok := parseSubscription(line); ok {
+					w.Write(append(svc.answer(req, stdioClient, true), '\n'))
+				} else if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pr, w
+}
+
+// lockedWriter serialises writes so each message stays in one piece
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
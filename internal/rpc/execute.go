@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"mcp-terminal-server/internal/charset"
+	"mcp-terminal-server/internal/executor"
+	"mcp-terminal-server/pkg/terminalpb"
+)
+
+// maxStreamLine is the longest line a stream sends whole; longer ones are
+// sent in pieces
+const maxStreamLine = 64 << 10
+
+// Execute runs a one-off command with execute_command
+func (s *Server) Execute(ctx context.Context, req *terminalpb.ExecuteRequest) (*terminalpb.ExecuteResponse, error) {
+	args, err := executeArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.call(ctx, "execute_command", args)
+	if err != nil {
+		return nil, err
+	}
+	resp := response(result)
+	if resp.Error != "" {
+		return nil, status.Error(codes.FailedPrecondition, resp.Error)
+	}
+	return resp, nil
+}
+
+// ExecuteStream runs a one-off command with execute_command, sending each
+// line of its output as it is printed and then the result
+func (s *Server) ExecuteStream(req *terminalpb.ExecuteRequest, stream terminalpb.Terminal_ExecuteStreamServer) error {
+	args, err := executeArgs(req)
+	if err != nil {
+		return err
+	}
+	encoding := req.Encoding
+	if encoding == "" {
+		encoding = s.cfg.OutputEncoding
+	}
+	if err := charset.Validate(encoding); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var mu sync.Mutex
+	send := func(chunk *terminalpb.OutputChunk) {
+		mu.Lock()
+		defer mu.Unlock()
+		stream.Send(&terminalpb.ExecuteEvent{Event: &terminalpb.ExecuteEvent_Output{Output: chunk}})
+	}
+	stdout := s.newLineWriter(encoding, false, send)
+	stderr := s.newLineWriter(encoding, true, send)
+
+	ctx := executor.WithLiveOutput(stream.Context(), stdout, stderr)
+	result, err := s.call(ctx, "execute_command", args)
+	if err != nil {
+		return err
+	}
+	stdout.flush()
+	stderr.flush()
+
+	resp := response(result)
+	if resp.Error != "" {
+		return status.Error(codes.FailedPrecondition, resp.Error)
+	}
+	return stream.Send(&terminalpb.ExecuteEvent{Event: &terminalpb.ExecuteEvent_Result{Result: resp}})
+}
+
+// executeArgs turns a request into the arguments of execute_command
+func executeArgs(req *terminalpb.ExecuteRequest) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	switch {
+	case len(req.Argv) > 0 && req.Command != "":
+		return nil, status.Error(codes.InvalidArgument, "give command or argv, not both")
+	case len(req.Argv) > 0:
+		argv := make([]interface{}, len(req.Argv))
+		for i, arg := range req.Argv {
+			argv[i] = arg
+		}
+		args["argv"] = argv
+	case req.Command != "":
+		args["command"] = req.Command
+	default:
+		return nil, status.Error(codes.InvalidArgument, "command or argv is required")
+	}
+
+	if len(req.Env) > 0 {
+		env := make(map[string]interface{}, len(req.Env))
+		for name, value := range req.Env {
+			env[name] = value
+		}
+		args["env"] = env
+	}
+	if req.Shell != "" {
+		args["shell"] = req.Shell
+	}
+	if req.Cwd != "" {
+		args["cwd"] = req.Cwd
+	}
+	if req.TimeoutSeconds > 0 {
+		args["timeout"] = float64(req.TimeoutSeconds)
+	}
+	if req.Encoding != "" {
+		args["encoding"] = req.Encoding
+	}
+	args["capture_stderr"] = req.CaptureStderr
+	args["confirm"] = req.Confirm
+	return args, nil
+}
+
+// lineWriter sends a command's output to a stream a line at a time, each
+// converted, mapped and redacted as results are. The command writes to it
+// from one goroutine at a time.
+type lineWriter struct {
+	s       *Server
+	decoder *charset.Decoder
+	stderr  bool
+	send    func(*terminalpb.OutputChunk)
+	partial []byte
+}
+
+// newLineWriter creates a line writer for output in encoding
+func (s *Server) newLineWriter(encoding string, stderr bool, send func(*terminalpb.OutputChunk)) *lineWriter {
+	decoder, _ := charset.NewDecoder(encoding)
+	return &lineWriter{s: s, decoder: decoder, stderr: stderr, send: send}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	for len(w.partial) > maxStreamLine {
+		w.line(w.partial[:maxStreamLine])
+		w.partial = w.partial[maxStreamLine:]
+	}
+	return len(p), nil
+}
+
+// flush sends what is left of a line the command did not end
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.line(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *lineWriter) line(data []byte) {
+	text := w.decoder.String(string(bytes.TrimSuffix(data, []byte("\r"))))
+	w.send(&terminalpb.OutputChunk{Line: w.s.redact.String(w.s.paths.ToClient(text)), Stderr: w.stderr})
+}
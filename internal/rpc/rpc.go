@@ -0,0 +1,327 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/auth"
+	"mcp-terminal-server/internal/backends"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/pathmap"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/redact"
+	"mcp-terminal-server/internal/render"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/pkg/terminalpb"
+)
+
+// Server implements the gRPC API. Commands are run by calling the MCP tools
+// in process, so the policy, audit log, redaction, limits and every other
+// tool middleware apply to them as to MCP clients; results are asked for in
+// the JSON result format and read into typed messages.
+type Server struct {
+	terminalpb.UnimplementedTerminalServer
+
+	cfg      *config.Config
+	mcp      *server.MCPServer
+	sessions *session.Manager
+	policy   *policy.Engine
+	profiles *profiles.Store
+	audit    *audit.Log
+	hook     auth.Hook
+	redact   *redact.Redactor
+	paths    *pathmap.Map
+	log      *slog.Logger
+	// calls numbers the JSON-RPC requests passed to the MCP server
+	calls atomic.Int64
+}
+
+// New creates a gRPC server serving the API with the tools registered on
+// mcpServer
+func New(cfg *config.Config, mcpServer *server.MCPServer, sessions *session.Manager, policyEngine *policy.Engine, profileStore *profiles.Store, auditLog *audit.Log) *grpc.Server {
+	s := &Server{
+		cfg:      cfg,
+		mcp:      mcpServer,
+		sessions: sessions,
+		policy:   policyEngine,
+		profiles: profileStore,
+		audit:    auditLog,
+		hook:     auth.New(cfg),
+		redact:   redact.New(cfg),
+		paths:    pathmap.New(cfg),
+		log:      logging.For("grpc"),
+	}
+	g := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := s.authenticate(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := s.authenticate(stream.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+		}),
+	)
+	terminalpb.RegisterTerminalServer(g, s)
+	return g
+}
+
+// authenticatedStream carries the caller's identity to a streaming call
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+// authenticate establishes who a call comes from, as the HTTP API does: the
+// auth hook, when there is one, is asked with the call's metadata as headers,
+// and "authorization: Bearer <admin token>" grants admin rights. The caller
+// becomes an MCP client of its own, named after its identity, so sessions it
+// creates are its own.
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = access.WithTransport(ctx, access.TransportGRPC)
+
+	if s.hook != nil {
+		req := auth.Request{Method: http.MethodPost, Path: method, Headers: make(map[string]string, len(md))}
+		if p, ok := peer.FromContext(ctx); ok {
+			req.Client = p.Addr.String()
+			if host, _, err := net.SplitHostPort(req.Client); err == nil {
+				req.Client = host
+			}
+		}
+		for name, values := range md {
+			req.Headers[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+		}
+
+		result, err := s.hook.Authenticate(ctx, req)
+		var unavailable *backends.Unavailable
+		if errors.As(err, &unavailable) {
+			return nil, status.Errorf(codes.Unavailable, "authentication is unavailable: %v", err)
+		}
+		if err != nil {
+			s.log.Warn("Auth hook failed", "method", method, "client", req.Client, "error", err)
+			return nil, status.Error(codes.Unavailable, "authentication is unavailable")
+		}
+		if !result.Allow {
+			reason := result.Reason
+			if reason == "" {
+				reason = "not authorized"
+			}
+			s.log.Info("Auth hook denied call", "method", method, "client", req.Client, "identity", result.Identity, "reason", reason)
+			if result.Identity == "" {
+				return nil, status.Error(codes.Unauthenticated, reason)
+			}
+			return nil, status.Error(codes.PermissionDenied, reason)
+		}
+		ctx = access.WithIdentity(ctx, access.Identity{Name: result.Identity, Role: result.Role})
+		if result.Admin {
+			ctx = access.WithAdmin(ctx)
+		}
+	}
+
+	if token := s.cfg.AdminToken; token != "" {
+		for _, value := range md.Get("authorization") {
+			presented, ok := strings.CutPrefix(value, "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+				ctx = access.WithAdmin(ctx)
+			}
+		}
+	}
+
+	id := "grpc"
+	if name := access.IdentityFrom(ctx).Name; name != "" {
+		id += ":" + name
+	}
+	return s.mcp.WithContext(ctx, &client{id: id}), nil
+}
+
+// client stands in for the MCP client session of a gRPC caller. It never
+// takes notifications, as the API streams what it has to say itself.
+type client struct {
+	id string
+}
+
+func (c *client) Initialize()       {}
+func (c *client) Initialized() bool { return false }
+func (c *client) SessionID() string { return c.id }
+
+func (c *client) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return nil
+}
+
+// call runs a tool through the MCP server with its result in the JSON
+// format. A call the server rejects outright, such as one naming a tool
+// that does not exist, returns an error.
+func (s *Server) call(ctx context.Context, tool string, args map[string]interface{}) (mcp.CallToolResult, error) {
+	args[render.Param] = render.FormatJSON
+	message, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      s.calls.Add(1),
+		"method":  mcp.MethodToolsCall,
+		"params":  map[string]interface{}{"name": tool, "arguments": args},
+	})
+	if err != nil {
+		return mcp.CallToolResult{}, status.Errorf(codes.InvalidArgument, "invalid arguments: %v", err)
+	}
+
+	switch response := s.mcp.HandleMessage(ctx, message).(type) {
+	case mcp.JSONRPCResponse:
+		if result, ok := response.Result.(mcp.CallToolResult); ok {
+			return result, nil
+		}
+		return mcp.CallToolResult{}, status.Errorf(codes.Internal, "unexpected result of %s", tool)
+	case mcp.JSONRPCError:
+		return mcp.CallToolResult{}, status.Error(codes.Internal, response.Error.Message)
+	}
+	return mcp.CallToolResult{}, status.Errorf(codes.Internal, "no result from %s", tool)
+}
+
+// response reads a command's result into a typed response. The first text
+// block holds the summary and fields, stream blocks hold stdout and stderr
+// kept apart, and further text blocks are notes. A result without an exit
+// code is of a command that never ran, such as one the policy refused, and
+// carries the reason as its error.
+func response(result mcp.CallToolResult) *terminalpb.ExecuteResponse {
+	resp := &terminalpb.ExecuteResponse{Fields: make(map[string]string)}
+	streams, _ := result.Meta[render.StreamsMeta].([]string)
+
+	haveSummary, haveExit := false, false
+	for i, content := range result.Content {
+		text, ok := content.(mcp.TextContent)
+		if !ok {
+			continue
+		}
+		stream := ""
+		if i < len(streams) {
+			stream = streams[i]
+		}
+		switch stream {
+		case render.StreamStdout:
+			resp.Output = text.Text
+			continue
+		case render.StreamStderr:
+			resp.Stderr = text.Text
+			continue
+		case render.StreamMerged:
+			continue
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(text.Text), &fields); err != nil {
+			fields = map[string]interface{}{"text": text.Text}
+		}
+		if haveSummary {
+			resp.Notes = append(resp.Notes, note(fields))
+			continue
+		}
+		haveSummary = true
+
+		for key, value := range fields {
+			switch key {
+			case "text":
+				resp.Summary, _ = value.(string)
+			case "output", "output_partial":
+				if resp.Output == "" {
+					resp.Output, _ = value.(string)
+				}
+			case "exit_code":
+				code, _ := value.(float64)
+				resp.ExitCode = int32(code)
+				haveExit = true
+			case "timed_out":
+				resp.TimedOut, _ = value.(bool)
+			case "error", render.StreamsMeta:
+			default:
+				resp.Fields[key] = fieldValue(value)
+			}
+		}
+	}
+
+	if !haveExit && result.IsError {
+		resp.Error = resp.Summary
+	}
+	return resp
+}
+
+// note turns a further block of a result back into text
+func note(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	if text, ok := fields["text"].(string); ok {
+		lines = append(lines, text)
+	}
+	for _, key := range keys {
+		if key != "text" && key != "error" && key != render.StreamsMeta {
+			lines = append(lines, fmt.Sprintf("%s: %s", key, fieldValue(fields[key])))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fieldValue formats a decoded field of a result as text
+func fieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// allowed checks that the caller's role may use a tool, for calls that do
+// not go through one
+func (s *Server) allowed(ctx context.Context, tool string) error {
+	d := s.policy.Evaluate(policy.Request{Tool: tool, Role: access.IdentityFrom(ctx).Role, Transport: access.Transport(ctx)})
+	if !d.Allowed {
+		return status.Errorf(codes.PermissionDenied, "denied by policy: %s", d.Reason)
+	}
+	return nil
+}
+
+// auditDetails are the details recorded with the caller's session changes
+func auditDetails(ctx context.Context) map[string]interface{} {
+	details := map[string]interface{}{"transport": access.TransportGRPC}
+	if identity := access.IdentityFrom(ctx).Name; identity != "" {
+		details["identity"] = identity
+	}
+	return details
+}
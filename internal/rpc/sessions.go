@@ -0,0 +1,342 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/executor"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/sse"
+	"mcp-terminal-server/pkg/terminalpb"
+)
+
+// CreateSession starts a persistent session owned by the caller
+func (s *Server) CreateSession(ctx context.Context, req *terminalpb.CreateSessionRequest) (*terminalpb.Session, error) {
+	if err := s.allowed(ctx, "persistent_shell"); err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if s.sessions.Exists(req.Id) {
+		return nil, status.Errorf(codes.AlreadyExists, "session already exists: %s", req.Id)
+	}
+
+	// The caller's profile applies as it does to persistent_shell calls: it
+	// gives the defaults, environment, user and teardown of the session
+	p, _ := s.profiles.Current(access.Client(ctx))
+	if p.Locked {
+		if req.Shell != "" && p.Shell != "" {
+			return nil, status.Errorf(codes.PermissionDenied, "profile %s is locked; its shell cannot be overridden", p.Name)
+		}
+		if req.Cwd != "" && p.Cwd != "" {
+			return nil, status.Errorf(codes.PermissionDenied, "profile %s is locked; its cwd cannot be overridden", p.Name)
+		}
+		for name := range req.Env {
+			if _, fixed := p.Env[name]; fixed {
+				return nil, status.Errorf(codes.PermissionDenied, "profile %s is locked; its %s variable cannot be overridden", p.Name, name)
+			}
+		}
+	}
+	profileCtx := profiles.NewContext(ctx, p)
+
+	vars := make(map[string]interface{}, len(req.Env))
+	for name, value := range req.Env {
+		vars[name] = value
+	}
+	env, err := executor.Env(map[string]interface{}{"env": vars})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid env: %v", err)
+	}
+
+	shell, cwd := req.Shell, req.Cwd
+	if shell == "" {
+		shell = p.Shell
+	}
+	if shell == "" {
+		shell = s.cfg.Shell
+	}
+	if cwd == "" {
+		cwd = p.Cwd
+	}
+	opts := session.Options{
+		Shell:      shell,
+		WorkingDir: cwd,
+		Owner:      access.Client(ctx),
+		Meta:       session.Meta{Name: req.Name, Description: req.Description, Tags: req.Tags},
+		Env:        append(profiles.Env(profileCtx), env...),
+		User:       profiles.User(profileCtx),
+	}
+	if len(p.Teardown) > 0 {
+		opts.Teardown = &session.Teardown{
+			Profile:  p.Name,
+			Commands: p.Teardown,
+			Timeout:  time.Duration(p.TeardownTimeout * float64(time.Second)),
+		}
+	}
+	_, err = s.sessions.GetOrCreateSession(req.Id, opts)
+	details := auditDetails(ctx)
+	if err != nil {
+		details["error"] = err.Error()
+		s.audit.Append(audit.ActorAgent, "create_session", req.Id, "error", details)
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to create session: %v", err)
+	}
+	s.audit.Append(audit.ActorAgent, "create_session", req.Id, "ok", details)
+	return s.describe(req.Id)
+}
+
+// GetSession describes one of the caller's sessions
+func (s *Server) GetSession(ctx context.Context, req *terminalpb.GetSessionRequest) (*terminalpb.Session, error) {
+	if err := s.access(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	return s.describe(req.Id)
+}
+
+// ListSessions lists the caller's sessions, or every session for
+// administrators
+func (s *Server) ListSessions(ctx context.Context, req *terminalpb.ListSessionsRequest) (*terminalpb.ListSessionsResponse, error) {
+	if err := s.allowed(ctx, "session_manager"); err != nil {
+		return nil, err
+	}
+	client, admin := access.Client(ctx), access.IsAdmin(ctx)
+	resp := &terminalpb.ListSessionsResponse{}
+	for _, summary := range s.sessions.Summaries() {
+		if admin || summary.Owner == client {
+			resp.Sessions = append(resp.Sessions, sessionMessage(summary))
+		}
+	}
+	return resp, nil
+}
+
+// DeleteSession closes one of the caller's sessions, returning the outcome
+// of its teardown commands
+func (s *Server) DeleteSession(ctx context.Context, req *terminalpb.DeleteSessionRequest) (*terminalpb.DeleteSessionResponse, error) {
+	if err := s.access(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	teardown, err := s.sessions.CloseSession(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	s.audit.Append(audit.ActorAgent, "close_session", req.Id, "ok", auditDetails(ctx))
+
+	resp := &terminalpb.DeleteSessionResponse{}
+	for _, result := range teardown {
+		command := &terminalpb.TeardownCommand{
+			Command:  result.Command,
+			ExitCode: int32(result.ExitCode),
+			TimedOut: result.TimedOut,
+			Output:   s.redact.String(s.paths.ToClient(result.Output)),
+		}
+		if result.Err != nil {
+			command.Error = result.Err.Error()
+		}
+		resp.Teardown = append(resp.Teardown, command)
+	}
+	return resp, nil
+}
+
+// access checks that the caller may manage a session: its owner or an
+// administrator. Other clients' sessions are as good as missing.
+func (s *Server) access(ctx context.Context, sessionID string) error {
+	if err := s.allowed(ctx, "session_manager"); err != nil {
+		return err
+	}
+	if sessionID == "" {
+		return status.Error(codes.InvalidArgument, "id is required")
+	}
+	if !s.sessions.Exists(sessionID) || (!access.IsAdmin(ctx) && !s.sessions.Owns(sessionID, access.Client(ctx))) {
+		return status.Errorf(codes.NotFound, "session not found: %s", sessionID)
+	}
+	return nil
+}
+
+// describe returns a session in full
+func (s *Server) describe(sessionID string) (*terminalpb.Session, error) {
+	info, err := s.sessions.Info(sessionID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	for _, summary := range s.sessions.Summaries() {
+		if summary.ID == sessionID {
+			message := sessionMessage(summary)
+			message.Cwd = info.Cwd
+			message.Description = info.Meta.Description
+			return message, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "session not found: %s", sessionID)
+}
+
+// sessionMessage converts a session's summary
+func sessionMessage(summary session.Summary) *terminalpb.Session {
+	return &terminalpb.Session{
+		Id:         summary.ID,
+		Name:       summary.Name,
+		Tags:       summary.Tags,
+		Shell:      summary.Shell,
+		Pid:        int32(summary.Pid),
+		State:      summary.State,
+		Owner:      summary.Owner,
+		Controller: summary.Controller,
+		Pinned:     summary.Pinned,
+		Created:    timestamppb.New(summary.Created),
+		LastUsed:   timestamppb.New(summary.LastUsed),
+		Command:    summary.Command,
+		Usage: &terminalpb.SessionUsage{
+			Commands:    int64(summary.Usage.Commands),
+			WallSeconds: summary.Usage.WallTime.Seconds(),
+			CpuSeconds:  summary.Usage.CPUTime.Seconds(),
+			OutputBytes: summary.Usage.OutputBytes,
+		},
+	}
+}
+
+// Attach follows one of the caller's sessions: the first message names the
+// session, after which its events stream to the caller, who may send
+// commands to run in it and interrupt them. Commands go through
+// persistent_shell, so they are checked and recorded as any other; each
+// one's result follows its events.
+func (s *Server) Attach(stream terminalpb.Terminal_AttachServer) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	open := first.GetOpen()
+	if open == nil {
+		return status.Error(codes.InvalidArgument, "the first message must open a session")
+	}
+	if err := s.access(ctx, open.SessionId); err != nil {
+		return err
+	}
+
+	sub := sse.Subscription{Topics: []string{open.SessionId}, Types: open.Types}
+	if open.LastEventId > 0 {
+		sub.Cursor = sse.Cursor{open.SessionId: open.LastEventId}
+	}
+	feed, unsubscribe := s.sessions.Subscribe(sub)
+	defer unsubscribe()
+
+	var mu sync.Mutex
+	send := func(event *terminalpb.AttachEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return stream.Send(event)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	received := make(chan error, 1)
+	go func() {
+		received <- s.attachInput(ctx, stream, open.SessionId, send)
+	}()
+
+	for {
+		select {
+		case event, ok := <-feed:
+			if !ok {
+				return nil
+			}
+			if err := send(s.attachEvent(event)); err != nil {
+				return err
+			}
+		case err := <-received:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// attachInput runs what the caller sends to an attached session until it
+// stops sending, then waits for the commands it sent to finish. Commands run
+// alongside further messages, so a running command can be interrupted.
+func (s *Server) attachInput(ctx context.Context, stream terminalpb.Terminal_AttachServer, sessionID string, send func(*terminalpb.AttachEvent) error) error {
+	var running sync.WaitGroup
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			running.Wait()
+			return err
+		}
+		switch {
+		case req.GetCommand() != nil:
+			command := req.GetCommand()
+			args := map[string]interface{}{
+				"session_id": sessionID,
+				"command":    command.Command,
+				"confirm":    command.Confirm,
+			}
+			if command.TimeoutSeconds > 0 {
+				args["timeout"] = float64(command.TimeoutSeconds)
+			}
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				result, err := s.call(ctx, "persistent_shell", args)
+				resp := response(result)
+				if err != nil {
+					resp = &terminalpb.ExecuteResponse{Error: status.Convert(err).Message()}
+				}
+				send(&terminalpb.AttachEvent{Event: &terminalpb.AttachEvent_Result{Result: resp}})
+			}()
+		case req.GetInterrupt() != nil:
+			result, err := s.call(ctx, "interrupt", map[string]interface{}{"session_id": sessionID})
+			if err != nil {
+				return err
+			}
+			if resp := response(result); resp.Error != "" {
+				send(&terminalpb.AttachEvent{Event: &terminalpb.AttachEvent_Result{Result: resp}})
+			}
+		default:
+			return status.Error(codes.InvalidArgument, "a session is already open; send a command or an interrupt")
+		}
+	}
+}
+
+// attachEvent converts a session event. Events without a message of their
+// own are passed on as their type and JSON payload.
+func (s *Server) attachEvent(event sse.Event) *terminalpb.AttachEvent {
+	message := &terminalpb.AttachEvent{Id: event.ID}
+	switch data := event.Data.(type) {
+	case events.Command:
+		message.Event = &terminalpb.AttachEvent_Command{Command: &terminalpb.CommandStarted{
+			Command: s.redact.String(data.Command),
+			By:      data.By,
+			Started: timestamppb.New(data.Started),
+		}}
+	case events.Output:
+		message.Event = &terminalpb.AttachEvent_Output{Output: &terminalpb.OutputChunk{Line: s.redact.String(data.Line)}}
+	case events.Exit:
+		message.Event = &terminalpb.AttachEvent_Exit{Exit: &terminalpb.CommandExited{
+			Seq:        int32(data.Seq),
+			Command:    s.redact.String(data.Command),
+			ExitCode:   int32(data.ExitCode),
+			TimedOut:   data.TimedOut,
+			DurationMs: data.DurationMS,
+		}}
+	default:
+		payload, err := json.Marshal(event.Data)
+		if err != nil {
+			payload = []byte(fmt.Sprintf("%q", err.Error()))
+		}
+		message.Event = &terminalpb.AttachEvent_Other{Other: &terminalpb.SessionEvent{Type: event.Type, Json: string(payload)}}
+	}
+	return message
+}
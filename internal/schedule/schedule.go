@@ -0,0 +1,401 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/executor"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/redact"
+	"mcp-terminal-server/internal/sse"
+)
+
+// maxOutput bounds the output kept for one run; the start is dropped
+const maxOutput = 64 << 10
+
+// Job states
+const (
+	StateScheduled = "scheduled"
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateCancelled = "cancelled"
+)
+
+// Spec describes a command to schedule
+type Spec struct {
+	Command string
+	// Delay runs the command once after it; Cron runs it on a schedule instead
+	Delay time.Duration
+	Cron  *Cron
+	// Timeout bounds each run
+	Timeout time.Duration
+	// Owner is the client that scheduled the command
+	Owner string
+	// Role is the policy role of the client, which each run is checked against
+	Role string
+	// Transport is how the client reached the server, for the policy's
+	// transport roles
+	Transport string
+	// Confirmed confirms the command to maintenance windows that ask for it
+	Confirmed bool
+	// Profile is the profile of the call that scheduled the command, whose
+	// environment, user and restrictions apply to each run (nil = none)
+	Profile *profiles.Profile
+}
+
+// Job is a scheduled command
+type Job struct {
+	ID      string
+	Command string
+	// Cron is the schedule of a recurring job, or "" for a one-shot job
+	Cron  string
+	Owner string
+	Role  string
+	// Confirmed is passed on to the policy with each run
+	Confirmed bool
+	Timeout   time.Duration
+	Created   time.Time
+	// Next is when the job runs next, or the zero time when it will not
+	Next  time.Time
+	State string
+	Runs  int
+}
+
+// Result is the outcome of one run of a job
+type Result struct {
+	Run      int
+	Started  time.Time
+	Duration time.Duration
+	Output   string
+	// Truncated is set when the start of Output was dropped
+	Truncated bool
+	ExitCode  int
+	TimedOut  bool
+	// Killed says what ended a command that did not exit by itself, such as
+	// a signal
+	Killed string
+	// Error says why the command did not run
+	Error string
+}
+
+// job is a scheduled command with its results and the means to stop it
+type job struct {
+	Job
+	// transport and profile are the Spec's, for the policy check and the
+	// command of each run
+	transport string
+	profile   *profiles.Profile
+	cron      *Cron
+	results   []Result
+	// cancel stops the job, including a run in progress
+	cancel context.CancelFunc
+	ctx    context.Context
+}
+
+// Scheduler runs commands after a delay or on a cron schedule, outside any
+// session and any tool call. Each run's result is kept for the job and
+// published on the scheduler's event stream.
+type Scheduler struct {
+	executor   *executor.Executor
+	policy     *policy.Engine
+	redact     *redact.Redactor
+	events     *sse.Broadcaster
+	maxJobs    int
+	maxResults int
+	log        *slog.Logger
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	seq  int
+}
+
+// New creates the scheduler
+func New(cfg *config.Config, exec *executor.Executor, policyEngine *policy.Engine) *Scheduler {
+	return &Scheduler{
+		executor:   exec,
+		policy:     policyEngine,
+		redact:     redact.New(cfg),
+		events:     sse.NewBroadcaster(cfg.SSEReplayEvents, cfg.SSEQueueSize, sse.Policy(cfg.SSELagPolicy)),
+		maxJobs:    cfg.ScheduleMaxJobs,
+		maxResults: cfg.ScheduleMaxResults,
+		log:        logging.For("schedule"),
+		jobs:       make(map[string]*job),
+	}
+}
+
+// Add schedules a command
+func (s *Scheduler) Add(spec Spec) (Job, error) {
+	if (spec.Cron == nil) == (spec.Delay <= 0) {
+		return Job{}, fmt.Errorf("give either a delay or a cron expression")
+	}
+
+	now := time.Now()
+	next := now.Add(spec.Delay)
+	if spec.Cron != nil {
+		if next = spec.Cron.Next(now); next.IsZero() {
+			return Job{}, fmt.Errorf("cron expression %q never matches", spec.Cron)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.makeRoom(); err != nil {
+		return Job{}, err
+	}
+
+	s.seq++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job: Job{
+			ID:        "job-" + strconv.Itoa(s.seq),
+			Command:   spec.Command,
+			Owner:     spec.Owner,
+			Role:      spec.Role,
+			Confirmed: spec.Confirmed,
+			Timeout:   spec.Timeout,
+			Created:   now,
+			Next:      next,
+			State:     StateScheduled,
+		},
+		transport: spec.Transport,
+		profile:   spec.Profile,
+		cron:      spec.Cron,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if spec.Cron != nil {
+		j.Cron = spec.Cron.String()
+	}
+	s.jobs[j.ID] = j
+
+	s.log.Info("Scheduled command", "job_id", j.ID, logging.Command(j.Command), "cron", j.Cron, "next", next)
+	go s.loop(j)
+
+	return j.Job, nil
+}
+
+// makeRoom forgets the oldest finished job when the limit is reached. The
+// caller must hold s.mu.
+func (s *Scheduler) makeRoom() error {
+	if len(s.jobs) < s.maxJobs {
+		return nil
+	}
+
+	var oldest *job
+	for _, j := range s.jobs {
+		if j.State != StateDone && j.State != StateCancelled {
+			continue
+		}
+		if oldest == nil || j.Created.Before(oldest.Created) {
+			oldest = j
+		}
+	}
+	if oldest == nil {
+		return fmt.Errorf("scheduled job limit of %d reached; cancel a job first", s.maxJobs)
+	}
+
+	delete(s.jobs, oldest.ID)
+	s.events.Close(oldest.ID)
+	return nil
+}
+
+// loop waits for each of a job's runs until it is done or cancelled
+func (s *Scheduler) loop(j *job) {
+	for {
+		s.mu.Lock()
+		next := j.Next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-j.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		j.State = StateRunning
+		j.Runs++
+		run := j.Runs
+		s.mu.Unlock()
+
+		result := s.run(j, run)
+
+		s.mu.Lock()
+		j.results = append(j.results, result)
+		if len(j.results) > s.maxResults {
+			j.results = j.results[len(j.results)-s.maxResults:]
+		}
+		j.Next = time.Time{}
+		if j.cron != nil {
+			j.Next = j.cron.Next(time.Now())
+		}
+		switch {
+		case j.ctx.Err() != nil:
+			j.State, j.Next = StateCancelled, time.Time{}
+		case j.Next.IsZero():
+			j.State = StateDone
+		default:
+			j.State = StateScheduled
+		}
+		state := j.State
+		var nextRun *time.Time
+		if !j.Next.IsZero() {
+			at := j.Next
+			nextRun = &at
+		}
+		s.mu.Unlock()
+
+		s.events.Publish(j.ID, sse.Event{Type: events.TypeScheduledRun, Data: events.ScheduledRun{
+			Version:    events.Version,
+			JobID:      j.ID,
+			Run:        result.Run,
+			Command:    j.Command,
+			Started:    result.Started,
+			DurationMS: result.Duration.Milliseconds(),
+			ExitCode:   result.ExitCode,
+			TimedOut:   result.TimedOut,
+			Killed:     result.Killed,
+			Output:     result.Output,
+			Error:      result.Error,
+			Next:       nextRun,
+		}})
+
+		if state != StateScheduled {
+			j.cancel()
+			return
+		}
+	}
+}
+
+// run runs a job once. The policy is checked again, since it may have changed
+// since the command was scheduled.
+func (s *Scheduler) run(j *job, run int) Result {
+	result := Result{Run: run, Started: time.Now(), ExitCode: -1}
+
+	req := policy.Request{Tool: "schedule_command", Command: j.Command, Role: j.Role, Transport: j.transport, Confirmed: j.Confirmed}
+	ctx := j.ctx
+	if j.profile != nil {
+		req.Restrictions = j.profile.Policy
+		ctx = profiles.NewContext(ctx, *j.profile)
+	}
+	decision := s.policy.Evaluate(req)
+	if !decision.Allowed {
+		result.Error = fmt.Sprintf("denied by policy: %s", decision.Reason)
+		if decision.Hint != "" {
+			result.Error += fmt.Sprintf(" (hint: %s)", decision.Hint)
+		}
+		s.log.Warn("Scheduled command denied", "job_id", j.ID, logging.Command(j.Command), "reason", decision.Reason)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, j.Timeout)
+	defer cancel()
+
+	output, exitCode, err := s.executor.Run(ctx, j.Command)
+	result.Duration = time.Since(result.Started)
+
+	output = s.redact.String(output)
+	if len(output) > maxOutput {
+		output = output[len(output)-maxOutput:]
+		result.Truncated = true
+	}
+	result.Output = output
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		result.ExitCode, result.Killed = exitCode, exitErr.String()
+		s.log.Warn("Scheduled command was killed", "job_id", j.ID, logging.Command(j.Command), "error", err)
+		return result
+	case err != nil:
+		result.Error = err.Error()
+		s.log.Warn("Scheduled command failed to start", "job_id", j.ID, logging.Command(j.Command), "error", err)
+		return result
+	}
+	result.ExitCode = exitCode
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+
+	s.log.Info("Scheduled command finished", "job_id", j.ID, "run", run, logging.Command(j.Command),
+		"exit_code", exitCode, "timed_out", result.TimedOut, "duration_ms", result.Duration.Milliseconds())
+	return result
+}
+
+// lookup returns a job the caller may see. Jobs of other clients are
+// reported as missing, except to administrators. The caller must hold s.mu.
+func (s *Scheduler) lookup(id, owner string, admin bool) (*job, error) {
+	j, ok := s.jobs[id]
+	if !ok || (j.Owner != owner && !admin) {
+		return nil, fmt.Errorf("scheduled job not found: %s", id)
+	}
+	return j, nil
+}
+
+// List returns the jobs the caller may see, oldest first
+func (s *Scheduler) List(owner string, admin bool) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []Job
+	for _, j := range s.jobs {
+		if j.Owner == owner || admin {
+			jobs = append(jobs, j.Job)
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].Created.Before(jobs[b].Created)
+	})
+	return jobs
+}
+
+// Results returns a job and its kept results, oldest first
+func (s *Scheduler) Results(id, owner string, admin bool) (Job, []Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, err := s.lookup(id, owner, admin)
+	if err != nil {
+		return Job{}, nil, err
+	}
+	return j.Job, append([]Result(nil), j.results...), nil
+}
+
+// Cancel stops a job from running again, stopping a run in progress
+func (s *Scheduler) Cancel(id, owner string, admin bool) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, err := s.lookup(id, owner, admin)
+	if err != nil {
+		return Job{}, err
+	}
+	if j.State == StateDone || j.State == StateCancelled {
+		return Job{}, fmt.Errorf("scheduled job %s is already %s", id, j.State)
+	}
+
+	j.cancel()
+	// A run in progress records its result and the state when it stops
+	if j.State == StateScheduled {
+		j.State, j.Next = StateCancelled, time.Time{}
+	}
+	s.log.Info("Cancelled scheduled command", "job_id", id, logging.Command(j.Command))
+
+	return j.Job, nil
+}
+
+// Subscribe follows the results of jobs as they run; see sse.Broadcaster.Subscribe
+func (s *Scheduler) Subscribe(sub sse.Subscription) (<-chan sse.Event, func()) {
+	return s.events.Subscribe(sub)
+}
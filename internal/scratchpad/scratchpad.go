@@ -0,0 +1,161 @@
+package scratchpad
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+)
+
+// keyPattern matches the keys entries may be given, such as "build/artifact-url"
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]{0,127}$`)
+
+// Entry is a value kept in the scratchpad
+type Entry struct {
+	Key     string
+	Value   string
+	Updated time.Time
+	Expires time.Time
+}
+
+// size is what an entry counts against the scratchpad's limit
+func (e Entry) size() int {
+	return len(e.Key) + len(e.Value)
+}
+
+// Pad is a small key-value store agents use to pass data between sessions
+// and tool calls. It is shared by the clients of the server, which serves a
+// single tenant, and kept in memory only.
+type Pad struct {
+	maxBytes      int
+	maxValueBytes int
+	ttl           time.Duration
+	maxTTL        time.Duration
+
+	mu      sync.Mutex
+	entries map[string]Entry
+	// used is the size of the entries
+	used int
+}
+
+// New creates the scratchpad, or returns nil when it is disabled
+func New(cfg *config.Config) *Pad {
+	if cfg.ScratchpadMaxBytes <= 0 {
+		return nil
+	}
+	return &Pad{
+		maxBytes:      cfg.ScratchpadMaxBytes,
+		maxValueBytes: cfg.ScratchpadMaxValueBytes,
+		ttl:           cfg.ScratchpadTTL,
+		maxTTL:        cfg.ScratchpadMaxTTL,
+		entries:       make(map[string]Entry),
+	}
+}
+
+// MaxValueBytes returns how large a value may be
+func (p *Pad) MaxValueBytes() int {
+	return p.maxValueBytes
+}
+
+// TTL returns how long entries are kept unless set with a TTL of their own
+func (p *Pad) TTL() time.Duration {
+	return p.ttl
+}
+
+// MaxTTL returns the longest TTL an entry may be given
+func (p *Pad) MaxTTL() time.Duration {
+	return p.maxTTL
+}
+
+// Set stores value under key for ttl, or the default TTL when ttl is 0,
+// replacing any value the key had
+func (p *Pad) Set(key, value string, ttl time.Duration) (Entry, error) {
+	if !keyPattern.MatchString(key) {
+		return Entry{}, fmt.Errorf("invalid key %q: use up to 128 letters, digits and '_.:/-', starting with a letter or digit", key)
+	}
+	if len(value) > p.maxValueBytes {
+		return Entry{}, fmt.Errorf("value is %d bytes, more than the %d allowed", len(value), p.maxValueBytes)
+	}
+	switch {
+	case ttl < 0:
+		return Entry{}, fmt.Errorf("ttl must be positive")
+	case ttl == 0:
+		ttl = p.ttl
+	case ttl > p.maxTTL:
+		return Entry{}, fmt.Errorf("ttl must be at most %s", p.maxTTL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.expire(now)
+	entry := Entry{Key: key, Value: value, Updated: now, Expires: now.Add(ttl)}
+	used := p.used - p.entries[key].size() + entry.size()
+	if used > p.maxBytes {
+		return Entry{}, fmt.Errorf("the scratchpad is full: %d of %d bytes in use; delete entries or wait for them to expire", p.used, p.maxBytes)
+	}
+	p.entries[key] = entry
+	p.used = used
+	return entry, nil
+}
+
+// Get returns the entry of key, if it has one that has not expired
+func (p *Pad) Get(key string) (Entry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+	entry, ok := p.entries[key]
+	return entry, ok
+}
+
+// Delete removes the entry of key, reporting whether there was one
+func (p *Pad) Delete(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+	entry, ok := p.entries[key]
+	if ok {
+		delete(p.entries, key)
+		p.used -= entry.size()
+	}
+	return ok
+}
+
+// List returns the entries whose keys start with prefix, sorted by key, and
+// how many bytes the scratchpad holds
+func (p *Pad) List(prefix string) ([]Entry, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+	var entries []Entry
+	for key, entry := range p.entries {
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Key, b.Key) })
+	return entries, p.used
+}
+
+// MaxBytes returns how many bytes the scratchpad may hold
+func (p *Pad) MaxBytes() int {
+	return p.maxBytes
+}
+
+// expire drops the entries that expired by now. The caller must hold p.mu.
+func (p *Pad) expire(now time.Time) {
+	for key, entry := range p.entries {
+		if !now.Before(entry.Expires) {
+			delete(p.entries, key)
+			p.used -= entry.size()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Record is the output of one command, from a session's transcript or a
+// scheduled job's run
+type Record struct {
+	// Source names where the output was recorded, e.g. "session build #3"
+	Source  string
+	Command string
+	// Status says how the command ended, e.g. "exit 1"
+	Status   string
+	Started  time.Time
+	Finished time.Time
+	Output   string
+}
+
+// Query says what to look for
+type Query struct {
+	Pattern *regexp.Regexp
+	// Since and Until bound when the commands ran (zero = unbounded)
+	Since time.Time
+	Until time.Time
+	// Context is how many lines around each match are shown
+	Context int
+	// Limit caps the matching lines returned
+	Limit int
+}
+
+// Line is a line of output shown in a result
+type Line struct {
+	// Number counts from 1 within the command's output
+	Number int
+	Text   string
+	Match  bool
+}
+
+// Hit is the matches in one record, with the lines around them, in order
+type Hit struct {
+	Record  Record
+	Lines   []Line
+	Matches int
+}
+
+// Compile builds the pattern of a query. A literal pattern matches its text
+// exactly.
+func Compile(pattern string, ignoreCase, literal bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("the pattern is empty")
+	}
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// ParseTime reads a bound of a time range: an RFC 3339 time, or a duration
+// such as "90m" meaning that long before now
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use an RFC 3339 time such as 2024-05-01T14:00:00Z, or a duration ago such as 90m)", s)
+}
+
+// Result is what a search found
+type Result struct {
+	Hits []Hit
+	// Searched counts the records in the query's time range
+	Searched int
+	// Truncated is set when matches were left out to stay within the limit
+	Truncated bool
+}
+
+// Search finds the lines matching a query in the records run in its time
+// range, oldest command first, so the first hit is where the text first
+// appeared
+func Search(records []Record, q Query) Result {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Started.Before(records[j].Started)
+	})
+
+	var result Result
+	found := 0
+	for _, record := range records {
+		if !q.Since.IsZero() && record.Finished.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && record.Started.After(q.Until) {
+			continue
+		}
+		result.Searched++
+
+		lines := strings.Split(strings.TrimRight(record.Output, "\n"), "\n")
+		var matched []int
+		for i, line := range lines {
+			if q.Pattern.MatchString(line) {
+				if q.Limit > 0 && found == q.Limit {
+					if len(matched) > 0 {
+						result.Hits = append(result.Hits, hit(record, lines, matched, q.Context))
+					}
+					result.Truncated = true
+					return result
+				}
+				matched = append(matched, i)
+				found++
+			}
+		}
+		if len(matched) > 0 {
+			result.Hits = append(result.Hits, hit(record, lines, matched, q.Context))
+		}
+	}
+	return result
+}
+
+// hit collects the matched lines of a record with context lines around them,
+// each line once
+func hit(record Record, lines []string, matched []int, context int) Hit {
+	h := Hit{Record: record, Matches: len(matched)}
+	isMatch := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		isMatch[i] = true
+	}
+
+	next := 0
+	for _, i := range matched {
+		from, to := max(i-context, next), min(i+context, len(lines)-1)
+		for j := from; j <= to; j++ {
+			h.Lines = append(h.Lines, Line{Number: j + 1, Text: lines[j], Match: isMatch[j]})
+		}
+		next = to + 1
+	}
+	return h
+}
+
+// Gap reports whether the line at index i of a hit does not follow the
+// line before it, so a separator belongs in between
+func (h Hit) Gap(i int) bool {
+	return i > 0 && h.Lines[i].Number != h.Lines[i-1].Number+1
+}
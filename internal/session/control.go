@@ -0,0 +1,195 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/sse"
+)
+
+// Parties that can hold control of a session
+const (
+	ControllerAgent    = "agent"
+	ControllerOperator = "operator"
+)
+
+// control tracks who may send commands to a session shared between the agent
+// and a human operator. Commands from both go through the session's command
+// lock, so handing over control never interleaves their input; a command
+// already running when control changes hands completes normally.
+type control struct {
+	mu        sync.Mutex
+	holder    string
+	requested string
+	// frozen explains why the session was taken from the agent after a trap
+	// alert; until the operator releases it, the agent cannot get it back
+	frozen string
+}
+
+// otherParty returns the party that does not hold control
+func otherParty(who string) string {
+	if who == ControllerOperator {
+		return ControllerAgent
+	}
+	return ControllerOperator
+}
+
+// check returns an error unless who holds control
+func (c *control) check(who string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.holder != who {
+		if c.frozen != "" {
+			return fmt.Errorf("session is frozen (%s) and awaits operator review", c.frozen)
+		}
+		return fmt.Errorf("session is controlled by the %s; request control first", c.holder)
+	}
+	return nil
+}
+
+// current returns who holds control and who, if anyone, has asked for it
+func (c *control) current() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.holder, c.requested
+}
+
+// Controller returns who holds control of a session and who, if anyone, has asked for it
+func (sm *Manager) Controller(sessionID string) (string, string, error) {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	holder, requested := session.control.current()
+	return holder, requested, nil
+}
+
+// RequestControl asks the current holder to hand control to who. It returns
+// true if who already holds control.
+func (sm *Manager) RequestControl(sessionID, who string) (bool, error) {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	c := &session.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.holder == who {
+		return true, nil
+	}
+	if c.frozen != "" {
+		return false, fmt.Errorf("session is frozen (%s); only the operator can release it", c.frozen)
+	}
+
+	c.requested = who
+	sm.publishControl(session, "requested", who)
+
+	return false, nil
+}
+
+// ReleaseControl hands control from who to the other party, granting any pending request
+func (sm *Manager) ReleaseControl(sessionID, who string) error {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	c := &session.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.holder != who {
+		return fmt.Errorf("session is controlled by the %s", c.holder)
+	}
+
+	c.holder = otherParty(who)
+	c.requested = ""
+	c.frozen = ""
+	sm.publishControl(session, "granted", who)
+
+	return nil
+}
+
+// TakeControl lets the operator override the agent without waiting for it to release control
+func (sm *Manager) TakeControl(sessionID string) error {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	c := &session.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.holder == ControllerOperator {
+		return nil
+	}
+
+	c.holder = ControllerOperator
+	c.requested = ""
+	sm.publishControl(session, "taken", ControllerOperator)
+
+	return nil
+}
+
+// Freeze takes a session away from the agent after a trap alert. The agent's
+// commands and control requests are refused until an operator releases it.
+func (sm *Manager) Freeze(sessionID, reason string) error {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	c := &session.control
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.holder = ControllerOperator
+	c.requested = ""
+	c.frozen = reason
+	sm.publishControl(session, "frozen", ControllerOperator)
+
+	return nil
+}
+
+// frozenReason returns why the session is frozen, or "" if it is not
+func (c *control) frozenReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.frozen
+}
+
+// publishControl announces a control change to the session's observers.
+// The caller must hold session.control.mu.
+func (sm *Manager) publishControl(session *ShellSession, action, by string) {
+	sm.log.Info("Session control changed", "session_id", session.ID, "action", action, "by", by, "controller", session.control.holder)
+
+	sm.events.Publish(session.ID, sse.Event{Type: events.TypeControl, Data: events.Control{
+		Version:    events.Version,
+		Action:     action,
+		By:         by,
+		Controller: session.control.holder,
+		Requested:  session.control.requested,
+		Frozen:     session.control.frozen,
+	}})
+}
+
+// getSession returns an existing session
+func (sm *Manager) getSession(sessionID string) (*ShellSession, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/shells"
+)
+
+// envTimeout bounds how long a shell may take to answer an environment request
+const envTimeout = 10 * time.Second
+
+// Environment returns the exported environment of a session's shell, as the
+// commands it runs would see it
+func (sm *Manager) Environment(sessionID string) (map[string]string, error) {
+	session, err := sm.lockIdle(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer session.mu.Unlock()
+
+	lines, err := sm.query(session, session.profile.PrintEnv())
+	if err != nil {
+		return nil, err
+	}
+	env := shells.ParseEnv(lines)
+	session.envState = env
+	return env, nil
+}
+
+// SetEnvironment exports set and removes unset in a session's shell, then
+// returns its environment so the caller can see the change took effect
+func (sm *Manager) SetEnvironment(sessionID string, set []shells.Var, unset []string, by string) (map[string]string, error) {
+	session, err := sm.lockIdle(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer session.mu.Unlock()
+
+	if err := session.control.check(by); err != nil {
+		return nil, err
+	}
+
+	var line strings.Builder
+	if len(unset) > 0 {
+		line.WriteString(session.profile.Unset(unset...) + "\n")
+	}
+	if len(set) > 0 {
+		line.WriteString(session.profile.Export(set...) + "\n")
+	}
+	line.WriteString(session.profile.PrintEnv())
+
+	lines, err := sm.query(session, line.String())
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(set)+len(unset))
+	for _, v := range set {
+		names = append(names, v.Name)
+	}
+	sm.log.Info("Changed session environment", "session_id", sessionID, "set", names, "unset", unset, "by", by)
+
+	// Changes made here are not reported as made by the next command
+	env := shells.ParseEnv(lines)
+	session.envState = env
+	return env, nil
+}
+
+// lockIdle locks a session that is not running a command. A session in the middle
+// of one is refused rather than waited for, since the command may run for long.
+func (sm *Manager) lockIdle(sessionID string) (*ShellSession, error) {
+	sm.mu.RLock()
+	session, exists := sm.sessions[sessionID]
+	paused := exists && session.Paused
+	sm.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if paused {
+		return nil, fmt.Errorf("session %s is paused; resume it first", sessionID)
+	}
+
+	if !session.mu.TryLock() {
+		return nil, fmt.Errorf("a command is running in session %s; try again once it finishes", sessionID)
+	}
+	if !session.Alive() {
+		session.mu.Unlock()
+		return nil, fmt.Errorf("the shell of session %s has exited; run a command to start a new one", sessionID)
+	}
+	return session, nil
+}
+
+// query writes lines the server needs answered to a session's shell and
+// returns what they print, without recording them in the session's history.
+// The caller must hold session.mu.
+func (sm *Manager) query(session *ShellSession, lines string) ([]string, error) {
+	if session.desynced {
+		if _, err := sm.resync(session); err != nil {
+			return nil, err
+		}
+	}
+
+	marker := fmt.Sprintf("MCPENV_%d", time.Now().UnixNano())
+	input := lines + "\n" + session.profile.Done(marker) + "\n"
+	typed := strings.Split(strings.TrimSpace(input), "\n")
+	if !session.terminal {
+		input += session.saveState()
+	}
+	if session.restore {
+		input = session.profile.LoadEnv(session.stateFile) + "\n" + input
+		session.restore = false
+	}
+
+	if _, err := session.Stdin.Write([]byte(input)); err != nil {
+		return nil, fmt.Errorf("failed to write to the shell: %v", err)
+	}
+
+	timeout := time.After(envTimeout)
+	var out []string
+	for {
+		select {
+		case line, ok := <-session.lines.lines:
+			if !ok {
+				return nil, session.lines.ended()
+			}
+			if session.terminal {
+				if line = cleanTerminalLine(line); isEcho(line, typed) {
+					continue
+				}
+			}
+			if before, _, _, ok := session.profile.ParseDone(line, marker); ok {
+				if before != "" {
+					out = append(out, sm.paths.ToClient(before))
+				}
+				session.LastUsed = time.Now()
+				return out, nil
+			}
+			if stale(session.profile, line, marker) {
+				// What came so far was left over from an earlier command
+				out = nil
+				continue
+			}
+			out = append(out, sm.paths.ToClient(line))
+		case <-timeout:
+			session.desynced = true
+			return nil, fmt.Errorf("the shell did not answer within %s", envTimeout)
+		}
+	}
+}
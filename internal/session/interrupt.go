@@ -0,0 +1,186 @@
+package session
+
+import (
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// keystrokeSettle is how long the terminal of an adopted session is given to
+// act on Ctrl-C before typing into it again
+const keystrokeSettle = 200 * time.Millisecond
+
+// running is the command a session is executing
+type running struct {
+	command string
+	by      string
+	started time.Time
+	// existing are the processes that were below the shell before the command
+	// started, such as background jobs, which an interrupt leaves alone
+	existing map[int]bool
+	// marker is the line that makes the shell report the command finished
+	marker string
+	// done is closed once the command has finished and the shell is at its prompt
+	done chan struct{}
+	// interrupted is set once an interrupt was sent
+	interrupted atomic.Bool
+	// timer ends the command when its timeout has run, counting only the
+	// time it was not paused; due is when, and left what remains of the
+	// timeout while paused. All three are guarded by the manager's lock.
+	timer *time.Timer
+	due   time.Time
+	left  time.Duration
+}
+
+// startClock starts the timeout of a command, calling expire once it has
+// run. A command paused before its clock starts waits for resuming.
+func (sm *Manager) startClock(session *ShellSession, run *running, timeout time.Duration, expire func()) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	run.timer = time.AfterFunc(timeout, expire)
+	run.due = time.Now().Add(timeout)
+	if session.Paused {
+		run.timer.Stop()
+		run.left = timeout
+	}
+}
+
+// stopClock holds the timeout of a paused command. The caller must hold sm.mu.
+func (run *running) stopClock() {
+	if run.timer != nil && run.timer.Stop() {
+		run.left = time.Until(run.due)
+	}
+}
+
+// resumeClock continues the timeout of a resumed command with what was left
+// of it. The caller must hold sm.mu.
+func (run *running) resumeClock() {
+	if run.timer != nil && run.left > 0 {
+		run.due = time.Now().Add(run.left)
+		run.timer.Reset(run.left)
+		run.left = 0
+	}
+}
+
+// Interrupted describes the outcome of interrupting a session's command
+type Interrupted struct {
+	// Command is the command that was running ("" if none was)
+	Command string
+	// Signalled are the processes sent SIGINT
+	Signalled []int
+	// Keystroke is set when Ctrl-C was typed into an adopted terminal instead
+	Keystroke bool
+	// Recovered is set when the command finished within the wait and the
+	// shell is ready for the next one
+	Recovered bool
+	// Remaining are the command's processes still running when the wait ended
+	Remaining []int
+	Elapsed   time.Duration
+}
+
+// track records the command a session starts running and returns the
+// function that marks it finished. The caller must hold session.mu.
+func (sm *Manager) track(session *ShellSession, command, by, marker string, existing map[int]bool) (*running, func()) {
+	run := &running{command: command, by: by, started: time.Now(), marker: marker, existing: existing, done: make(chan struct{})}
+
+	sm.mu.Lock()
+	session.running = run
+	sm.mu.Unlock()
+
+	return run, func() {
+		sm.mu.Lock()
+		session.running = nil
+		// Whatever was paused has ended with the command, and its process
+		// IDs may be reused
+		session.Paused, session.stopped = false, nil
+		if run.timer != nil {
+			run.timer.Stop()
+		}
+		sm.mu.Unlock()
+		close(run.done)
+	}
+}
+
+// Running reports whether a command is running in a session
+func (sm *Manager) Running(sessionID string) (bool, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return false, fmt.Errorf("session not found: %s", sessionID)
+	}
+	return session.running != nil, nil
+}
+
+// Interrupt sends Ctrl-C to the command running in a session, as a user would
+// at a terminal, and waits up to wait for the shell to return to its prompt.
+// Only the processes the command started are signalled, so the shell and any
+// background jobs keep running. by is the party asking, which must be the one
+// that sent the command.
+func (sm *Manager) Interrupt(sessionID, by string, wait time.Duration) (Interrupted, error) {
+	sm.mu.Lock()
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		sm.mu.Unlock()
+		return Interrupted{}, fmt.Errorf("session not found: %s", sessionID)
+	}
+	run := session.running
+	if run == nil {
+		sm.mu.Unlock()
+		return Interrupted{}, nil
+	}
+	if run.by != by {
+		sm.mu.Unlock()
+		return Interrupted{}, fmt.Errorf("the running command was sent by the %s", run.by)
+	}
+	run.interrupted.Store(true)
+	paused := session.Paused
+	sm.mu.Unlock()
+
+	result := Interrupted{Command: run.command}
+	started := time.Now()
+
+	if input, ok := session.Stdin.(*tmuxInput); ok {
+		// The pane's terminal delivers Ctrl-C to its foreground process group
+		if err := exec.Command("tmux", "send-keys", "-t", input.pane, "C-c").Run(); err != nil {
+			return result, fmt.Errorf("failed to send Ctrl-C to %s: %v", input.pane, err)
+		}
+		result.Keystroke = true
+
+		// The terminal discards typed-ahead input on Ctrl-C, including the
+		// marker line, so it is typed again once the prompt is back
+		time.Sleep(keystrokeSettle)
+		if _, err := session.Stdin.Write([]byte(run.marker + "\n")); err != nil {
+			return result, err
+		}
+	} else {
+		// Without a terminal there is no foreground process group to signal,
+		// so the command's processes are signalled one by one. The shell is
+		// left alone: a non-interactive shell would exit on SIGINT.
+		for _, pid := range descendants(session.Pid, run.existing) {
+			if syscall.Kill(pid, syscall.SIGINT) == nil {
+				result.Signalled = append(result.Signalled, pid)
+			}
+		}
+	}
+	if paused {
+		// A stopped process only sees the signal once it continues
+		sm.ResumeSession(sessionID)
+	}
+	sm.log.Info("Interrupted command", "session_id", sessionID, "signalled", len(result.Signalled), "by", by)
+
+	select {
+	case <-run.done:
+		result.Recovered = session.Alive()
+	case <-time.After(wait):
+		if !session.terminal {
+			result.Remaining = descendants(session.Pid, run.existing)
+		}
+	}
+	result.Elapsed = time.Since(started)
+
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClockPause(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	sm := &Manager{}
+
+	tests := []struct {
+		name string
+		// pausedAtStart pauses the session before the clock starts, and
+		// pauseAfter pauses it once the clock has run that long
+		pausedAtStart bool
+		pauseAfter    time.Duration
+	}{
+		{name: "paused while running", pauseAfter: 50 * time.Millisecond},
+		{name: "paused before the clock starts", pausedAtStart: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &ShellSession{Paused: tt.pausedAtStart}
+			run := &running{}
+			var expired atomic.Bool
+			sm.startClock(session, run, timeout, func() { expired.Store(true) })
+
+			if !tt.pausedAtStart {
+				time.Sleep(tt.pauseAfter)
+				sm.mu.Lock()
+				run.stopClock()
+				sm.mu.Unlock()
+			}
+
+			// Paused, the command outlives its timeout
+			time.Sleep(2 * timeout)
+			if expired.Load() {
+				t.Fatal("the timeout ran out while the command was paused")
+			}
+
+			sm.mu.Lock()
+			run.resumeClock()
+			sm.mu.Unlock()
+
+			// Resumed, it has what was left of the timeout and no more
+			deadline := time.Now().Add(timeout - tt.pauseAfter + time.Second)
+			for !expired.Load() {
+				if time.Now().After(deadline) {
+					t.Fatal("the timeout did not run out after resuming")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/shells"
+)
+
+// maxLineBytes bounds a line of shell output; longer lines are passed on in pieces
+const maxLineBytes = 16 << 20
+
+// resyncTimeout bounds the wait for a shell to answer the marker that brings
+// its session back in step
+const resyncTimeout = 5 * time.Second
+
+// endMarker matches the markers that end what the server writes to shells:
+// commands, queries and resynchronizations, with the nonce of integrated
+// shells. A terminal echoing the typed lines never shows one, as they are
+// split where "_" meets the label.
+var endMarker = regexp.MustCompile(`MCP(?:CMD|ENV|SYNC)_[0-9]+_(?:([0-9a-f]+)_)?(?:DONE:|ENV_END)`)
+
+// lineQueue reads a shell's output line by line in the background. Commands
+// and queries take their lines from it rather than from the shell's pipe, so
+// one that gives up, as when a command times out, leaves the lines it did
+// not get to for the next one instead of going on to swallow that one's.
+type lineQueue struct {
+	lines chan string
+	// err is why the output ended, if not at its end; set before lines is closed
+	err error
+}
+
+// newLineQueue starts reading r
+func newLineQueue(r io.Reader) *lineQueue {
+	q := &lineQueue{lines: make(chan string, 256)}
+	go func() {
+		defer close(q.lines)
+		reader := bufio.NewReaderSize(r, 64*1024)
+		var line []byte
+		for {
+			chunk, more, err := reader.ReadLine()
+			if err != nil {
+				if err != io.EOF {
+					q.err = err
+				}
+				return
+			}
+			line = append(line, chunk...)
+			if more && len(line) < maxLineBytes {
+				continue
+			}
+			q.lines <- string(line)
+			line = line[:0]
+		}
+	}()
+	return q
+}
+
+// ended returns the error a read reports once q has no more lines
+func (q *lineQueue) ended() error {
+	if q.err != nil {
+		return q.err
+	}
+	return fmt.Errorf("the shell exited")
+}
+
+// stale reports whether line ends the output of a command or query other
+// than the one marker belongs to, which the shell only got to after that one
+// gave up waiting. In integrated shells only marks with their nonce count.
+func stale(profile shells.Profile, line, marker string) bool {
+	if strings.Contains(line, marker+"_") {
+		return false
+	}
+	for _, match := range endMarker.FindAllStringSubmatch(line, -1) {
+		if match[1] == profile.Nonce() {
+			return true
+		}
+	}
+	return false
+}
+
+// resync brings a session back in step with its shell after a command or
+// query ended without its marker being read: it writes a fresh marker and
+// drops the output until the shell prints it. It returns how many lines were
+// dropped. The caller must hold session.mu.
+func (sm *Manager) resync(session *ShellSession) (int, error) {
+	marker := fmt.Sprintf("MCPSYNC_%d", time.Now().UnixNano())
+	line := session.profile.Done(marker)
+	if _, err := session.Stdin.Write([]byte(line + "\n")); err != nil {
+		return 0, fmt.Errorf("failed to write to the shell: %v", err)
+	}
+
+	doneMarker := session.profile.Token(marker, "DONE:")
+	typed := []string{line}
+	dropped := 0
+	timer := time.NewTimer(resyncTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case output, ok := <-session.lines.lines:
+			if !ok {
+				return dropped, session.lines.ended()
+			}
+			if strings.Contains(output, doneMarker) {
+				session.desynced = false
+				sm.log.Info("Resynchronized session", "session_id", session.ID, "dropped_lines", dropped)
+				return dropped, nil
+			}
+			if session.terminal && isEcho(cleanTerminalLine(output), typed) {
+				continue
+			}
+			dropped++
+		case <-timer.C:
+			return dropped, fmt.Errorf("the shell did not answer within %s; a command may still be running in it or reading its input", resyncTimeout)
+		}
+	}
+}
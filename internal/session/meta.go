@@ -0,0 +1,191 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/process"
+)
+
+// Meta describes a session to the people and agents working with it
+type Meta struct {
+	Name        string
+	Description string
+	Tags        []string
+}
+
+// MetaUpdate changes some of a session's metadata; nil fields are kept
+type MetaUpdate struct {
+	Name        *string
+	Description *string
+	// Tags replaces every tag; an empty list removes them all
+	Tags *[]string
+}
+
+// cleanTags trims tags and drops empty and repeated ones
+func cleanTags(tags []string) []string {
+	var cleaned []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			cleaned = append(cleaned, tag)
+		}
+	}
+	return cleaned
+}
+
+// SetMeta changes the name, description or tags of a session
+func (sm *Manager) SetMeta(sessionID string, update MetaUpdate) (Meta, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return Meta{}, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	if update.Name != nil {
+		session.meta.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Description != nil {
+		session.meta.Description = strings.TrimSpace(*update.Description)
+	}
+	if update.Tags != nil {
+		session.meta.Tags = cleanTags(*update.Tags)
+	}
+	sm.log.Info("Updated session metadata", "session_id", sessionID, "name", session.meta.Name, "tags", session.meta.Tags)
+
+	return session.meta, nil
+}
+
+// SetPinned pins a session, so it is never closed for being idle, or unpins
+// it. At most MaxPinnedSessions sessions are pinned at a time.
+func (sm *Manager) SetPinned(sessionID string, pinned bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if session.pinned == pinned {
+		return nil
+	}
+
+	if pinned {
+		count := 0
+		for _, s := range sm.sessions {
+			if s.pinned {
+				count++
+			}
+		}
+		if max := sm.config.MaxPinnedSessions; count >= max {
+			if max == 0 {
+				return fmt.Errorf("pinning sessions is disabled")
+			}
+			return fmt.Errorf("pinned session limit of %d reached; unpin a session first", max)
+		}
+	}
+	session.pinned = pinned
+	sm.log.Info("Changed session pin", "session_id", sessionID, "pinned", pinned)
+
+	return nil
+}
+
+// Info is the full description of one session
+type Info struct {
+	ID   string
+	Meta Meta
+	// Cwd is the shell's current directory in the client's view, where the
+	// platform exposes it
+	Cwd        string
+	Shell      string
+	Pid        int
+	Created    time.Time
+	LastUsed   time.Time
+	Alive      bool
+	Paused     bool
+	Pinned     bool
+	Adopted    string
+	Controller string
+	Frozen     string
+	Owner      string
+	// Usage counts everything the session ran, including commands no
+	// longer kept in its transcript
+	Usage Usage
+	// Restarts counts the shells that exited and were replaced
+	Restarts int
+	// TmuxSession is the tmux session a session of the tmux backend runs
+	// in, which users can attach to
+	TmuxSession string
+	// EnvNames are the environment variables the shell started with; values
+	// are left out as they may hold secrets
+	EnvNames []string
+}
+
+// Info describes a session in full
+func (sm *Manager) Info(sessionID string) (Info, error) {
+	cpu := sm.shellCPU()
+
+	sm.mu.RLock()
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		sm.mu.RUnlock()
+		return Info{}, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	controller, _ := session.control.current()
+	info := Info{
+		ID:         sessionID,
+		Meta:       session.meta,
+		Shell:      session.Shell,
+		Pid:        session.Pid,
+		Created:    session.Created,
+		LastUsed:   session.LastUsed,
+		Alive:      session.Alive(),
+		Paused:     session.Paused,
+		Pinned:     session.pinned,
+		Adopted:    session.Adopted,
+		Controller: controller,
+		Frozen:     session.control.frozenReason(),
+		Owner:      session.owner,
+		Restarts:   session.restarts,
+	}
+	info.TmuxSession = session.tmuxSession
+	info.Meta.Tags = append([]string(nil), session.meta.Tags...)
+	info.Usage = session.usage(cpu)
+	if session.Cmd != nil {
+		info.EnvNames = envNames(session.Cmd.Env)
+	}
+	cwd := session.cwd
+	sm.mu.RUnlock()
+
+	// The shell follows cd, so its current directory is read from the system,
+	// or else taken from where the last command left it
+	if p, err := process.Get(info.Pid); err == nil && p.Cwd != "" {
+		info.Cwd = sm.paths.ToClient(p.Cwd)
+	} else if cwd != "" {
+		info.Cwd = sm.paths.ToClient(cwd)
+	}
+
+	return info, nil
+}
+
+// envNames returns the sorted names of the variables in env
+func envNames(env []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, v := range env {
+		name, _, _ := strings.Cut(v, "=")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,184 @@
+package session
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/sse"
+)
+
+// Roles that can be granted on a session over HTTP
+const (
+	// RoleObserver may watch a session's output and read its history
+	RoleObserver = "observer"
+	// RoleOperator may additionally take control of the session and send commands
+	RoleOperator = "operator"
+)
+
+// AllSessions in place of a session ID stands for every session, current and future
+const AllSessions = "*"
+
+// grant is the access an observer token gives to a session
+type grant struct {
+	sessionID string
+	role      string
+}
+
+// Observe grants access to a session and returns the token presented to
+// watch its output and read its history. Observers can never send input;
+// operators can once they hold control of the session. AllSessions grants
+// observers the event streams of every session, for dashboards.
+func (sm *Manager) Observe(sessionID, role string) (string, error) {
+	if role == "" {
+		role = RoleObserver
+	}
+	if role != RoleObserver && role != RoleOperator {
+		return "", fmt.Errorf("unknown role: %s", role)
+	}
+	if sessionID == AllSessions && role != RoleObserver {
+		return "", fmt.Errorf("only observers can be granted every session")
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sessionID != AllSessions {
+		session, exists := sm.sessions[sessionID]
+		if !exists {
+			return "", fmt.Errorf("session not found: %s", sessionID)
+		}
+		// Otherwise the agent could mint itself an operator token to undo a freeze
+		if reason := session.control.frozenReason(); reason != "" && role == RoleOperator {
+			return "", fmt.Errorf("session is frozen (%s); operator access can no longer be granted", reason)
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	sm.observers[token] = grant{sessionID: sessionID, role: role}
+
+	sm.log.Info("Granted session access", "session_id", sessionID, "role", role)
+
+	return token, nil
+}
+
+// ObservedSession returns the session a token grants access to and the role it grants
+func (sm *Manager) ObservedSession(token string) (*ShellSession, string, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	g, ok := sm.observers[token]
+	if !ok {
+		return nil, "", fmt.Errorf("invalid observer token")
+	}
+	if g.sessionID == AllSessions {
+		return nil, "", fmt.Errorf("token grants every session and can only stream events")
+	}
+
+	session, exists := sm.sessions[g.sessionID]
+	if !exists {
+		return nil, "", fmt.Errorf("session not found: %s", g.sessionID)
+	}
+
+	return session, g.role, nil
+}
+
+// Scope resolves observer tokens to the sessions an event stream may follow.
+// requested narrows them down and may be AllSessions, which needs a token
+// granting every session. A nil result with no error means every session,
+// including ones created later.
+func (sm *Manager) Scope(tokens []string, requested []string) ([]string, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("an observer token is required")
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	granted := make(map[string]bool)
+	all := false
+	for _, token := range tokens {
+		g, ok := sm.observers[token]
+		if !ok {
+			return nil, fmt.Errorf("invalid observer token")
+		}
+		if g.sessionID == AllSessions {
+			all = true
+		} else {
+			granted[g.sessionID] = true
+		}
+	}
+
+	if len(requested) == 0 {
+		if all {
+			return nil, nil
+		}
+		scope := make([]string, 0, len(granted))
+		for id := range granted {
+			scope = append(scope, id)
+		}
+		sort.Strings(scope)
+		return scope, nil
+	}
+
+	if slices.Contains(requested, AllSessions) {
+		if !all {
+			return nil, fmt.Errorf("no token grants every session")
+		}
+		return nil, nil
+	}
+
+	var scope []string
+	for _, id := range requested {
+		if slices.Contains(scope, id) {
+			continue
+		}
+		if !all && !granted[id] {
+			return nil, fmt.Errorf("no token grants session %s", id)
+		}
+		if _, exists := sm.sessions[id]; !exists {
+			return nil, fmt.Errorf("session not found: %s", id)
+		}
+		scope = append(scope, id)
+	}
+	return scope, nil
+}
+
+// Subscribe streams the live events of the sessions in sub.Topics (nil for
+// every session): "command" when a command is sent, "output" for each line it
+// prints, "exit" when it finishes, "annotation" when a note is attached,
+// "control" when control changes hands, "alert" when a command touches a trap
+// path, "shell_restarted" when an exited shell is replaced and "closed" when
+// the session ends
+func (sm *Manager) Subscribe(sub sse.Subscription) (<-chan sse.Event, func()) {
+	return sm.events.Subscribe(sub)
+}
+
+// Alert tells a session's observers that a command touched a trap path
+func (sm *Manager) Alert(sessionID, path, command string) {
+	if _, err := sm.getSession(sessionID); err != nil {
+		return
+	}
+	sm.events.Publish(sessionID, sse.Event{Type: events.TypeAlert, Data: events.Alert{
+		Version: events.Version,
+		Path:    path,
+		Command: command,
+	}})
+}
+
+// revokeObservers drops the observer tokens of a closed session and ends its streams.
+// The caller must hold sm.mu.
+func (sm *Manager) revokeObservers(sessionID string) {
+	for token, g := range sm.observers {
+		if g.sessionID == sessionID {
+			delete(sm.observers, token)
+		}
+	}
+
+	sm.events.Publish(sessionID, sse.Event{Type: events.TypeClosed, Data: events.Closed{Version: events.Version, SessionID: sessionID}})
+	sm.events.Close(sessionID)
+}
@@ -0,0 +1,70 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+// newToken returns a random token for granting access to sessions
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Authorize checks that a client may use a session. The client that created
+// the session owns it; another client presenting the session's owner token
+// takes over ownership, so a session survives its creator reconnecting.
+// Administrators may use any session. Sessions that do not exist yet pass, so
+// callers can go on to create them.
+func (sm *Manager) Authorize(sessionID, client, token string, admin bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists || admin || session.owner == client {
+		return nil
+	}
+
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.ownerToken)) == 1 {
+		sm.log.Info("Session ownership transferred", "session_id", sessionID, "from", session.owner, "to", client)
+		session.owner = client
+		return nil
+	}
+
+	return fmt.Errorf("session %s belongs to another client; pass its owner_token", sessionID)
+}
+
+// Owns reports whether a client owns a session
+func (sm *Manager) Owns(sessionID, client string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[sessionID]
+	return exists && session.owner == client
+}
+
+// OwnerToken returns the token that proves ownership of a session
+func (sm *Manager) OwnerToken(sessionID string) (string, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return "", fmt.Errorf("session not found: %s", sessionID)
+	}
+	return session.ownerToken, nil
+}
+
+// Exists reports whether a session exists
+func (sm *Manager) Exists(sessionID string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	_, exists := sm.sessions[sessionID]
+	return exists
+}
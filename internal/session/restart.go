@@ -0,0 +1,97 @@
+package session
+
+import (
+	"fmt"
+	"os"
+
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/sse"
+)
+
+// newStateFile creates the file a session's shell saves its exported
+// environment to after each command, for a replacement shell to load
+func newStateFile() (string, error) {
+	f, err := os.CreateTemp("", "mcp-session-*.env")
+	if err != nil {
+		return "", fmt.Errorf("failed to create session state file: %v", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// saveState returns the shell line that saves the exported environment to
+// the session's state file, or "" when the session keeps none
+func (s *ShellSession) saveState() string {
+	if s.stateFile == "" {
+		return ""
+	}
+	return s.profile.SaveEnv(s.stateFile) + "\n"
+}
+
+// exitStatus describes how an exited shell ended, e.g. "exit status 0"
+func (s *ShellSession) exitStatus() string {
+	if s.exit == nil || s.exit.state == nil {
+		return "unknown status"
+	}
+	return s.exit.state.String()
+}
+
+// restart replaces the exited shell of a session with a new one, started in
+// the directory the old shell was last in and with its exported environment
+// loaded before the next command. It returns a note for that command's result.
+// The caller must hold session.mu.
+func (sm *Manager) restart(session *ShellSession) (string, error) {
+	dir := session.cwd
+	if info, err := os.Stat(dir); dir == "" || err != nil || !info.IsDir() {
+		dir = session.WorkingDir
+	}
+
+	fresh, err := sm.startShell(session.Shell, dir, session.env, session.spec, session.user)
+	if err != nil {
+		return "", err
+	}
+
+	oldPid, status := session.Pid, session.exitStatus()
+	session.Stdin.Close()
+	session.Stdout.Close()
+	session.Stderr.Close()
+	session.limits.Release()
+
+	sm.mu.Lock()
+	session.replacedCPU += session.exitedCPU()
+	session.Cmd = fresh.Cmd
+	session.Pid = fresh.Pid
+	session.Stdin = fresh.Stdin
+	session.Stdout = fresh.Stdout
+	session.lines = fresh.lines
+	session.profile = fresh.profile
+	session.desynced = false
+	session.Stderr = fresh.Stderr
+	session.limits = fresh.limits
+	session.exit = fresh.exit
+	session.Paused, session.stopped = false, nil
+	session.restarts++
+	session.envState = nil
+	sm.mu.Unlock()
+
+	// The saved environment is loaded ahead of the next command
+	session.restore = session.stateFile != ""
+
+	sm.log.Warn("Restarted exited shell", "session_id", session.ID, "old_pid", oldPid, "status", status, "pid", session.Pid, "cwd", dir)
+	sm.events.Publish(session.ID, sse.Event{Type: events.TypeRestarted, Data: events.Restarted{
+		Version: events.Version,
+		OldPID:  oldPid,
+		NewPID:  session.Pid,
+		Status:  status,
+		Cwd:     sm.paths.ToClient(dir),
+	}})
+
+	note := fmt.Sprintf("the previous shell (PID %d) exited with %s; a new one was started", oldPid, status)
+	if dir != "" {
+		note += " in " + sm.paths.ToClient(dir)
+	}
+	if session.restore {
+		note += " with the exported environment restored"
+	}
+	return note, nil
+}
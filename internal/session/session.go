@@ -1,33 +1,202 @@
 package session
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/charset"
 	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/deadline"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/limits"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/metrics"
+	"mcp-terminal-server/internal/netwatch"
+	"mcp-terminal-server/internal/ownership"
+	"mcp-terminal-server/internal/pathmap"
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/progress"
+	"mcp-terminal-server/internal/ratelimit"
+	"mcp-terminal-server/internal/receipt"
+	"mcp-terminal-server/internal/redact"
+	"mcp-terminal-server/internal/render"
+	"mcp-terminal-server/internal/report"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/sse"
+	"mcp-terminal-server/internal/tracing"
+	"mcp-terminal-server/internal/transcript"
+	"mcp-terminal-server/internal/webhook"
+	"mcp-terminal-server/internal/workspace"
+)
+
+// drainTimeout bounds the wait for a shell to finish a command whose processes
+// were stopped after a timeout
+const drainTimeout = time.Second
+
+// A command whose output stalled for stallAfter while it runs no processes
+// may be waiting for input that swallowed its end marker; this is checked
+// every stallCheck
+const (
+	stallAfter = 2 * time.Second
+	stallCheck = 500 * time.Millisecond
 )
 
 // ShellSession represents a persistent shell session
 type ShellSession struct {
-	ID          string
-	Cmd         *exec.Cmd
-	Stdin       io.WriteCloser
-	Stdout      io.ReadCloser
-	Stderr      io.ReadCloser
-	WorkingDir  string
-	Shell       string
-	Created     time.Time
-	LastUsed    time.Time
-	mu          sync.Mutex
+	ID string
+	// Cmd is the shell process for sessions started by the manager and nil for adopted ones
+	Cmd        *exec.Cmd
+	Pid        int
+	Stdin      io.WriteCloser
+	Stdout     io.ReadCloser
+	Stderr     io.ReadCloser
+	WorkingDir string
+	Shell      string
+	// profile is the syntax of the lines sent to the shell besides commands
+	profile    shells.Profile
+	Created    time.Time
+	LastUsed   time.Time
+	Paused     bool
+	Transcript *transcript.Transcript
+	// Adopted describes the terminal an adopted session is attached to (empty otherwise)
+	Adopted string
+	// terminal is set when output comes from a terminal, with input echo and escape sequences
+	terminal bool
+	// detach releases an adopted terminal without killing it
+	detach  func()
+	limits  *limits.Handle
+	control control
+	// exit records the end of an owned shell (nil for adopted ones)
+	exit *shellExit
+	// pane is the tmux pane of sessions in tmux, adopted or started by the
+	// tmux backend, and tmuxSession the tmux session the backend started
+	pane        string
+	tmuxSession string
+	// typed is what has been typed on the pane's current line with send
+	// keys; guarded by the manager's lock
+	typed string
+	// spec, cwd and stateFile let an exited shell be replaced: the limits it
+	// was started with, the directory it was in after the last command, and
+	// the file its exported environment is saved to after each command.
+	// restore is set while a replacement has yet to load that environment.
+	spec      limits.Spec
+	cwd       string
+	stateFile string
+	restore   bool
+	restarts  int
+	// envState is the exported environment the shell had after its last
+	// command, when commands are followed by a dump of it
+	envState map[string]string
+	// replacedCPU is the CPU time used by shells that exited and were
+	// replaced; guarded by the manager's lock
+	replacedCPU time.Duration
+	// env is what the session's shell adds to the server's environment
+	env []string
+	// user is who the shell runs as, nil for the server's user
+	user *process.User
+	// teardown runs once the session has ended, if set
+	teardown *Teardown
+	// lines is what commands and queries read the shell's output from
+	lines *lineQueue
+	// desynced is set when a command or query ended without its marker being
+	// read, so output of its may still come before that of the next one
+	desynced bool
+	// output caps the rate at which the session's output is passed on
+	output *ratelimit.Throughput
+	// meta names and describes the session; guarded by the manager's lock
+	meta Meta
+	// pinned exempts the session from idle cleanup; guarded by the manager's lock
+	pinned bool
+	// running is the command being executed, if any; guarded by the manager's lock
+	running *running
+	// stopped are the processes pausing the session stopped, which resuming
+	// continues; guarded by the manager's lock
+	stopped []int
+	// owner is the MCP client allowed to use the session and ownerToken lets
+	// other clients prove ownership; both are guarded by the manager's lock
+	owner      string
+	ownerToken string
+	mu         sync.Mutex
+}
+
+// shellExit records the end of a shell: done is closed once it has exited,
+// and state then says how it ended
+type shellExit struct {
+	done  chan struct{}
+	state *os.ProcessState
+}
+
+// Alive reports whether the session's shell is still running
+func (s *ShellSession) Alive() bool {
+	if s.exit != nil {
+		select {
+		case <-s.exit.done:
+			return false
+		default:
+			return true
+		}
+	}
+	return syscall.Kill(s.Pid, 0) == nil
+}
+
+// terminate stops an owned shell with everything it started, or detaches
+// from an adopted one, and releases its resources
+func (s *ShellSession) terminate() {
+	s.Stdin.Close()
+	s.Stdout.Close()
+	s.Stderr.Close()
+	if s.Cmd != nil && s.Cmd.Process != nil {
+		// The shell leads its process group, so -pid also reaches background jobs
+		syscall.Kill(-s.Pid, syscall.SIGKILL)
+		s.Cmd.Process.Kill()
+		<-s.exit.done
+	}
+	if s.detach != nil {
+		s.detach()
+	}
+	if s.stateFile != "" {
+		os.Remove(s.stateFile)
+	}
+	s.limits.Release()
+}
+
+// Options controls how a command is run. Shell, WorkingDir and Limits only
+// apply when the session is created and are ignored once it exists.
+type Options struct {
+	Shell string
+	// WorkingDir is the initial directory, in the client's view of the filesystem
+	WorkingDir string
+	Limits     limits.Spec
+	// Controller is who is sending the command, ControllerAgent if empty.
+	// It must hold control of the session.
+	Controller string
+	// Owner is the MCP client that becomes the owner of a new session
+	Owner string
+	// Meta names and describes a new session
+	Meta Meta
+	// Env adds NAME=value entries to the environment of a new session's shell
+	Env []string
+	// Teardown is run when a new session ends
+	Teardown *Teardown
+	// Encoding is the character encoding of the command's output, converted
+	// to UTF-8; empty for the server's default
+	Encoding string
+	// User is who a new session's shell runs as (nil = the server's user)
+	User *process.User
 }
 
 // Manager manages persistent shell sessions
@@ -35,23 +204,83 @@ type Manager struct {
 	sessions map[string]*ShellSession
 	mu       sync.RWMutex
 	config   *config.Config
+	limiter  *limits.Limiter
+	paths    *pathmap.Map
+	owner    *ownership.Fixer
+	events   *sse.Broadcaster
+	net      *netwatch.Watcher
+	redact   *redact.Redactor
+	// audit records the teardown commands of ended sessions
+	audit *audit.Log
+	// teardowns tracks the teardowns of expired sessions, which run in the background
+	teardowns sync.WaitGroup
+	// workspace is where shells start and confines them when sandboxed
+	workspace *workspace.Workspace
+	log       *slog.Logger
+	// observers maps read-only observer tokens to session IDs
+	observers map[string]grant
+	// warm holds idle shells per configured shell, started ahead of time;
+	// warmRefill wakes the goroutine that tops the pool up
+	warmMu     sync.Mutex
+	warm       map[string][]*ShellSession
+	warmRefill chan struct{}
 }
 
-// NewManager creates a new session manager
-func NewManager(cfg *config.Config) *Manager {
+// NewManager creates a new session manager, which records the teardowns of
+// sessions in auditLog
+func NewManager(cfg *config.Config, auditLog *audit.Log) *Manager {
+	paths := pathmap.New(cfg)
 	sm := &Manager{
-		sessions: make(map[string]*ShellSession),
-		config:   cfg,
+		sessions:  make(map[string]*ShellSession),
+		config:    cfg,
+		limiter:   limits.New(cfg),
+		paths:     paths,
+		owner:     ownership.New(cfg, paths),
+		events:    sse.NewBroadcaster(cfg.SSEReplayEvents, cfg.SSEQueueSize, sse.Policy(cfg.SSELagPolicy)),
+		net:       netwatch.New(cfg),
+		redact:    redact.New(cfg),
+		audit:     auditLog,
+		workspace: workspace.New(cfg),
+		log:       logging.For("session"),
+		observers: make(map[string]grant),
 	}
 
 	// Start cleanup goroutine
 	go sm.cleanupSessions()
 
+	// Fill the pool of warm shells, if any are configured
+	if len(cfg.WarmShells) > 0 {
+		sm.warm = make(map[string][]*ShellSession)
+		for _, ws := range cfg.WarmShells {
+			sm.warm[ws.Shell] = nil
+		}
+		sm.warmRefill = make(chan struct{}, 1)
+		sm.warmRefill <- struct{}{}
+		go sm.keepWarm()
+	}
+
 	return sm
 }
 
+// Profile returns the profile of the shell a session's commands are written
+// for: the session's own, or for a new session that of shell or, when shell
+// is "", the configured one
+func (sm *Manager) Profile(sessionID, shell string) shells.Profile {
+	sm.mu.RLock()
+	session, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if exists {
+		return session.profile
+	}
+
+	if shell == "" {
+		shell = sm.config.Shell
+	}
+	return shells.For(shell)
+}
+
 // GetOrCreateSession gets an existing session or creates a new one
-func (sm *Manager) GetOrCreateSession(sessionID string, shell string) (*ShellSession, error) {
+func (sm *Manager) GetOrCreateSession(sessionID string, opts Options) (*ShellSession, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -60,13 +289,116 @@ func (sm *Manager) GetOrCreateSession(sessionID string, shell string) (*ShellSes
 		session.LastUsed = time.Now()
 		return session, nil
 	}
+	if sessionID == AllSessions {
+		return nil, fmt.Errorf("session ID %s is reserved", AllSessions)
+	}
+	if err := sm.checkCapacity(opts.Owner); err != nil {
+		return nil, err
+	}
 
 	// Create new session
+	shell := opts.Shell
 	if shell == "" {
 		shell = sm.config.Shell
+	} else if _, err := shells.Validate(shell); err != nil {
+		return nil, fmt.Errorf("invalid shell: %v", err)
 	}
 
-	cmd := exec.Command(shell)
+	workingDir := ""
+	if opts.WorkingDir != "" {
+		workingDir = sm.workspace.Abs(sm.paths.ToServer(opts.WorkingDir))
+		if info, err := os.Stat(workingDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("working directory does not exist: %s", opts.WorkingDir)
+		}
+		if err := sm.workspace.Check(workingDir); err != nil {
+			return nil, fmt.Errorf("invalid working directory: %v", err)
+		}
+	}
+
+	ownerToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Idle shells started ahead of time only fit sessions without a working
+	// directory, environment or limits of their own
+	var session *ShellSession
+	warm := false
+	if sm.config.SessionBackend == "tmux" {
+		if opts.User != nil {
+			return nil, fmt.Errorf("the tmux session backend cannot run shells as another user")
+		}
+		if session, err = sm.startTmux(sessionID, shell, workingDir, opts.Env); err != nil {
+			return nil, err
+		}
+	} else if workingDir == "" && len(opts.Env) == 0 && opts.User == nil && opts.Limits.String() == sm.limiter.Defaults().String() {
+		session = sm.takeWarm(shell)
+		warm = session != nil
+	}
+	if session == nil {
+		if session, err = sm.startShell(shell, workingDir, opts.Env, opts.Limits, opts.User); err != nil {
+			return nil, err
+		}
+	}
+
+	session.ID = sessionID
+	session.Created = time.Now()
+	session.LastUsed = time.Now()
+	session.Transcript = transcript.New(sm.config.TranscriptMaxEntries, sm.config.TranscriptMaxBytes)
+	session.control = control{holder: ControllerAgent}
+	session.owner = opts.Owner
+	session.ownerToken = ownerToken
+	session.output = ratelimit.NewThroughput(sm.config.OutputRateLimit)
+	session.spec = opts.Limits
+	session.teardown = opts.Teardown
+	if sm.config.SessionAutoRestart && session.Cmd != nil && session.profile.SavesEnv() {
+		// Without it a replacement shell still starts in the last directory
+		if session.stateFile, err = newStateFile(); err != nil {
+			sm.log.Warn("Environment will not survive a shell restart", "session_id", sessionID, "error", err)
+		} else if opts.User != nil {
+			// The shell saves its environment there as its own user
+			os.Chown(session.stateFile, int(opts.User.UID), int(opts.User.GID))
+		}
+	}
+	session.meta = Meta{
+		Name:        strings.TrimSpace(opts.Meta.Name),
+		Description: strings.TrimSpace(opts.Meta.Description),
+		Tags:        cleanTags(opts.Meta.Tags),
+	}
+
+	sm.sessions[sessionID] = session
+	sm.announce(session)
+
+	sm.log.Info("Created shell session", "session_id", sessionID, "shell", shell, "pid", session.Pid, "warm", warm)
+	if summary := session.limits.Summary(); summary != "" {
+		sm.log.Info("Applied session limits", "session_id", sessionID, "limits", summary)
+	}
+
+	return session, nil
+}
+
+// startShell starts a shell process for a session, with env added to the
+// server's environment, as user unless that is nil
+func (sm *Manager) startShell(shell, workingDir string, env []string, spec limits.Spec, user *process.User) (*ShellSession, error) {
+	profile := shells.For(shell)
+	args, err := profile.SessionArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Shells start in the workspace unless given a directory of their own
+	if workingDir == "" {
+		workingDir = sm.workspace.Dir()
+	}
+
+	cmd := exec.Command(shell, args...)
+	cmd.Dir = workingDir
+	// Run the shell in its own process group so its commands can be signalled together
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	process.DieWithServer(cmd)
+	if err := sm.workspace.Confine(cmd); err != nil {
+		return nil, err
+	}
 
 	// Set up environment variables
 	cmd.Env = os.Environ() // Start with current environment
@@ -74,6 +406,10 @@ func (sm *Manager) GetOrCreateSession(sessionID string, shell string) (*ShellSes
 		// Add or update DISPLAY variable
 		cmd.Env = append(cmd.Env, "DISPLAY="+sm.config.Display)
 	}
+	cmd.Env = append(cmd.Env, env...)
+	// The session and request are exported with each command, as the shell may be warm
+	cmd.Env = labels.Environ(cmd.Env, sm.config.Tenant, "", "")
+	process.RunAs(cmd, user)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -94,175 +430,941 @@ func (sm *Manager) GetOrCreateSession(sessionID string, shell string) (*ShellSes
 	}
 
 	// Start the shell
-	if err := cmd.Start(); err != nil {
+	handle, err := sm.limiter.Start(cmd, spec)
+	if err != nil {
 		stdin.Close()
 		stdout.Close()
 		stderr.Close()
 		return nil, fmt.Errorf("failed to start shell: %v", err)
 	}
 
+	// Integrated shells define their functions before anything else is typed
+	if sm.config.ShellIntegration {
+		if nonce, err := newToken(); err != nil {
+			sm.log.Warn("Failed to set up shell integration", "shell", shell, "error", err)
+		} else if integrated := profile.Integrated(nonce); integrated.Integration() != "" {
+			if _, err := stdin.Write([]byte(integrated.Integration() + "\n")); err != nil {
+				sm.log.Warn("Failed to set up shell integration", "shell", shell, "error", err)
+			} else {
+				profile = integrated
+			}
+		}
+	}
+
 	session := &ShellSession{
-		ID:         sessionID,
 		Cmd:        cmd,
+		Pid:        cmd.Process.Pid,
 		Stdin:      stdin,
 		Stdout:     stdout,
 		Stderr:     stderr,
-		WorkingDir: "",
+		lines:      newLineQueue(stdout),
+		WorkingDir: workingDir,
 		Shell:      shell,
-		Created:    time.Now(),
-		LastUsed:   time.Now(),
+		env:        env,
+		user:       user,
+		profile:    profile,
+		limits:     handle,
+		exit:       &shellExit{done: make(chan struct{})},
 	}
 
-	sm.sessions[sessionID] = session
-
-	log.Printf("Created new shell session: %s (shell: %s, pid: %d)", sessionID, shell, cmd.Process.Pid)
+	// The shell is reaped as soon as it exits, so its session notices at once
+	exit := session.exit
+	go func() {
+		exit.state, _ = cmd.Process.Wait()
+		close(exit.done)
+	}()
 
 	return session, nil
 }
 
 // ExecuteCommand executes a command in a persistent shell session
-func (sm *Manager) ExecuteCommand(sessionID string, command string, timeout time.Duration, shell string, captureStderr bool) (*mcp.CallToolResult, error) {
-	session, err := sm.GetOrCreateSession(sessionID, shell)
+func (sm *Manager) ExecuteCommand(ctx context.Context, sessionID string, command string, timeout time.Duration, opts Options, captureStderr bool) (*mcp.CallToolResult, error) {
+	if opts.Encoding == "" {
+		opts.Encoding = sm.config.OutputEncoding
+	}
+	if err := charset.Validate(opts.Encoding); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid encoding: %v", err)), nil
+	}
+
+	session, err := sm.GetOrCreateSession(sessionID, opts)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to get session: %v", err)), nil
 	}
 
+	// The paused command holds the session, so a new one would only wait
+	sm.mu.RLock()
+	paused := session.Paused
+	sm.mu.RUnlock()
+	if paused {
+		return mcp.NewToolResultError(fmt.Sprintf("Session %s is paused; resume it with session_manager before running commands", sessionID)), nil
+	}
+
 	session.mu.Lock()
 	defer session.mu.Unlock()
 
 	// Check if session is still alive
-	if session.Cmd.ProcessState != nil && session.Cmd.ProcessState.Exited() {
-		// Session died, remove it and create a new one
-		sm.mu.Lock()
-		delete(sm.sessions, sessionID)
-		sm.mu.Unlock()
+	var restarted string
+	if !session.Alive() {
+		if session.Cmd == nil || !sm.config.SessionAutoRestart {
+			// Session died, remove it so the retry creates a new one
+			status := session.exitStatus()
+			sm.mu.Lock()
+			if sm.sessions[sessionID] == session {
+				delete(sm.sessions, sessionID)
+				sm.revokeObservers(sessionID)
+			}
+			sm.mu.Unlock()
+			session.terminate()
+			sm.log.Warn("Dropped session whose shell exited", "session_id", sessionID, "status", status)
+			sm.teardowns.Add(1)
+			go func() {
+				defer sm.teardowns.Done()
+				sm.teardown(session, TeardownExited)
+			}()
+
+			return mcp.NewToolResultError(fmt.Sprintf("Shell session died (%s), please retry", status)), nil
+		}
+
+		if restarted, err = sm.restart(session); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to restart shell: %v", err)), nil
+		}
+	}
+
+	controller := opts.Controller
+	if controller == "" {
+		controller = ControllerAgent
+	}
+	if err := session.control.check(controller); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Cannot run command: %v", err)), nil
+	}
+
+	var notes []string
+	if restarted != "" {
+		notes = append(notes, "Shell Restarted: "+restarted)
+	}
+	result, lost := sm.runCommand(ctx, session, command, timeout, controller, opts.Encoding, notes)
+	if lost && sm.config.SessionResyncRerun {
+		sm.log.Warn("Running command again after its end marker was lost", "session_id", sessionID, logging.Command(command))
+		result, _ = sm.runCommand(ctx, session, command, timeout, controller, opts.Encoding,
+			append(notes, "Re-run: the first run's end marker was lost, so the command was run once more"))
+	}
+	return result, nil
+}
+
+// runCommand sends a command to a session's shell and reads its result, to
+// which notes are added. Its output is converted to UTF-8 from encoding. It
+// also reports whether the command's end marker was
+// lost, as when the command read the lines typed after it, leaving its exit
+// code unknown. The caller must hold session.mu.
+func (sm *Manager) runCommand(ctx context.Context, session *ShellSession, command string, timeout time.Duration, controller, encoding string, notes []string) (*mcp.CallToolResult, bool) {
+	sessionID := session.ID
 
-		return mcp.NewToolResultError("Shell session died, please retry"), nil
+	// Output of an earlier command that was given up on may still be coming,
+	// and is cleared before this command is sent
+	if session.desynced {
+		dropped, err := sm.resync(session)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Session %s is out of step with its shell: %v. Interrupt what is running in it, or close the session", sessionID, err)), false
+		}
+		note := "Resynchronized: the session was brought back in step with its shell"
+		if dropped > 0 {
+			note += fmt.Sprintf(", dropping %d line(s) an earlier command printed after it was given up on", dropped)
+		}
+		notes = append(notes, note)
 	}
+	sm.baseline(session)
+	_, span := tracing.StartCommand(ctx, command, sessionID)
 
 	// Create a unique command marker
 	commandMarker := fmt.Sprintf("MCPCMD_%d", time.Now().UnixNano())
 
-	// Write command to shell
-	fullCommand := fmt.Sprintf("%s\necho %s_DONE\n", command, commandMarker)
+	// Processes already below the shell, such as background jobs, are left
+	// alone if the command times out
+	existing := make(map[int]bool)
+	for _, pid := range descendants(session.Pid, nil) {
+		existing[pid] = true
+	}
+	run, finished := sm.track(session, command, controller, session.profile.Done(commandMarker), existing)
+	defer finished()
+
+	// Write command to shell. The marker is split with an empty string so that a
+	// terminal echoing the typed input never shows the literal marker.
+	started := time.Now()
+	watch := sm.net.Watch(session.Pid)
+	// What observers and the transcript see of the command and its output
+	shown := sm.redact.String(command)
+	lines := sm.redact.Lines()
+	decoder, _ := charset.NewDecoder(encoding)
+
+	// The marker also reports the directory the shell is left in
+	fullCommand := command + "\n" + session.profile.Done(commandMarker) + "\n"
+	if start := session.profile.Start(commandMarker); start != "" {
+		fullCommand = start + "\n" + fullCommand
+	}
+	typedLines := strings.Split(strings.TrimSpace(fullCommand), "\n")
+	// wrapper describes what was typed around the command, for debug results
+	wrapper := []string{"done marker " + commandMarker}
+	if session.profile.Nonce() != "" {
+		wrapper = append(wrapper, "shell integration")
+	}
+	reportState := sm.reportsState(session)
+	if reportState {
+		fullCommand += session.stateLines(commandMarker)
+		wrapper = append(wrapper, "environment report")
+	}
+	if !session.terminal {
+		// Label the processes the command starts. Adopted terminals are left
+		// alone, since the line would show up in the user's terminal.
+		fullCommand = labels.Exports(session.profile, sessionID, labels.RequestID(ctx)) + fullCommand + session.saveState()
+		wrapper = append(wrapper, "process labels")
+		if session.stateFile != "" {
+			wrapper = append(wrapper, "state saved to "+session.stateFile)
+		}
+	}
+	if session.restore {
+		fullCommand = session.profile.LoadEnv(session.stateFile) + "\n" + fullCommand
+		session.restore = false
+		wrapper = append(wrapper, "state restored from "+session.stateFile)
+	}
 
 	if _, err := session.Stdin.Write([]byte(fullCommand)); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to write command: %v", err)), nil
+		watch.Stop()
+		span.RecordError(err)
+		tracing.EndCommand(span, -1, time.Since(started), false)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to write command: %v", err)), false
 	}
+	sm.events.Publish(sessionID, sse.Event{Type: events.TypeCommand, Data: events.Command{
+		Version: events.Version,
+		Command: shown,
+		By:      controller,
+		Started: started,
+	}})
 
-	// Read output with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	// Read output until the command times out, or the call is abandoned, as
+	// when an HTTP client disconnects. A bound on the whole request shortens
+	// the timeout. Time spent paused does not count towards the timeout, but
+	// does towards the bound on the request.
+	timeout = deadline.Timeout(ctx, timeout)
+	timeoutCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	sm.startClock(session, run, timeout, cancel)
 
-	outputChan := make(chan string, 1)
+	reporter := progress.FromContext(ctx)
+	reporter.Start(timeout)
+	defer reporter.Stop()
+
+	type commandOutput struct {
+		output   string
+		exitCode int
+		// cwd is the directory the shell was left in
+		cwd string
+		// env is the environment the shell was left with, when reported
+		env map[string]string
+		// eof is set when the output ended without the marker, as when the shell exits
+		eof bool
+		// lost is set when the marker was lost, yet the shell went on to what
+		// was typed after it
+		lost bool
+		// dropped counts the lines dropped as output of an earlier command
+		dropped int
+	}
+
+	outputChan := make(chan commandOutput, 1)
 	errorChan := make(chan error, 1)
 
+	throttle := newOutputThrottle(session.output, sm.config.OutputRatePolicy)
+
+	// The output read so far is also returned if the command times out
+	var (
+		outputMu sync.Mutex
+		buffer   strings.Builder
+		offsets  []time.Duration
+	)
+	appendOutput := func(line string) {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+		if sm.config.OutputTiming == "transcript" {
+			offsets = append(offsets, time.Since(started))
+		}
+	}
+	partialOutput := func() string {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		return buffer.String()
+	}
+	// dropOutput discards the output read so far and says how many lines it had
+	dropOutput := func() int {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		n := strings.Count(buffer.String(), "\n")
+		buffer.Reset()
+		offsets = nil
+		return n
+	}
+
+	lineOffsets := func() []time.Duration {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		return slices.Clone(offsets)
+	}
+
+	// The reader stops when the command's result is returned, leaving what it
+	// did not get to for the next command. lastLine is when it last got a
+	// line, and probe the marker written to tell whether the shell is idle.
+	stop := make(chan struct{})
+	defer close(stop)
+	var lastLine atomic.Int64
+	lastLine.Store(started.UnixNano())
+	var probe atomic.Value
+	probe.Store("")
+
 	go func() {
-		var output strings.Builder
-		scanner := bufio.NewScanner(session.Stdout)
-		doneMarker := commandMarker + "_DONE"
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == doneMarker {
-				outputChan <- output.String()
+		start := session.profile.Token(commandMarker, "START")
+		envBegin := session.profile.Token(commandMarker, "ENV_BEGIN")
+		envEnd := session.profile.Token(commandMarker, "ENV_END")
+
+		// done holds the command's result while the environment that
+		// follows it is read
+		var done *commandOutput
+		var envLines []string
+		dropped := 0
+		for {
+			var line string
+			select {
+			case next, ok := <-session.lines.lines:
+				if !ok {
+					if err := session.lines.err; err != nil {
+						errorChan <- err
+						return
+					}
+					if done != nil {
+						outputChan <- *done
+						return
+					}
+					outputChan <- commandOutput{output: partialOutput(), exitCode: -1, eof: true, dropped: dropped}
+					return
+				}
+				line = next
+			case <-stop:
+				return
+			}
+			lastLine.Store(time.Now().UnixNano())
+
+			if done != nil {
+				if strings.Contains(line, envEnd) {
+					done.env = shells.ParseEnv(envLines)
+					outputChan <- *done
+					return
+				}
+				if !strings.Contains(line, envBegin) {
+					envLines = append(envLines, line)
+				}
+				continue
+			}
+			if session.terminal {
+				line = cleanTerminalLine(line)
+				if isEcho(line, typedLines) {
+					continue
+				}
+				// Input typed ahead is echoed wherever the cursor is, possibly mid-output
+				if stripped := strings.ReplaceAll(line, typedLines[len(typedLines)-1], ""); stripped != line {
+					if line = stripped; line == "" {
+						continue
+					}
+				}
+			}
+			// The marker may follow output that did not end with a newline
+			if before, exitCode, cwd, ok := session.profile.ParseDone(line, commandMarker); ok {
+				if before != "" {
+					appendOutput(lines.Line(decoder.String(before)))
+				}
+				done = &commandOutput{output: partialOutput(), exitCode: exitCode, cwd: cwd, dropped: dropped}
+				if !reportState {
+					outputChan <- *done
+					return
+				}
+				continue
+			}
+			// The shell went on past the marker without printing it: the
+			// command read it, and maybe more, as its own input
+			if strings.Contains(line, envBegin) {
+				done = &commandOutput{output: partialOutput(), exitCode: -1, lost: true, dropped: dropped}
+				continue
+			}
+			if marker := probe.Load().(string); strings.Contains(line, envEnd) || (marker != "" && strings.Contains(line, session.profile.Token(marker, "DONE:"))) {
+				outputChan <- commandOutput{output: partialOutput(), exitCode: -1, lost: true, dropped: dropped}
 				return
 			}
-			output.WriteString(line)
-			output.WriteString("\n")
+			if stale(session.profile, line, commandMarker) {
+				// What came so far was left over from an earlier command
+				dropped += dropOutput()
+				continue
+			}
+			// An integrated shell marks where the command's output begins
+			if strings.Contains(line, start) {
+				dropped += dropOutput()
+				continue
+			}
+			line = lines.Line(decoder.String(line))
+			if keep, first := throttle.admit(len(line) + 1); !keep {
+				if !first {
+					continue
+				}
+				line = droppedNotice
+			}
+			appendOutput(line)
+			reporter.Write([]byte(line + "\n"))
+			event := events.Output{Version: events.Version, Line: sm.paths.ToClient(line)}
+			if sm.config.OutputTiming != "off" {
+				offset := time.Since(started).Milliseconds()
+				event.OffsetMS = &offset
+			}
+			sm.events.Publish(sessionID, sse.Event{Type: events.TypeOutput, Data: event})
+		}
+	}()
+
+	// A command that reads its input can swallow the marker typed after it.
+	// When the output has stalled and the command runs no processes, a
+	// probe tells: an idle shell answers it before the lost marker would come.
+	stall := time.NewTicker(stallCheck)
+	defer stall.Stop()
+
+	var out commandOutput
+wait:
+	for {
+		select {
+		case out = <-outputChan:
+			break wait
+
+		case <-stall.C:
+			if probe.Load().(string) != "" || session.terminal || time.Since(time.Unix(0, lastLine.Load())) < stallAfter ||
+				len(descendants(session.Pid, existing)) > 0 {
+				continue
+			}
+			marker := fmt.Sprintf("MCPSYNC_%d", time.Now().UnixNano())
+			probe.Store(marker)
+			session.Stdin.Write([]byte(session.profile.Done(marker) + "\n"))
+
+		case err := <-errorChan:
+			watch.Stop()
+			span.RecordError(err)
+			tracing.EndCommand(span, -1, time.Since(started), false)
+			return mcp.NewToolResultError(fmt.Sprintf("Error reading output: %v", err)), false
+
+		case <-timeoutCtx.Done():
+			// The command may still be running, so this covers only its connections so far
+			if watch != nil {
+				audit.Annotate(ctx, "network", watch.Stop())
+			}
+
+			// Stop what the command started but keep the shell, so the session
+			// stays usable. Once they are gone the shell prints the marker, which
+			// is consumed here rather than by the next command.
+			killed := process.Stop(func() []int { return descendants(session.Pid, existing) }, sm.config.KillGracePeriod)
+			select {
+			case <-outputChan:
+			case <-errorChan:
+			case <-time.After(drainTimeout):
+				// What the shell prints from here on is left to the next command to clear
+				session.desynced = true
+			}
+			session.LastUsed = time.Now()
+			output := sm.paths.ToClient(partialOutput())
+			cancelled := ctx.Err() == context.Canceled
+
+			entry := session.Transcript.Record(transcript.Entry{
+				Command:     shown,
+				Output:      output,
+				ExitCode:    -1,
+				TimedOut:    !cancelled,
+				Started:     started,
+				Finished:    session.LastUsed,
+				LineOffsets: lineOffsets(),
+			})
+			sm.publishExit(sessionID, entry, throttle.throttled())
+			tracing.EndCommand(span, entry.ExitCode, entry.Duration(), entry.TimedOut)
+			receipt.Record(ctx, receipt.Command{Command: command, SessionID: sessionID, ExitCode: entry.ExitCode, TimedOut: entry.TimedOut, Started: started, Finished: entry.Finished})
+
+			var result string
+			if cancelled {
+				sm.log.Warn("Command cancelled", "session_id", sessionID, logging.Command(command),
+					"by", controller, "killed", killed)
+				result = fmt.Sprintf("Command cancelled in persistent shell because the call was abandoned; its processes were stopped.\nOutput (partial): %s\nElapsed: %s\nSession ID: %s\nShell: %s (PID: %d)",
+					strings.TrimSpace(output), entry.Duration().Round(time.Millisecond), sessionID, session.Shell, session.Pid)
+			} else {
+				sm.log.Warn("Command timed out", "session_id", sessionID, logging.Command(command),
+					"timeout", timeout.String(), "by", controller, "killed", killed)
+				// The partial output lets the caller decide whether to retry with a
+				// longer timeout or go on with what it has
+				result = fmt.Sprintf("Command timed out in persistent shell after %s; its processes were stopped.\nOutput (partial): %s\nTimed Out: true\nElapsed: %s\nSession ID: %s\nShell: %s (PID: %d)",
+					timeout, strings.TrimSpace(output), entry.Duration().Round(time.Millisecond), sessionID, session.Shell, session.Pid)
+			}
+			for _, note := range notes {
+				result += "\n" + note
+			}
+			if summary := throttle.summary(); summary != "" {
+				result += "\nThrottled: " + summary
+			}
+			return mcp.NewToolResultError(result), false
 		}
+	}
+
+	network := watch.Stop()
 
-		if err := scanner.Err(); err != nil {
-			errorChan <- err
-			return
+	// A shell that exited during the command, as on 'exit', ends its
+	// output without the marker; its exit status stands for the command's
+	exitedShell := false
+	if out.eof && session.exit != nil {
+		select {
+		case <-session.exit.done:
+			exitedShell = true
+			if session.exit.state != nil {
+				out.exitCode = session.exit.state.ExitCode()
+			}
+		case <-time.After(drainTimeout):
 		}
+	}
 
-		outputChan <- output.String()
-	}()
+	if out.cwd != "" && !session.terminal {
+		session.cwd = out.cwd
+	}
+	session.LastUsed = time.Now()
+	sm.owner.Fix(started)
+	output := sm.paths.ToClient(out.output)
 
-	select {
-	case output := <-outputChan:
-		session.LastUsed = time.Now()
+	entry := session.Transcript.Record(transcript.Entry{
+		Command:     shown,
+		Output:      output,
+		ExitCode:    out.exitCode,
+		Started:     started,
+		Finished:    session.LastUsed,
+		LineOffsets: lineOffsets(),
+	})
+	sm.publishExit(sessionID, entry, throttle.throttled())
+	tracing.EndCommand(span, entry.ExitCode, entry.Duration(), false)
+	receipt.Record(ctx, receipt.Command{Command: command, SessionID: sessionID, ExitCode: entry.ExitCode, Started: started, Finished: entry.Finished})
+	sm.log.Info("Command finished", "session_id", sessionID, logging.Command(command),
+		"exit_code", entry.ExitCode, "duration_ms", entry.Duration().Milliseconds(), "by", controller, "throttled", throttle.throttled())
 
-		result := fmt.Sprintf("Command executed in persistent shell.\nOutput: %s\nSession ID: %s\nShell: %s (PID: %d)",
-			strings.TrimSpace(output), sessionID, session.Shell, session.Cmd.Process.Pid)
+	result := fmt.Sprintf("Command executed in persistent shell.\nOutput: %s\nExit Code: %d\nSession ID: %s\nShell: %s (PID: %d)",
+		strings.TrimSpace(output), out.exitCode, sessionID, session.Shell, session.Pid)
+	for _, note := range notes {
+		result += "\n" + note
+	}
+	if out.lost {
+		session.desynced = true
+		result += "\nOut Of Sync: the command's end marker never came back, probably because the command read the input typed after it; its exit code is unknown and the session will be resynchronized"
+	}
+	if out.dropped > 0 {
+		result += fmt.Sprintf("\nDropped: %d line(s) an earlier command printed after it was given up on", out.dropped)
+	}
+	// The reader is done with the decoder once it has sent the output
+	if note := decoder.Note(); note != "" {
+		result += "\nEncoding: " + note
+	}
+	if summary := throttle.summary(); summary != "" {
+		result += "\nThrottled: " + summary
+	}
+	if run.interrupted.Load() {
+		result += "\nInterrupted: true"
+	}
+	if exitedShell {
+		result += fmt.Sprintf("\nShell Exited: the shell ended with %s during the command", session.exitStatus())
+		if sm.config.SessionAutoRestart {
+			result += "; a new one will be started for the next command"
+		}
+	}
+	if out.cwd != "" {
+		result += "\nWorking Directory: " + sm.paths.ToClient(out.cwd)
+	}
+	// An empty dump means the environment could not be read, not that it is empty
+	if len(out.env) > 0 {
+		if session.envState != nil {
+			if changes := envChanges(session.envState, out.env, sm.redact.String); changes != "" {
+				result += "\nEnvironment Changed: " + changes
+			}
+		}
+		session.envState = out.env
+	}
+	if watch != nil {
+		result += "\nNetwork: " + network.String()
+		audit.Annotate(ctx, "network", network)
+	}
+	if render.Debug(ctx) {
+		result += fmt.Sprintf("\nCommand: %s\nWrapper: %s\nTerminal: %v\nTimeout: %s\nStarted: %s\nDuration: %s",
+			shown, strings.Join(wrapper, "; "), session.terminal, timeout,
+			started.UTC().Format(time.RFC3339Nano), entry.Duration().Round(time.Millisecond))
+		if len(session.envState) > 0 {
+			result += "\nEnvironment: " + render.Environment(slices.Collect(maps.Keys(session.envState)))
+		}
+	}
 
-		return mcp.NewToolResultText(result), nil
+	return mcp.NewToolResultText(result), out.lost
+}
 
-	case err := <-errorChan:
-		return mcp.NewToolResultError(fmt.Sprintf("Error reading output: %v", err)), nil
+// descendants lists the processes below pid in the process tree, leaving out
+// those in except
+func descendants(pid int, except map[int]bool) []int {
+	processes, err := process.List(process.Filter{DescendantsOf: pid})
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, p := range processes {
+		if !except[p.PID] {
+			pids = append(pids, p.PID)
+		}
+	}
+	return pids
+}
+
+// publishExit announces a finished command to the session's observers and
+// counts it in the server's metrics
+func (sm *Manager) publishExit(sessionID string, entry transcript.Entry, throttled bool) {
+	metrics.Record(sessionID, entry.Command, entry.Duration(), entry.ExitCode, entry.TimedOut, throttled)
+	webhook.Command(events.CommandFinished{
+		SessionID:  sessionID,
+		Command:    entry.Command,
+		ExitCode:   entry.ExitCode,
+		TimedOut:   entry.TimedOut,
+		DurationMS: entry.Duration().Milliseconds(),
+	})
+	sm.events.Publish(sessionID, sse.Event{Type: events.TypeExit, Data: events.Exit{
+		Version:    events.Version,
+		Seq:        entry.Seq,
+		Command:    entry.Command,
+		ExitCode:   entry.ExitCode,
+		TimedOut:   entry.TimedOut,
+		DurationMS: entry.Duration().Milliseconds(),
+	}})
+}
+
+// GetTranscript returns the transcript of an existing session
+func (sm *Manager) GetTranscript(sessionID string) (*transcript.Transcript, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	return session.Transcript, nil
+}
+
+// Report compiles a session's transcript and notes into a run report
+func (sm *Manager) Report(sessionID string) (*report.Report, error) {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
 
-	case <-ctx.Done():
-		return mcp.NewToolResultError("Command timeout"), nil
+	return report.New(report.Session{
+		ID:      session.ID,
+		Shell:   session.Shell,
+		Created: session.Created,
+	}, session.Transcript.Entries(), session.Transcript.Notes()), nil
+}
+
+// Annotate attaches a note to a session's history after the command with
+// sequence number after (negative = the latest) and announces it to observers
+func (sm *Manager) Annotate(sessionID string, after int, author, text string) (transcript.Note, error) {
+	session, err := sm.getSession(sessionID)
+	if err != nil {
+		return transcript.Note{}, err
 	}
+
+	note, err := session.Transcript.Annotate(after, author, text)
+	if err != nil {
+		return transcript.Note{}, err
+	}
+
+	sm.events.Publish(sessionID, sse.Event{Type: events.TypeAnnotation, Data: events.Annotation{
+		Version: events.Version,
+		After:   note.After,
+		Author:  note.Author,
+		Text:    note.Text,
+		Time:    note.Time,
+	}})
+
+	return note, nil
 }
 
-// CloseSession closes a specific session
-func (sm *Manager) CloseSession(sessionID string) error {
+// CloseSession closes a specific session and returns the outcome of its
+// teardown commands, which have run by the time it returns
+func (sm *Manager) CloseSession(sessionID string) ([]TeardownResult, error) {
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		sm.mu.Unlock()
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	delete(sm.sessions, sessionID)
+	sm.revokeObservers(sessionID)
+	sm.mu.Unlock()
+
+	// Ending the shell can take its kill grace period, so it is done without
+	// holding up other sessions
+	session.terminate()
+	sm.log.Info("Closed session", "session_id", sessionID)
 
+	// Teardown may take a while, so it runs without holding up other sessions
+	return sm.teardown(session, TeardownClosed), nil
+}
+
+// CloseAll closes the sessions owned by owner, or every session when all is
+// set, and returns the outcome of their teardown commands by session ID
+func (sm *Manager) CloseAll(owner string, all bool) map[string][]TeardownResult {
+	return sm.closeWhere(func(session *ShellSession) bool {
+		return all || session.owner == owner
+	}, TeardownClosed)
+}
+
+// Close closes every session and the idle warm shells, as when the server
+// shuts down, and waits for the teardown commands of sessions to finish
+func (sm *Manager) Close() {
+	if closed := sm.closeWhere(func(*ShellSession) bool { return true }, TeardownShutdown); len(closed) > 0 {
+		sm.log.Info("Closed sessions on shutdown", "sessions", len(closed))
+	}
+
+	sm.warmMu.Lock()
+	for shell, idle := range sm.warm {
+		for _, session := range idle {
+			session.terminate()
+		}
+		sm.warm[shell] = nil
+	}
+	sm.warmMu.Unlock()
+
+	sm.teardowns.Wait()
+}
+
+// closeWhere closes the sessions match selects, running their teardowns side
+// by side, and returns the outcome of those by session ID
+func (sm *Manager) closeWhere(match func(*ShellSession) bool, reason string) map[string][]TeardownResult {
+	sm.mu.Lock()
+	var closing []*ShellSession
+	for id, session := range sm.sessions {
+		if !match(session) {
+			continue
+		}
+		closing = append(closing, session)
+		delete(sm.sessions, id)
+		sm.revokeObservers(id)
+	}
+	sm.mu.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string][]TeardownResult, len(closing))
+	for _, session := range closing {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session.terminate()
+			sm.log.Info("Closed session", "session_id", session.ID, "reason", reason)
+			teardown := sm.teardown(session, reason)
+			mu.Lock()
+			results[session.ID] = teardown
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// PauseSession suspends the command running in a session (SIGSTOP). Only the
+// processes the command started are stopped, as for Interrupt, so the shell
+// and background jobs keep running; commands sent to the session are refused
+// until it is resumed.
+func (sm *Manager) PauseSession(sessionID string) error {
+	sm.mu.RLock()
 	session, exists := sm.sessions[sessionID]
+	var run *running
+	if exists {
+		run = session.running
+	}
+	sm.mu.RUnlock()
 	if !exists {
 		return fmt.Errorf("session not found: %s", sessionID)
 	}
+	if run == nil {
+		return fmt.Errorf("no command is running in session %s; nothing to pause", sessionID)
+	}
 
-	session.Stdin.Close()
-	session.Stdout.Close()
-	session.Stderr.Close()
-	if session.Cmd.Process != nil {
-		session.Cmd.Process.Kill()
+	var stopped []int
+	for _, pid := range descendants(session.Pid, run.existing) {
+		if syscall.Kill(pid, syscall.SIGSTOP) == nil {
+			stopped = append(stopped, pid)
+		}
+	}
+	if len(stopped) == 0 {
+		return fmt.Errorf("the command running in session %s has no processes to pause", sessionID)
 	}
 
-	delete(sm.sessions, sessionID)
-	log.Printf("Closed session: %s", sessionID)
+	sm.mu.Lock()
+	if session.running != run {
+		// The command ended meanwhile; the IDs are not its any more
+		sm.mu.Unlock()
+		return fmt.Errorf("the command running in session %s has finished", sessionID)
+	}
+	session.Paused = true
+	session.stopped = append(session.stopped, stopped...)
+	run.stopClock()
+	sm.mu.Unlock()
+	sm.log.Info("Paused session", "session_id", sessionID, "stopped", len(stopped))
+	return nil
+}
+
+// ResumeSession continues the command of a paused session (SIGCONT)
+func (sm *Manager) ResumeSession(sessionID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if !session.Paused {
+		return fmt.Errorf("session %s is not paused", sessionID)
+	}
 
+	// Processes that have exited since are gone, which is fine
+	for _, pid := range session.stopped {
+		syscall.Kill(pid, syscall.SIGCONT)
+	}
+	session.Paused, session.stopped = false, nil
+	if session.running != nil {
+		session.running.resumeClock()
+	}
+	sm.log.Info("Resumed session", "session_id", sessionID)
 	return nil
 }
 
+// Count returns the number of active sessions
+func (sm *Manager) Count() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return len(sm.sessions)
+}
+
 // ListSessions returns information about active sessions
 func (sm *Manager) ListSessions() map[string]interface{} {
+	cpu := sm.shellCPU()
+
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
 	result := make(map[string]interface{})
 	for id, session := range sm.sessions {
+		controller, _ := session.control.current()
+		usage := session.usage(cpu)
 		result[id] = map[string]interface{}{
 			"shell":      session.Shell,
 			"created":    session.Created.Format(time.RFC3339),
 			"last_used":  session.LastUsed.Format(time.RFC3339),
-			"pid":        session.Cmd.Process.Pid,
-			"alive":      session.Cmd.ProcessState == nil || !session.Cmd.ProcessState.Exited(),
+			"pid":        session.Pid,
+			"alive":      session.Alive(),
+			"paused":     session.Paused,
+			"adopted":    session.Adopted,
+			"controller": controller,
+			"frozen":     session.control.frozenReason(),
+			"owner":      session.owner,
+			"name":       session.meta.Name,
+			"tags":       append([]string(nil), session.meta.Tags...),
+			"pinned":     session.pinned,
+			"usage":      usage,
 		}
 	}
 
 	return result
 }
 
-// cleanupSessions removes inactive sessions
+// cleanupSessions closes sessions that have been idle longer than the
+// configured timeout, except pinned ones
 func (sm *Manager) cleanupSessions() {
-	ticker := time.NewTicker(5 * time.Minute)
+	if sm.config.SessionIdleTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(sm.config.SessionCleanupInterval)
 	defer ticker.Stop()
 
-	for {
-		select {
-		case <-ticker.C:
-			sm.mu.Lock()
-			now := time.Now()
-			for id, session := range sm.sessions {
-				// Remove sessions inactive for more than 30 minutes
-				if now.Sub(session.LastUsed) > 30*time.Minute {
-					log.Printf("Cleaning up inactive session: %s", id)
-					session.Stdin.Close()
-					session.Stdout.Close()
-					session.Stderr.Close()
-					if session.Cmd.Process != nil {
-						session.Cmd.Process.Kill()
-					}
-					delete(sm.sessions, id)
-				}
+	for range ticker.C {
+		// Expired sessions are taken out under the lock and ended after it is
+		// released, as ending a shell can take its kill grace period
+		sm.mu.Lock()
+		now := time.Now()
+		var expired []*ShellSession
+		for id, session := range sm.sessions {
+			idle := now.Sub(session.LastUsed)
+			// A command that runs longer than the timeout, or is paused,
+			// keeps its session in use
+			if idle <= sm.config.SessionIdleTimeout || session.pinned || session.running != nil || session.Paused {
+				continue
 			}
-			sm.mu.Unlock()
+			expired = append(expired, session)
+			delete(sm.sessions, id)
+			sm.revokeObservers(id)
+		}
+		sm.mu.Unlock()
+
+		for _, session := range expired {
+			idle := now.Sub(session.LastUsed)
+			sm.log.Info("Cleaning up inactive session", "session_id", session.ID, "idle", idle.Round(time.Second).String())
+			event := events.Expired{
+				Version:     events.Version,
+				SessionID:   session.ID,
+				LastUsed:    session.LastUsed,
+				IdleSeconds: int64(idle.Seconds()),
+			}
+			sm.events.Publish(session.ID, sse.Event{Type: events.TypeExpired, Data: event})
+			webhook.Notify(events.TypeExpired, event)
+			sm.teardowns.Add(1)
+			go func() {
+				defer sm.teardowns.Done()
+				session.terminate()
+				sm.teardown(session, TeardownExpired)
+			}()
+		}
+	}
+}
+
+// announce tells the lifecycle webhooks about a new session. The caller must hold sm.mu.
+func (sm *Manager) announce(session *ShellSession) {
+	webhook.Notify(events.TypeSessionCreated, events.SessionCreated{
+		Version:   events.Version,
+		SessionID: session.ID,
+		Shell:     session.Shell,
+		PID:       session.Pid,
+		Owner:     session.owner,
+		Name:      session.meta.Name,
+		Adopted:   session.Adopted,
+	})
+}
+
+// checkCapacity refuses a new session when the configured session limits are
+// reached, in total or for owner. The caller must hold sm.mu.
+func (sm *Manager) checkCapacity(owner string) error {
+	if max := sm.config.MaxSessions; max > 0 && len(sm.sessions) >= max {
+		return fmt.Errorf("session limit of %d reached; close a session first", max)
+	}
+
+	if max := sm.config.MaxSessionsPerClient; max > 0 && owner != "" {
+		owned := 0
+		for _, session := range sm.sessions {
+			if session.owner == owner {
+				owned++
+			}
+		}
+		if owned >= max {
+			return fmt.Errorf("per-client session limit of %d reached; close one of your sessions first", max)
 		}
 	}
-}
\ No newline at end of file
+	return nil
+}
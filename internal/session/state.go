@@ -0,0 +1,82 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/shells"
+)
+
+// maxStateValue caps how much of a changed variable's value a result shows
+const maxStateValue = 200
+
+// unreported are variables the shell or the server change around every
+// command, which would only be noise in the reported changes
+var unreported = map[string]bool{
+	"PWD":               true,
+	"OLDPWD":            true,
+	labels.EnvSessionID: true,
+	labels.EnvRequestID: true,
+}
+
+// reportsState reports whether commands in the session are followed by a dump
+// of its environment. Adopted terminals are left out, since the dump would
+// show up in the user's terminal.
+func (sm *Manager) reportsState(session *ShellSession) bool {
+	return sm.config.SessionStateReport && !session.terminal
+}
+
+// stateLines returns the lines that print the session's environment after a
+// command, between marker+"_ENV_BEGIN" and marker+"_ENV_END". The first tells
+// the environment from the output when the command's own marker was lost.
+func (session *ShellSession) stateLines(marker string) string {
+	return session.profile.Mark(marker, "ENV_BEGIN") + "\n" + session.profile.PrintEnv() + "\n" + session.profile.Mark(marker, "ENV_END") + "\n"
+}
+
+// baseline records the session's environment before its first command, so
+// what that command changes can be told. The caller must hold session.mu.
+func (sm *Manager) baseline(session *ShellSession) {
+	if session.envState != nil || !sm.reportsState(session) {
+		return
+	}
+	lines, err := sm.query(session, session.profile.PrintEnv())
+	if err != nil {
+		sm.log.Warn("Failed to read session environment", "session_id", session.ID, "error", err)
+		return
+	}
+	session.envState = shells.ParseEnv(lines)
+}
+
+// envChanges describes how the environment went from before to after, e.g.
+// "set FOO=bar, PATH=/opt/bin:/usr/bin; unset DEBUG", or "" when nothing the
+// agent would care about changed. Values pass through redact.
+func envChanges(before, after map[string]string, redact func(string) string) string {
+	var set, unset []string
+	for name, value := range after {
+		if old, ok := before[name]; (!ok || old != value) && !unreported[name] {
+			value = redact(value)
+			if len(value) > maxStateValue {
+				value = value[:maxStateValue] + "..."
+			}
+			set = append(set, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok && !unreported[name] {
+			unset = append(unset, name)
+		}
+	}
+	sort.Strings(set)
+	sort.Strings(unset)
+
+	var parts []string
+	if len(set) > 0 {
+		parts = append(parts, "set "+strings.Join(set, ", "))
+	}
+	if len(unset) > 0 {
+		parts = append(parts, "unset "+strings.Join(unset, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"sort"
+	"time"
+)
+
+// States a session is summarised as being in
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateFrozen  = "frozen"
+	StateExited  = "exited"
+)
+
+// Summary is the state of one session at a glance
+type Summary struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Shell      string    `json:"shell"`
+	Pid        int       `json:"pid"`
+	State      string    `json:"state"`
+	Owner      string    `json:"owner"`
+	Controller string    `json:"controller"`
+	Pinned     bool      `json:"pinned,omitempty"`
+	Adopted    string    `json:"adopted,omitempty"`
+	Created    time.Time `json:"created"`
+	LastUsed   time.Time `json:"last_used"`
+	// Command is what the session is running and CommandStarted when it
+	// began, while its state is running
+	Command        string     `json:"command,omitempty"`
+	CommandStarted *time.Time `json:"command_started,omitempty"`
+	Usage          Usage      `json:"usage"`
+}
+
+// Summaries returns the state of every session, oldest first
+func (sm *Manager) Summaries() []Summary {
+	cpu := sm.shellCPU()
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	summaries := make([]Summary, 0, len(sm.sessions))
+	for id, session := range sm.sessions {
+		controller, _ := session.control.current()
+		summary := Summary{
+			ID:         id,
+			Name:       session.meta.Name,
+			Tags:       append([]string(nil), session.meta.Tags...),
+			Shell:      session.Shell,
+			Pid:        session.Pid,
+			State:      StateIdle,
+			Owner:      session.owner,
+			Controller: controller,
+			Pinned:     session.pinned,
+			Adopted:    session.Adopted,
+			Created:    session.Created,
+			LastUsed:   session.LastUsed,
+			Usage:      session.usage(cpu),
+		}
+		if run := session.running; run != nil {
+			summary.State = StateRunning
+			summary.Command = run.command
+			summary.CommandStarted = &run.started
+		}
+		switch {
+		case !session.Alive():
+			summary.State = StateExited
+		case session.control.frozenReason() != "":
+			summary.State = StateFrozen
+		case session.Paused:
+			summary.State = StatePaused
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Created.Before(summaries[j].Created)
+	})
+	return summaries
+}
@@ -0,0 +1,203 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/shells"
+)
+
+// DefaultTeardownTimeout bounds each teardown command whose profile sets no timeout
+const DefaultTeardownTimeout = time.Minute
+
+// maxTeardownOutput bounds the output of a teardown command kept in the audit log
+const maxTeardownOutput = 4096
+
+// Why a session's teardown runs
+const (
+	TeardownClosed  = "closed"
+	TeardownExpired = "expired"
+	// TeardownExited is a session dropped because its shell exited
+	TeardownExited   = "exited"
+	TeardownShutdown = "shutdown"
+)
+
+// Teardown is what to run when a session ends, e.g. "docker compose down":
+// commands run one after another in a fresh shell, in the directory the
+// session was last in and with its environment
+type Teardown struct {
+	// Profile is the profile the commands come from
+	Profile  string
+	Commands []string
+	// Timeout bounds each command, DefaultTeardownTimeout if zero
+	Timeout time.Duration
+}
+
+// TeardownResult is the outcome of one teardown command
+type TeardownResult struct {
+	Command  string
+	ExitCode int
+	TimedOut bool
+	Output   string
+	Duration time.Duration
+	Err      error
+}
+
+// OK reports whether the command succeeded
+func (r TeardownResult) OK() bool {
+	return r.Err == nil && !r.TimedOut && r.ExitCode == 0
+}
+
+// teardown runs the teardown commands of a session that has ended, recording
+// each in the audit log. Every command runs even when one before it failed.
+func (sm *Manager) teardown(session *ShellSession, reason string) []TeardownResult {
+	if session.teardown == nil || len(session.teardown.Commands) == 0 {
+		return nil
+	}
+	td := session.teardown
+	timeout := td.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTeardownTimeout
+	}
+
+	dir := session.cwd
+	if info, err := os.Stat(dir); dir == "" || err != nil || !info.IsDir() {
+		dir = session.WorkingDir
+	}
+	env := sm.teardownEnv(session)
+
+	results := make([]TeardownResult, 0, len(td.Commands))
+	for _, command := range td.Commands {
+		r := sm.runTeardown(session.Shell, dir, env, session.user, command, timeout)
+		results = append(results, r)
+
+		outcome := "ok"
+		details := map[string]interface{}{
+			"profile":     td.Profile,
+			"reason":      reason,
+			"command":     command,
+			"exit_code":   r.ExitCode,
+			"duration_ms": r.Duration.Milliseconds(),
+			"output":      sm.redact.String(r.Output),
+		}
+		switch {
+		case r.Err != nil:
+			outcome = "error"
+			details["error"] = r.Err.Error()
+		case r.TimedOut:
+			outcome = "timeout"
+			details["timeout_seconds"] = timeout.Seconds()
+		case r.ExitCode != 0:
+			outcome = "error"
+		}
+		sm.audit.Append(audit.ActorServer, "teardown", session.ID, outcome, details)
+
+		if r.OK() {
+			sm.log.Info("Ran teardown command", "session_id", session.ID, "profile", td.Profile, "reason", reason, "command", command, "duration", r.Duration.String())
+		} else {
+			sm.log.Warn("Teardown command failed", "session_id", session.ID, "profile", td.Profile, "reason", reason, "command", command, "exit_code", r.ExitCode, "timed_out", r.TimedOut, "error", r.Err)
+		}
+	}
+	return results
+}
+
+// teardownEnv returns the environment of a session's teardown commands: the
+// one its shell was started with and, when commands are followed by a dump
+// of it, what the shell exported since
+func (sm *Manager) teardownEnv(session *ShellSession) []string {
+	env := os.Environ()
+	if sm.config.Display != "" {
+		env = append(env, "DISPLAY="+sm.config.Display)
+	}
+	env = append(env, session.env...)
+
+	names := make([]string, 0, len(session.envState))
+	for name := range session.envState {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+session.envState[name])
+	}
+	return env
+}
+
+// runTeardown runs one teardown command as the session's user, stopping it
+// and everything it started once timeout has passed
+func (sm *Manager) runTeardown(shell, dir string, env []string, user *process.User, command string, timeout time.Duration) TeardownResult {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, shell, shells.For(shell).CommandArgs(command)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	process.RunAs(cmd, user)
+	process.Group(cmd, sm.config.KillGracePeriod)
+	r := TeardownResult{Command: command}
+	if err := sm.workspace.Confine(cmd); err != nil {
+		r.ExitCode = -1
+		r.Err = err
+		return r
+	}
+
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	started := time.Now()
+	err := cmd.Run()
+	r.Duration = time.Since(started)
+	r.Output = output.String()
+	if len(r.Output) > maxTeardownOutput {
+		r.Output = r.Output[:maxTeardownOutput] + "\n[output truncated]"
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		r.ExitCode = -1
+		r.TimedOut = true
+	case errors.As(err, &exitErr):
+		r.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		r.ExitCode = -1
+		r.Err = err
+	}
+	return r
+}
+
+// TeardownSummary describes the outcome of a session's teardown for the
+// result of the call that closed it, or "" when it had none
+func TeardownSummary(results []TeardownResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+	failed := 0
+	var lines []string
+	for _, r := range results {
+		status := fmt.Sprintf("exit %d", r.ExitCode)
+		switch {
+		case r.Err != nil:
+			status = r.Err.Error()
+		case r.TimedOut:
+			status = "timed out"
+		}
+		if !r.OK() {
+			failed++
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s (%s)", r.Command, status, r.Duration.Round(time.Millisecond)))
+	}
+	header := fmt.Sprintf("Teardown: %d command(s) ran", len(results))
+	if failed > 0 {
+		header += fmt.Sprintf(", %d failed", failed)
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
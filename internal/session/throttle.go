@@ -0,0 +1,89 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/ratelimit"
+)
+
+// droppedNotice stands in for output discarded by the output rate limit
+const droppedNotice = "[output dropped: over the session's output rate limit]"
+
+// outputThrottle applies a session's output rate limit to the output of one
+// command, so a command printing in a tight loop cannot flood observers,
+// progress notifications and the result
+type outputThrottle struct {
+	limit *ratelimit.Throughput
+	drop  bool
+
+	mu           sync.Mutex
+	paused       time.Duration
+	droppedLines int
+	droppedBytes int64
+	dropping     bool
+}
+
+// newOutputThrottle applies limit with the configured policy
+func newOutputThrottle(limit *ratelimit.Throughput, policy string) *outputThrottle {
+	return &outputThrottle{limit: limit, drop: policy == "drop"}
+}
+
+// admit decides about a line of n bytes. Under the pause policy it waits until
+// the line fits and always keeps it. Under the drop policy it reports whether
+// to keep the line, and whether it starts a run of dropped lines that should
+// be marked with droppedNotice.
+func (t *outputThrottle) admit(n int) (keep, first bool) {
+	if t.limit == nil {
+		return true, false
+	}
+
+	if !t.drop {
+		if wait := t.limit.Wait(n); wait > 0 {
+			// Sleeps overshoot short waits, so the pause is measured
+			start := time.Now()
+			time.Sleep(wait)
+			t.mu.Lock()
+			t.paused += time.Since(start)
+			t.mu.Unlock()
+		}
+		return true, false
+	}
+
+	allowed := t.limit.Allow(n)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if allowed {
+		t.dropping = false
+		return true, false
+	}
+	first = !t.dropping
+	t.dropping = true
+	t.droppedLines++
+	t.droppedBytes += int64(n)
+	return false, first
+}
+
+// throttled reports whether the limit held back any output
+func (t *outputThrottle) throttled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.paused > 0 || t.droppedLines > 0
+}
+
+// summary describes what the limit did, or returns "" when it did nothing
+func (t *outputThrottle) summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case t.droppedLines > 0:
+		return fmt.Sprintf("%d lines (%d bytes) of output dropped over the %d bytes/s limit", t.droppedLines, t.droppedBytes, t.limit.Rate())
+	case t.paused > 0:
+		return fmt.Sprintf("output paused for %s to stay within the %d bytes/s limit", t.paused.Round(time.Millisecond), t.limit.Rate())
+	}
+	return ""
+}
@@ -0,0 +1,433 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/ratelimit"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/transcript"
+)
+
+// escapeSequence matches ANSI CSI/OSC sequences and other two-byte escapes
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// AdoptTmux attaches an existing tmux pane as a managed session, so a terminal
+// a user already has open can be handed over to the agent. The pane is given
+// as a tmux target (e.g. "work:1.0" or "%3") or, when pid is non-zero, as the
+// PID of a process running in it. Closing the session detaches from the pane
+// but leaves it running.
+func (sm *Manager) AdoptTmux(sessionID, target string, pid int, owner string) (*ShellSession, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.sessions[sessionID]; exists {
+		return nil, fmt.Errorf("session already exists: %s", sessionID)
+	}
+	if sessionID == AllSessions {
+		return nil, fmt.Errorf("session ID %s is reserved", AllSessions)
+	}
+	if err := sm.checkCapacity(owner); err != nil {
+		return nil, err
+	}
+
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return nil, fmt.Errorf("tmux is not installed: %v", err)
+	}
+
+	ownerToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if pid != 0 {
+		if target, err = paneForPID(pid); err != nil {
+			return nil, err
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("a tmux target or pid is required")
+	}
+
+	// Resolve the target to a stable pane ID
+	out, err := exec.Command("tmux", "display-message", "-p", "-t", target, "#{pane_id} #{pane_pid} #{pane_current_command}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("tmux pane not found: %s", target)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("unexpected tmux output: %q", strings.TrimSpace(string(out)))
+	}
+	paneID := fields[0]
+	panePid, _ := strconv.Atoi(fields[1])
+	shell := "tmux"
+	if len(fields) > 2 {
+		shell = fields[2]
+	}
+
+	session, err := pipePane(paneID, panePid, shell)
+	if err != nil {
+		return nil, err
+	}
+	session.ID = sessionID
+	session.Created = time.Now()
+	session.LastUsed = time.Now()
+	session.Transcript = transcript.New(sm.config.TranscriptMaxEntries, sm.config.TranscriptMaxBytes)
+	session.Adopted = "tmux pane " + paneID
+	session.control = control{holder: ControllerAgent}
+	session.owner = owner
+	session.ownerToken = ownerToken
+	session.output = ratelimit.NewThroughput(sm.config.OutputRateLimit)
+
+	sm.sessions[sessionID] = session
+	sm.announce(session)
+
+	sm.log.Info("Adopted tmux pane", "session_id", sessionID, "pane", paneID, "shell", shell, "pid", panePid)
+
+	return session, nil
+}
+
+// pipePane makes a session of a tmux pane: what is typed goes to the pane
+// with send-keys, and its output is read from a FIFO it is piped into.
+// Detaching stops the piping but leaves the pane running.
+func pipePane(paneID string, panePid int, shell string) (*ShellSession, error) {
+	// Pane output is mirrored into a FIFO that is read like a shell's stdout. It is
+	// opened read-write so opening does not block waiting for tmux to connect.
+	dir, err := os.MkdirTemp("", "mcp-adopt-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe directory: %v", err)
+	}
+	fifo := filepath.Join(dir, "output")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create pipe: %v", err)
+	}
+	output, err := os.OpenFile(fifo, os.O_RDWR, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open pipe: %v", err)
+	}
+
+	if err := exec.Command("tmux", "pipe-pane", "-t", paneID, "cat >> "+shells.For("sh").Quote(fifo)).Run(); err != nil {
+		output.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to pipe tmux pane output: %v", err)
+	}
+
+	return &ShellSession{
+		Pid:      panePid,
+		Stdin:    &tmuxInput{pane: paneID},
+		Stdout:   output,
+		lines:    newLineQueue(output),
+		Stderr:   io.NopCloser(strings.NewReader("")),
+		Shell:    shell,
+		profile:  shells.For(shell),
+		terminal: true,
+		pane:     paneID,
+		detach: func() {
+			// pipe-pane without a command stops piping
+			exec.Command("tmux", "pipe-pane", "-t", paneID).Run()
+			os.RemoveAll(dir)
+		},
+	}, nil
+}
+
+// tmuxName returns the name of the tmux session the tmux backend runs a
+// session in, "mcp-<session ID>" with what tmux does not allow in names replaced
+func tmuxName(sessionID string) string {
+	return "mcp-" + strings.Map(func(r rune) rune {
+		if r == '.' || r == ':' || r <= ' ' {
+			return '_'
+		}
+		return r
+	}, sessionID)
+}
+
+// startTmux starts a session's shell in a detached tmux session on the host,
+// for the tmux backend, so users can attach to it with "tmux attach -t
+// mcp-<session ID>" and work in the shell alongside the agent. Ending the
+// session kills the tmux session. The shell is started by the tmux server,
+// so the workspace sandbox and resource limits cannot be applied to it.
+func (sm *Manager) startTmux(sessionID, shell, workingDir string, env []string) (*ShellSession, error) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return nil, fmt.Errorf("tmux is not installed: %v", err)
+	}
+	if sm.config.WorkspaceSandbox != "none" {
+		return nil, fmt.Errorf("the tmux session backend cannot run shells in the %s workspace sandbox", sm.config.WorkspaceSandbox)
+	}
+	if workingDir == "" {
+		workingDir = sm.workspace.Dir()
+	}
+
+	name := tmuxName(sessionID)
+	args := []string{"new-session", "-d", "-s", name, "-x", "200", "-y", "50", "-P", "-F", "#{pane_id} #{pane_pid}"}
+	if workingDir != "" {
+		args = append(args, "-c", workingDir)
+	}
+	vars := slices.Clone(env)
+	if sm.config.Display != "" {
+		vars = append(vars, "DISPLAY="+sm.config.Display)
+	}
+	for _, v := range labels.Environ(vars, sm.config.Tenant, sessionID, "") {
+		args = append(args, "-e", v)
+	}
+	args = append(args, shell)
+
+	out, err := exec.Command("tmux", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start tmux session %s: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		exec.Command("tmux", "kill-session", "-t", "="+name).Run()
+		return nil, fmt.Errorf("unexpected tmux output: %q", strings.TrimSpace(string(out)))
+	}
+	panePid, _ := strconv.Atoi(fields[1])
+
+	session, err := pipePane(fields[0], panePid, shell)
+	if err != nil {
+		exec.Command("tmux", "kill-session", "-t", "="+name).Run()
+		return nil, err
+	}
+	detach := session.detach
+	session.detach = func() {
+		detach()
+		exec.Command("tmux", "kill-session", "-t", "="+name).Run()
+	}
+	session.WorkingDir = workingDir
+	session.env = env
+	session.tmuxSession = name
+	return session, nil
+}
+
+// SendKeys types into the tmux pane of a session, as a user at the terminal
+// would: text literally, then keys by their tmux names, such as "Enter",
+// "C-c", "Up" or "q". It works while a command runs, to answer a prompt or
+// drive a program such as an editor or pager. by is the party typing, which
+// must hold control of the session.
+func (sm *Manager) SendKeys(sessionID, text string, keys []string, by string) error {
+	sm.mu.RLock()
+	session, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if session.pane == "" {
+		return fmt.Errorf("session %s does not run in tmux; adopt a tmux pane or use the tmux session backend", sessionID)
+	}
+	if err := session.control.check(by); err != nil {
+		return err
+	}
+	if err := checkKeys(keys); err != nil {
+		return err
+	}
+
+	if text != "" {
+		if out, err := exec.Command("tmux", "send-keys", "-t", session.pane, "-l", "--", text).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to send keys to %s: %v: %s", session.pane, err, strings.TrimSpace(string(out)))
+		}
+	}
+	if len(keys) > 0 {
+		args := append([]string{"send-keys", "-t", session.pane, "--"}, keys...)
+		if out, err := exec.Command("tmux", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to send keys to %s: %v: %s", session.pane, err, strings.TrimSpace(string(out)))
+		}
+	}
+	sm.mu.Lock()
+	_, session.typed = typeLine(session.typed, text, keys)
+	sm.mu.Unlock()
+	sm.log.Info("Sent keys to session", "session_id", sessionID, "pane", session.pane, "text_bytes", len(text), "keys", keys, "by", by)
+	return nil
+}
+
+// tmuxKey matches what SendKeys presses: a single character, or a tmux key
+// name, with any C-, M- and S- modifiers, or a control key as ^X. Anything
+// else tmux would type as text, unchecked.
+var tmuxKey = regexp.MustCompile(`^(?:[CMS]-)*(?:F(?:[1-9]|1[0-2])|IC|Insert|DC|Delete|Home|End|NPage|PageDown|PgDn|PPage|PageUp|PgUp|Tab|BTab|Space|BSpace|Enter|Escape|Up|Down|Left|Right|KP[0-9/*+.-]|KPEnter|[!-~])$|^\^[!-~]$`)
+
+// checkKeys returns an error naming the first of keys that is not a key
+func checkKeys(keys []string) error {
+	for _, key := range keys {
+		if !tmuxKey.MatchString(key) {
+			return fmt.Errorf("unknown key %q; give text in 'text' and keys by their tmux names, such as Enter, Escape, C-c, Up or F1", key)
+		}
+	}
+	return nil
+}
+
+// Typed returns the lines that typing text and then pressing keys in the
+// tmux pane of a session would submit, each completed with what was typed
+// on it before, so they can be checked before SendKeys sends them
+func (sm *Manager) Typed(sessionID, text string, keys []string) ([]string, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	lines, _ := typeLine(session.typed, text, keys)
+	return lines, nil
+}
+
+// typeLine follows the line being typed at a terminal from line through
+// text and keys, returning the lines submitted and what is left typed. Only
+// typing, erasing and clearing are followed: keys moving the cursor or
+// recalling history leave the line as it is, and a human typing in the pane
+// is not seen, so the lines are a best guess.
+func typeLine(line, text string, keys []string) ([]string, string) {
+	var submitted []string
+	current := []rune(line)
+	for _, r := range text {
+		switch r {
+		case '\r', '\n':
+			submitted = append(submitted, string(current))
+			current = current[:0]
+		case '\b', 0x7f:
+			if len(current) > 0 {
+				current = current[:len(current)-1]
+			}
+		case 0x03, 0x15:
+			current = current[:0]
+		default:
+			current = append(current, r)
+		}
+	}
+	for _, key := range keys {
+		if len(key) == 1 {
+			current = append(current, rune(key[0]))
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "enter", "kpenter", "c-m", "c-j", "^m", "^j":
+			submitted = append(submitted, string(current))
+			current = current[:0]
+		case "bspace", "c-h", "^h":
+			if len(current) > 0 {
+				current = current[:len(current)-1]
+			}
+		case "c-c", "c-u", "^c", "^u":
+			current = current[:0]
+		case "space":
+			current = append(current, ' ')
+		}
+	}
+	return submitted, string(current)
+}
+
+// Screen returns what the tmux pane of a session shows, preceded by up to
+// history lines of its scrollback. Wrapped lines are joined.
+func (sm *Manager) Screen(sessionID string, history int) (string, error) {
+	sm.mu.RLock()
+	session, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("session not found: %s", sessionID)
+	}
+	if session.pane == "" {
+		return "", fmt.Errorf("session %s does not run in tmux; adopt a tmux pane or use the tmux session backend", sessionID)
+	}
+
+	args := []string{"capture-pane", "-p", "-J", "-t", session.pane}
+	if history > 0 {
+		args = append(args, "-S", strconv.Itoa(-history))
+	}
+	out, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to capture tmux pane %s: %v", session.pane, err)
+	}
+	return sm.paths.ToClient(sm.redact.String(strings.TrimRight(string(out), "\n"))), nil
+}
+
+// paneForPID finds the tmux pane whose shell is pid or one of its ancestors
+func paneForPID(pid int) (string, error) {
+	out, err := exec.Command("tmux", "list-panes", "-a", "-F", "#{pane_id} #{pane_pid}").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list tmux panes: %v", err)
+	}
+
+	panes := make(map[int]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if panePid, err := strconv.Atoi(fields[1]); err == nil {
+			panes[panePid] = fields[0]
+		}
+	}
+
+	for current := pid; current > 1; {
+		if pane, ok := panes[current]; ok {
+			return pane, nil
+		}
+
+		out, err := exec.Command("ps", "-o", "ppid=", "-p", strconv.Itoa(current)).Output()
+		if err != nil {
+			break
+		}
+		if current, err = strconv.Atoi(strings.TrimSpace(string(out))); err != nil {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("process %d is not running in a tmux pane", pid)
+}
+
+// tmuxInput types into a tmux pane
+type tmuxInput struct {
+	pane string
+}
+
+func (t *tmuxInput) Write(p []byte) (int, error) {
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		if text != "" {
+			if err := exec.Command("tmux", "send-keys", "-t", t.pane, "-l", "--", text).Run(); err != nil {
+				return 0, fmt.Errorf("failed to send keys to %s: %v", t.pane, err)
+			}
+		}
+		if strings.HasSuffix(line, "\n") {
+			if err := exec.Command("tmux", "send-keys", "-t", t.pane, "Enter").Run(); err != nil {
+				return 0, fmt.Errorf("failed to send keys to %s: %v", t.pane, err)
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tmuxInput) Close() error {
+	return nil
+}
+
+// cleanTerminalLine strips escape sequences and carriage returns from terminal output
+func cleanTerminalLine(line string) string {
+	line = escapeSequence.ReplaceAllString(line, "")
+	if i := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); i >= 0 {
+		// A bare carriage return means the line was redrawn; keep what is visible
+		line = line[i+1:]
+	}
+	return strings.TrimRight(line, "\r")
+}
+
+// isEcho reports whether a terminal line is the echo of input typed by the manager
+func isEcho(line string, typed []string) bool {
+	for _, t := range typed {
+		if t != "" && strings.HasSuffix(line, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTypeLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		text      string
+		keys      []string
+		submitted []string
+		left      string
+	}{
+		{name: "text only", text: "ls -la", left: "ls -la"},
+		{name: "text and Enter", text: "ls", keys: []string{"Enter"}, submitted: []string{"ls"}},
+		{name: "newlines in text", text: "cd /tmp\nls\n", submitted: []string{"cd /tmp", "ls"}},
+		{name: "completes the typed line", line: "git ", text: "status", keys: []string{"C-m"}, submitted: []string{"git status"}},
+		{name: "backspace", text: "lss\b", keys: []string{"BSpace", "s", "Enter"}, submitted: []string{"ls"}},
+		{name: "delete character", text: "ab\x7f", left: "a"},
+		{name: "ctrl-c clears", text: "rm -rf /", keys: []string{"C-c", "l", "s", "^M"}, submitted: []string{"ls"}},
+		{name: "ctrl-u in text clears", line: "rm", text: "\x15echo hi\r", submitted: []string{"echo hi"}},
+		{name: "space key", text: "echo", keys: []string{"Space", "x"}, left: "echo x"},
+		{name: "cursor keys are ignored", text: "ls", keys: []string{"Up", "Left"}, left: "ls"},
+		{name: "unicode", text: "echo é\b", keys: []string{"KPEnter"}, submitted: []string{"echo "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitted, left := typeLine(tt.line, tt.text, tt.keys)
+			if !slices.Equal(submitted, tt.submitted) {
+				t.Errorf("submitted = %q, want %q", submitted, tt.submitted)
+			}
+			if left != tt.left {
+				t.Errorf("left typed = %q, want %q", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		keys []string
+		// refused is the key named in the error, if the keys are refused
+		refused string
+		ok      bool
+	}{
+		{keys: nil, ok: true},
+		{keys: []string{"Enter", "C-c", "M-S-Up", "F12", "^C", "a", "KP5", "BTab"}, ok: true},
+		{keys: []string{"Enter", "ls -la"}, refused: "ls -la"},
+		{keys: []string{"F13"}, refused: "F13"},
+		{keys: []string{"C-"}, refused: "C-"},
+		{keys: []string{""}, refused: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.keys, ","), func(t *testing.T) {
+			err := checkKeys(tt.keys)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case !tt.ok && err == nil:
+				t.Errorf("checkKeys accepted %q", tt.refused)
+			case !tt.ok && !strings.Contains(err.Error(), strconv.Quote(tt.refused)):
+				t.Errorf("error = %v, want it to name %q", err, tt.refused)
+			}
+		})
+	}
+}
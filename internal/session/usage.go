@@ -0,0 +1,115 @@
+package session
+
+import (
+	"encoding/json"
+	"time"
+
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/transcript"
+)
+
+// Usage is what a session has consumed since it was created, so runaway
+// sessions can be told apart from busy ones
+type Usage struct {
+	Commands    int
+	OutputBytes int64
+	// WallTime is how long its commands ran
+	WallTime time.Duration
+	// CPUTime is the CPU time of its shells and everything they started,
+	// replaced shells included
+	CPUTime time.Duration
+	// LastFailure is the latest command that exited non-zero (nil if none did)
+	LastFailure *transcript.Entry
+}
+
+// MarshalJSON encodes the usage with times in milliseconds, and the last
+// failure without its output
+func (u Usage) MarshalJSON() ([]byte, error) {
+	type failure struct {
+		Seq      int       `json:"seq"`
+		Command  string    `json:"command"`
+		ExitCode int       `json:"exit_code"`
+		TimedOut bool      `json:"timed_out,omitempty"`
+		Finished time.Time `json:"finished"`
+	}
+	encoded := struct {
+		Commands    int      `json:"commands"`
+		OutputBytes int64    `json:"output_bytes"`
+		WallTimeMS  int64    `json:"wall_time_ms"`
+		CPUTimeMS   int64    `json:"cpu_time_ms"`
+		LastFailure *failure `json:"last_failure,omitempty"`
+	}{
+		Commands:    u.Commands,
+		OutputBytes: u.OutputBytes,
+		WallTimeMS:  u.WallTime.Milliseconds(),
+		CPUTimeMS:   u.CPUTime.Milliseconds(),
+	}
+	if f := u.LastFailure; f != nil {
+		encoded.LastFailure = &failure{Seq: f.Seq, Command: f.Command, ExitCode: f.ExitCode, TimedOut: f.TimedOut, Finished: f.Finished}
+	}
+	return json.Marshal(encoded)
+}
+
+// Usage returns the usage of every session by ID
+func (sm *Manager) Usage() map[string]Usage {
+	cpu := sm.shellCPU()
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	usage := make(map[string]Usage, len(sm.sessions))
+	for id, session := range sm.sessions {
+		usage[id] = session.usage(cpu)
+	}
+	return usage
+}
+
+// shellCPU returns the CPU time used so far by the running shell of each
+// session and the processes below it, by PID
+func (sm *Manager) shellCPU() map[int]time.Duration {
+	sm.mu.RLock()
+	pids := make([]int, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		if session.Alive() {
+			pids = append(pids, session.Pid)
+		}
+	}
+	sm.mu.RUnlock()
+
+	if len(pids) == 0 {
+		return nil
+	}
+	cpu, err := process.TreeCPU(pids...)
+	if err != nil {
+		sm.log.Warn("Failed to read the CPU time of sessions", "error", err)
+	}
+	return cpu
+}
+
+// usage sums up the session's consumption, taking the CPU time of running
+// shells from cpu. The caller must hold the manager's lock.
+func (s *ShellSession) usage(cpu map[int]time.Duration) Usage {
+	totals := s.Transcript.Totals()
+	used := s.replacedCPU
+	if s.Alive() {
+		used += cpu[s.Pid]
+	} else {
+		used += s.exitedCPU()
+	}
+	return Usage{
+		Commands:    totals.Commands,
+		OutputBytes: totals.OutputBytes,
+		WallTime:    totals.Time,
+		CPUTime:     used,
+		LastFailure: totals.LastFailure,
+	}
+}
+
+// exitedCPU returns the CPU time used by the session's shell and the
+// children it waited for, once it has exited
+func (s *ShellSession) exitedCPU() time.Duration {
+	if s.exit == nil || s.Alive() || s.exit.state == nil {
+		return 0
+	}
+	return s.exit.state.UserTime() + s.exit.state.SystemTime()
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/health"
+)
+
+// warmReadyTimeout bounds how long a warm shell may take to finish starting
+const warmReadyTimeout = 30 * time.Second
+
+// takeWarm hands out an idle shell started ahead of time for shell, or
+// returns nil when none is ready. The pool is topped up in the background.
+func (sm *Manager) takeWarm(shell string) *ShellSession {
+	sm.warmMu.Lock()
+	defer sm.warmMu.Unlock()
+
+	var taken *ShellSession
+	for len(sm.warm[shell]) > 0 && taken == nil {
+		idle := sm.warm[shell]
+		candidate := idle[len(idle)-1]
+		sm.warm[shell] = idle[:len(idle)-1]
+		if candidate.Alive() {
+			taken = candidate
+		} else {
+			candidate.terminate()
+		}
+	}
+
+	if _, pooled := sm.warm[shell]; pooled {
+		select {
+		case sm.warmRefill <- struct{}{}:
+		default:
+		}
+	}
+	return taken
+}
+
+// keepWarm starts the configured idle shells and replaces those handed out,
+// until the pool is full again each time it is woken
+func (sm *Manager) keepWarm() {
+	for range sm.warmRefill {
+		var problems []string
+		for _, ws := range sm.config.WarmShells {
+			for sm.idle(ws.Shell) < ws.Count {
+				session, err := sm.startWarm(ws.Shell)
+				if err != nil {
+					sm.log.Warn("Failed to start warm shell", "shell", ws.Shell, "error", err)
+					problems = append(problems, fmt.Sprintf("%s: %v", ws.Shell, err))
+					break
+				}
+
+				sm.warmMu.Lock()
+				sm.warm[ws.Shell] = append(sm.warm[ws.Shell], session)
+				sm.warmMu.Unlock()
+				sm.log.Debug("Started warm shell", "shell", ws.Shell, "pid", session.Pid)
+			}
+		}
+
+		if len(problems) > 0 {
+			health.SetDegraded("warm-shells", strings.Join(problems, "; "))
+		} else {
+			health.Clear("warm-shells")
+		}
+	}
+}
+
+// idle counts the warm shells ready for shell
+func (sm *Manager) idle(shell string) int {
+	sm.warmMu.Lock()
+	defer sm.warmMu.Unlock()
+
+	return len(sm.warm[shell])
+}
+
+// startWarm starts a shell and waits until it has read its startup files and
+// answers commands
+func (sm *Manager) startWarm(shell string) (*ShellSession, error) {
+	session, err := sm.startShell(shell, "", nil, sm.limiter.Defaults(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := fmt.Sprintf("MCPREADY_%d", time.Now().UnixNano())
+	if _, err := fmt.Fprintf(session.Stdin, "echo \"%s\"\n", marker); err != nil {
+		session.terminate()
+		return nil, fmt.Errorf("failed to write to shell: %v", err)
+	}
+
+	timeout := time.After(warmReadyTimeout)
+	for {
+		select {
+		case line, ok := <-session.lines.lines:
+			if !ok {
+				session.terminate()
+				return nil, fmt.Errorf("shell exited while starting")
+			}
+			if line == marker {
+				return session, nil
+			}
+		case <-timeout:
+			session.terminate()
+			return nil, fmt.Errorf("shell not ready after %s", warmReadyTimeout)
+		}
+	}
+}
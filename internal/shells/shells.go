@@ -0,0 +1,413 @@
+package shells
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// etcShells lists the login shells installed on the system
+const etcShells = "/etc/shells"
+
+// Families of shells that share a command syntax
+const (
+	FamilyPOSIX      = "posix"
+	FamilyFish       = "fish"
+	FamilyPowerShell = "powershell"
+)
+
+// families maps the base names of known shells to their family
+var families = map[string]string{
+	"sh":         FamilyPOSIX,
+	"bash":       FamilyPOSIX,
+	"rbash":      FamilyPOSIX,
+	"zsh":        FamilyPOSIX,
+	"dash":       FamilyPOSIX,
+	"ash":        FamilyPOSIX,
+	"ksh":        FamilyPOSIX,
+	"mksh":       FamilyPOSIX,
+	"yash":       FamilyPOSIX,
+	"busybox":    FamilyPOSIX,
+	"fish":       FamilyFish,
+	"pwsh":       FamilyPowerShell,
+	"powershell": FamilyPowerShell,
+}
+
+// preferred is the order in which detected shells are chosen. Only POSIX
+// shells are chosen on their own, since agents write commands in sh syntax.
+var preferred = []string{"bash", "zsh", "ksh", "mksh", "ash", "dash", "yash", "sh"}
+
+// Var is an environment variable to set in a shell
+type Var struct {
+	Name  string
+	Value string
+}
+
+// Profile describes how to drive one family of shells: how to run a single
+// command, how to start a shell reading commands from stdin, and the syntax
+// of the lines the server sends to a persistent shell besides the commands
+type Profile struct {
+	Family string
+	// commandFlag precedes a command run on its own
+	commandFlag string
+	// sessionArgs start a shell reading commands from stdin, or are nil when
+	// the shell cannot run persistent sessions over a pipe
+	sessionArgs []string
+	// scriptFlags precede the path of a script file, which must end in
+	// scriptExt
+	scriptFlags []string
+	scriptExt   string
+	// nonce is set when the shell runs the functions of Integration, and is
+	// part of every mark they print
+	nonce string
+}
+
+// profiles holds the profile of each family
+var profiles = map[string]Profile{
+	FamilyPOSIX: {Family: FamilyPOSIX, commandFlag: "-c", sessionArgs: []string{}, scriptExt: ".sh"},
+	// fish reads all of a piped stdin before running any of it
+	FamilyFish: {Family: FamilyFish, commandFlag: "-c", scriptExt: ".fish"},
+	FamilyPowerShell: {Family: FamilyPowerShell, commandFlag: "-Command", sessionArgs: []string{"-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "-"},
+		scriptFlags: []string{"-NoLogo", "-NoProfile", "-NonInteractive", "-File"}, scriptExt: ".ps1"},
+}
+
+// family returns the family of the shell at path from its base name, ignoring
+// a version suffix as in "bash5.2" or "pwsh-preview", or "" for unknown shells
+func family(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	name = strings.TrimSuffix(name, ".exe")
+	if f, ok := families[name]; ok {
+		return f
+	}
+	name, _, _ = strings.Cut(name, "-")
+	return families[strings.TrimRight(name, "0123456789.")]
+}
+
+// For returns the profile of a shell. Shells of unknown families are driven
+// like POSIX shells.
+func For(shell string) Profile {
+	if f := family(shell); f != "" {
+		return profiles[f]
+	}
+	return profiles[FamilyPOSIX]
+}
+
+// Validate checks a shell requested for a command or session: it must be a
+// known shell and installed as an executable. It returns the shell's path.
+func Validate(shell string) (string, error) {
+	if family(shell) == "" {
+		return "", fmt.Errorf("unsupported shell %q; supported shells are bash, zsh, ksh, sh, dash, ash, fish and pwsh", shell)
+	}
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return "", fmt.Errorf("shell %q is not installed: %v", shell, err)
+	}
+	return path, nil
+}
+
+// Detect picks the shell commands run with when none is configured: the
+// user's $SHELL if it is a POSIX shell, otherwise the first installed of the
+// preferred shells, looking in /etc/shells and then on the PATH. Systems such
+// as Alpine containers have no bash, so it cannot be assumed. /bin/sh is the
+// last resort.
+func Detect() string {
+	if shell := os.Getenv("SHELL"); family(shell) == FamilyPOSIX && executable(shell) {
+		return shell
+	}
+
+	listed := listedShells()
+	for _, name := range preferred {
+		for _, path := range listed {
+			if filepath.Base(path) == name && executable(path) {
+				return path
+			}
+		}
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return "/bin/sh"
+}
+
+// listedShells reads the absolute paths in /etc/shells
+func listedShells() []string {
+	f, err := os.Open(etcShells)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "/") && !slices.Contains(paths, line) {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// executable reports whether path is an executable file
+func executable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// CommandArgs returns the arguments that run command on its own
+func (p Profile) CommandArgs(command string) []string {
+	return []string{p.commandFlag, command}
+}
+
+// ScriptArgs returns the arguments that run the script file at path
+func (p Profile) ScriptArgs(path string) []string {
+	return append(slices.Clone(p.scriptFlags), path)
+}
+
+// ScriptExt returns the extension script files for the shell are given,
+// which PowerShell insists on
+func (p Profile) ScriptExt() string {
+	return p.scriptExt
+}
+
+// SessionArgs returns the arguments that start a persistent shell reading
+// commands from stdin, or an error when the shell cannot be driven that way
+func (p Profile) SessionArgs() ([]string, error) {
+	if p.sessionArgs == nil {
+		return nil, fmt.Errorf("%s shells cannot run persistent sessions; use a POSIX shell such as bash", p.Family)
+	}
+	return p.sessionArgs, nil
+}
+
+// Done returns the line that prints Token(marker, "DONE:") followed by the
+// exit status of the previous command and the working directory, separated by
+// a colon. The marker is split in two quoted parts so that a terminal echoing
+// the line never shows it literally.
+func (p Profile) Done(marker string) string {
+	if p.nonce != "" {
+		return "__mcp_done " + marker
+	}
+	switch p.Family {
+	case FamilyFish:
+		return fmt.Sprintf("echo \"%s_\"\"DONE:$status:$PWD\"", marker)
+	case FamilyPowerShell:
+		return fmt.Sprintf("\"%s_\" + \"DONE:$(if ($?) { 0 } elseif ($LASTEXITCODE) { $LASTEXITCODE } else { 1 }):$PWD\"", marker)
+	}
+	return fmt.Sprintf("echo \"%s_\"\"DONE:$?:$PWD\"", marker)
+}
+
+// Mark returns the line that prints Token(marker, label), split like the line
+// of Done so that a terminal echoing it never shows it literally
+func (p Profile) Mark(marker, label string) string {
+	if p.nonce != "" {
+		return "__mcp_mark " + marker + " " + label
+	}
+	if p.Family == FamilyPowerShell {
+		return fmt.Sprintf("\"%s_\" + \"%s\"", marker, label)
+	}
+	return fmt.Sprintf("echo \"%s_\"\"%s\"", marker, label)
+}
+
+// Start returns the line that marks where the output of a command begins, or
+// "" when the shell is not integrated
+func (p Profile) Start(marker string) string {
+	if p.nonce == "" {
+		return ""
+	}
+	return "__mcp_start " + marker
+}
+
+// Token returns what the lines of Mark and Done print for marker and label
+func (p Profile) Token(marker, label string) string {
+	if p.nonce != "" {
+		return marker + "_" + p.nonce + "_" + label
+	}
+	return marker + "_" + label
+}
+
+// ParseDone finds the mark the line of Done printed for marker in line. It
+// returns the output before the mark, which a command may leave without a
+// final newline, the exit status (-1 if unreadable) and the working directory.
+func (p Profile) ParseDone(line, marker string) (before string, status int, cwd string, ok bool) {
+	token := p.Token(marker, "DONE:")
+	i := strings.Index(line, token)
+	if i < 0 {
+		return "", 0, "", false
+	}
+	before = line[:i]
+	if p.nonce != "" {
+		before = strings.TrimSuffix(before, promptEnd.FindString(before))
+	}
+	statusStr, cwd, _ := strings.Cut(line[i+len(token):], ":")
+	status, err := strconv.Atoi(statusStr)
+	if err != nil {
+		status = -1
+	}
+	return before, status, cwd, true
+}
+
+// Integrated returns the profile of a shell that runs the functions of
+// Integration, whose marks carry nonce so no output can pass for them. Only
+// POSIX shells are integrated; the profiles of others are returned as they are.
+func (p Profile) Integrated(nonce string) Profile {
+	if p.Family == FamilyPOSIX {
+		p.nonce = nonce
+	}
+	return p
+}
+
+// promptEnd matches the OSC 133 sequence that tells terminals a command ended,
+// which the integration prints ahead of the mark of Done
+var promptEnd = regexp.MustCompile("\x1b\\]133;D;-?[0-9]*\x07$")
+
+// Integration returns the lines that define the functions an integrated shell
+// prints its marks with, or "" when it is not integrated. They frame commands
+// with OSC 133 sequences, as terminals do for shell integration, read the exit
+// status before anything else can change it, and print with the printf
+// builtin, so aliases or functions a command defines, such as one named echo,
+// do not get in the way.
+func (p Profile) Integration() string {
+	if p.nonce == "" {
+		return ""
+	}
+	return strings.Join([]string{
+		`__mcp_start() { command printf '\033]133;C\007%s_` + p.nonce + `_START\n' "$1"; }`,
+		`__mcp_done() { __mcp_status=$?; command printf '\033]133;D;%s\007%s_` + p.nonce + `_DONE:%s:%s\n' "$__mcp_status" "$1" "$__mcp_status" "$PWD"; return $__mcp_status; }`,
+		`__mcp_mark() { command printf '%s_` + p.nonce + `_%s\n' "$1" "$2"; }`,
+	}, "\n")
+}
+
+// Nonce returns the nonce the marks of an integrated shell carry, or ""
+func (p Profile) Nonce() string {
+	return p.nonce
+}
+
+// Export returns the line that sets and exports vars
+func (p Profile) Export(vars ...Var) string {
+	parts := make([]string, len(vars))
+	for i, v := range vars {
+		switch p.Family {
+		case FamilyFish:
+			parts[i] = "set -gx " + v.Name + " " + p.Quote(v.Value)
+		case FamilyPowerShell:
+			parts[i] = "$env:" + v.Name + " = " + p.Quote(v.Value)
+		default:
+			parts[i] = v.Name + "=" + p.Quote(v.Value)
+		}
+	}
+
+	switch p.Family {
+	case FamilyFish, FamilyPowerShell:
+		return strings.Join(parts, "; ")
+	}
+	return "export " + strings.Join(parts, " ")
+}
+
+// Quote makes value a single word of the shell's syntax
+func (p Profile) Quote(value string) string {
+	switch p.Family {
+	case FamilyFish:
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+	case FamilyPowerShell:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// plainWord matches words every shell reads literally, which need no quotes
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Join builds a command line that runs words as the argument vector, without
+// the shell expanding, splitting or interpreting any of them. Words that are
+// not plain ASCII are quoted, so spaces, unicode and metacharacters in file
+// names and arguments arrive unchanged.
+func (p Profile) Join(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = word
+		if !plainWord.MatchString(word) {
+			quoted[i] = p.Quote(word)
+		}
+	}
+
+	line := strings.Join(quoted, " ")
+	// PowerShell reads a quoted program name as a string, not a command
+	if p.Family == FamilyPowerShell && len(words) > 0 && quoted[0] != words[0] {
+		line = "& " + line
+	}
+	return line
+}
+
+// Unset returns the line that removes names from the environment
+func (p Profile) Unset(names ...string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		switch p.Family {
+		case FamilyFish:
+			parts[i] = "set -e " + name
+		case FamilyPowerShell:
+			parts[i] = "Remove-Item Env:" + name + " -ErrorAction SilentlyContinue"
+		default:
+			return "unset " + strings.Join(names, " ")
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// envNewline stands in for newlines in the values PrintEnv prints, so each
+// variable is printed on one line
+const envNewline = "\x01"
+
+// PrintEnv returns the line that prints the exported environment as one
+// NAME=value line per variable, to be read back with ParseEnv
+func (p Profile) PrintEnv() string {
+	if p.Family == FamilyPowerShell {
+		return "Get-ChildItem Env: | ForEach-Object { $_.Name + '=' + ($_.Value -replace \"`r?`n\", [string][char]1) }"
+	}
+	// awk sees exactly the variables the shell exports, whatever the shell
+	return `awk 'BEGIN { for (k in ENVIRON) { v = ENVIRON[k]; gsub(/\n/, "\001", v); print k "=" v } }'`
+}
+
+// ParseEnv reads the output of PrintEnv
+func ParseEnv(lines []string) map[string]string {
+	env := make(map[string]string, len(lines))
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || name == "" || name == "_" {
+			continue
+		}
+		env[name] = strings.ReplaceAll(value, envNewline, "\n")
+	}
+	return env
+}
+
+// validName matches the environment variable names every shell can set
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidName reports whether name can be set as an environment variable
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// SavesEnv reports whether the shell can save its exported environment with
+// SaveEnv and load it back with LoadEnv
+func (p Profile) SavesEnv() bool {
+	return p.Family == FamilyPOSIX
+}
+
+// SaveEnv returns the line that saves the exported environment to path
+func (p Profile) SaveEnv(path string) string {
+	return "export -p > " + p.Quote(path) + " 2>/dev/null"
+}
+
+// LoadEnv returns the line that loads an environment saved by SaveEnv
+func (p Profile) LoadEnv(path string) string {
+	return ". " + p.Quote(path) + " 2>/dev/null"
+}
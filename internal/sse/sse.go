@@ -0,0 +1,718 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/logging"
+)
+
+// heartbeatInterval keeps idle streams open through proxies
+const heartbeatInterval = 15 * time.Second
+
+// maxBatch bounds how many ready events are written before a flush
+const maxBatch = 64
+
+// DefaultQueueSize is how many events of one topic a subscriber may fall
+// behind before its policy applies
+const DefaultQueueSize = 256
+
+// Policy says what happens when a subscriber falls a full queue behind on a topic
+type Policy string
+
+const (
+	// DropNewest drops events that arrive while the queue is full
+	DropNewest Policy = "drop-newest"
+	// DropOldest drops the oldest queued event to make room, so the client
+	// keeps up with the latest
+	DropOldest Policy = "drop-oldest"
+	// Coalesce merges output lines into the output event queued before them,
+	// dropping events only when nothing can be merged
+	Coalesce Policy = "coalesce"
+	// Disconnect drops everything queued for the topic and ends the stream,
+	// so the client reconnects and catches up from the replay buffer
+	Disconnect Policy = "disconnect"
+)
+
+// ParsePolicy reads a policy name
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case DropNewest, DropOldest, Coalesce, Disconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown lag policy %q (use drop-newest, drop-oldest, coalesce or disconnect)", name)
+}
+
+// Event is one server-sent event
+type Event struct {
+	// ID increases by one with every event published on a topic; it is
+	// assigned by Publish along with Topic
+	ID    uint64
+	Topic string
+	Type  string
+	Data  interface{}
+}
+
+// Subscription selects the events a subscriber receives
+type Subscription struct {
+	// Topics to follow, or nil for every topic, including ones created later
+	Topics []string
+	// Types of event to receive, or nil for all
+	Types []string
+	// Cursor is the last event seen on each topic by a reconnecting client.
+	// Buffered events after it are delivered first; nil skips the replay.
+	Cursor Cursor
+	// Policy applies when the subscriber falls behind ("" for the broadcaster's)
+	Policy Policy
+}
+
+// subscriber is one subscription's filters and event queues. Each topic it
+// follows has its own bounded queue, and a pump feeds the queues into the
+// subscriber's channel in turn. A slow client therefore holds back every topic
+// equally, and a topic that overflows loses only its own events.
+type subscriber struct {
+	ch chan Event
+	// topics is nil for subscribers to every topic
+	topics map[string]bool
+	// types is nil when every type is wanted
+	types map[string]bool
+	// limit is the length of each queue, and policy what happens beyond it
+	limit  int
+	policy Policy
+
+	mu     sync.Mutex
+	queues map[string]*queue
+	// order is the round-robin order of queues; turn is the next one to serve
+	order []string
+	turn  int
+	// ready wakes the pump when an event is queued or the subscriber closes
+	ready chan struct{}
+	// stop ends the pump without draining, when the client has gone
+	stop     chan struct{}
+	stopOnce sync.Once
+	closed   bool
+	// total counts the events the subscriber lost over its lifetime
+	total int
+}
+
+// queue holds a subscriber's pending events of one topic
+type queue struct {
+	events []Event
+	// dropped counts events lost to overflow since the client was last told,
+	// from firstDropped to lastDropped
+	dropped      int
+	firstDropped uint64
+	lastDropped  uint64
+}
+
+// newSubscriber creates a subscriber, with its pump not yet started
+func newSubscriber(limit int, policy Policy) *subscriber {
+	return &subscriber{
+		ch:     make(chan Event),
+		limit:  limit,
+		policy: policy,
+		queues: make(map[string]*queue),
+		ready:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// wants reports whether the subscriber's type filter lets an event through
+func (s *subscriber) wants(event Event) bool {
+	return s.types == nil || s.types[event.Type]
+}
+
+// queue returns the queue of a topic, creating it if needed. The caller must hold s.mu.
+func (s *subscriber) queue(name string) *queue {
+	q, ok := s.queues[name]
+	if !ok {
+		q = &queue{}
+		s.queues[name] = q
+		s.order = append(s.order, name)
+	}
+	return q
+}
+
+// push queues an event, applying the subscriber's policy when its topic's
+// queue is full. It reports whether the event was queued, on its own or merged
+// into another. Replayed events are queued regardless of the limit, since the
+// client asked for them.
+func (s *subscriber) push(event Event, replay bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	q := s.queue(event.Topic)
+	queued := true
+	switch {
+	case replay || len(q.events) < s.limit:
+		q.events = append(q.events, event)
+	case s.policy == DropOldest:
+		s.drop(q, q.events[0])
+		q.events[0] = Event{}
+		q.events = append(q.events[1:], event)
+	case s.policy == Coalesce && q.coalesce(event):
+	case s.policy == Disconnect:
+		// The client can only catch up by reconnecting, so what is queued
+		// for the topic would be sent in vain
+		for _, dropped := range q.events {
+			s.drop(q, dropped)
+		}
+		s.drop(q, event)
+		q.events = nil
+		s.closed = true
+		queued = false
+	default:
+		s.drop(q, event)
+		queued = false
+	}
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+	return queued
+}
+
+// drop records an event of q as lost. The caller must hold s.mu.
+func (s *subscriber) drop(q *queue, event Event) {
+	if q.dropped == 0 {
+		q.firstDropped = event.ID
+	}
+	q.dropped++
+	q.lastDropped = event.ID
+	s.total++
+}
+
+// coalesce makes room for an event in a full queue by merging output lines.
+// An output line joins the output event queued last; any other event frees a
+// place by merging the first two adjacent output events. It reports false
+// when there was nothing to merge. A merged event takes the later event's ID,
+// so a client that reconnects resumes after both.
+func (q *queue) coalesce(event Event) bool {
+	if line, ok := event.Data.(events.Output); ok {
+		last := &q.events[len(q.events)-1]
+		if merged, ok := mergeOutput(last.Data, line); ok {
+			last.ID, last.Data = event.ID, merged
+			return true
+		}
+		return false
+	}
+
+	for i := 0; i+1 < len(q.events); i++ {
+		later, ok := q.events[i+1].Data.(events.Output)
+		if !ok {
+			continue
+		}
+		if merged, ok := mergeOutput(q.events[i].Data, later); ok {
+			q.events[i].ID, q.events[i].Data = q.events[i+1].ID, merged
+			q.events = append(slices.Delete(q.events, i+1, i+2), event)
+			return true
+		}
+	}
+	return false
+}
+
+// mergeOutput joins an output line to the output event data before it,
+// keeping the earlier line's timing
+func mergeOutput(data interface{}, line events.Output) (events.Output, bool) {
+	earlier, ok := data.(events.Output)
+	if !ok {
+		return events.Output{}, false
+	}
+	earlier.Line += "\n" + line.Line
+	return earlier, true
+}
+
+// next takes the next event to send, serving topics in turn. A topic that lost
+// events first yields a "lagged" event saying which, and how many the
+// subscriber has lost in all. It reports false when nothing is pending.
+func (s *subscriber) next() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.order) > 0 {
+		s.turn %= len(s.order)
+		name := s.order[s.turn]
+		q := s.queues[name]
+
+		var event Event
+		switch {
+		case q.dropped > 0:
+			event = Event{Topic: name, Type: events.TypeLagged, Data: events.Lagged{
+				Version:      events.Version,
+				Dropped:      q.dropped,
+				FirstDropped: q.firstDropped,
+				LastDropped:  q.lastDropped,
+				TotalDropped: s.total,
+				Policy:       string(s.policy),
+			}}
+			q.dropped = 0
+		case len(q.events) > 0:
+			event = q.events[0]
+			q.events[0] = Event{}
+			q.events = q.events[1:]
+		default:
+			// Drained queues are removed so closed topics are not kept around
+			delete(s.queues, name)
+			s.order = slices.Delete(s.order, s.turn, s.turn+1)
+			continue
+		}
+
+		s.turn++
+		return event, true
+	}
+	return Event{}, false
+}
+
+// pump feeds queued events into the subscriber's channel, blocking while the
+// client is busy. Once the subscriber is closed the remaining events are sent
+// and the channel is closed; a stopped subscriber's channel closes at once.
+func (s *subscriber) pump() {
+	defer close(s.ch)
+
+	for {
+		event, ok := s.next()
+		if !ok {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return
+			}
+
+			select {
+			case <-s.ready:
+			case <-s.stop:
+				return
+			}
+			continue
+		}
+
+		select {
+		case s.ch <- event:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// close ends the subscription after the queued events are sent
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// topic holds a topic's subscribers and its most recent events, kept in a ring
+// so clients that reconnect can catch up on what they missed
+type topic struct {
+	subs   map[*subscriber]struct{}
+	lastID uint64
+	ring   []Event
+	// next is where the ring's next event goes; ring[next] is the oldest once it is full
+	next int
+	full bool
+}
+
+// since returns the buffered events after lastID, oldest first, and whether
+// any events after lastID have already been overwritten
+func (t *topic) since(lastID uint64) ([]Event, bool) {
+	if lastID >= t.lastID {
+		return nil, false
+	}
+
+	var buffered []Event
+	if t.full {
+		buffered = append(buffered, t.ring[t.next:]...)
+	}
+	buffered = append(buffered, t.ring[:t.next]...)
+
+	var events []Event
+	for _, event := range buffered {
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	missed := len(events) == 0 || events[0].ID > lastID+1
+	return events, missed
+}
+
+// Broadcaster fans out events published on a topic to its subscribers
+type Broadcaster struct {
+	mu     sync.Mutex
+	topics map[string]*topic
+	// wildcard holds the subscribers to every topic
+	wildcard map[*subscriber]struct{}
+	replay   int
+	// queueSize and policy are the defaults of subscribers falling behind
+	queueSize int
+	policy    Policy
+	log       *slog.Logger
+}
+
+// NewBroadcaster creates an empty broadcaster keeping the last replay events
+// of each topic for clients that reconnect (0 disables replay). Subscribers may
+// fall queueSize events behind on a topic (DefaultQueueSize if not positive)
+// before policy applies, unless they chose another.
+func NewBroadcaster(replay, queueSize int, policy Policy) *Broadcaster {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	if policy == "" {
+		policy = DropNewest
+	}
+	return &Broadcaster{
+		topics:    make(map[string]*topic),
+		wildcard:  make(map[*subscriber]struct{}),
+		replay:    replay,
+		queueSize: queueSize,
+		policy:    policy,
+		log:       logging.For("sse"),
+	}
+}
+
+// topic returns the named topic, creating it if needed. The caller must hold b.mu.
+func (b *Broadcaster) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{
+			subs: make(map[*subscriber]struct{}),
+			ring: make([]Event, b.replay),
+		}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// backlog returns the buffered events of a topic after lastID that s wants. If
+// some of them are no longer buffered, a "reset" event carrying the oldest one
+// available comes first so the client knows to reload its state.
+func backlog(name string, t *topic, lastID uint64, s *subscriber) []Event {
+	buffered, missed := t.since(lastID)
+
+	var wanted []Event
+	if missed {
+		oldest := t.lastID + 1
+		if len(buffered) > 0 {
+			oldest = buffered[0].ID
+		}
+		wanted = append(wanted, Event{Topic: name, Type: events.TypeReset, Data: events.Reset{
+			Version:         events.Version,
+			LastEventID:     lastID,
+			OldestAvailable: oldest,
+		}})
+	}
+	for _, event := range buffered {
+		if s.wants(event) {
+			wanted = append(wanted, event)
+		}
+	}
+	return wanted
+}
+
+// Subscribe returns a channel receiving the events selected by sub and a
+// function that ends the subscription. Filtering happens here, so events a
+// subscriber does not want never reach its channel. The channel is closed when
+// the function is called or every topic followed has been closed.
+func (b *Broadcaster) Subscribe(sub Subscription) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	policy := sub.Policy
+	if policy == "" {
+		policy = b.policy
+	}
+	s := newSubscriber(b.queueSize, policy)
+	if len(sub.Types) > 0 {
+		s.types = make(map[string]bool)
+		for _, t := range sub.Types {
+			s.types[t] = true
+		}
+	}
+
+	var replayed []Event
+	if sub.Topics == nil {
+		if sub.Cursor != nil {
+			names := make([]string, 0, len(b.topics))
+			for name := range b.topics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				replayed = append(replayed, backlog(name, b.topics[name], sub.Cursor[name], s)...)
+			}
+		}
+		b.wildcard[s] = struct{}{}
+	} else {
+		s.topics = make(map[string]bool)
+		for _, name := range sub.Topics {
+			t := b.topic(name)
+			if sub.Cursor != nil && !s.topics[name] {
+				replayed = append(replayed, backlog(name, t, sub.Cursor[name], s)...)
+			}
+			t.subs[s] = struct{}{}
+			s.topics[name] = true
+		}
+	}
+
+	for _, event := range replayed {
+		s.push(event, true)
+	}
+	go s.pump()
+	b.log.Debug("Subscribed", "topics", sub.Topics, "types", sub.Types, "policy", policy, "replayed", len(replayed))
+
+	return s.ch, func() {
+		s.stopOnce.Do(func() { close(s.stop) })
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.wildcard, s)
+		for name := range s.topics {
+			if t, ok := b.topics[name]; ok {
+				delete(t.subs, s)
+			}
+		}
+		s.close()
+		s.mu.Lock()
+		dropped := s.total
+		s.mu.Unlock()
+		if dropped > 0 {
+			b.log.Info("Slow subscriber lost events", "topics", sub.Topics, "policy", policy, "dropped", dropped)
+		}
+		b.log.Debug("Unsubscribed", "topics", sub.Topics)
+	}
+}
+
+// Publish numbers an event, buffers it for replay and sends it to every
+// subscriber that wants it. Subscribers that are too far behind on the topic
+// lose events by their policy rather than blocking the publisher.
+func (b *Broadcaster) Publish(name string, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(name)
+	t.lastID++
+	event.ID = t.lastID
+	event.Topic = name
+
+	if len(t.ring) > 0 {
+		t.ring[t.next] = event
+		t.next = (t.next + 1) % len(t.ring)
+		if t.next == 0 {
+			t.full = true
+		}
+	}
+
+	for s := range t.subs {
+		b.deliver(s, event)
+	}
+	for s := range b.wildcard {
+		b.deliver(s, event)
+	}
+}
+
+// deliver sends an event to a subscriber if it wants it, without blocking.
+// The caller must hold b.mu.
+func (b *Broadcaster) deliver(s *subscriber, event Event) {
+	if !s.wants(event) {
+		return
+	}
+	if !s.push(event, false) {
+		b.log.Debug("Dropped event for slow subscriber", "topic", event.Topic, "event", event.Type, "policy", s.policy)
+	}
+}
+
+// Close discards a topic's buffered events and ends the subscriptions that
+// follow only it. Subscribers to other topics stay connected.
+func (b *Broadcaster) Close(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[name]
+	if !ok {
+		return
+	}
+	for s := range t.subs {
+		delete(s.topics, name)
+		if len(s.topics) == 0 {
+			s.close()
+		}
+	}
+	if len(t.subs) > 0 {
+		b.log.Debug("Closed topic", "topic", name, "subscribers", len(t.subs))
+	}
+	delete(b.topics, name)
+}
+
+// Cursor records the last event ID a client has seen on each topic
+type Cursor map[string]uint64
+
+// String encodes the cursor as comma-separated "topic:id" pairs
+func (c Cursor) String() string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s:%d", url.PathEscape(name), c[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ParseCursor decodes an event ID sent back by a reconnecting client. Streams
+// of a single topic use plain numbers, which apply to defaultTopic; streams of
+// several topics use the form written by Cursor.String. An empty or malformed
+// value returns nil.
+func ParseCursor(value, defaultTopic string) Cursor {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		if defaultTopic == "" {
+			return nil
+		}
+		return Cursor{defaultTopic: id}
+	}
+
+	cursor := make(Cursor)
+	for _, pair := range strings.Split(value, ",") {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return nil
+		}
+		name, err := url.PathUnescape(pair[:i])
+		if err != nil {
+			return nil
+		}
+		id, err := strconv.ParseUint(pair[i+1:], 10, 64)
+		if err != nil {
+			return nil
+		}
+		cursor[name] = id
+	}
+	return cursor
+}
+
+// Serve streams events to an HTTP client until the channel is closed or the
+// client disconnects. Numbered events carry an "id:" line, so browsers send it
+// back as Last-Event-ID when they reconnect. With a nil cursor the stream is
+// of one topic: IDs are plain numbers and data is sent as published. Otherwise
+// each ID is the updated cursor and data is wrapped as {"topic": ..., "data": ...}.
+func Serve(w http.ResponseWriter, r *http.Request, events <-chan Event, cursor Cursor) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, event, cursor)
+
+			// Events already waiting go out in the same flush
+			open := drain(w, events, cursor)
+			flusher.Flush()
+			if !open {
+				return
+			}
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one event in the format described for Serve
+func writeEvent(w io.Writer, event Event, cursor Cursor) {
+	var payload interface{} = event.Data
+	if cursor != nil {
+		payload = map[string]interface{}{"topic": event.Topic, "data": event.Data}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	if event.ID > 0 {
+		if cursor != nil {
+			cursor[event.Topic] = event.ID
+			fmt.Fprintf(w, "id: %s\n", cursor)
+		} else {
+			fmt.Fprintf(w, "id: %d\n", event.ID)
+		}
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+// drain writes up to maxBatch events that are ready without waiting. It
+// reports false once the channel is closed.
+func drain(w io.Writer, events <-chan Event, cursor Cursor) bool {
+	for i := 0; i < maxBatch; i++ {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			writeEvent(w, event, cursor)
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+// LastEventID returns the event ID a reconnecting client has seen, from the
+// Last-Event-ID header or, for clients that cannot set headers, the
+// last_event_id query parameter
+func LastEventID(r *http.Request) string {
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		return value
+	}
+	return r.URL.Query().Get("last_event_id")
+}
@@ -0,0 +1,256 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/shells"
+)
+
+// Parameter types a template may declare
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+)
+
+// placeholder matches a parameter reference in a command template, {{name}}
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// toolName matches the names templates may be exposed under
+var toolName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Param describes one argument of a template
+type Param struct {
+	// Type is "string", "number", "integer" or "boolean" (empty = "string")
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	// Default is used when the argument is not given; a parameter that is
+	// not required must have one
+	Default interface{} `json:"default,omitempty"`
+	// Enum lists the allowed values of a string parameter
+	Enum []string `json:"enum,omitempty"`
+	// Pattern is a regular expression a string argument must match in full
+	Pattern string `json:"pattern,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Template is a command exposed as a tool of its own, such as deploy_staging
+type Template struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Params      map[string]Param `json:"params,omitempty"`
+	// Command is the command line, with {{name}} replaced by the argument of
+	// parameter name, quoted so the shell reads it as one literal word
+	Command string `json:"command"`
+	// Cwd, Shell and Timeout (seconds) are how the command is run (optional)
+	Cwd     string  `json:"cwd,omitempty"`
+	Shell   string  `json:"shell,omitempty"`
+	Timeout float64 `json:"timeout,omitempty"`
+}
+
+// file is the layout of the tools file
+type file struct {
+	Tools []Template `json:"tools"`
+}
+
+// Load reads the templates of the tools file at path (none when path is empty)
+func Load(path string) ([]Template, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range f.Tools {
+		t := &f.Tools[i]
+		if err := t.compile(); err != nil {
+			return nil, fmt.Errorf("tool %q: %v", t.Name, err)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("tool %q is defined twice", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return f.Tools, nil
+}
+
+// compile validates a template and prepares its parameters
+func (t *Template) compile() error {
+	if !toolName.MatchString(t.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits and underscores")
+	}
+	if strings.TrimSpace(t.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if t.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if t.Shell != "" {
+		if _, err := shells.Validate(t.Shell); err != nil {
+			return err
+		}
+	}
+
+	for name, p := range t.Params {
+		if p.Type == "" {
+			p.Type = TypeString
+		}
+		if !slices.Contains([]string{TypeString, TypeNumber, TypeInteger, TypeBoolean}, p.Type) {
+			return fmt.Errorf("parameter %s: unknown type %q", name, p.Type)
+		}
+		if (len(p.Enum) > 0 || p.Pattern != "") && p.Type != TypeString {
+			return fmt.Errorf("parameter %s: enum and pattern only apply to strings", name)
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("parameter %s: invalid pattern: %v", name, err)
+			}
+			p.re = re
+		}
+		if !p.Required {
+			if p.Default == nil {
+				return fmt.Errorf("parameter %s: give a default or make it required", name)
+			}
+			if _, err := p.format(p.Default); err != nil {
+				return fmt.Errorf("parameter %s: invalid default: %v", name, err)
+			}
+		}
+		t.Params[name] = p
+	}
+
+	for _, m := range placeholder.FindAllStringSubmatch(t.Command, -1) {
+		if _, ok := t.Params[m[1]]; !ok {
+			return fmt.Errorf("command uses {{%s}}, which is not a parameter", m[1])
+		}
+	}
+	return nil
+}
+
+// Tool returns the MCP tool the template is exposed as
+func (t Template) Tool() mcp.Tool {
+	description := t.Description
+	if description == "" {
+		description = "Run: " + t.Command
+	}
+	opts := []mcp.ToolOption{mcp.WithDescription(description)}
+
+	names := make([]string, 0, len(t.Params))
+	for name := range t.Params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		p := t.Params[name]
+		var props []mcp.PropertyOption
+		if p.Description != "" {
+			props = append(props, mcp.Description(p.Description))
+		}
+		if p.Required {
+			props = append(props, mcp.Required())
+		}
+		switch p.Type {
+		case TypeBoolean:
+			if def, ok := p.Default.(bool); ok {
+				props = append(props, mcp.DefaultBool(def))
+			}
+			opts = append(opts, mcp.WithBoolean(name, props...))
+		case TypeNumber, TypeInteger:
+			if def, ok := p.Default.(float64); ok {
+				props = append(props, mcp.DefaultNumber(def))
+			}
+			opts = append(opts, mcp.WithNumber(name, props...))
+		default:
+			if def, ok := p.Default.(string); ok {
+				props = append(props, mcp.DefaultString(def))
+			}
+			if len(p.Enum) > 0 {
+				props = append(props, mcp.Enum(p.Enum...))
+			}
+			if p.Pattern != "" {
+				props = append(props, mcp.Pattern("^(?:"+p.Pattern+")$"))
+			}
+			opts = append(opts, mcp.WithString(name, props...))
+		}
+	}
+
+	return mcp.NewTool(t.Name, opts...)
+}
+
+// Render builds the command line for a call, quoting every argument for
+// profile so that no argument can add to or change the command
+func (t Template) Render(args map[string]interface{}, profile shells.Profile) (string, error) {
+	values := make(map[string]string, len(t.Params))
+	for name, p := range t.Params {
+		value, ok := args[name]
+		if !ok || value == nil {
+			if p.Required {
+				return "", fmt.Errorf("%s is required", name)
+			}
+			value = p.Default
+		}
+		text, err := p.format(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		values[name] = text
+	}
+
+	return placeholder.ReplaceAllStringFunc(t.Command, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		return profile.Quote(values[name])
+	}), nil
+}
+
+// format checks an argument against the parameter and returns it as text
+func (p Param) format(value interface{}) (string, error) {
+	switch p.Type {
+	case TypeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("must be a boolean")
+		}
+		return strconv.FormatBool(b), nil
+
+	case TypeNumber, TypeInteger:
+		n, ok := value.(float64)
+		if !ok {
+			return "", fmt.Errorf("must be a number")
+		}
+		if p.Type == TypeInteger && n != float64(int64(n)) {
+			return "", fmt.Errorf("must be an integer")
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("must be a string")
+	}
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+		return "", fmt.Errorf("must be one of %s", strings.Join(p.Enum, ", "))
+	}
+	if p.re != nil && !p.re.MatchString(s) {
+		return "", fmt.Errorf("must match %s", p.Pattern)
+	}
+	return s, nil
+}
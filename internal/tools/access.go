@@ -0,0 +1,28 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/access"
+)
+
+// authorize refuses a call on a session owned by another client, returning
+// the result to send back, or nil when the caller may use the session
+func (r *Registry) authorize(ctx context.Context, args map[string]interface{}, sessionID string) *mcp.CallToolResult {
+	token, _ := args["owner_token"].(string)
+	if err := r.sessionManager.Authorize(sessionID, access.Client(ctx), token, access.IsAdmin(ctx)); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Access denied: %v", err))
+	}
+	return nil
+}
+
+// ownerTokenText tells the creator of a session how to use it from another connection
+func (r *Registry) ownerTokenText(sessionID string) (mcp.Content, bool) {
+	token, err := r.sessionManager.OwnerToken(sessionID)
+	if err != nil {
+		return nil, false
+	}
+	return mcp.NewTextContent(fmt.Sprintf("Owner token for session %s: %s (pass as owner_token to use this session from another connection)", sessionID, token)), true
+}
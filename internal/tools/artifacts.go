@@ -0,0 +1,266 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/artifact"
+	"mcp-terminal-server/internal/profiles"
+)
+
+// maxDetectedArtifacts bounds the files detect_artifacts keeps from one command
+const maxDetectedArtifacts = 20
+
+// withArtifacts adds the artifacts and detect_artifacts parameters, which
+// keep files a command produces in the artifact store
+func withArtifacts() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithArray("artifacts",
+			mcp.Description("Files the command produces to keep as downloadable artifacts once it finishes, as paths or glob patterns relative to the directory it starts in, e.g. ['dist/*.tar.gz', 'coverage/**/*.html'] (optional)"),
+			mcp.WithStringItems(),
+		)(t)
+		mcp.WithBoolean("detect_artifacts",
+			mcp.Description(fmt.Sprintf("Keep the files the command creates or changes under the directory it starts in as artifacts, at most %d, leaving out hidden directories and dependency caches such as node_modules (optional, defaults to false)", maxDetectedArtifacts)),
+		)(t)
+	}
+}
+
+// artifactTools builds the artifacts tool
+func (r *Registry) artifactTools() []server.ServerTool {
+	artifactsTool := mcp.NewTool("artifacts",
+		mcp.WithDescription("Manage files kept as artifacts: those your commands produced, kept with their 'artifacts' or 'detect_artifacts' parameters, and binary output too large to return. Artifacts outlive the session that produced them until they expire, and can be downloaded over HTTP from /artifacts/{id}"),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action: 'list' to show your artifacts (every artifact for administrators), 'info' to describe one, 'delete' to remove one before it expires"),
+			mcp.Enum("list", "info", "delete"),
+		),
+		mcp.WithString("id",
+			mcp.Description("Artifact ID (required for 'info' and 'delete')"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: artifactsTool, Handler: r.handleArtifacts},
+	}
+}
+
+// handleArtifacts handles listing, describing and deleting artifacts
+func (r *Registry) handleArtifacts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	action, _ := args["action"].(string)
+	client, admin := access.Client(ctx), access.IsAdmin(ctx)
+
+	if action == "list" {
+		artifacts := r.artifacts.List(client, admin)
+		if len(artifacts) == 0 {
+			return mcp.NewToolResultText("No artifacts"), nil
+		}
+		var result strings.Builder
+		fmt.Fprintf(&result, "%d artifact(s), newest first:\n", len(artifacts))
+		for _, a := range artifacts {
+			result.WriteString("- " + r.describeArtifact(a) + "\n")
+		}
+		return mcp.NewToolResultText(result.String()), nil
+	}
+
+	id, _ := args["id"].(string)
+	if id == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("Artifact ID is required for %s action", action)), nil
+	}
+	a, err := r.artifacts.Get(id)
+	// Other clients' artifacts are as good as missing; binary output has no
+	// owner, so its ID is all it takes, as for downloading it
+	if err == nil && !admin && a.Owner != "" && a.Owner != client {
+		err = fmt.Errorf("artifact not found: %s", id)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	switch action {
+	case "info":
+		var result strings.Builder
+		fmt.Fprintf(&result, "Artifact %s\n", a.ID)
+		if a.Name != "" {
+			fmt.Fprintf(&result, "Name: %s\n", a.Name)
+		}
+		if a.Source != "" {
+			fmt.Fprintf(&result, "Source: %s\n", a.Source)
+		}
+		fmt.Fprintf(&result, "Type: %s\nSize: %d bytes\n", a.MIMEType, a.Size)
+		if a.SHA256 != "" {
+			fmt.Fprintf(&result, "SHA-256: %s\n", a.SHA256)
+		}
+		if a.Command != "" {
+			fmt.Fprintf(&result, "Command: %s\n", a.Command)
+		}
+		if a.SessionID != "" {
+			fmt.Fprintf(&result, "Session: %s\n", a.SessionID)
+		}
+		fmt.Fprintf(&result, "Created: %s\nExpires: %s\nDownload: GET /artifacts/%s\n",
+			a.Created.Format(time.RFC3339), a.Expires.Format(time.RFC3339), a.ID)
+		return mcp.NewToolResultText(result.String()), nil
+
+	case "delete":
+		if err := r.artifacts.Delete(id); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Artifact deleted: %s", id)), nil
+	}
+	return mcp.NewToolResultError(fmt.Sprintf("Unknown action: %s", action)), nil
+}
+
+// describeArtifact describes an artifact in one line
+func (r *Registry) describeArtifact(a artifact.Artifact) string {
+	name := a.Name
+	if a.Source != "" {
+		name = a.Source
+	}
+	if name == "" {
+		name = a.MIMEType
+	}
+	text := fmt.Sprintf("%s: %s, %d bytes", a.ID, name, a.Size)
+	if a.SHA256 != "" {
+		text += ", sha256 " + a.SHA256
+	}
+	return text + fmt.Sprintf(", expires %s, download with GET /artifacts/%s", a.Expires.Format(time.RFC3339), a.ID)
+}
+
+// artifactRequest is what a call asked to keep of the files its command
+// produces
+type artifactRequest struct {
+	// dir is the directory the command starts in, in the server's view
+	dir      string
+	patterns []string
+	snapshot *artifact.Snapshot
+}
+
+// prepareArtifacts reads a call's artifact parameters before its command
+// runs in dir, recording the files there when new ones are to be detected.
+// It returns nil when the call keeps no artifacts.
+func (r *Registry) prepareArtifacts(args map[string]interface{}, dir string) *artifactRequest {
+	patterns, _ := stringList(args, "artifacts")
+	detect, _ := args["detect_artifacts"].(bool)
+	if len(patterns) == 0 && !detect {
+		return nil
+	}
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+
+	req := &artifactRequest{dir: dir, patterns: patterns}
+	if detect {
+		req.snapshot = artifact.Scan(dir)
+	}
+	return req
+}
+
+// keepArtifacts saves the files a finished command produced to the artifact
+// store, adding a block to its result that lists them
+func (r *Registry) keepArtifacts(ctx context.Context, req *artifactRequest, command, sessionID string, result *mcp.CallToolResult) {
+	if req == nil || result == nil {
+		return
+	}
+
+	var lines []string
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, pattern := range req.patterns {
+		matches, err := artifact.Match(req.dir, r.paths.ToServer(pattern))
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("- %s: invalid pattern: %v", pattern, err))
+			continue
+		}
+		if len(matches) == 0 {
+			lines = append(lines, fmt.Sprintf("- %s: no matching files", pattern))
+		}
+		for _, path := range matches {
+			add(path)
+		}
+	}
+	if req.snapshot != nil {
+		if !req.snapshot.Complete {
+			lines = append(lines, fmt.Sprintf("- too many files under %s to detect new ones; name them in 'artifacts'", r.paths.ToClient(req.dir)))
+		} else {
+			changed, more := req.snapshot.Changed(maxDetectedArtifacts)
+			for _, path := range changed {
+				add(path)
+			}
+			if more {
+				lines = append(lines, fmt.Sprintf("- more than %d files were created or changed; only the first %d were kept, name the others in 'artifacts'", maxDetectedArtifacts, maxDetectedArtifacts))
+			}
+		}
+	}
+
+	for _, path := range paths {
+		source := r.paths.ToClient(path)
+		// Files outside the allowed paths, or trap paths, are not given out
+		resolved, err := r.files.Resolve(path)
+		if err == nil {
+			var a artifact.Artifact
+			a, err = r.saveArtifact(ctx, resolved, artifact.Artifact{
+				Source:    source,
+				Owner:     access.Client(ctx),
+				Command:   command,
+				SessionID: sessionID,
+			})
+			if err == nil {
+				lines = append(lines, "- "+r.describeArtifact(a))
+				continue
+			}
+		}
+		lines = append(lines, fmt.Sprintf("- %s: not kept: %v", source, err))
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, "- no files were created or changed")
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Artifacts (kept for %s):\n%s",
+		r.artifacts.TTL(), strings.Join(lines, "\n"))))
+}
+
+// saveArtifact saves a file a command produced. Commands run as a profile's
+// user only get to keep files that user can read, so a symlink or hard link
+// to one of the server's files is not handed out.
+func (r *Registry) saveArtifact(ctx context.Context, path string, a artifact.Artifact) (artifact.Artifact, error) {
+	u := profiles.User(ctx)
+	if u == nil {
+		return r.artifacts.SaveFile(path, a)
+	}
+	src, err := u.Open(path)
+	if err != nil {
+		return artifact.Artifact{}, err
+	}
+	defer src.Close()
+	return r.artifacts.SaveOpened(src, a)
+}
+
+// commandDir returns the directory a one-off command given cwd starts in,
+// in the server's view
+func (r *Registry) commandDir(cwd string) string {
+	if cwd != "" {
+		return r.workspace.Abs(r.paths.ToServer(cwd))
+	}
+	return r.workspace.Dir()
+}
+
+// sessionDir returns the directory a session's next command starts in, in
+// the server's view. A new session starts where its cwd says.
+func (r *Registry) sessionDir(sessionID, cwd string) string {
+	if info, err := r.sessionManager.Info(sessionID); err == nil && info.Cwd != "" {
+		return r.paths.ToServer(info.Cwd)
+	}
+	return r.commandDir(cwd)
+}
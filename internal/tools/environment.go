@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/shells"
+)
+
+// environmentTools builds the environment tool
+func (r *Registry) environmentTools() []server.ServerTool {
+	environmentTool := mcp.NewTool("environment",
+		mcp.WithDescription("Inspect or change the exported environment of a persistent shell session, such as PATH or API keys, without writing export commands. 'set' and 'unset' read the environment back afterwards and report whether every change took effect"),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action: 'get' to show variables, 'set' to export variables, 'unset' to remove them"),
+			mcp.Enum("get", "set", "unset"),
+		),
+		mcp.WithString("session_id",
+			mcp.Required(),
+			mcp.Description("Session whose environment to inspect or change"),
+		),
+		mcp.WithArray("names",
+			mcp.Description("Variables to show for 'get' (optional, defaults to all) or to remove for 'unset' (required)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithObject("vars",
+			mcp.Description("Variables to export and their values, e.g. {\"PATH\": \"/opt/tool/bin:/usr/bin\"} (required for 'set')"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("owner_token",
+			mcp.Description("Owner token of a session created from another connection (optional)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: environmentTool, Handler: r.handleEnvironment},
+	}
+}
+
+// handleEnvironment handles inspecting and changing a session's environment
+func (r *Registry) handleEnvironment(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	action, _ := args["action"].(string)
+	sessionID, ok := args["session_id"].(string)
+	if !ok || sessionID == "" {
+		return mcp.NewToolResultError("Session ID is required"), nil
+	}
+	if result := r.authorize(ctx, args, sessionID); result != nil {
+		return result, nil
+	}
+
+	names, _ := stringList(args, "names")
+	for _, name := range names {
+		if !shells.ValidName(name) {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid variable name: %q", name)), nil
+		}
+	}
+
+	switch action {
+	case "get":
+		env, err := r.sessionManager.Environment(sessionID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get environment: %v", err)), nil
+		}
+		if len(names) == 0 {
+			for name := range env {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+		}
+
+		var result strings.Builder
+		fmt.Fprintf(&result, "Environment of session %s:\n", sessionID)
+		for _, name := range names {
+			if value, ok := env[name]; ok {
+				fmt.Fprintf(&result, "%s=%s\n", name, value)
+			} else {
+				fmt.Fprintf(&result, "%s is not set\n", name)
+			}
+		}
+		return mcp.NewToolResultText(result.String()), nil
+
+	case "set":
+		vars, _ := args["vars"].(map[string]interface{})
+		if len(vars) == 0 {
+			return mcp.NewToolResultError("Vars are required for set action"), nil
+		}
+		set := make([]shells.Var, 0, len(vars))
+		for name, value := range vars {
+			text, ok := value.(string)
+			if !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("Invalid value for %s: must be a string", name)), nil
+			}
+			if !shells.ValidName(name) {
+				return mcp.NewToolResultError(fmt.Sprintf("Invalid variable name: %q", name)), nil
+			}
+			set = append(set, shells.Var{Name: name, Value: text})
+		}
+		slices.SortFunc(set, func(a, b shells.Var) int { return strings.Compare(a.Name, b.Name) })
+
+		env, err := r.sessionManager.SetEnvironment(sessionID, set, nil, session.ControllerAgent)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to set environment: %v", err)), nil
+		}
+
+		var result strings.Builder
+		failed := false
+		for _, v := range set {
+			switch value, ok := env[v.Name]; {
+			case !ok:
+				failed = true
+				fmt.Fprintf(&result, "%s: not set, the shell did not export it\n", v.Name)
+			case value != v.Value:
+				failed = true
+				fmt.Fprintf(&result, "%s: set to %q instead\n", v.Name, value)
+			default:
+				fmt.Fprintf(&result, "%s: set\n", v.Name)
+			}
+		}
+		return environmentResult(sessionID, result.String(), failed), nil
+
+	case "unset":
+		if len(names) == 0 {
+			return mcp.NewToolResultError("Names are required for unset action"), nil
+		}
+
+		env, err := r.sessionManager.SetEnvironment(sessionID, nil, names, session.ControllerAgent)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to unset environment: %v", err)), nil
+		}
+
+		var result strings.Builder
+		failed := false
+		for _, name := range names {
+			if _, ok := env[name]; ok {
+				failed = true
+				fmt.Fprintf(&result, "%s: still set, it may be read-only in the shell\n", name)
+			} else {
+				fmt.Fprintf(&result, "%s: unset\n", name)
+			}
+		}
+		return environmentResult(sessionID, result.String(), failed), nil
+
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown action: %s", action)), nil
+	}
+}
+
+// environmentResult reports the outcome of changing a session's environment,
+// as an error when a change did not take effect
+func environmentResult(sessionID, changes string, failed bool) *mcp.CallToolResult {
+	if failed {
+		return mcp.NewToolResultError(fmt.Sprintf("Environment of session %s was not changed as requested:\n%s", sessionID, changes))
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Environment of session %s changed and verified:\n%s", sessionID, changes))
+}
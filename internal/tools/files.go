@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/render"
+)
+
+// fileTools builds the read_file, write_file and list_directory tools
+func (r *Registry) fileTools() []server.ServerTool {
+	readFileTool := mcp.NewTool("read_file",
+		mcp.WithDescription("Read a text file without going through the shell"),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path of the file to read"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Byte offset to start reading at (optional, defaults to 0)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of bytes to read (optional, defaults to the server maximum)"),
+		),
+	)
+
+	writeFileTool := mcp.NewTool("write_file",
+		mcp.WithDescription("Write content to a file without shell quoting, replacing it unless 'append' is set"),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path of the file to write"),
+		),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Content to write"),
+		),
+		mcp.WithBoolean("append",
+			mcp.Description("Append to the file instead of replacing it (optional, defaults to false)"),
+		),
+		mcp.WithBoolean("create_dirs",
+			mcp.Description("Create missing parent directories (optional, defaults to false)"),
+		),
+	)
+
+	listDirectoryTool := mcp.NewTool("list_directory",
+		mcp.WithDescription("List the entries of a directory with type, size and modification time"),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Directory to list"),
+		),
+		mcp.WithBoolean("show_hidden",
+			mcp.Description("Include entries starting with '.' (optional, defaults to false)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: readFileTool, Handler: r.handleReadFile},
+		{Tool: writeFileTool, Handler: r.handleWriteFile},
+		{Tool: listDirectoryTool, Handler: r.handleListDirectory},
+	}
+}
+
+// handleReadFile handles reading a file
+func (r *Registry) handleReadFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return mcp.NewToolResultError("Path is required"), nil
+	}
+
+	var offset, limit int64
+	if offsetArg, ok := args["offset"].(float64); ok && offsetArg > 0 {
+		offset = int64(offsetArg)
+	}
+	if limitArg, ok := args["limit"].(float64); ok && limitArg > 0 {
+		limit = int64(limitArg)
+	}
+
+	if result := r.restricted(ctx, "read_file"); result != nil {
+		return result, nil
+	}
+	data, size, truncated, err := r.files.As(profiles.User(ctx)).Read(path, offset, limit)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+	}
+
+	if !utf8.Valid(data) {
+		return mcp.NewToolResultError(fmt.Sprintf("File appears to be binary (%d bytes): %s", size, path)), nil
+	}
+
+	result := string(data)
+	if truncated {
+		result += fmt.Sprintf("\n[Showing bytes %d-%d of %d; use offset=%d to continue]", offset, offset+int64(len(data)), size, offset+int64(len(data)))
+	}
+
+	render.Raw(ctx)
+	return mcp.NewToolResultText(result), nil
+}
+
+// handleWriteFile handles writing a file
+func (r *Registry) handleWriteFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return mcp.NewToolResultError("Path is required"), nil
+	}
+
+	content, ok := args["content"].(string)
+	if !ok {
+		return mcp.NewToolResultError("Content is required"), nil
+	}
+
+	appendMode, _ := args["append"].(bool)
+	createDirs, _ := args["create_dirs"].(bool)
+
+	if result := r.restricted(ctx, "write_file"); result != nil {
+		return result, nil
+	}
+	if err := r.files.As(profiles.User(ctx)).Write(path, []byte(content), appendMode, createDirs); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to write file: %v", err)), nil
+	}
+
+	verb := "Wrote"
+	if appendMode {
+		verb = "Appended"
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s %d bytes to %s", verb, len(content), path)), nil
+}
+
+// handleListDirectory handles listing a directory
+func (r *Registry) handleListDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return mcp.NewToolResultError("Path is required"), nil
+	}
+
+	showHidden, _ := args["show_hidden"].(bool)
+
+	if result := r.restricted(ctx, "list_directory"); result != nil {
+		return result, nil
+	}
+	entries, err := r.files.As(profiles.User(ctx)).List(path, showHidden)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to list directory: %v", err)), nil
+	}
+
+	if len(entries) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("Directory is empty: %s", path)), nil
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Contents of %s:\n", path)
+	for _, e := range entries {
+		// Names with newlines or other control characters would break the listing
+		name := e.Name
+		if strings.ContainsFunc(name, unicode.IsControl) {
+			name = strconv.Quote(name)
+		}
+		switch {
+		case e.Target != "":
+			name += " -> " + e.Target
+		case e.IsDir:
+			name += "/"
+		}
+		fmt.Fprintf(&result, "%s %10d %s %s\n", e.Mode, e.Size, e.ModTime.Format("2006-01-02 15:04"), name)
+	}
+
+	return mcp.NewToolResultText(result.String()), nil
+}
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// defaultHistoryLimit is how many commands shell_history shows unless asked otherwise
+const defaultHistoryLimit = 20
+
+// historyTools builds the shell_history tool, which only exists when the
+// operator enabled it
+func (r *Registry) historyTools() []server.ServerTool {
+	if r.history == nil {
+		return nil
+	}
+
+	historyTool := mcp.NewTool("shell_history",
+		mcp.WithDescription("Show the latest commands from the user's own shell history, with secrets masked, to learn what the user already tried before asking for help"),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Number of recent commands to show (optional, defaults to %d, at most %d)", min(defaultHistoryLimit, r.history.MaxEntries()), r.history.MaxEntries())),
+		),
+		mcp.WithString("contains",
+			mcp.Description("Only show commands containing this text (optional)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: historyTool, Handler: r.handleShellHistory},
+	}
+}
+
+// handleShellHistory handles reading the user's shell history
+func (r *Registry) handleShellHistory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	limit := defaultHistoryLimit
+	if limitArg, ok := args["limit"].(float64); ok && limitArg > 0 {
+		limit = int(limitArg)
+	}
+	contains, _ := args["contains"].(string)
+
+	entries, err := r.history.Recent(limit, contains)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read shell history: %v", err)), nil
+	}
+	if len(entries) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("No matching commands in %s", r.history.Path())), nil
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Last %d commands from %s (oldest first):\n", len(entries), r.history.Path())
+	for _, entry := range entries {
+		command := r.redact.String(entry.Command)
+		if !entry.Time.IsZero() {
+			fmt.Fprintf(&result, "%s  %s\n", entry.Time.Format(time.DateTime), command)
+		} else {
+			fmt.Fprintf(&result, "%s\n", command)
+		}
+	}
+	return mcp.NewToolResultText(result.String()), nil
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/session"
+)
+
+const (
+	// defaultInterruptWait is how long an interrupt waits for the prompt unless the call says otherwise
+	defaultInterruptWait = 5 * time.Second
+	maxInterruptWait     = time.Minute
+)
+
+// interruptTools builds the interrupt tool
+func (r *Registry) interruptTools() []server.ServerTool {
+	interruptTool := mcp.NewTool("interrupt",
+		mcp.WithDescription("Stop the command running in a persistent shell session by sending it Ctrl-C, then wait briefly for the shell to return to its prompt and report whether the session recovered. Use it to stop a command started by mistake or one that hangs; the session, its directory and environment are kept"),
+		mcp.WithString("session_id",
+			mcp.Required(),
+			mcp.Description("Session whose running command to interrupt"),
+		),
+		mcp.WithNumber("wait",
+			mcp.Description("Seconds to wait for the prompt to return (optional, defaults to 5, at most 60)"),
+		),
+		mcp.WithString("owner_token",
+			mcp.Description("Owner token of a session created from another connection (optional)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: interruptTool, Handler: r.handleInterrupt},
+	}
+}
+
+// handleInterrupt handles interrupting a session's running command
+func (r *Registry) handleInterrupt(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	sessionID, ok := args["session_id"].(string)
+	if !ok || sessionID == "" {
+		return mcp.NewToolResultError("Session ID is required"), nil
+	}
+	if result := r.readOnly(ctx, "commands cannot be interrupted"); result != nil {
+		return result, nil
+	}
+	if result := r.authorize(ctx, args, sessionID); result != nil {
+		return result, nil
+	}
+
+	wait := defaultInterruptWait
+	if waitArg, ok := args["wait"].(float64); ok && waitArg > 0 {
+		wait = min(time.Duration(waitArg*float64(time.Second)), maxInterruptWait)
+	}
+
+	interrupted, err := r.sessionManager.Interrupt(sessionID, session.ControllerAgent, wait)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to interrupt command: %v", err)), nil
+	}
+	if interrupted.Command == "" {
+		return mcp.NewToolResultText(fmt.Sprintf("No command is running in session %s; nothing to interrupt", sessionID)), nil
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Command: %s\n", interrupted.Command)
+	if len(interrupted.Signalled) > 0 {
+		fmt.Fprintf(&result, "Signalled: %s\n", strings.Trim(fmt.Sprint(interrupted.Signalled), "[]"))
+	}
+	if interrupted.Recovered {
+		fmt.Fprintf(&result, "Recovered: true\nElapsed: %s\nSession %s is back at its prompt and ready for the next command.",
+			interrupted.Elapsed.Round(time.Millisecond), sessionID)
+		return mcp.NewToolResultText(result.String()), nil
+	}
+
+	fmt.Fprintf(&result, "Recovered: false\nElapsed: %s\n", interrupted.Elapsed.Round(time.Millisecond))
+	if len(interrupted.Remaining) > 0 {
+		fmt.Fprintf(&result, "Still running: %s\n", strings.Trim(fmt.Sprint(interrupted.Remaining), "[]"))
+	}
+	if !interrupted.Keystroke && len(interrupted.Signalled) == 0 {
+		result.WriteString("The command started no processes to signal: it runs in the shell itself, such as a loop of builtins. Close the session to stop it.")
+	} else {
+		result.WriteString("The command ignored Ctrl-C or is still shutting down. Interrupt again, kill its processes with process_manager, or close the session.")
+	}
+	return mcp.NewToolResultError(result.String()), nil
+}
@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/plugins"
+)
+
+// AddPlugins adds the tools of the plugin executables. A plugin tool may not
+// take the name of a built-in tool or command template.
+func (r *Registry) AddPlugins(list []*plugins.Tool) error {
+	for _, t := range r.serverTools() {
+		for _, plugin := range list {
+			if plugin.Name == t.Tool.Name {
+				return fmt.Errorf("tool %q is already defined", plugin.Name)
+			}
+		}
+	}
+	r.plugins = list
+	return nil
+}
+
+// pluginTools builds a tool for each tool the plugins provide
+func (r *Registry) pluginTools() []server.ServerTool {
+	tools := make([]server.ServerTool, 0, len(r.plugins))
+	for _, t := range r.plugins {
+		tool := mcp.NewToolWithRawSchema(t.Name, t.Description, t.InputSchema)
+		tools = append(tools, server.ServerTool{Tool: tool, Handler: r.handlePlugin(t)})
+	}
+	return tools
+}
+
+// handlePlugin returns the handler calling a plugin tool. Which roles may call
+// it is up to the policy's tool lists; the plugin is told who is calling.
+func (r *Registry) handlePlugin(t *plugins.Tool) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		release, busy := r.concurrency.Acquire("")
+		if busy != nil {
+			return mcp.NewToolResultError(busy.JSON()), nil
+		}
+		defer release()
+
+		identity := access.IdentityFrom(ctx)
+		result, err := t.Call(ctx, plugins.Call{
+			Tool:      t.Name,
+			Arguments: request.GetArguments(),
+			Identity:  identity.Name,
+			Role:      identity.Role,
+		})
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to run plugin: %v", r.redact.String(err.Error()))), nil
+		}
+		if result.Error != "" {
+			return mcp.NewToolResultError(r.redact.String(result.Error)), nil
+		}
+		return mcp.NewToolResultText(r.redact.String(result.Text)), nil
+	}
+}
@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/trap"
+	"mcp-terminal-server/internal/webhook"
+)
+
+// policyTools builds the policy_check tool
+func (r *Registry) policyTools() []server.ServerTool {
+	policyCheckTool := mcp.NewTool("policy_check",
+		mcp.WithDescription("Test a command against the current policy, role permissions and risk classifier without running it, returning the full decision trace"),
+		mcp.WithString("command",
+			mcp.Required(),
+			mcp.Description("Command to evaluate"),
+		),
+		mcp.WithString("tool",
+			mcp.Description("Tool the command would be run with (optional, defaults to 'execute_command')"),
+			mcp.Enum("execute_command", "persistent_shell"),
+		),
+		mcp.WithString("role",
+			mcp.Description("Role to evaluate as (optional, defaults to the caller's role or the policy's default role)"),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("Session the command would run in, passed to an external OPA policy (optional)"),
+		),
+		mcp.WithString("cwd",
+			mcp.Description("Working directory the command would run in, passed to an external OPA policy (optional)"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Evaluate as if the call confirmed the command to maintenance windows (optional, defaults to false)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: policyCheckTool, Handler: r.handlePolicyCheck},
+	}
+}
+
+// handlePolicyCheck handles policy simulation
+func (r *Registry) handlePolicyCheck(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	command, ok := args["command"].(string)
+	if !ok || command == "" {
+		return mcp.NewToolResultError("Command is required"), nil
+	}
+
+	tool, _ := args["tool"].(string)
+	if tool == "" {
+		tool = "execute_command"
+	}
+	role, _ := args["role"].(string)
+	if role == "" {
+		role = access.IdentityFrom(ctx).Role
+	}
+	sessionID, _ := args["session_id"].(string)
+	cwd, _ := args["cwd"].(string)
+	confirmed, _ := args["confirm"].(bool)
+
+	decision := r.policy.Evaluate(policy.Request{Tool: tool, Command: command, Role: role, Transport: access.Transport(ctx), Target: sessionID, Cwd: cwd, Confirmed: confirmed, Restrictions: profiles.Restrictions(ctx)})
+	return mcp.NewToolResultText(decision.String()), nil
+}
+
+// readOnly returns an error result saying what cannot be done when the
+// server or the caller's role is read-only, for actions that change state
+// without running a command, such as signalling processes
+func (r *Registry) readOnly(ctx context.Context, what string) *mcp.CallToolResult {
+	if r.policy.ReadOnly() {
+		return mcp.NewToolResultError("Denied by policy: the server is read-only; " + what)
+	}
+	if r.policy.RoleReadOnly(access.IdentityFrom(ctx).Role, access.Transport(ctx)) {
+		return mcp.NewToolResultError("Denied by policy: the caller's role is read-only; " + what)
+	}
+	if restrictions := profiles.Restrictions(ctx); restrictions != nil && restrictions.ReadOnly {
+		return mcp.NewToolResultError(fmt.Sprintf("Denied by policy: %s is read-only; %s", restrictions.Name, what))
+	}
+	return nil
+}
+
+// restricted returns an error result when the restrictions of the call's
+// profile refuse the tool itself, for tools that run no command; the policy
+// middleware checks only the caller's role
+func (r *Registry) restricted(ctx context.Context, tool string) *mcp.CallToolResult {
+	restrictions := profiles.Restrictions(ctx)
+	if restrictions == nil {
+		return nil
+	}
+	decision := r.policy.Evaluate(policy.Request{Tool: tool, Role: access.IdentityFrom(ctx).Role, Transport: access.Transport(ctx), Restrictions: restrictions})
+	if decision.Allowed {
+		return nil
+	}
+	return mcp.NewToolResultError("Denied by policy: " + decision.Reason)
+}
+
+// denied returns an error result if the policy refuses the request. Without a
+// role or transport of its own the request is checked against the caller's,
+// and within the restrictions of the call's profile.
+func (r *Registry) denied(ctx context.Context, req policy.Request) *mcp.CallToolResult {
+	if req.Role == "" {
+		req.Role = access.IdentityFrom(ctx).Role
+	}
+	if req.Transport == "" {
+		req.Transport = access.Transport(ctx)
+	}
+	if req.Restrictions == nil {
+		req.Restrictions = profiles.Restrictions(ctx)
+	}
+	decision := r.policy.Evaluate(req)
+	if decision.Allowed {
+		return nil
+	}
+	if !req.Confirmed {
+		// Only a confirmation stands in the way, which a human may want to weigh in on
+		confirmed := req
+		confirmed.Confirmed = true
+		if r.policy.Evaluate(confirmed).Allowed {
+			webhook.Notify(events.TypeApprovalRequested, events.ApprovalRequested{
+				Version:  events.Version,
+				Tool:     req.Tool,
+				Command:  req.Command,
+				Reason:   decision.Reason,
+				Role:     decision.Role,
+				Identity: access.IdentityFrom(ctx).Name,
+			})
+		}
+	}
+	message := fmt.Sprintf("Command denied by policy: %s (risk: %s). Use policy_check for the full decision trace.", decision.Reason, decision.Risk)
+	if suggestions := decision.Suggestions(); suggestions != "" {
+		message += "\n" + strings.TrimSuffix(suggestions, "\n")
+	}
+	return mcp.NewToolResultError(message)
+}
+
+// tripped raises an alert when a command refers to a trap path. When freezing
+// is configured the command is refused and its session handed to the operator;
+// otherwise it runs, so the agent cannot tell it was noticed.
+func (r *Registry) tripped(tool, command, cwd, sessionID string) *mcp.CallToolResult {
+	path := r.traps.Command(command, cwd)
+	if path == "" {
+		return nil
+	}
+
+	r.traps.Alert(trap.Trip{Path: path, Source: "command", Tool: tool, Command: command, SessionID: sessionID})
+	if sessionID != "" {
+		r.sessionManager.Alert(sessionID, path, command)
+	}
+	if !r.traps.Freeze() {
+		return nil
+	}
+
+	if sessionID == "" {
+		return mcp.NewToolResultError("Command refused: it touches a protected path. An operator has been alerted.")
+	}
+	// The session may not exist yet, in which case refusing the command is enough
+	r.sessionManager.Freeze(sessionID, "a command touched a protected path")
+	return mcp.NewToolResultError("Command refused: it touches a protected path. The session is frozen until an operator reviews it.")
+}
+
+// repeated refuses a state-changing command submitted again in the same scope
+// within the duplicate window, unless the call confirms it. Commands from the
+// read-only list never need confirming.
+func (r *Registry) repeated(scope, command string, args map[string]interface{}) *mcp.CallToolResult {
+	if r.dedup == nil || !r.policy.Mutating(command) {
+		return nil
+	}
+
+	confirmed, _ := args["confirm"].(bool)
+	ago, refused := r.dedup.Check(scope, command, confirmed)
+	if !refused {
+		return nil
+	}
+	return mcp.NewToolResultError(fmt.Sprintf("Command refused: the same command was submitted %s ago and may change state, so running it again could apply it twice. If the earlier run did not take effect, call again with confirm set to true.", max(ago.Round(time.Second), time.Second)))
+}
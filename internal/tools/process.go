@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/process"
+	"mcp-terminal-server/internal/profiles"
+)
+
+// defaultProcessLimit caps how many processes 'list' shows unless asked otherwise
+const defaultProcessLimit = 200
+
+// processTools builds the process_manager tool
+func (r *Registry) processTools() []server.ServerTool {
+	processTool := mcp.NewTool("process_manager",
+		mcp.WithDescription("Inspect and signal processes without relying on platform-specific ps/kill invocations"),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action: 'list' for a ps-style snapshot, 'info' for details of one process, 'kill' to send it a signal"),
+			mcp.Enum("list", "info", "kill"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Only list processes whose name or command line contains this text (optional, for 'list')"),
+		),
+		mcp.WithString("user",
+			mcp.Description("Only list processes owned by this user (optional, for 'list')"),
+		),
+		mcp.WithBoolean("descendants_only",
+			mcp.Description("Only list processes started by this server, e.g. from its shells (optional, for 'list')"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of processes to list (optional, defaults to %d)", defaultProcessLimit)),
+		),
+		mcp.WithNumber("pid",
+			mcp.Description("Process ID (required for 'info' and 'kill')"),
+		),
+		mcp.WithString("signal",
+			mcp.Description("Signal to send: TERM, KILL, INT, HUP, QUIT, USR1, USR2, STOP or CONT (optional, for 'kill', defaults to TERM)"),
+		),
+		mcp.WithBoolean("group",
+			mcp.Description("Signal the process's whole process group (optional, for 'kill', defaults to false)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: processTool, Handler: r.handleProcessManager},
+	}
+}
+
+// handleProcessManager handles process management operations
+func (r *Registry) handleProcessManager(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	action, ok := args["action"].(string)
+	if !ok || action == "" {
+		return mcp.NewToolResultError("Action is required"), nil
+	}
+	if result := r.restricted(ctx, "process_manager"); result != nil {
+		return result, nil
+	}
+
+	pid := 0
+	if pidArg, ok := args["pid"].(float64); ok {
+		pid = int(pidArg)
+	}
+
+	switch action {
+	case "list":
+		filter := process.Filter{}
+		filter.Name, _ = args["name"].(string)
+		filter.User, _ = args["user"].(string)
+		if descendants, _ := args["descendants_only"].(bool); descendants {
+			filter.DescendantsOf = os.Getpid()
+		}
+
+		limit := defaultProcessLimit
+		if limitArg, ok := args["limit"].(float64); ok && limitArg > 0 {
+			limit = int(limitArg)
+		}
+
+		processes, err := process.List(filter)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to list processes: %v", err)), nil
+		}
+		if len(processes) == 0 {
+			return mcp.NewToolResultText("No matching processes"), nil
+		}
+
+		var result strings.Builder
+		fmt.Fprintf(&result, "%7s %7s %-10s %-5s %10s %10s %s\n", "PID", "PPID", "USER", "STATE", "RSS", "CPU", "COMMAND")
+		for i, p := range processes {
+			if i == limit {
+				fmt.Fprintf(&result, "[%d more processes not shown; narrow the filter or raise the limit]\n", len(processes)-limit)
+				break
+			}
+			fmt.Fprintf(&result, "%7d %7d %-10s %-5s %10s %10s %s\n",
+				p.PID, p.PPID, p.User, p.State, formatBytes(p.RSSBytes), p.CPUTime.Truncate(10*time.Millisecond), p.Command)
+		}
+
+		return mcp.NewToolResultText(result.String()), nil
+
+	case "info":
+		if pid <= 0 {
+			return mcp.NewToolResultError("PID is required for info action"), nil
+		}
+
+		p, err := process.Get(pid)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get process: %v", err)), nil
+		}
+		children, _ := process.Children(pid)
+
+		var result strings.Builder
+		fmt.Fprintf(&result, "PID: %d\nParent PID: %d\nUser: %s\nName: %s\nCommand: %s\nState: %s\nRSS: %s\nCPU time: %s\n",
+			p.PID, p.PPID, p.User, p.Name, p.Command, p.State, formatBytes(p.RSSBytes), p.CPUTime.Truncate(10*time.Millisecond))
+		if !p.Started.IsZero() {
+			fmt.Fprintf(&result, "Started: %s (%s ago)\n", p.Started.Format(time.RFC3339), time.Since(p.Started).Truncate(time.Second))
+		}
+		if p.Cwd != "" {
+			fmt.Fprintf(&result, "Working directory: %s\n", p.Cwd)
+		}
+		if len(children) > 0 {
+			fmt.Fprintf(&result, "Children: %s\n", strings.Trim(fmt.Sprint(children), "[]"))
+		}
+
+		return mcp.NewToolResultText(result.String()), nil
+
+	case "kill":
+		if pid <= 0 {
+			return mcp.NewToolResultError("PID is required for kill action"), nil
+		}
+		if result := r.readOnly(ctx, "processes cannot be signalled"); result != nil {
+			return result, nil
+		}
+
+		signalName, _ := args["signal"].(string)
+		sig, err := process.ParseSignal(signalName)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		group, _ := args["group"].(bool)
+
+		kill := process.Kill
+		if u := profiles.User(ctx); u != nil {
+			// Under a profile's user only that user's processes may be signalled
+			kill = u.Kill
+		}
+		if err := kill(pid, sig, group); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to kill process: %v", err)), nil
+		}
+
+		target := fmt.Sprintf("process %d", pid)
+		if group {
+			target = fmt.Sprintf("process group of %d", pid)
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Sent %v to %s", sig, target)), nil
+
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown action: %s", action)), nil
+	}
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
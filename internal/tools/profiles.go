@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/profiles"
+)
+
+// withProfile adds the profile parameter, which runs a call under a profile
+// of its own, when the operator configured profiles
+func (r *Registry) withProfile() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		names := r.profiles.Names()
+		if len(names) == 0 {
+			return
+		}
+		mcp.WithString("profile",
+			mcp.Description("Execution profile to run this call under, with the shell, working directory, environment, resource limits, user and command restrictions the operator set up for it; arguments the profile sets can be left out (optional, defaults to the profile selected with use_profile)"),
+			mcp.Enum(names...),
+		)(t)
+	}
+}
+
+// profileTools builds the use_profile tool, which only exists when the
+// operator configured profiles
+func (r *Registry) profileTools() []server.ServerTool {
+	names := r.profiles.Names()
+	if len(names) == 0 {
+		return nil
+	}
+
+	useProfileTool := mcp.NewTool("use_profile",
+		mcp.WithDescription("Select a named execution profile (shell, working directory, timeout, environment, resource limits, user, command restrictions) that all later calls from this connection inherit, instead of repeating them on every call. Without a name, shows the current profile and the available ones"),
+		mcp.WithString("name",
+			mcp.Description("Profile to use, or 'none' to stop using one (optional)"),
+			mcp.Enum(append(names, "none")...),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: useProfileTool, Handler: r.handleUseProfile},
+	}
+}
+
+// handleUseProfile handles switching the profile of the calling client
+func (r *Registry) handleUseProfile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	client := access.Client(ctx)
+	name, _ := request.GetArguments()["name"].(string)
+
+	current, ok := r.profiles.Current(client)
+	if name == "" {
+		if !ok {
+			return mcp.NewToolResultText(fmt.Sprintf("No profile in use. Available profiles: %s", strings.Join(r.profiles.Names(), ", "))), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Using %s\nAvailable profiles: %s", describeProfile(current), strings.Join(r.profiles.Names(), ", "))), nil
+	}
+	// A locked profile is a preset the operator keeps the connection to
+	if ok && current.Locked && name != current.Name {
+		return mcp.NewToolResultError(fmt.Sprintf("This connection is locked to profile %s", current.Name)), nil
+	}
+	if name == "none" {
+		r.profiles.Use(client, "")
+		return mcp.NewToolResultText("No profile in use; calls use the server's defaults"), nil
+	}
+
+	p, err := r.profiles.Use(client, name)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to use profile: %v", err)), nil
+	}
+	if p.Locked {
+		return mcp.NewToolResultText(fmt.Sprintf("Now using %s\nThe profile is locked: calls cannot override its settings, and this connection cannot switch to another profile.", describeProfile(p))), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Now using %s\nArguments given in a call still override the profile.", describeProfile(p))), nil
+}
+
+// describeProfile lists the defaults of a profile. Environment values are
+// left out, as they may hold secrets.
+func describeProfile(p profiles.Profile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "profile %s", p.Name)
+	if p.Shell != "" {
+		fmt.Fprintf(&b, "\nShell: %s", p.Shell)
+	}
+	if p.Cwd != "" {
+		fmt.Fprintf(&b, "\nWorking directory: %s", p.Cwd)
+	}
+	if p.Timeout > 0 {
+		fmt.Fprintf(&b, "\nTimeout: %gs", p.Timeout)
+	}
+	var limits []string
+	if p.IOReadBPS > 0 {
+		limits = append(limits, fmt.Sprintf("read %d B/s", p.IOReadBPS))
+	}
+	if p.IOWriteBPS > 0 {
+		limits = append(limits, fmt.Sprintf("write %d B/s", p.IOWriteBPS))
+	}
+	if p.CPUs != "" {
+		limits = append(limits, "CPUs "+p.CPUs)
+	}
+	if p.Nice != nil {
+		limits = append(limits, fmt.Sprintf("nice %d", *p.Nice))
+	}
+	if p.IOClass != "" {
+		limits = append(limits, "IO class "+p.IOClass)
+	}
+	if p.IOPriority != nil {
+		limits = append(limits, fmt.Sprintf("IO priority %d", *p.IOPriority))
+	}
+	if len(limits) > 0 {
+		fmt.Fprintf(&b, "\nLimits: %s", strings.Join(limits, ", "))
+	}
+	if p.User != "" {
+		fmt.Fprintf(&b, "\nUser: %s", p.User)
+	}
+	if len(p.Env) > 0 {
+		names := make([]string, 0, len(p.Env))
+		for name := range p.Env {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprintf(&b, "\nEnvironment: %s", strings.Join(names, ", "))
+	}
+	if p.Policy != nil {
+		var restrictions []string
+		if p.Policy.ReadOnly {
+			restrictions = append(restrictions, "read-only commands")
+		}
+		if len(p.Policy.Rules) > 0 {
+			restrictions = append(restrictions, fmt.Sprintf("%d rule(s)", len(p.Policy.Rules)))
+		}
+		if p.Policy.Default == "deny" {
+			restrictions = append(restrictions, "commands no rule allows are denied")
+		}
+		if len(restrictions) > 0 {
+			fmt.Fprintf(&b, "\nRestrictions: %s (policy_check shows how a command fares)", strings.Join(restrictions, ", "))
+		}
+	}
+	return b.String()
+}
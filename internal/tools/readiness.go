@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/readiness"
+	"mcp-terminal-server/internal/schedule"
+)
+
+// withWaitFor adds the wait_for and wait_timeout parameters, which hold a
+// command back until what it depends on is ready
+func (r *Registry) withWaitFor() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		mcp.WithArray("wait_for",
+			mcp.Description("Conditions to wait for, in order, before running the command, e.g. ['port:3000'] to run tests once a server started in another session is up: 'port:<port>' or 'port:<host>:<port>' accepting connections, 'file:<path>' existing, an http(s):// URL answering with a status below 400, 'session:<id>' running no command, 'job:<id>' of a finished scheduled job (optional)"),
+			mcp.WithStringItems(),
+		)(t)
+		mcp.WithNumber("wait_timeout",
+			mcp.Description(fmt.Sprintf("Seconds to wait for the wait_for conditions before giving up without running the command (optional, defaults to %d, at most %d)",
+				int(r.config.WaitForTimeout.Seconds()), int(r.config.WaitForMaxTimeout.Seconds()))),
+		)(t)
+	}
+}
+
+// waitFor waits for the wait_for conditions of a call. It returns a note on
+// the wait for the result, or the error result when the conditions are
+// invalid or not met in time, in which case the command must not run.
+func (r *Registry) waitFor(ctx context.Context, args map[string]interface{}) (string, *mcp.CallToolResult) {
+	specs, _ := stringList(args, "wait_for")
+	if len(specs) == 0 {
+		return "", nil
+	}
+
+	timeout := r.config.WaitForTimeout
+	if timeoutArg, ok := args["wait_timeout"].(float64); ok && timeoutArg > 0 {
+		timeout = time.Duration(timeoutArg * float64(time.Second))
+	}
+	if timeout > r.config.WaitForMaxTimeout {
+		timeout = r.config.WaitForMaxTimeout
+	}
+
+	client, admin := access.Client(ctx), access.IsAdmin(ctx)
+	src := readiness.Sources{
+		Resolve: r.files.Resolve,
+		Session: func(id string) (bool, error) {
+			// Other clients' sessions are as good as missing
+			if !admin && !r.sessionManager.Owns(id, client) {
+				return false, fmt.Errorf("session not found: %s", id)
+			}
+			return r.sessionManager.Running(id)
+		},
+	}
+	if r.scheduler != nil {
+		src.Job = func(id string) (bool, error) {
+			job, _, err := r.scheduler.Results(id, client, admin)
+			if err != nil {
+				return false, err
+			}
+			return job.State == schedule.StateDone || job.State == schedule.StateCancelled, nil
+		}
+	}
+
+	conditions := make([]*readiness.Condition, 0, len(specs))
+	for _, spec := range specs {
+		c, err := readiness.Parse(spec, src)
+		if err != nil {
+			return "", mcp.NewToolResultError(fmt.Sprintf("Invalid wait_for condition: %v", err))
+		}
+		conditions = append(conditions, c)
+	}
+
+	waited, err := readiness.Wait(ctx, conditions, timeout)
+	if err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Command not run: %v", err))
+	}
+	return fmt.Sprintf("Waited: %s for %s", waited.Round(time.Millisecond), strings.Join(specs, ", ")), nil
+}
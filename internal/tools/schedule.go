@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/schedule"
+	"mcp-terminal-server/internal/shells"
+)
+
+// scheduleTools builds the schedule_command tool
+func (r *Registry) scheduleTools() []server.ServerTool {
+	scheduleTool := mcp.NewTool("schedule_command",
+		mcp.WithDescription("Run a command later, once after a delay or repeatedly on a cron schedule, e.g. 'run this cleanup in 10 minutes'. Commands run in a fresh shell like execute_command. Results are kept for each job, returned by the 'results' action and published on the /schedule/events stream"),
+		mcp.WithString("action",
+			mcp.Description("Action to perform (optional, defaults to 'create')"),
+			mcp.Enum("create", "list", "cancel", "results"),
+		),
+		mcp.WithString("command",
+			mcp.Description("Command to schedule (required for create)"),
+		),
+		mcp.WithArray("args",
+			mcp.Description("Arguments of the program in 'command', quoted so they arrive exactly as given (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithNumber("delay",
+			mcp.Description("Seconds to wait before running the command once (give either 'delay' or 'cron')"),
+		),
+		mcp.WithString("cron",
+			mcp.Description("Five-field cron expression in the server's local time, e.g. '*/15 * * * *', or @hourly, @daily, @weekly, @monthly (give either 'delay' or 'cron')"),
+		),
+		mcp.WithNumber("timeout",
+			mcp.Description("Timeout of each run in seconds (optional, defaults to 30)"),
+		),
+		mcp.WithString("job_id",
+			mcp.Description("Job to cancel or read the results of (required for cancel and results)"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Run the command even when a maintenance window that asks for confirmation is open (optional, defaults to false)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: scheduleTool, Handler: r.handleSchedule},
+	}
+}
+
+// handleSchedule creates, lists and cancels scheduled commands
+func (r *Registry) handleSchedule(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	action, _ := args["action"].(string)
+	jobID, _ := args["job_id"].(string)
+	owner, admin := access.Client(ctx), access.IsAdmin(ctx)
+
+	switch action {
+	case "", "create":
+		return r.scheduleCommand(ctx, args), nil
+
+	case "list":
+		jobs := r.scheduler.List(owner, admin)
+		if len(jobs) == 0 {
+			return mcp.NewToolResultText("No scheduled commands"), nil
+		}
+		var b strings.Builder
+		b.WriteString("Scheduled commands:\n")
+		for _, job := range jobs {
+			b.WriteString("- " + formatJob(job) + "\n")
+		}
+		return mcp.NewToolResultText(b.String()), nil
+
+	case "cancel":
+		if jobID == "" {
+			return mcp.NewToolResultError("Job ID is required for cancel action"), nil
+		}
+		job, err := r.scheduler.Cancel(jobID, owner, admin)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to cancel job: %v", err)), nil
+		}
+		if job.State == schedule.StateRunning {
+			return mcp.NewToolResultText(fmt.Sprintf("Job %s cancelled; its current run is being stopped", jobID)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Job %s cancelled", jobID)), nil
+
+	case "results":
+		if jobID == "" {
+			return mcp.NewToolResultError("Job ID is required for results action"), nil
+		}
+		job, results, err := r.scheduler.Results(jobID, owner, admin)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get results: %v", err)), nil
+		}
+		return mcp.NewToolResultText(formatResults(job, results)), nil
+
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown action: %s", action)), nil
+	}
+}
+
+// scheduleCommand checks a command against the policy and schedules it
+func (r *Registry) scheduleCommand(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	command := commandLine(args, shells.For(r.config.Shell))
+	if command == "" {
+		return mcp.NewToolResultError("Command is required for create action")
+	}
+
+	spec := schedule.Spec{Command: command, Timeout: r.config.DefaultTimeout, Owner: access.Client(ctx), Role: access.IdentityFrom(ctx).Role, Transport: access.Transport(ctx)}
+	spec.Confirmed, _ = args["confirm"].(bool)
+	if p, ok := profiles.FromContext(ctx); ok {
+		spec.Profile = &p
+	}
+	if delayArg, ok := args["delay"].(float64); ok && delayArg > 0 {
+		spec.Delay = time.Duration(delayArg * float64(time.Second))
+	}
+	if cronArg, _ := args["cron"].(string); cronArg != "" {
+		cron, err := schedule.ParseCron(cronArg)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid cron expression: %v", err))
+		}
+		spec.Cron = cron
+	}
+	if timeoutArg, ok := args["timeout"].(float64); ok && timeoutArg > 0 {
+		spec.Timeout = time.Duration(timeoutArg) * time.Second
+	}
+
+	// Maintenance windows are checked for the first run, and again at each run
+	at := time.Now().Add(spec.Delay)
+	if spec.Cron != nil {
+		at = spec.Cron.Next(time.Now())
+	}
+	if result := r.denied(ctx, policy.Request{Tool: "schedule_command", Command: command, Confirmed: spec.Confirmed, At: at}); result != nil {
+		return result
+	}
+	if result := r.tripped("schedule_command", command, "", ""); result != nil {
+		return result
+	}
+
+	job, err := r.scheduler.Add(spec)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to schedule command: %v", err))
+	}
+
+	text := fmt.Sprintf("Scheduled %s to run at %s", job.ID, job.Next.Format(time.RFC3339))
+	if job.Cron != "" {
+		text = fmt.Sprintf("Scheduled %s on '%s'; first run at %s", job.ID, job.Cron, job.Next.Format(time.RFC3339))
+	}
+	return mcp.NewToolResultText(text + fmt.Sprintf("\nCommand: %s\nTimeout: %s\nUse the results action with job_id %s to read its output", command, job.Timeout, job.ID))
+}
+
+// formatJob describes a scheduled command on one line
+func formatJob(job schedule.Job) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s] %s", job.ID, job.State, job.Command)
+	if job.Cron != "" {
+		fmt.Fprintf(&b, " (cron: %s)", job.Cron)
+	}
+	if !job.Next.IsZero() {
+		fmt.Fprintf(&b, ", next run %s", job.Next.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, ", runs: %d", job.Runs)
+	return b.String()
+}
+
+// formatResults describes a job and the results kept for it
+func formatResults(job schedule.Job, results []schedule.Result) string {
+	var b strings.Builder
+	b.WriteString(formatJob(job) + "\n")
+	if len(results) == 0 {
+		b.WriteString("No runs yet")
+		return b.String()
+	}
+
+	for _, result := range results {
+		fmt.Fprintf(&b, "\n--- run %d at %s (%s) ---\n", result.Run, result.Started.Format(time.RFC3339), result.Duration.Round(time.Millisecond))
+		if result.Error != "" {
+			fmt.Fprintf(&b, "Not run: %s\n", result.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "Exit Code: %d\n", result.ExitCode)
+		if result.TimedOut {
+			b.WriteString("Timed Out: true\n")
+		}
+		if result.Killed != "" {
+			fmt.Fprintf(&b, "Killed: %s\n", result.Killed)
+		}
+		if result.Truncated {
+			b.WriteString("[earlier output omitted]\n")
+		}
+		fmt.Fprintf(&b, "Output: %s\n", strings.TrimSpace(result.Output))
+	}
+	return b.String()
+}
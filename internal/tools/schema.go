@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"mcp-terminal-server/internal/executor"
+)
+
+// deprecatedArgs are the execute_command arguments of schema version 1 that
+// version 2 replaced, with what replaces them
+var deprecatedArgs = []struct {
+	name        string
+	replacement string
+}{
+	{"exec_args", "pass the same list as 'argv'"},
+	{"args", "pass the program and its arguments together as 'argv'"},
+}
+
+// executeCommandTool builds the execute_command tool in the configured schema
+// version. Version 2 gives the argument vector as 'argv' in place of
+// 'exec_args' and 'command' with 'args', and adds an 'env' object. The
+// handler takes either shape whichever version is advertised, so clients
+// written against the other keep working while they move over.
+func (r *Registry) executeCommandTool() mcp.Tool {
+	niceMin, niceMax, ioClasses := r.limiter.Bounds()
+	opts := []mcp.ToolOption{
+		mcp.WithDescription("Execute terminal commands with configurable timeout (non-persistent)"),
+	}
+	if r.config.ToolSchemaVersion >= 2 {
+		opts = append(opts,
+			mcp.WithString("command",
+				mcp.Description("The shell command to execute (required unless 'argv' or 'script' is given)"),
+			),
+			withScript(),
+			mcp.WithArray("argv",
+				mcp.Description("Program and arguments to run directly without a shell, e.g. ['grep', '-r', 'TODO', 'src dir']: no globbing, expansion or quoting rules apply, so spaces, quotes, unicode and metacharacters need no escaping (give instead of 'command'; not combined with 'shell')"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithObject("env",
+				mcp.Description("Environment variables to set for the command, e.g. {'NODE_ENV': 'test'}, added to the server's environment (optional)"),
+				mcp.AdditionalProperties(map[string]interface{}{"type": "string"}),
+			),
+		)
+	} else {
+		opts = append(opts,
+			mcp.WithString("command",
+				mcp.Description("The command to execute, or the program to run when 'args' is given (required unless 'exec_args' or 'script' is given)"),
+			),
+			withScript(),
+			mcp.WithArray("exec_args",
+				mcp.Description("Program and arguments to run directly without a shell, e.g. ['grep', '-r', 'TODO', 'src dir']: no globbing, expansion or quoting rules apply (give instead of 'command'; not combined with 'shell')"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithArray("args",
+				mcp.Description("Arguments of the program in 'command', passed to it exactly as given without a shell, so spaces, quotes, unicode and metacharacters need no escaping (optional; not combined with 'shell')"),
+				mcp.WithStringItems(),
+			),
+		)
+	}
+	opts = append(opts,
+		mcp.WithNumber("timeout",
+			mcp.Description("Timeout in seconds (optional, defaults to 30)"),
+		),
+		mcp.WithString("shell",
+			mcp.Description("Shell to use for execution (optional, defaults to system shell)"),
+		),
+		mcp.WithBoolean("capture_stderr",
+			mcp.Description("Return stdout and stderr as separate content blocks after the summary, instead of one combined output (optional, defaults to false)"),
+		),
+		mcp.WithBoolean("merged_output",
+			mcp.Description("With capture_stderr, add a block with stdout and stderr interleaved in the order they were written (optional, defaults to false)"),
+		),
+		mcp.WithString("output_type",
+			mcp.Description("How to return stdout: 'auto' detects binary data such as images or archives, 'text' always returns text, 'binary' always attaches it as image or resource content (optional, defaults to 'auto')"),
+			mcp.Enum(executor.OutputAuto, executor.OutputText, executor.OutputBinary),
+		),
+		mcp.WithString("cwd",
+			mcp.Description("Working directory for the command (optional, defaults to the server's directory)"),
+		),
+		withEncoding(),
+		mcp.WithNumber("io_read_bps",
+			mcp.Description("Cap disk reads to this many bytes per second, at most the server's cap when it has one (optional, defaults to server setting)"),
+		),
+		mcp.WithNumber("io_write_bps",
+			mcp.Description("Cap disk writes to this many bytes per second, at most the server's cap when it has one (optional, defaults to server setting)"),
+		),
+		mcp.WithString("cpus",
+			mcp.Description("CPU cores to pin the command to, e.g. '0-3,6', among the server's cores when it has a set (optional, defaults to server setting)"),
+		),
+		mcp.WithNumber("nice",
+			mcp.Description(fmt.Sprintf("Scheduling niceness, from %d to %d; higher values yield the CPU to other work, e.g. 19 for a heavy build on a shared host (optional, defaults to server setting)", niceMin, niceMax)),
+		),
+		mcp.WithString("io_class",
+			mcp.Description("IO scheduling class, as for ionice: 'idle' only gets disk time no one else wants (optional, defaults to server setting)"),
+			mcp.Enum(ioClasses...),
+		),
+		mcp.WithNumber("io_priority",
+			mcp.Description("IO priority within the IO class, from 0 (highest) to 7; without io_class, within the default class or else best-effort (optional)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Return the resolved shell, arguments, environment, working directory and policy decision without running anything (optional, defaults to false)"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Run a state-changing command even though the same command was just submitted, or one an open maintenance window asks to confirm (optional, defaults to false)"),
+		),
+		r.withWaitFor(),
+		withArtifacts(),
+		r.withProfile(),
+	)
+	return mcp.NewTool("execute_command", opts...)
+}
+
+// handleExecuteCommand handles non-persistent command execution. Once schema
+// version 2 is advertised, calls in the shape of version 1 get a warning
+// naming what replaced the arguments they used.
+func (r *Registry) handleExecuteCommand(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	result, err := r.executeCommand(ctx, request)
+	if result == nil || r.config.ToolSchemaVersion < 2 {
+		return result, err
+	}
+	for _, arg := range deprecatedArgs {
+		if _, given := request.GetArguments()[arg.name]; given {
+			result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf(
+				"Deprecated: '%s' is from version 1 of the execute_command schema and will stop being accepted; %s", arg.name, arg.replacement)))
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// scratchpadTools builds the scratchpad_set, scratchpad_get and
+// scratchpad_delete tools, which only exist when the scratchpad is enabled
+func (r *Registry) scratchpadTools() []server.ServerTool {
+	if r.scratchpad == nil {
+		return nil
+	}
+
+	setTool := mcp.NewTool("scratchpad_set",
+		mcp.WithDescription("Store a value under a key in a scratchpad shared by the sessions and tool calls of this server, to pass data such as IDs, URLs or short results from one to another instead of through environment variables or temp files. Entries expire after their TTL"),
+		mcp.WithString("key",
+			mcp.Required(),
+			mcp.Description("Key to store the value under, e.g. 'build/image-tag': letters, digits and '_.:/-'"),
+		),
+		mcp.WithString("value",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Value to store, replacing any the key had (at most %d bytes)", r.scratchpad.MaxValueBytes())),
+		),
+		mcp.WithNumber("ttl",
+			mcp.Description(fmt.Sprintf("Seconds to keep the entry (optional, defaults to %d, at most %d)", int(r.scratchpad.TTL().Seconds()), int(r.scratchpad.MaxTTL().Seconds()))),
+		),
+	)
+
+	getTool := mcp.NewTool("scratchpad_get",
+		mcp.WithDescription("Read a value from the scratchpad, or without a key list the keys it holds"),
+		mcp.WithString("key",
+			mcp.Description("Key to read (optional; without it, the keys are listed)"),
+		),
+		mcp.WithString("prefix",
+			mcp.Description("Without a key, only list keys starting with this (optional)"),
+		),
+	)
+
+	deleteTool := mcp.NewTool("scratchpad_delete",
+		mcp.WithDescription("Remove an entry from the scratchpad"),
+		mcp.WithString("key",
+			mcp.Required(),
+			mcp.Description("Key to remove"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: setTool, Handler: r.handleScratchpadSet},
+		{Tool: getTool, Handler: r.handleScratchpadGet},
+		{Tool: deleteTool, Handler: r.handleScratchpadDelete},
+	}
+}
+
+// handleScratchpadSet handles storing a scratchpad entry
+func (r *Registry) handleScratchpadSet(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	key, _ := args["key"].(string)
+	value, ok := args["value"].(string)
+	if !ok {
+		return mcp.NewToolResultError("Value is required"), nil
+	}
+	var ttl time.Duration
+	if ttlArg, ok := args["ttl"].(float64); ok {
+		if ttlArg <= 0 {
+			return mcp.NewToolResultError("TTL must be positive"), nil
+		}
+		ttl = time.Duration(ttlArg * float64(time.Second))
+	}
+
+	entry, err := r.scratchpad.Set(key, value, ttl)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to store value: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Stored %s (%d bytes, expires %s)", entry.Key, len(entry.Value), entry.Expires.Format(time.RFC3339))), nil
+}
+
+// handleScratchpadGet handles reading a scratchpad entry or listing the keys
+func (r *Registry) handleScratchpadGet(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	if key, _ := args["key"].(string); key != "" {
+		entry, ok := r.scratchpad.Get(key)
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("No entry for key %s (it may have expired)", key)), nil
+		}
+		return mcp.NewToolResultText(entry.Value), nil
+	}
+
+	prefix, _ := args["prefix"].(string)
+	entries, used := r.scratchpad.List(prefix)
+	if len(entries) == 0 && prefix != "" {
+		return mcp.NewToolResultText(fmt.Sprintf("No scratchpad keys start with %s", prefix)), nil
+	}
+	if len(entries) == 0 {
+		return mcp.NewToolResultText("The scratchpad holds no entries"), nil
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Scratchpad entries (%d of %d bytes in use):\n", used, r.scratchpad.MaxBytes())
+	for _, entry := range entries {
+		fmt.Fprintf(&result, "- %s: %d bytes, updated %s, expires %s\n",
+			entry.Key, len(entry.Value), entry.Updated.Format(time.RFC3339), entry.Expires.Format(time.RFC3339))
+	}
+	return mcp.NewToolResultText(result.String()), nil
+}
+
+// handleScratchpadDelete handles removing a scratchpad entry
+func (r *Registry) handleScratchpadDelete(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	key, _ := request.GetArguments()["key"].(string)
+	if key == "" {
+		return mcp.NewToolResultError("Key is required"), nil
+	}
+	if !r.scratchpad.Delete(key) {
+		return mcp.NewToolResultText(fmt.Sprintf("No entry for key %s", key)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Deleted %s", key)), nil
+}
@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/search"
+)
+
+const (
+	// defaultSearchContext and maxSearchContext bound the lines shown around each match
+	defaultSearchContext = 2
+	maxSearchContext     = 20
+	// defaultSearchLimit and maxSearchLimit bound the matching lines returned
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// searchTools builds the search_output tool
+func (r *Registry) searchTools() []server.ServerTool {
+	searchTool := mcp.NewTool("search_output",
+		mcp.WithDescription("Search the recorded output of commands run in your persistent sessions and of your scheduled jobs' runs, like grep, to answer questions such as 'when did that error first appear?' without running anything again. Matches are returned oldest first with the command that printed them and the lines around them. Output of closed sessions, and what transcripts dropped to stay within their bounds, is not searched"),
+		mcp.WithString("pattern",
+			mcp.Required(),
+			mcp.Description("Regular expression (RE2 syntax) to look for in each line of output, e.g. 'panic:|FATAL'"),
+		),
+		mcp.WithBoolean("ignore_case",
+			mcp.Description("Match regardless of case (optional, defaults to false)"),
+		),
+		mcp.WithBoolean("literal",
+			mcp.Description("Match the pattern as plain text rather than a regular expression (optional, defaults to false)"),
+		),
+		mcp.WithString("source",
+			mcp.Description("What to search (optional, defaults to 'all')"),
+			mcp.Enum("all", "sessions", "jobs"),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("Only search this session (optional)"),
+		),
+		mcp.WithString("job_id",
+			mcp.Description("Only search the runs of this scheduled job (optional)"),
+		),
+		mcp.WithString("since",
+			mcp.Description("Only search commands still running at or after this time: an RFC 3339 time, or a duration ago such as '30m' (optional)"),
+		),
+		mcp.WithString("until",
+			mcp.Description("Only search commands started at or before this time, in the same forms as 'since' (optional)"),
+		),
+		mcp.WithNumber("context",
+			mcp.Description(fmt.Sprintf("Lines to show before and after each match (optional, defaults to %d, at most %d)", defaultSearchContext, maxSearchContext)),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of matching lines to return (optional, defaults to %d, at most %d)", defaultSearchLimit, maxSearchLimit)),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: searchTool, Handler: r.handleSearchOutput},
+	}
+}
+
+// handleSearchOutput handles searching recorded command output
+func (r *Registry) handleSearchOutput(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	pattern, _ := args["pattern"].(string)
+	ignoreCase, _ := args["ignore_case"].(bool)
+	literal, _ := args["literal"].(bool)
+	re, err := search.Compile(pattern, ignoreCase, literal)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid pattern: %v", err)), nil
+	}
+	q := search.Query{Pattern: re, Context: defaultSearchContext, Limit: defaultSearchLimit}
+
+	now := time.Now()
+	if since, _ := args["since"].(string); since != "" {
+		if q.Since, err = search.ParseTime(since, now); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid since: %v", err)), nil
+		}
+	}
+	if until, _ := args["until"].(string); until != "" {
+		if q.Until, err = search.ParseTime(until, now); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid until: %v", err)), nil
+		}
+	}
+	if contextArg, ok := args["context"].(float64); ok && contextArg >= 0 {
+		q.Context = min(int(contextArg), maxSearchContext)
+	}
+	if limitArg, ok := args["limit"].(float64); ok && limitArg > 0 {
+		q.Limit = min(int(limitArg), maxSearchLimit)
+	}
+
+	source, _ := args["source"].(string)
+	if source == "" {
+		source = "all"
+	}
+	if source != "all" && source != "sessions" && source != "jobs" {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid source: %s (use all, sessions or jobs)", source)), nil
+	}
+	sessionID, _ := args["session_id"].(string)
+	jobID, _ := args["job_id"].(string)
+	if sessionID != "" && jobID == "" && source == "all" {
+		source = "sessions"
+	}
+	if jobID != "" && sessionID == "" && source == "all" {
+		source = "jobs"
+	}
+
+	var records []search.Record
+	client, admin := access.Client(ctx), access.IsAdmin(ctx)
+	if source != "jobs" {
+		sessionRecords, err := r.sessionRecords(sessionID, client, admin)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		records = append(records, sessionRecords...)
+	}
+	if source != "sessions" {
+		jobRecords, err := r.jobRecords(jobID, client, admin)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		records = append(records, jobRecords...)
+	}
+
+	found := search.Search(records, q)
+	if len(found.Hits) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("No matches for %s in the output of %d command(s)", pattern, found.Searched)), nil
+	}
+
+	matches := 0
+	for _, hit := range found.Hits {
+		matches += hit.Matches
+	}
+	var result strings.Builder
+	fmt.Fprintf(&result, "%d matching line(s) in %d of %d command(s), oldest first:\n", matches, len(found.Hits), found.Searched)
+	for _, hit := range found.Hits {
+		record := hit.Record
+		fmt.Fprintf(&result, "\n%s [%s] %s: %s\n", record.Source, record.Started.Format(time.RFC3339), record.Status, record.Command)
+		for i, line := range hit.Lines {
+			if hit.Gap(i) {
+				result.WriteString("  --\n")
+			}
+			sep := "-"
+			if line.Match {
+				sep = ":"
+			}
+			fmt.Fprintf(&result, "  %d%s %s\n", line.Number, sep, line.Text)
+		}
+	}
+	if found.Truncated {
+		fmt.Fprintf(&result, "\nStopped at %d matching line(s); narrow the search or raise limit to see more\n", q.Limit)
+	}
+	return mcp.NewToolResultText(result.String()), nil
+}
+
+// sessionRecords returns the recorded commands of the caller's sessions, or
+// of one of them. Other clients' sessions are as good as missing unless the
+// caller is an administrator.
+func (r *Registry) sessionRecords(sessionID, client string, admin bool) ([]search.Record, error) {
+	var ids []string
+	if sessionID != "" {
+		if !r.sessionManager.Exists(sessionID) || (!admin && !r.sessionManager.Owns(sessionID, client)) {
+			return nil, fmt.Errorf("session not found: %s", sessionID)
+		}
+		ids = []string{sessionID}
+	} else {
+		for _, summary := range r.sessionManager.Summaries() {
+			if admin || summary.Owner == client {
+				ids = append(ids, summary.ID)
+			}
+		}
+	}
+
+	var records []search.Record
+	for _, id := range ids {
+		t, err := r.sessionManager.GetTranscript(id)
+		if err != nil {
+			// Closed since it was listed
+			continue
+		}
+		for _, e := range t.Entries() {
+			records = append(records, search.Record{
+				Source:   fmt.Sprintf("session %s #%d", id, e.Seq),
+				Command:  e.Command,
+				Status:   exitStatus(e),
+				Started:  e.Started,
+				Finished: e.Finished,
+				Output:   e.Output,
+			})
+		}
+	}
+	return records, nil
+}
+
+// jobRecords returns the kept runs of the caller's scheduled jobs, or of
+// one of them
+func (r *Registry) jobRecords(jobID, client string, admin bool) ([]search.Record, error) {
+	if r.scheduler == nil {
+		if jobID != "" {
+			return nil, fmt.Errorf("scheduled jobs are disabled")
+		}
+		return nil, nil
+	}
+
+	var ids []string
+	if jobID != "" {
+		ids = []string{jobID}
+	} else {
+		for _, job := range r.scheduler.List(client, admin) {
+			ids = append(ids, job.ID)
+		}
+	}
+
+	var records []search.Record
+	for _, id := range ids {
+		job, results, err := r.scheduler.Results(id, client, admin)
+		if err != nil {
+			if jobID != "" {
+				return nil, err
+			}
+			continue
+		}
+		for _, result := range results {
+			if result.Error != "" {
+				continue
+			}
+			status := fmt.Sprintf("exit %d", result.ExitCode)
+			if result.TimedOut {
+				status = "timed out"
+			}
+			records = append(records, search.Record{
+				Source:   fmt.Sprintf("job %s run %d", job.ID, result.Run),
+				Command:  job.Command,
+				Status:   status,
+				Started:  result.Started,
+				Finished: result.Started.Add(result.Duration),
+				Output:   result.Output,
+			})
+		}
+	}
+	return records, nil
+}
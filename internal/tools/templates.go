@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/progress"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/templates"
+)
+
+// AddTemplates adds the operator's command templates as tools. A template
+// may not take the name of a built-in tool.
+func (r *Registry) AddTemplates(list []templates.Template) error {
+	for _, t := range r.serverTools() {
+		for _, custom := range list {
+			if custom.Name == t.Tool.Name {
+				return fmt.Errorf("tool %q is built in", custom.Name)
+			}
+		}
+	}
+	r.templates = list
+	return nil
+}
+
+// templateTools builds a tool for each command template
+func (r *Registry) templateTools() []server.ServerTool {
+	tools := make([]server.ServerTool, 0, len(r.templates))
+	for _, t := range r.templates {
+		tools = append(tools, server.ServerTool{Tool: t.Tool(), Handler: r.handleTemplate(t)})
+	}
+	return tools
+}
+
+// handleTemplate returns the handler running a command template. The command
+// goes through the same policy, trap and concurrency checks as execute_command,
+// under the template's name.
+func (r *Registry) handleTemplate(t templates.Template) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		shell := t.Shell
+		if shell == "" {
+			shell = r.config.Shell
+		}
+
+		command, err := t.Render(request.GetArguments(), shells.For(shell))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid arguments: %v", err)), nil
+		}
+		if result := r.denied(ctx, policy.Request{Tool: t.Name, Command: command, Cwd: t.Cwd}); result != nil {
+			return result, nil
+		}
+		if result := r.tripped(t.Name, command, t.Cwd, ""); result != nil {
+			return result, nil
+		}
+		if result := r.repeated("client:"+access.Client(ctx)+":"+t.Cwd, command, request.GetArguments()); result != nil {
+			return result, nil
+		}
+
+		release, busy := r.concurrency.Acquire("")
+		if busy != nil {
+			return mcp.NewToolResultError(busy.JSON()), nil
+		}
+		defer release()
+
+		// The executor runs the rendered command as if execute_command had been called
+		args := map[string]interface{}{"command": command}
+		if t.Cwd != "" {
+			args["cwd"] = t.Cwd
+		}
+		if t.Shell != "" {
+			args["shell"] = t.Shell
+		}
+		if t.Timeout > 0 {
+			args["timeout"] = t.Timeout
+		}
+		run := request
+		run.Params.Arguments = args
+
+		ctx = progress.WithReporter(ctx, progress.NewReporter(ctx, request, r.config.ProgressInterval, r.redact))
+		return r.executor.Execute(ctx, run)
+	}
+}
@@ -3,13 +3,38 @@ package tools
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/artifact"
 	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/dedup"
 	"mcp-terminal-server/internal/executor"
+	"mcp-terminal-server/internal/files"
+	"mcp-terminal-server/internal/history"
+	"mcp-terminal-server/internal/idempotency"
+	"mcp-terminal-server/internal/limits"
+	"mcp-terminal-server/internal/pathmap"
+	"mcp-terminal-server/internal/plugins"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/progress"
+	"mcp-terminal-server/internal/ratelimit"
+	"mcp-terminal-server/internal/redact"
+	"mcp-terminal-server/internal/render"
+	"mcp-terminal-server/internal/report"
+	"mcp-terminal-server/internal/schedule"
+	"mcp-terminal-server/internal/scratchpad"
 	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/templates"
+	"mcp-terminal-server/internal/transcript"
+	"mcp-terminal-server/internal/trap"
+	"mcp-terminal-server/internal/workspace"
 )
 
 // Registry holds all the tools and their dependencies
@@ -17,43 +42,77 @@ type Registry struct {
 	config         *config.Config
 	sessionManager *session.Manager
 	executor       *executor.Executor
+	limiter        *limits.Limiter
+	concurrency    *ratelimit.Concurrency
+	files          *files.Service
+	policy         *policy.Engine
+	traps          *trap.Detector
+	redact         *redact.Redactor
+	dedup          *dedup.Guard
+	scheduler      *schedule.Scheduler
+	history        *history.Reader
+	profiles       *profiles.Store
+	scratchpad     *scratchpad.Pad
+	artifacts      *artifact.Store
+	paths          *pathmap.Map
+	workspace      *workspace.Workspace
+	// templates are the operator's command templates, each exposed as a tool
+	templates []templates.Template
+	// plugins are the tools of the plugin executables
+	plugins []*plugins.Tool
 }
 
 // NewRegistry creates a new tools registry
-func NewRegistry(cfg *config.Config, sm *session.Manager, exec *executor.Executor) *Registry {
+func NewRegistry(cfg *config.Config, sm *session.Manager, exec *executor.Executor, policyEngine *policy.Engine, scheduler *schedule.Scheduler, profileStore *profiles.Store) *Registry {
 	return &Registry{
 		config:         cfg,
 		sessionManager: sm,
 		executor:       exec,
+		policy:         policyEngine,
+		scheduler:      scheduler,
+		profiles:       profileStore,
+		limiter:        limits.New(cfg),
+		concurrency:    ratelimit.NewConcurrency(cfg.MaxConcurrent, cfg.MaxConcurrentPerSession),
+		files:          files.New(cfg),
+		traps:          trap.New(cfg),
+		redact:         redact.New(cfg),
+		dedup:          dedup.New(cfg),
+		history:        history.New(cfg),
+		scratchpad:     scratchpad.New(cfg),
+		artifacts:      artifact.New(cfg),
+		paths:          pathmap.New(cfg),
+		workspace:      workspace.New(cfg),
 	}
 }
 
 // RegisterTools registers all tools with the MCP server
 func (r *Registry) RegisterTools(s *server.MCPServer) {
-	// Register execute_command tool
-	executeCommandTool := mcp.NewTool("execute_command",
-		mcp.WithDescription("Execute terminal commands with configurable timeout (non-persistent)"),
-		mcp.WithString("command",
-			mcp.Required(),
-			mcp.Description("The command to execute"),
-		),
-		mcp.WithNumber("timeout",
-			mcp.Description("Timeout in seconds (optional, defaults to 30)"),
-		),
-		mcp.WithString("shell",
-			mcp.Description("Shell to use for execution (optional, defaults to system shell)"),
-		),
-		mcp.WithBoolean("capture_stderr",
-			mcp.Description("Whether to capture stderr separately (optional, defaults to false)"),
-		),
-	)
+	tools := r.serverTools()
+	for i := range tools {
+		render.AddParam(&tools[i].Tool)
+		if r.config.IdempotencyWindow > 0 {
+			idempotency.AddParam(&tools[i].Tool)
+		}
+	}
+	s.AddTools(tools...)
+}
+
+// serverTools builds the tool definitions together with their handlers
+func (r *Registry) serverTools() []server.ServerTool {
+	// Register execute_command tool, in the configured schema version
+	executeCommandTool := r.executeCommandTool()
+	niceMin, niceMax, ioClasses := r.limiter.Bounds()
 
 	// Register persistent_shell tool
 	persistentShellTool := mcp.NewTool("persistent_shell",
 		mcp.WithDescription("Execute commands in persistent shell sessions - maintains state between commands"),
 		mcp.WithString("command",
 			mcp.Required(),
-			mcp.Description("The command to execute"),
+			mcp.Description("The command to execute, or the program to run when 'args' is given"),
+		),
+		mcp.WithArray("args",
+			mcp.Description("Arguments of the program in 'command', each quoted for the session's shell so it arrives exactly as given, with spaces, quotes, unicode and metacharacters (optional)"),
+			mcp.WithStringItems(),
 		),
 		mcp.WithString("session_id",
 			mcp.Required(),
@@ -65,6 +124,48 @@ func (r *Registry) RegisterTools(s *server.MCPServer) {
 		mcp.WithString("shell",
 			mcp.Description("Shell to use for execution (optional, defaults to system shell)"),
 		),
+		mcp.WithString("cwd",
+			mcp.Description("Initial working directory of the session (optional, applied when the session is created)"),
+		),
+		withEncoding(),
+		mcp.WithNumber("io_read_bps",
+			mcp.Description("Cap disk reads of the session to this many bytes per second, at most the server's cap when it has one (optional, applied when the session is created)"),
+		),
+		mcp.WithNumber("io_write_bps",
+			mcp.Description("Cap disk writes of the session to this many bytes per second, at most the server's cap when it has one (optional, applied when the session is created)"),
+		),
+		mcp.WithString("cpus",
+			mcp.Description("CPU cores to pin the session to, e.g. '0-3,6', among the server's cores when it has a set (optional, applied when the session is created)"),
+		),
+		mcp.WithNumber("nice",
+			mcp.Description(fmt.Sprintf("Scheduling niceness of the session, from %d to %d; higher values yield the CPU to other work (optional, applied when the session is created)", niceMin, niceMax)),
+		),
+		mcp.WithString("io_class",
+			mcp.Description("IO scheduling class of the session, as for ionice: 'idle' only gets disk time no one else wants (optional, applied when the session is created)"),
+			mcp.Enum(ioClasses...),
+		),
+		mcp.WithNumber("io_priority",
+			mcp.Description("IO priority of the session within its IO class, from 0 (highest) to 7; without io_class, within the default class or else best-effort (optional, applied when the session is created)"),
+		),
+		mcp.WithString("owner_token",
+			mcp.Description("Owner token of a session created from another connection (optional)"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Run a state-changing command even though the same command was just submitted to the session, or one an open maintenance window asks to confirm (optional, defaults to false)"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Human-readable name of the session (optional, applied when the session is created)"),
+		),
+		mcp.WithString("description",
+			mcp.Description("What the session is for (optional, applied when the session is created)"),
+		),
+		mcp.WithArray("tags",
+			mcp.Description("Tags to attach to the session, e.g. ['deploy', 'team=infra'] (optional, applied when the session is created)"),
+			mcp.WithStringItems(),
+		),
+		r.withWaitFor(),
+		withArtifacts(),
+		r.withProfile(),
 	)
 
 	// Register session_manager tool
@@ -72,23 +173,144 @@ func (r *Registry) RegisterTools(s *server.MCPServer) {
 		mcp.WithDescription("Manage persistent shell sessions"),
 		mcp.WithString("action",
 			mcp.Required(),
-			mcp.Description("Action: 'list' to show sessions, 'close' to close a session"),
-			mcp.Enum("list", "close"),
+			mcp.Description("Action: 'list' to show sessions, 'close' to close a session, 'close_all' to close every session of yours (every session for administrators), 'pause' to suspend the session's running command, with its timeout, leaving the shell and background jobs running, 'resume' to continue it, 'history' to list past commands, 'transcript' to page through commands with their output, 'adopt' to take over an existing tmux pane as a session, 'observe' to create a link for watching the session over HTTP, 'request_control' to ask a human operator to hand the session back, 'release_control' to hand it to the operator, 'annotate' to attach a note to the session's history, 'report' to compile the session into a shareable report, 'set_meta' to change the session's name, description or tags, 'info' to show everything known about the session, 'pin' to keep the session open however long it is idle, 'unpin' to undo that, 'send_keys' to type into the tmux pane of an adopted session or one of the tmux backend, even while a command runs, 'screen' to show what that pane displays"),
+			mcp.Enum("list", "close", "close_all", "pause", "resume", "history", "transcript", "adopt", "observe", "request_control", "release_control", "annotate", "report", "set_meta", "info", "pin", "unpin", "send_keys", "screen"),
 		),
 		mcp.WithString("session_id",
-			mcp.Description("Session ID (required for 'close' action)"),
+			mcp.Description("Session ID (required for all actions except 'list' and 'close_all'; '*' with 'observe' grants the event streams of every session to administrators)"),
+		),
+		mcp.WithNumber("from",
+			mcp.Description("Sequence number of the first command to show (optional, for 'history' and 'transcript')"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of commands to show (optional, for 'history' and 'transcript', defaults to 20 for 'transcript'), or lines of scrollback to show above the screen (optional, for 'screen')"),
+		),
+		mcp.WithString("target",
+			mcp.Description("tmux pane to adopt, e.g. 'work:1.0' or '%3' (for 'adopt')"),
+		),
+		mcp.WithNumber("pid",
+			mcp.Description("PID of a process running in the tmux pane to adopt, instead of 'target' (for 'adopt')"),
+		),
+		mcp.WithString("text",
+			mcp.Description("Text to type literally, e.g. an answer to a prompt (for 'send_keys')"),
+		),
+		mcp.WithArray("keys",
+			mcp.Description("Keys to press after the text, by their tmux names, such as Enter, Escape, C-c, Up or F1, or single characters, e.g. ['Enter'] or ['C-c']; anything else goes in 'text' (for 'send_keys')"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("role",
+			mcp.Description("'observer' for read-only access or 'operator' to let a human take turns controlling the session (optional, for 'observe', defaults to 'observer')"),
+			mcp.Enum(session.RoleObserver, session.RoleOperator),
+		),
+		mcp.WithString("note",
+			mcp.Description("Text of the note, e.g. 'starting migration' or why a command failed (required for 'annotate')"),
+		),
+		mcp.WithNumber("seq",
+			mcp.Description("Sequence number of the command the note follows (optional, for 'annotate', defaults to the latest command)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Report format (optional, for 'report', defaults to 'markdown')"),
+			mcp.Enum(report.FormatMarkdown, report.FormatHTML),
+		),
+		mcp.WithString("name",
+			mcp.Description("New name of the session, empty to remove it (optional, for 'set_meta')"),
+		),
+		mcp.WithString("description",
+			mcp.Description("New description of the session, empty to remove it (optional, for 'set_meta')"),
+		),
+		mcp.WithArray("tags",
+			mcp.Description("Tags replacing the session's current ones, empty to remove them (optional, for 'set_meta')"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("owner_token",
+			mcp.Description("Owner token of a session created from another connection (optional)"),
 		),
 	)
 
-	// Add tool handlers
-	s.AddTool(executeCommandTool, r.handleExecuteCommand)
-	s.AddTool(persistentShellTool, r.handlePersistentShell)
-	s.AddTool(sessionTool, r.handleSessionManager)
+	tools := []server.ServerTool{
+		{Tool: executeCommandTool, Handler: r.handleExecuteCommand},
+		{Tool: persistentShellTool, Handler: r.handlePersistentShell},
+		{Tool: sessionTool, Handler: r.handleSessionManager},
+	}
+	tools = append(tools, r.fileTools()...)
+	tools = append(tools, r.processTools()...)
+	tools = append(tools, r.policyTools()...)
+	tools = append(tools, r.watchTools()...)
+	tools = append(tools, r.scheduleTools()...)
+	tools = append(tools, r.interruptTools()...)
+	tools = append(tools, r.environmentTools()...)
+	tools = append(tools, r.historyTools()...)
+	tools = append(tools, r.searchTools()...)
+	tools = append(tools, r.scratchpadTools()...)
+	tools = append(tools, r.artifactTools()...)
+	tools = append(tools, r.profileTools()...)
+	tools = append(tools, r.templateTools()...)
+	tools = append(tools, r.pluginTools()...)
+
+	return tools
 }
 
-// handleExecuteCommand handles non-persistent command execution
-func (r *Registry) handleExecuteCommand(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return r.executor.Execute(request)
+// executeCommand runs an execute_command call
+func (r *Registry) executeCommand(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if dryRun, _ := request.GetArguments()["dry_run"].(bool); dryRun {
+		return r.dryRun(ctx, request), nil
+	}
+
+	if command := oneOffCommand(request.GetArguments(), shells.For(r.config.Shell)); command != "" {
+		cwd, _ := request.GetArguments()["cwd"].(string)
+		confirmed, _ := request.GetArguments()["confirm"].(bool)
+		if result := r.denied(ctx, policy.Request{Tool: "execute_command", Command: command, Cwd: cwd, Confirmed: confirmed}); result != nil {
+			return result, nil
+		}
+		if result := r.tripped("execute_command", command, cwd, ""); result != nil {
+			return result, nil
+		}
+		// One-off commands have no shell session, so repeats are matched per connection and directory
+		if result := r.repeated("client:"+access.Client(ctx)+":"+cwd, command, request.GetArguments()); result != nil {
+			return result, nil
+		}
+	}
+
+	// Waiting holds no concurrency slot
+	waited, notReady := r.waitFor(ctx, request.GetArguments())
+	if notReady != nil {
+		return notReady, nil
+	}
+
+	release, busy := r.concurrency.Acquire("")
+	if busy != nil {
+		return mcp.NewToolResultError(busy.JSON()), nil
+	}
+	defer release()
+
+	cwd, _ := request.GetArguments()["cwd"].(string)
+	artifacts := r.prepareArtifacts(request.GetArguments(), r.commandDir(cwd))
+
+	ctx = progress.WithReporter(ctx, progress.NewReporter(ctx, request, r.config.ProgressInterval, r.redact))
+	result, err := r.executor.Execute(ctx, request)
+	if waited != "" && result != nil {
+		result.Content = append(result.Content, mcp.NewTextContent(waited))
+	}
+	if result != nil && !result.IsError {
+		r.keepArtifacts(ctx, artifacts, oneOffCommand(request.GetArguments(), shells.For(r.config.Shell)), "", result)
+	}
+	return result, err
+}
+
+// dryRun previews a command: how it would be run and whether the policy allows
+// it. Nothing is executed, so trap paths and concurrency limits do not apply.
+func (r *Registry) dryRun(ctx context.Context, request mcp.CallToolRequest) *mcp.CallToolResult {
+	result := r.executor.DryRun(ctx, request)
+	if result.IsError {
+		return result
+	}
+
+	command := oneOffCommand(request.GetArguments(), shells.For(r.config.Shell))
+	cwd, _ := request.GetArguments()["cwd"].(string)
+	confirmed, _ := request.GetArguments()["confirm"].(bool)
+	decision := r.policy.Evaluate(policy.Request{Tool: "execute_command", Command: command, Role: access.IdentityFrom(ctx).Role, Transport: access.Transport(ctx), Cwd: cwd, Confirmed: confirmed, Restrictions: profiles.Restrictions(ctx)})
+	result.Content = append(result.Content, mcp.NewTextContent(decision.String()))
+	return result
 }
 
 // handlePersistentShell handles persistent shell command execution
@@ -105,10 +327,8 @@ func (r *Registry) handlePersistentShell(ctx context.Context, request mcp.CallTo
 		return mcp.NewToolResultError("Session ID is required"), nil
 	}
 
-	// Get timeout
-	timeout := r.config.DefaultTimeout
-	if timeoutArg, ok := args["timeout"].(float64); ok && timeoutArg > 0 {
-		timeout = time.Duration(timeoutArg) * time.Second
+	if result := r.authorize(ctx, args, sessionID); result != nil {
+		return result, nil
 	}
 
 	// Get shell
@@ -116,8 +336,81 @@ func (r *Registry) handlePersistentShell(ctx context.Context, request mcp.CallTo
 	if shellArg, ok := args["shell"].(string); ok && shellArg != "" {
 		shell = shellArg
 	}
+	command = commandLine(args, r.sessionManager.Profile(sessionID, shell))
+
+	cwd, _ := args["cwd"].(string)
+	confirmed, _ := args["confirm"].(bool)
+	if result := r.denied(ctx, policy.Request{Tool: "persistent_shell", Command: command, Target: sessionID, Cwd: cwd, Confirmed: confirmed}); result != nil {
+		return result, nil
+	}
+	if result := r.tripped("persistent_shell", command, cwd, sessionID); result != nil {
+		return result, nil
+	}
+	if result := r.repeated("session:"+sessionID, command, args); result != nil {
+		return result, nil
+	}
+	waited, notReady := r.waitFor(ctx, args)
+	if notReady != nil {
+		return notReady, nil
+	}
 
-	return r.sessionManager.ExecuteCommand(sessionID, command, timeout, shell, false)
+	// Get timeout
+	timeout := r.config.DefaultTimeout
+	if timeoutArg, ok := args["timeout"].(float64); ok && timeoutArg > 0 {
+		timeout = time.Duration(timeoutArg) * time.Second
+	}
+
+	spec, err := r.limiter.SpecFromArgs(args)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid resource limits: %v", err)), nil
+	}
+
+	// Get working directory
+	workingDir, _ := args["cwd"].(string)
+
+	opts := session.Options{
+		Shell:      shell,
+		WorkingDir: workingDir,
+		Limits:     spec,
+		Owner:      access.Client(ctx),
+		Env:        profiles.Env(ctx),
+		User:       profiles.User(ctx),
+	}
+	opts.Encoding, _ = args["encoding"].(string)
+	if p, ok := profiles.FromContext(ctx); ok && len(p.Teardown) > 0 {
+		opts.Teardown = &session.Teardown{
+			Profile:  p.Name,
+			Commands: p.Teardown,
+			Timeout:  time.Duration(p.TeardownTimeout * float64(time.Second)),
+		}
+	}
+	opts.Meta.Name, _ = args["name"].(string)
+	opts.Meta.Description, _ = args["description"].(string)
+	opts.Meta.Tags, _ = stringList(args, "tags")
+
+	release, busy := r.concurrency.Acquire(sessionID)
+	if busy != nil {
+		return mcp.NewToolResultError(busy.JSON()), nil
+	}
+	defer release()
+
+	created := !r.sessionManager.Exists(sessionID)
+	artifacts := r.prepareArtifacts(args, r.sessionDir(sessionID, workingDir))
+
+	ctx = progress.WithReporter(ctx, progress.NewReporter(ctx, request, r.config.ProgressInterval, r.redact))
+	result, err := r.sessionManager.ExecuteCommand(ctx, sessionID, command, timeout, opts, false)
+	if waited != "" && result != nil {
+		result.Content = append(result.Content, mcp.NewTextContent(waited))
+	}
+	if result != nil && !result.IsError {
+		r.keepArtifacts(ctx, artifacts, command, sessionID, result)
+	}
+	if created && result != nil {
+		if text, ok := r.ownerTokenText(sessionID); ok {
+			result.Content = append(result.Content, text)
+		}
+	}
+	return result, err
 }
 
 // handleSessionManager handles session management operations
@@ -129,9 +422,22 @@ func (r *Registry) handleSessionManager(ctx context.Context, request mcp.CallToo
 		return mcp.NewToolResultError("Action is required"), nil
 	}
 
+	if sessionID, _ := args["session_id"].(string); sessionID != "" && sessionID != session.AllSessions {
+		if result := r.authorize(ctx, args, sessionID); result != nil {
+			return result, nil
+		}
+	}
+
 	switch action {
 	case "list":
+		// Other clients' sessions are hidden unless the caller is an administrator
+		client, admin := access.Client(ctx), access.IsAdmin(ctx)
 		sessions := r.sessionManager.ListSessions()
+		for id, info := range sessions {
+			if owner, _ := info.(map[string]interface{})["owner"].(string); !admin && owner != client {
+				delete(sessions, id)
+			}
+		}
 		if len(sessions) == 0 {
 			return mcp.NewToolResultText("No active sessions"), nil
 		}
@@ -139,8 +445,36 @@ func (r *Registry) handleSessionManager(ctx context.Context, request mcp.CallToo
 		result := "Active Sessions:\n"
 		for id, info := range sessions {
 			infoMap := info.(map[string]interface{})
-			result += fmt.Sprintf("- %s: %s (PID: %v, Created: %s, Last Used: %s, Alive: %v)\n",
-				id, infoMap["shell"], infoMap["pid"], infoMap["created"], infoMap["last_used"], infoMap["alive"])
+			result += fmt.Sprintf("- %s", id)
+			if name, _ := infoMap["name"].(string); name != "" {
+				result += fmt.Sprintf(" %q", name)
+			}
+			result += fmt.Sprintf(": %s (PID: %v, Created: %s, Last Used: %s, Alive: %v, Paused: %v)",
+				infoMap["shell"], infoMap["pid"], infoMap["created"], infoMap["last_used"], infoMap["alive"], infoMap["paused"])
+			if tags, _ := infoMap["tags"].([]string); len(tags) > 0 {
+				result += fmt.Sprintf(" [tags: %s]", strings.Join(tags, ", "))
+			}
+			if adopted, _ := infoMap["adopted"].(string); adopted != "" {
+				result += fmt.Sprintf(" [adopted %s]", adopted)
+			}
+			if controller, _ := infoMap["controller"].(string); controller != session.ControllerAgent {
+				result += fmt.Sprintf(" [controlled by %s]", controller)
+			}
+			if frozen, _ := infoMap["frozen"].(string); frozen != "" {
+				result += fmt.Sprintf(" [frozen: %s]", frozen)
+			}
+			if pinned, _ := infoMap["pinned"].(bool); pinned {
+				result += " [pinned]"
+			}
+			if usage, ok := infoMap["usage"].(session.Usage); ok && usage.Commands > 0 {
+				result += fmt.Sprintf(" [%d commands, ran %s, CPU %s, output %s",
+					usage.Commands, usage.WallTime.Round(time.Millisecond), usage.CPUTime.Round(time.Millisecond), formatBytes(usage.OutputBytes))
+				if usage.LastFailure != nil {
+					result += fmt.Sprintf(", last failure #%d %s", usage.LastFailure.Seq, exitStatus(*usage.LastFailure))
+				}
+				result += "]"
+			}
+			result += "\n"
 		}
 
 		return mcp.NewToolResultText(result), nil
@@ -151,90 +485,498 @@ func (r *Registry) handleSessionManager(ctx context.Context, request mcp.CallToo
 			return mcp.NewToolResultError("Session ID is required for close action"), nil
 		}
 
-		if err := r.sessionManager.CloseSession(sessionID); err != nil {
+		teardown, err := r.sessionManager.CloseSession(sessionID)
+		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("Failed to close session: %v", err)), nil
 		}
 
-		return mcp.NewToolResultText(fmt.Sprintf("Session closed: %s", sessionID)), nil
+		result := fmt.Sprintf("Session closed: %s", sessionID)
+		if summary := session.TeardownSummary(teardown); summary != "" {
+			result += "\n" + summary
+		}
+		return mcp.NewToolResultText(result), nil
+
+	case "close_all":
+		// Like list, other clients' sessions are left alone unless the caller is an administrator
+		closed := r.sessionManager.CloseAll(access.Client(ctx), access.IsAdmin(ctx))
+		if len(closed) == 0 {
+			return mcp.NewToolResultText("No active sessions"), nil
+		}
+
+		ids := make([]string, 0, len(closed))
+		for id := range closed {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		result := fmt.Sprintf("Closed %d session(s):\n", len(ids))
+		for _, id := range ids {
+			result += "- " + id + "\n"
+			if summary := session.TeardownSummary(closed[id]); summary != "" {
+				result += "  " + strings.ReplaceAll(summary, "\n", "\n  ") + "\n"
+			}
+		}
+		return mcp.NewToolResultText(result), nil
+
+	case "pause":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for pause action"), nil
+		}
+		if result := r.readOnly(ctx, "sessions cannot be paused"); result != nil {
+			return result, nil
+		}
+
+		if err := r.sessionManager.PauseSession(sessionID); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to pause session: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Session paused: %s (its running command is stopped and new commands are refused until resumed)", sessionID)), nil
+
+	case "resume":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for resume action"), nil
+		}
+		if result := r.readOnly(ctx, "sessions cannot be resumed"); result != nil {
+			return result, nil
+		}
+
+		if err := r.sessionManager.ResumeSession(sessionID); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to resume session: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Session resumed: %s", sessionID)), nil
+
+	case "adopt":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for adopt action"), nil
+		}
+
+		target, _ := args["target"].(string)
+		pid := 0
+		if pidArg, ok := args["pid"].(float64); ok {
+			pid = int(pidArg)
+		}
+		if target == "" && pid == 0 {
+			return mcp.NewToolResultError("Either target or pid is required for adopt action"), nil
+		}
+
+		adopted, err := r.sessionManager.AdoptTmux(sessionID, target, pid, access.Client(ctx))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to adopt terminal: %v", err)), nil
+		}
+
+		result := mcp.NewToolResultText(fmt.Sprintf("Adopted %s as session %s (shell: %s, PID: %d). Closing the session detaches without killing the terminal.",
+			adopted.Adopted, sessionID, adopted.Shell, adopted.Pid))
+		if text, ok := r.ownerTokenText(sessionID); ok {
+			result.Content = append(result.Content, text)
+		}
+		return result, nil
+
+	case "observe":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for observe action"), nil
+		}
+		if sessionID == session.AllSessions && !access.IsAdmin(ctx) {
+			return mcp.NewToolResultError("Access denied: observing every session requires the admin token"), nil
+		}
+
+		role, _ := args["role"].(string)
+		token, err := r.sessionManager.Observe(sessionID, role)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to observe session: %v", err)), nil
+		}
+
+		if sessionID == session.AllSessions {
+			return mcp.NewToolResultText(fmt.Sprintf("Read-only observer token for every session: %s\nWatch live events: GET /sessions/observe?token=%s (server-sent events; add &sessions=a,b or &types=output,exit to filter)\nThe token stays valid while the server runs and does not allow sending input.",
+				token, token)), nil
+		}
+
+		if role == session.RoleOperator {
+			return mcp.NewToolResultText(fmt.Sprintf("Operator token for session %s: %s\nWatch live output: GET /sessions/observe?token=%s (server-sent events)\nRead history: GET /sessions/history?token=%s\nRequest, take or release control: POST /sessions/control?token=%s&action=request|take|release\nSend a command while holding control: POST /sessions/input?token=%s\nThe token is valid until the session closes.",
+				sessionID, token, token, token, token, token)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Read-only observer token for session %s: %s\nWatch live output: GET /sessions/observe?token=%s (server-sent events)\nRead history: GET /sessions/history?token=%s\nThe token is valid until the session closes and does not allow sending input.",
+			sessionID, token, token, token)), nil
+
+	case "request_control":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for request_control action"), nil
+		}
+
+		held, err := r.sessionManager.RequestControl(sessionID, session.ControllerAgent)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to request control: %v", err)), nil
+		}
+		if held {
+			return mcp.NewToolResultText(fmt.Sprintf("You already control session %s", sessionID)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Requested control of session %s from the operator; commands are refused until they release it", sessionID)), nil
+
+	case "release_control":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for release_control action"), nil
+		}
+
+		if err := r.sessionManager.ReleaseControl(sessionID, session.ControllerAgent); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to release control: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Handed control of session %s to the operator", sessionID)), nil
+
+	case "annotate":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for annotate action"), nil
+		}
+
+		text, _ := args["note"].(string)
+		if strings.TrimSpace(text) == "" {
+			return mcp.NewToolResultError("Note is required for annotate action"), nil
+		}
+		after := -1
+		if seqArg, ok := args["seq"].(float64); ok && seqArg >= 0 {
+			after = int(seqArg)
+		}
+
+		note, err := r.sessionManager.Annotate(sessionID, after, session.ControllerAgent, text)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to annotate session: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Added note to session %s after command #%d", sessionID, note.After)), nil
+
+	case "report":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for report action"), nil
+		}
+
+		rep, err := r.sessionManager.Report(sessionID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to build report: %v", err)), nil
+		}
+
+		format, _ := args["format"].(string)
+		text, err := rep.Render(format)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to build report: %v", err)), nil
+		}
+
+		render.Document(ctx)
+		return mcp.NewToolResultText(text), nil
+
+	case "set_meta":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for set_meta action"), nil
+		}
+
+		var update session.MetaUpdate
+		if name, ok := args["name"].(string); ok {
+			update.Name = &name
+		}
+		if description, ok := args["description"].(string); ok {
+			update.Description = &description
+		}
+		if tags, ok := stringList(args, "tags"); ok {
+			update.Tags = &tags
+		}
+		if update.Name == nil && update.Description == nil && update.Tags == nil {
+			return mcp.NewToolResultError("At least one of name, description or tags is required for set_meta action"), nil
+		}
+
+		meta, err := r.sessionManager.SetMeta(sessionID, update)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to set metadata: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Updated session %s: name %q, description %q, tags [%s]",
+			sessionID, meta.Name, meta.Description, strings.Join(meta.Tags, ", "))), nil
+
+	case "info":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for info action"), nil
+		}
+
+		info, err := r.sessionManager.Info(sessionID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get session info: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(formatInfo(info)), nil
+
+	case "pin", "unpin":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError(fmt.Sprintf("Session ID is required for %s action", action)), nil
+		}
+
+		if err := r.sessionManager.SetPinned(sessionID, action == "pin"); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to %s session: %v", action, err)), nil
+		}
+
+		if action == "pin" {
+			return mcp.NewToolResultText(fmt.Sprintf("Session pinned: %s (it stays open however long it is idle; close it when done)", sessionID)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Session unpinned: %s", sessionID)), nil
+
+	case "send_keys":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for send_keys action"), nil
+		}
+		text, _ := args["text"].(string)
+		keys, _ := stringList(args, "keys")
+		if text == "" && len(keys) == 0 {
+			return mcp.NewToolResultError("Text or keys are required for send_keys action"), nil
+		}
+
+		// Typed text can run a command as well as the command tools can, so
+		// it is checked, and so is each line the text and keys submit
+		lines, err := r.sessionManager.Typed(sessionID, text, keys)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to send keys: %v", err)), nil
+		}
+		if text != "" && !slices.Contains(lines, text) {
+			lines = append([]string{text}, lines...)
+		}
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if result := r.denied(ctx, policy.Request{Tool: "session_manager", Command: line, Target: sessionID}); result != nil {
+				return result, nil
+			}
+			if result := r.tripped("session_manager", line, "", sessionID); result != nil {
+				return result, nil
+			}
+		}
+
+		if err := r.sessionManager.SendKeys(sessionID, text, keys, session.ControllerAgent); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to send keys: %v", err)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Sent %d characters and %d keys to session %s; use the 'screen' action to see the result", len([]rune(text)), len(keys), sessionID)), nil
+
+	case "screen":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError("Session ID is required for screen action"), nil
+		}
+		history := 0
+		if limitArg, ok := args["limit"].(float64); ok && limitArg > 0 {
+			history = int(limitArg)
+		}
+
+		screen, err := r.sessionManager.Screen(sessionID, history)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to capture screen: %v", err)), nil
+		}
+		return mcp.NewToolResultText(screen), nil
+
+	case "history", "transcript":
+		sessionID, ok := args["session_id"].(string)
+		if !ok || sessionID == "" {
+			return mcp.NewToolResultError(fmt.Sprintf("Session ID is required for %s action", action)), nil
+		}
+
+		t, err := r.sessionManager.GetTranscript(sessionID)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to get %s: %v", action, err)), nil
+		}
+
+		from := 0
+		if fromArg, ok := args["from"].(float64); ok && fromArg > 0 {
+			from = int(fromArg)
+		}
+		limit := 0
+		if action == "transcript" {
+			limit = 20
+		}
+		if limitArg, ok := args["limit"].(float64); ok && limitArg > 0 {
+			limit = int(limitArg)
+		}
+
+		entries, more := t.Page(from, limit)
+		if len(entries) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("No recorded commands for session %s", sessionID)), nil
+		}
+
+		// Notes are shown after the command they follow, or first if they precede the page
+		notes := make(map[int][]transcript.Note)
+		for _, n := range t.Notes() {
+			after := n.After
+			if after < entries[0].Seq {
+				if from > 0 {
+					continue
+				}
+				after = 0
+			}
+			notes[after] = append(notes[after], n)
+		}
+		writeNotes := func(result *strings.Builder, after int) {
+			for _, n := range notes[after] {
+				fmt.Fprintf(result, "  [note by %s at %s] %s\n", n.Author, n.Time.Format(time.RFC3339), n.Text)
+			}
+		}
+
+		var result strings.Builder
+		if action == "history" {
+			fmt.Fprintf(&result, "Command history for session %s:\n", sessionID)
+			writeNotes(&result, 0)
+			for _, e := range entries {
+				fmt.Fprintf(&result, "#%d [%s] %s (%s): %s\n",
+					e.Seq, e.Started.Format(time.RFC3339), exitStatus(e), e.Duration().Round(time.Millisecond), e.Command)
+				writeNotes(&result, e.Seq)
+			}
+		} else {
+			fmt.Fprintf(&result, "Transcript for session %s:\n", sessionID)
+			writeNotes(&result, 0)
+			for _, e := range entries {
+				fmt.Fprintf(&result, "--- #%d [%s] %s (%s) ---\n$ %s\n%s",
+					e.Seq, e.Started.Format(time.RFC3339), exitStatus(e), e.Duration().Round(time.Millisecond), e.Command, e.TimedOutput())
+				writeNotes(&result, e.Seq)
+			}
+		}
+		if more {
+			fmt.Fprintf(&result, "More commands available, continue with from=%d\n", entries[len(entries)-1].Seq+1)
+		}
+
+		render.Raw(ctx)
+		return mcp.NewToolResultText(result.String()), nil
 
 	default:
 		return mcp.NewToolResultError(fmt.Sprintf("Unknown action: %s", action)), nil
 	}
 }
 
+// formatInfo describes a session for the info action
+func formatInfo(info session.Info) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session %s\n", info.ID)
+	if info.Meta.Name != "" {
+		fmt.Fprintf(&b, "Name: %s\n", info.Meta.Name)
+	}
+	if info.Meta.Description != "" {
+		fmt.Fprintf(&b, "Description: %s\n", info.Meta.Description)
+	}
+	if len(info.Meta.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(info.Meta.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "Shell: %s (PID: %d, Alive: %v, Paused: %v)\n", info.Shell, info.Pid, info.Alive, info.Paused)
+	if info.Pinned {
+		fmt.Fprintf(&b, "Pinned: kept open however long it is idle\n")
+	}
+	if info.Cwd != "" {
+		fmt.Fprintf(&b, "Working directory: %s\n", info.Cwd)
+	}
+	if info.Adopted != "" {
+		fmt.Fprintf(&b, "Adopted: %s\n", info.Adopted)
+	}
+	if info.TmuxSession != "" {
+		fmt.Fprintf(&b, "tmux session: %s (attach with: tmux attach -t %s)\n", info.TmuxSession, info.TmuxSession)
+	}
+	fmt.Fprintf(&b, "Created: %s\nLast used: %s\n", info.Created.Format(time.RFC3339), info.LastUsed.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Commands: %d (ran for %s, CPU time %s)\nOutput: %d bytes\n",
+		info.Usage.Commands, info.Usage.WallTime.Round(time.Millisecond), info.Usage.CPUTime.Round(time.Millisecond), info.Usage.OutputBytes)
+	if failure := info.Usage.LastFailure; failure != nil {
+		fmt.Fprintf(&b, "Last failure: #%d [%s] %s: %s\n", failure.Seq, failure.Finished.Format(time.RFC3339), exitStatus(*failure), failure.Command)
+	}
+	if info.Restarts > 0 {
+		fmt.Fprintf(&b, "Shell restarts: %d\n", info.Restarts)
+	}
+	fmt.Fprintf(&b, "Owner: %s\nController: %s\n", info.Owner, info.Controller)
+	if info.Frozen != "" {
+		fmt.Fprintf(&b, "Frozen: %s\n", info.Frozen)
+	}
+	if len(info.EnvNames) > 0 {
+		fmt.Fprintf(&b, "Environment at start (%d variables, values hidden): %s\n", len(info.EnvNames), strings.Join(info.EnvNames, ", "))
+	}
+	return b.String()
+}
+
+// stringList reads an argument holding a list of strings, skipping other values
+func stringList(args map[string]interface{}, key string) ([]string, bool) {
+	items, ok := args[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list, true
+}
+
+// commandLine returns the command of a call as a shell line. A program given
+// with 'args' is joined with them, each quoted for profile, so the shell
+// passes spaces, unicode and metacharacters in them on literally.
+func commandLine(args map[string]interface{}, profile shells.Profile) string {
+	if argv, ok := executor.Argv(args); ok {
+		return profile.Join(argv)
+	}
+	command, _ := args["command"].(string)
+	return command
+}
+
+// oneOffCommand returns the command of an execute_command call: its script,
+// or its command as a shell line
+func oneOffCommand(args map[string]interface{}, profile shells.Profile) string {
+	if script, ok := executor.Script(args); ok {
+		return script
+	}
+	return commandLine(args, profile)
+}
+
+// withScript adds the script argument of execute_command, which takes one
+// block of text or a list of lines
+func withScript() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		t.InputSchema.Properties["script"] = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"description": "A multi-line script, as one block of text or a list of lines, written to a file and run by the shell, so here-documents, quotes and dollar signs need no escaping. A first line such as '#!/usr/bin/env python3' runs it with that interpreter instead (give instead of 'command')",
+		}
+	}
+}
+
+// withEncoding adds the encoding parameter, which says what the output of a
+// command is in when it is not UTF-8
+func withEncoding() mcp.ToolOption {
+	return mcp.WithString("encoding",
+		mcp.Description("Character encoding of the command's output, converted to UTF-8 in the result: 'auto' converts output that is not valid UTF-8 from the encoding it reads sensibly in, or a name such as 'shift_jis', 'gbk', 'euc-kr', 'big5' or 'latin1' (optional, defaults to server setting)"),
+	)
+}
+
+// exitStatus describes how a recorded command finished
+func exitStatus(e transcript.Entry) string {
+	if e.TimedOut {
+		return "timed out"
+	}
+	return fmt.Sprintf("exit %d", e.ExitCode)
+}
+
 // GetToolSchemas returns the tool schemas for HTTP handlers
 func (r *Registry) GetToolSchemas() []map[string]interface{} {
-	return []map[string]interface{}{
-		{
-			"name":        "execute_command",
-			"description": "Execute terminal commands with configurable timeout (non-persistent)",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"command": map[string]interface{}{
-						"type":        "string",
-						"description": "The command to execute",
-					},
-					"timeout": map[string]interface{}{
-						"type":        "number",
-						"description": "Timeout in seconds (optional, defaults to 30)",
-					},
-					"shell": map[string]interface{}{
-						"type":        "string",
-						"description": "Shell to use for execution (optional, defaults to system shell)",
-					},
-					"capture_stderr": map[string]interface{}{
-						"type":        "boolean",
-						"description": "Whether to capture stderr separately (optional, defaults to false)",
-					},
-				},
-				"required": []string{"command"},
-			},
-		},
-		{
-			"name":        "persistent_shell",
-			"description": "Execute commands in persistent shell sessions - maintains state between commands",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"command": map[string]interface{}{
-						"type":        "string",
-						"description": "The command to execute",
-					},
-					"session_id": map[string]interface{}{
-						"type":        "string",
-						"description": "Session ID to maintain persistent shell state",
-					},
-					"timeout": map[string]interface{}{
-						"type":        "number",
-						"description": "Timeout in seconds (optional, defaults to 30)",
-					},
-					"shell": map[string]interface{}{
-						"type":        "string",
-						"description": "Shell to use for execution (optional, defaults to system shell)",
-					},
-				},
-				"required": []string{"command", "session_id"},
-			},
-		},
-		{
-			"name":        "session_manager",
-			"description": "Manage persistent shell sessions",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"action": map[string]interface{}{
-						"type":        "string",
-						"description": "Action: 'list' to show sessions, 'close' to close a session",
-						"enum":        []string{"list", "close"},
-					},
-					"session_id": map[string]interface{}{
-						"type":        "string",
-						"description": "Session ID (required for 'close' action)",
-					},
-				},
-				"required": []string{"action"},
-			},
-		},
+	var schemas []map[string]interface{}
+	for _, t := range r.serverTools() {
+		schemas = append(schemas, map[string]interface{}{
+			"name":        t.Tool.Name,
+			"description": t.Tool.Description,
+			"inputSchema": t.Tool.InputSchema,
+		})
 	}
-}
\ No newline at end of file
+	return schemas
+}
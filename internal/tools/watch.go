@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/progress"
+	"mcp-terminal-server/internal/shells"
+	"mcp-terminal-server/internal/watch"
+)
+
+const (
+	// defaultWatchDuration is how long a watch lasts unless the call says otherwise
+	defaultWatchDuration = 30 * time.Second
+	// Files are cheap to poll; commands are re-run less often and never in a tight loop
+	defaultFileInterval    = time.Second
+	minFileInterval        = 100 * time.Millisecond
+	defaultCommandInterval = 5 * time.Second
+	minCommandInterval     = time.Second
+)
+
+// watchTools builds the watch tool
+func (r *Registry) watchTools() []server.ServerTool {
+	watchTool := mcp.NewTool("watch",
+		mcp.WithDescription("Follow a file like 'tail -f', or re-run a command on an interval, for a bounded time. New lines or changes in the command's output are streamed as progress notifications and returned at the end. With 'until' the watch ends as soon as a line matches, e.g. to wait for a service to come up"),
+		mcp.WithString("path",
+			mcp.Description("File to follow; only lines written after the call starts are reported (give either 'path' or 'command')"),
+		),
+		mcp.WithString("command",
+			mcp.Description("Command to re-run; changes in its output are reported as a line diff (give either 'path' or 'command')"),
+		),
+		mcp.WithArray("args",
+			mcp.Description("Arguments of the program in 'command', quoted so they arrive exactly as given (optional)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithNumber("interval",
+			mcp.Description("Seconds between polls of the file or runs of the command (optional, defaults to 1 for files and 5 for commands)"),
+		),
+		mcp.WithNumber("duration",
+			mcp.Description("Seconds to watch for (optional, defaults to 30, capped by the server)"),
+		),
+		mcp.WithString("until",
+			mcp.Description("Regular expression ending the watch at the first line it matches (optional)"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Run a command an open maintenance window asks to confirm (optional, defaults to false)"),
+		),
+	)
+
+	return []server.ServerTool{
+		{Tool: watchTool, Handler: r.handleWatch},
+	}
+}
+
+// handleWatch follows a file or command until the duration ends or the condition is met
+func (r *Registry) handleWatch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	path, _ := args["path"].(string)
+	command := commandLine(args, shells.For(r.config.Shell))
+	if (path == "") == (command == "") {
+		return mcp.NewToolResultError("Give either path or command"), nil
+	}
+
+	opts := watch.Options{Duration: defaultWatchDuration}
+	if durationArg, ok := args["duration"].(float64); ok && durationArg > 0 {
+		opts.Duration = time.Duration(durationArg * float64(time.Second))
+	}
+	opts.Duration = min(opts.Duration, r.config.WatchMaxDuration)
+
+	opts.Interval = defaultFileInterval
+	minInterval := minFileInterval
+	if command != "" {
+		opts.Interval, minInterval = defaultCommandInterval, minCommandInterval
+	}
+	if intervalArg, ok := args["interval"].(float64); ok && intervalArg > 0 {
+		opts.Interval = max(time.Duration(intervalArg*float64(time.Second)), minInterval)
+	}
+
+	if until, _ := args["until"].(string); until != "" {
+		re, err := regexp.Compile(until)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid until pattern: %v", err)), nil
+		}
+		opts.Until = re
+	}
+
+	// Changes are streamed to clients that asked for progress
+	reporter := progress.NewReporter(ctx, request, r.config.ProgressInterval, r.redact)
+	emit := func(text string) {
+		reporter.Write([]byte(text))
+		reporter.Send(text)
+	}
+
+	var (
+		result watch.Result
+		err    error
+		target string
+	)
+	if path != "" {
+		resolved, resolveErr := r.files.Resolve(path)
+		if resolveErr != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to watch file: %v", resolveErr)), nil
+		}
+		// A profile's user may only watch what it could read itself
+		if u := profiles.User(ctx); u != nil {
+			f, err := u.Open(resolved)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Failed to watch file: %v", err)), nil
+			}
+			f.Close()
+		}
+
+		target = path
+		reporter.Start(opts.Duration)
+		result, err = watch.File(ctx, resolved, opts, emit)
+		reporter.Stop()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to watch file: %v", err)), nil
+		}
+	} else {
+		confirmed, _ := args["confirm"].(bool)
+		if result := r.denied(ctx, policy.Request{Tool: "watch", Command: command, Confirmed: confirmed}); result != nil {
+			return result, nil
+		}
+		if result := r.tripped("watch", command, "", ""); result != nil {
+			return result, nil
+		}
+
+		release, busy := r.concurrency.Acquire("")
+		if busy != nil {
+			return mcp.NewToolResultError(busy.JSON()), nil
+		}
+		defer release()
+
+		target = command
+		reporter.Start(opts.Duration)
+		run := func(ctx context.Context) (string, int, error) {
+			return r.executor.Run(ctx, command)
+		}
+		result, err = watch.Command(ctx, run, opts, emit)
+		reporter.Stop()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to watch command: %v", err)), nil
+		}
+	}
+
+	var text strings.Builder
+	switch {
+	case result.Matched != "":
+		fmt.Fprintf(&text, "Condition matched after %s: %s\n", result.Elapsed.Round(time.Millisecond), result.Matched)
+	case opts.Until != nil:
+		fmt.Fprintf(&text, "Watched %s for %s; the condition did not match\n", target, result.Elapsed.Round(time.Second))
+	default:
+		fmt.Fprintf(&text, "Watched %s for %s\n", target, result.Elapsed.Round(time.Second))
+	}
+	if command != "" {
+		fmt.Fprintf(&text, "Runs: %d, last exit code: %d\n", result.Runs, result.ExitCode)
+	}
+
+	switch {
+	case result.Changes == 0:
+		text.WriteString("No changes")
+	case result.Truncated:
+		text.WriteString("[earlier changes omitted]\n" + result.Output)
+	default:
+		text.WriteString(result.Output)
+	}
+
+	return mcp.NewToolResultText(text.String()), nil
+}
@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/logging"
+)
+
+// serviceName is reported unless OTEL_SERVICE_NAME overrides it
+const serviceName = "mcp-terminal-server"
+
+// Setup installs an OTLP/HTTP trace exporter when the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT variable
+// is set, and does nothing otherwise. The exporter reads the remaining
+// standard OTEL_* variables (headers, timeouts, resource attributes) itself.
+// The returned function flushes pending spans and must be called before exit.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return noop, nil
+	}
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(serviceName)),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("failed to build trace resource: %v", err)
+	}
+	// Environment attributes win over the built-in service name
+	if env, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, env); err == nil {
+			res = merged
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the server's tracer. It is a no-op until Setup installs an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer(serviceName)
+}
+
+// StartCommand starts a span for running a command, in a session if sessionID is set
+func StartCommand(ctx context.Context, command, sessionID string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("command.hash", logging.CommandHash(command))}
+	if sessionID != "" {
+		attrs = append(attrs, attribute.String("mcp.session.id", sessionID))
+	}
+	return Tracer().Start(ctx, "command.execute", trace.WithAttributes(attrs...))
+}
+
+// EndCommand records how a command finished and ends its span
+func EndCommand(span trace.Span, exitCode int, duration time.Duration, timedOut bool) {
+	span.SetAttributes(
+		attribute.Int("process.exit.code", exitCode),
+		attribute.Int64("command.duration_ms", duration.Milliseconds()),
+		attribute.Bool("command.timed_out", timedOut),
+	)
+	if timedOut {
+		span.SetStatus(codes.Error, "command timed out")
+	} else if exitCode != 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("exit code %d", exitCode))
+	}
+	span.End()
+}
+
+// ToolMiddleware wraps every tool call in a span
+func ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ctx, span := Tracer().Start(ctx, "tools/call "+request.Params.Name,
+				trace.WithAttributes(attribute.String("mcp.tool.name", request.Params.Name)))
+			defer span.End()
+
+			if sessionID, ok := request.GetArguments()["session_id"].(string); ok && sessionID != "" {
+				span.SetAttributes(attribute.String("mcp.session.id", sessionID))
+			}
+			if requestID := labels.RequestID(ctx); requestID != "" {
+				span.SetAttributes(attribute.String("mcp.request.id", requestID))
+			}
+
+			result, err := next(ctx, request)
+			switch {
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			case result != nil && result.IsError:
+				span.SetStatus(codes.Error, "tool returned an error result")
+			}
+
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package transcript
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one command run in a session together with its output
+type Entry struct {
+	Seq      int
+	Command  string
+	Output   string
+	ExitCode int
+	TimedOut bool
+	Started  time.Time
+	Finished time.Time
+	// LineOffsets says when each line of Output was printed, relative to
+	// Started (nil unless output timing is recorded in transcripts)
+	LineOffsets []time.Duration
+}
+
+// Duration returns how long the command ran
+func (e Entry) Duration() time.Duration {
+	return e.Finished.Sub(e.Started)
+}
+
+// TimedOutput returns the output with each line prefixed by when it was
+// printed, such as "[+1.204s] ", or the plain output when no timing was recorded
+func (e Entry) TimedOutput() string {
+	lines := strings.SplitAfter(e.Output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(e.LineOffsets) == 0 || len(lines) != len(e.LineOffsets) {
+		return e.Output
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&b, "[+%.3fs] %s", e.LineOffsets[i].Seconds(), line)
+	}
+	return b.String()
+}
+
+// Note is an annotation attached to a point in a session's history
+type Note struct {
+	// After is the sequence number of the command the note follows (0 = before the first command)
+	After  int
+	Author string
+	Text   string
+	Time   time.Time
+}
+
+// Transcript is a bounded, append-only record of a session's commands and
+// the notes attached to them. The oldest entries, and the notes attached to
+// them, are dropped once either bound is exceeded.
+type Transcript struct {
+	mu      sync.RWMutex
+	entries []Entry
+	notes   []Note
+	bytes   int
+	nextSeq int
+	// totalBytes and totalTime count the output and running time of every
+	// recorded entry, dropped ones included
+	totalBytes int64
+	totalTime  time.Duration
+	// lastFailure is the latest entry that exited non-zero, without its output
+	lastFailure *Entry
+	maxEntries  int
+	maxBytes    int
+}
+
+// New creates a transcript keeping at most maxEntries entries and maxBytes of output (0 = unbounded)
+func New(maxEntries, maxBytes int) *Transcript {
+	return &Transcript{
+		nextSeq:    1,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// Record appends an entry, assigning its sequence number, and returns it
+func (t *Transcript) Record(entry Entry) Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry.Seq = t.nextSeq
+	t.nextSeq++
+
+	t.entries = append(t.entries, entry)
+	t.bytes += len(entry.Output)
+	t.totalBytes += int64(len(entry.Output))
+	t.totalTime += entry.Duration()
+	if entry.ExitCode != 0 {
+		failure := entry
+		failure.Output, failure.LineOffsets = "", nil
+		t.lastFailure = &failure
+	}
+
+	for len(t.entries) > 1 && (t.maxEntries > 0 && len(t.entries) > t.maxEntries || t.maxBytes > 0 && t.bytes > t.maxBytes) {
+		t.bytes -= len(t.entries[0].Output)
+		t.entries = t.entries[1:]
+	}
+
+	// Notes may precede the oldest retained command but not earlier ones
+	for len(t.notes) > 0 && t.notes[0].After < t.entries[0].Seq-1 {
+		t.notes = t.notes[1:]
+	}
+
+	return entry
+}
+
+// Annotate attaches a note after the command with sequence number after, or
+// after the latest command when after is negative, and returns it
+func (t *Transcript) Annotate(after int, author, text string) (Note, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if after < 0 {
+		after = t.nextSeq - 1
+	}
+	if after >= t.nextSeq {
+		return Note{}, fmt.Errorf("no command #%d recorded yet", after)
+	}
+	if len(t.entries) > 0 && after < t.entries[0].Seq-1 {
+		return Note{}, fmt.Errorf("command #%d is no longer retained", after)
+	}
+
+	note := Note{
+		After:  after,
+		Author: author,
+		Text:   text,
+		Time:   time.Now(),
+	}
+
+	// Keep notes ordered by position, then by time
+	i := len(t.notes)
+	for i > 0 && t.notes[i-1].After > after {
+		i--
+	}
+	t.notes = append(t.notes, Note{})
+	copy(t.notes[i+1:], t.notes[i:])
+	t.notes[i] = note
+
+	if t.maxEntries > 0 && len(t.notes) > t.maxEntries {
+		t.notes = t.notes[1:]
+	}
+
+	return note, nil
+}
+
+// Notes returns a copy of the retained notes in timeline order
+func (t *Transcript) Notes() []Note {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return append([]Note(nil), t.notes...)
+}
+
+// Entries returns a copy of the retained entries, oldest first
+func (t *Transcript) Entries() []Entry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return append([]Entry(nil), t.entries...)
+}
+
+// Page returns up to limit entries starting at sequence number from (0 = oldest retained)
+// and whether more entries follow
+func (t *Transcript) Page(from, limit int) ([]Entry, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	start := 0
+	for start < len(t.entries) && t.entries[start].Seq < from {
+		start++
+	}
+
+	end := len(t.entries)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	return append([]Entry(nil), t.entries[start:end]...), end < len(t.entries)
+}
+
+// Len returns the number of retained entries
+func (t *Transcript) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.entries)
+}
+
+// Totals sums up everything recorded in a transcript, counting entries
+// that have since been dropped
+type Totals struct {
+	Commands    int
+	OutputBytes int64
+	// Time is the wall-clock time the commands ran
+	Time time.Duration
+	// LastFailure is the latest command that exited non-zero, without its
+	// output (nil if none did)
+	LastFailure *Entry
+}
+
+// Totals returns the totals of every command recorded
+func (t *Transcript) Totals() Totals {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	totals := Totals{Commands: t.nextSeq - 1, OutputBytes: t.totalBytes, Time: t.totalTime}
+	if t.lastFailure != nil {
+		failure := *t.lastFailure
+		totals.LastFailure = &failure
+	}
+	return totals
+}
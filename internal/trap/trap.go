@@ -0,0 +1,162 @@
+package trap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/logging"
+)
+
+// webhookTimeout bounds how long an alert delivery may take
+const webhookTimeout = 5 * time.Second
+
+// Trip describes an access to a trap path; it is the webhook's payload
+type Trip = events.Trap
+
+// Detector recognises accesses to trap paths: decoy files such as fake
+// credentials that no legitimate task should touch. Any access is treated as
+// a sign the agent has been manipulated.
+type Detector struct {
+	paths   []string
+	freeze  bool
+	webhook string
+	client  *http.Client
+	log     *slog.Logger
+}
+
+// New creates a detector, or returns nil when no trap paths are configured
+func New(cfg *config.Config) *Detector {
+	if len(cfg.TrapPaths) == 0 {
+		return nil
+	}
+
+	var paths []string
+	for _, path := range cfg.TrapPaths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Clean(abs))
+		// File tools compare resolved paths, so match the link target too
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil && resolved != abs {
+			paths = append(paths, resolved)
+		}
+	}
+
+	return &Detector{
+		paths:   paths,
+		freeze:  cfg.TrapFreeze,
+		webhook: cfg.TrapWebhook,
+		client:  &http.Client{Timeout: webhookTimeout},
+		log:     logging.For("trap"),
+	}
+}
+
+// Freeze reports whether accesses should be refused and their session frozen
+func (d *Detector) Freeze() bool {
+	return d != nil && d.freeze
+}
+
+// Path returns the trap path that a resolved file path is or lies under
+func (d *Detector) Path(path string) string {
+	if d == nil {
+		return ""
+	}
+
+	path = filepath.Clean(path)
+	for _, trap := range d.paths {
+		if path == trap || strings.HasPrefix(path, trap+"/") {
+			return trap
+		}
+	}
+	return ""
+}
+
+// Command returns the first trap path a command refers to or is run inside.
+// Besides the absolute path, the forms relative to the home directory and to
+// the command's working directory are recognised.
+func (d *Detector) Command(command, cwd string) string {
+	if d == nil {
+		return ""
+	}
+
+	// Anything run from inside a trap directory touches it
+	if cwd != "" {
+		if trap := d.Path(cwd); trap != "" {
+			return trap
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, trap := range d.paths {
+		forms := []string{trap}
+		if home != "" && strings.HasPrefix(trap, home+"/") {
+			rel := strings.TrimPrefix(trap, home+"/")
+			forms = append(forms, "~/"+rel, "$HOME/"+rel, "${HOME}/"+rel)
+		}
+		if cwd != "" && strings.HasPrefix(trap, filepath.Clean(cwd)+"/") {
+			forms = append(forms, strings.TrimPrefix(trap, filepath.Clean(cwd)+"/"))
+		}
+
+		for _, form := range forms {
+			if strings.Contains(command, form) {
+				return trap
+			}
+		}
+	}
+	return ""
+}
+
+// Alert reports a trip in the log and, when configured, to the webhook.
+// Delivery happens in the background so the caller is never delayed.
+func (d *Detector) Alert(trip Trip) {
+	if d == nil {
+		return
+	}
+	trip.Version = events.Version
+	if trip.Time.IsZero() {
+		trip.Time = time.Now()
+	}
+
+	d.log.Error("Trap path accessed", "path", trip.Path, "source", trip.Source, "tool", trip.Tool,
+		"session_id", trip.SessionID, logging.Command(trip.Command), "freeze", d.freeze)
+
+	if d.webhook == "" {
+		return
+	}
+	go func() {
+		body, err := json.Marshal(trip)
+		if err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhook, bytes.NewReader(body))
+		if err != nil {
+			d.log.Error("Failed to send trap alert", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			d.log.Error("Failed to send trap alert", "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			d.log.Error("Trap alert webhook rejected the alert", "status", resp.Status)
+		}
+	}()
+}
@@ -0,0 +1,277 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// maxOutput bounds the changes kept for the result; the oldest are dropped
+	maxOutput = 64 << 10
+	// maxReadPerPoll bounds how much of a fast-growing file one poll reads
+	maxReadPerPoll = 1 << 20
+	// maxDiffCells bounds the work of diffing two command outputs; larger
+	// outputs are reported in full instead
+	maxDiffCells = 250000
+)
+
+// Options bound a watch
+type Options struct {
+	// Interval is the time between polls of a file or runs of a command
+	Interval time.Duration
+	// Duration is the longest the watch lasts
+	Duration time.Duration
+	// Until ends the watch early at the first line it matches (nil = never)
+	Until *regexp.Regexp
+}
+
+// Result is what a watch saw
+type Result struct {
+	// Output holds the changes in the order they were seen
+	Output string
+	// Truncated is set when the oldest changes were dropped from Output
+	Truncated bool
+	// Changes counts the polls or runs that brought something new
+	Changes int
+	// Runs counts the runs of a command, and ExitCode is the last one's
+	Runs     int
+	ExitCode int
+	// Matched is the line that matched Options.Until, if any
+	Matched string
+	Elapsed time.Duration
+}
+
+// Emit receives each change as soon as it is seen
+type Emit func(text string)
+
+// collector gathers the changes of a watch and passes them on
+type collector struct {
+	result  Result
+	until   *regexp.Regexp
+	emit    Emit
+	started time.Time
+}
+
+func newCollector(opts Options, emit Emit) *collector {
+	return &collector{until: opts.Until, emit: emit, started: time.Now()}
+}
+
+// add records a change and passes it on
+func (c *collector) add(text string) {
+	if text == "" {
+		return
+	}
+	c.result.Changes++
+	c.result.Output += text
+	if len(c.result.Output) > maxOutput {
+		c.result.Output = c.result.Output[len(c.result.Output)-maxOutput:]
+		c.result.Truncated = true
+	}
+	c.emit(text)
+}
+
+// match reports whether one of lines meets the condition, recording the first that does
+func (c *collector) match(lines []string) bool {
+	if c.until == nil {
+		return false
+	}
+	for _, line := range lines {
+		if c.until.MatchString(line) {
+			c.result.Matched = line
+			return true
+		}
+	}
+	return false
+}
+
+func (c *collector) finish() Result {
+	c.result.Elapsed = time.Since(c.started)
+	return c.result
+}
+
+// File follows a file like tail -f: only content written after the watch
+// starts is reported. A file that is truncated or replaced, as by log
+// rotation, is read again from the start.
+func File(ctx context.Context, path string, opts Options, emit Emit) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() { f.Close() }()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Result{}, err
+	}
+
+	c := newCollector(opts, emit)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(opts.Duration)
+	defer deadline.Stop()
+
+	// read reports the complete lines added to f since the last read, so a
+	// line being written is not split, and whether one meets the condition
+	var partial string
+	read := func() (bool, error) {
+		data, err := io.ReadAll(io.NewSectionReader(f, offset, maxReadPerPoll))
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		offset += int64(len(data))
+
+		text := partial + string(data)
+		end := strings.LastIndexByte(text, '\n') + 1
+		text, partial = text[:end], text[end:]
+		if text == "" {
+			return false, nil
+		}
+		c.add(text)
+		return c.match(strings.Split(strings.TrimSuffix(text, "\n"), "\n")), nil
+	}
+	flush := func() {
+		if partial != "" {
+			c.add(partial + "\n")
+			partial = ""
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return c.finish(), nil
+		case <-deadline.C:
+			flush()
+			return c.finish(), nil
+		case <-ticker.C:
+		}
+
+		// The path may name a new file since the last poll, as after log
+		// rotation; the old file is read to its end before switching. While
+		// the path is missing the old file is still read.
+		var replaced *os.File
+		if info, err := os.Stat(path); err == nil {
+			current, err := f.Stat()
+			switch {
+			case err != nil || !os.SameFile(info, current):
+				replaced, _ = os.Open(path)
+			case info.Size() < offset:
+				offset, partial = 0, ""
+				c.add("[file truncated, reading from the start]\n")
+			}
+		}
+
+		if matched, err := read(); matched || err != nil {
+			if replaced != nil {
+				replaced.Close()
+			}
+			return c.finish(), err
+		}
+		if replaced == nil {
+			continue
+		}
+
+		flush()
+		f.Close()
+		f, offset = replaced, 0
+		c.add("[file replaced, reading from the start]\n")
+		if matched, err := read(); matched || err != nil {
+			return c.finish(), err
+		}
+	}
+}
+
+// Command runs a command every interval and reports how its output changed
+// since the previous run as a line diff; the first run is reported in full
+func Command(ctx context.Context, run func(context.Context) (string, int, error), opts Options, emit Emit) (Result, error) {
+	c := newCollector(opts, emit)
+	deadline := time.Now().Add(opts.Duration)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	var previous []string
+	for {
+		output, exitCode, err := run(ctx)
+		if ctx.Err() != nil {
+			// A run cut short by the deadline says nothing about the command
+			return c.finish(), nil
+		}
+		if err != nil {
+			return c.finish(), err
+		}
+		c.result.Runs++
+
+		lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+		header := fmt.Sprintf("--- run %d at %s (exit %d) ---\n", c.result.Runs, time.Now().Format("15:04:05"), exitCode)
+		switch {
+		case c.result.Runs == 1:
+			if output != "" && !strings.HasSuffix(output, "\n") {
+				output += "\n"
+			}
+			c.add(header + output)
+		case exitCode != c.result.ExitCode || !slices.Equal(previous, lines):
+			c.add(header + diff(previous, lines))
+		}
+		c.result.ExitCode = exitCode
+		previous = lines
+
+		if c.match(lines) {
+			return c.finish(), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return c.finish(), nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// diff lists the lines removed from old with "- " and those added in new with
+// "+ ", in order, using the longest common subsequence of the two
+func diff(old, new []string) string {
+	var out strings.Builder
+	if len(old)*len(new) > maxDiffCells {
+		for _, line := range new {
+			out.WriteString("  " + line + "\n")
+		}
+		return out.String()
+	}
+
+	// common[i][j] is the length of the longest common subsequence of old[i:] and new[j:]
+	common := make([][]int, len(old)+1)
+	for i := range common {
+		common[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			i++
+			j++
+		case i < len(old) && (j == len(new) || common[i+1][j] >= common[i][j+1]):
+			out.WriteString("- " + old[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + new[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/events"
+	"mcp-terminal-server/internal/health"
+	"mcp-terminal-server/internal/logging"
+)
+
+const (
+	// deliveryTimeout bounds one attempt to deliver an event
+	deliveryTimeout = 10 * time.Second
+	// queueSize is how many events may wait for one endpoint before new
+	// ones are dropped
+	queueSize = 1000
+	// firstBackoff is the wait before the first retry, doubled for each
+	// further retry up to maxBackoff
+	firstBackoff = time.Second
+	maxBackoff   = time.Minute
+)
+
+// Types lists the events the lifecycle webhooks can receive
+var Types = []string{
+	events.TypeCommandCompleted,
+	events.TypeCommandFailed,
+	events.TypeSessionCreated,
+	events.TypeExpired,
+	events.TypeApprovalRequested,
+}
+
+// Envelope is the body of every delivery
+type Envelope struct {
+	// ID is the same for every attempt to deliver the event, so receivers
+	// can drop duplicates
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// notifier delivers events to the configured endpoints
+type notifier struct {
+	endpoints []*endpoint
+	// types selects the events sent (empty = all)
+	types []string
+	log   *slog.Logger
+}
+
+// endpoint delivers events to one URL in order, so one slow or failing
+// receiver does not hold back the others
+type endpoint struct {
+	url     string
+	secret  []byte
+	retries int
+	client  *http.Client
+	queue   chan Envelope
+	log     *slog.Logger
+}
+
+// current is the notifier set up from the configuration, nil when no webhook is configured
+var current atomic.Pointer[notifier]
+
+// Setup starts delivering lifecycle events to the configured webhooks
+func Setup(cfg *config.Config) {
+	if len(cfg.WebhookURLs) == 0 {
+		return
+	}
+
+	n := &notifier{types: cfg.WebhookEvents, log: logging.For("webhook")}
+	for _, t := range n.types {
+		if !slices.Contains(Types, t) {
+			n.log.Warn("Ignoring unknown webhook event", "event", t)
+		}
+	}
+	for _, url := range cfg.WebhookURLs {
+		e := &endpoint{
+			url:     url,
+			secret:  []byte(cfg.WebhookSecret),
+			retries: cfg.WebhookRetries,
+			client:  &http.Client{Timeout: deliveryTimeout},
+			queue:   make(chan Envelope, queueSize),
+			log:     n.log,
+		}
+		n.endpoints = append(n.endpoints, e)
+		go e.run()
+	}
+	current.Store(n)
+	n.log.Info("Sending lifecycle events to webhooks", "endpoints", len(n.endpoints), "signed", cfg.WebhookSecret != "")
+}
+
+// Notify queues an event for every webhook. It never blocks: when an
+// endpoint has fallen too far behind, the event is dropped for it.
+func Notify(eventType string, data interface{}) {
+	n := current.Load()
+	if n == nil || (len(n.types) > 0 && !slices.Contains(n.types, eventType)) {
+		return
+	}
+
+	envelope := Envelope{ID: newID(), Type: eventType, Time: time.Now().UTC(), Data: data}
+	for _, e := range n.endpoints {
+		select {
+		case e.queue <- envelope:
+		default:
+			e.log.Warn("Webhook is falling behind; dropping event", "url", e.url, "event", eventType)
+		}
+	}
+}
+
+// Command reports a finished command, as command_failed when it exited
+// non-zero or timed out and command_completed otherwise
+func Command(finished events.CommandFinished) {
+	finished.Version = events.Version
+	eventType := events.TypeCommandCompleted
+	if finished.ExitCode != 0 || finished.TimedOut {
+		eventType = events.TypeCommandFailed
+	}
+	Notify(eventType, finished)
+}
+
+// run delivers the endpoint's events one at a time
+func (e *endpoint) run() {
+	for envelope := range e.queue {
+		body, err := json.Marshal(envelope)
+		if err != nil {
+			e.log.Error("Failed to encode webhook event", "event", envelope.Type, "error", err)
+			continue
+		}
+		e.deliver(envelope, body)
+	}
+}
+
+// deliver posts an event, retrying with exponential backoff while the
+// endpoint is unreachable, answers 5xx or asks to slow down with 429
+func (e *endpoint) deliver(envelope Envelope, body []byte) {
+	backoff := firstBackoff
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := e.post(envelope, body)
+		if err == nil {
+			health.Clear("webhook")
+			return
+		}
+		if !retry || attempt >= e.retries {
+			e.log.Error("Failed to deliver webhook event", "url", e.url, "event", envelope.Type, "id", envelope.ID, "attempts", attempt+1, "error", err)
+			health.SetDegraded("webhook", fmt.Sprintf("failed to deliver %s to %s: %v", envelope.Type, e.url, err))
+			return
+		}
+
+		wait = min(max(wait, backoff), maxBackoff)
+		e.log.Warn("Retrying webhook delivery", "url", e.url, "event", envelope.Type, "id", envelope.ID, "in", wait.String(), "error", err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// post makes one delivery attempt. It reports whether a failed attempt is
+// worth retrying, and how long the endpoint asked to wait first.
+func (e *endpoint) post(envelope Envelope, body []byte) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-MCP-Event", envelope.Type)
+	req.Header.Set("X-MCP-Delivery", envelope.ID)
+	if len(e.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-MCP-Timestamp", timestamp)
+		req.Header.Set("X-MCP-Signature-256", "sha256="+Sign(e.secret, timestamp, body))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var wait time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return true, wait, fmt.Errorf("endpoint answered %s", resp.Status)
+	default:
+		return false, 0, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" under secret,
+// which receivers compute to check the X-MCP-Signature-256 header. Signing
+// the timestamp lets them refuse old deliveries replayed later.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newID returns a random delivery ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
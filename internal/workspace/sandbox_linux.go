@@ -0,0 +1,201 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// systemDirs are shared read-only with commands in a chroot sandbox
+var systemDirs = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc"}
+
+// Confine arranges for cmd to run inside the workspace sandbox: it is started
+// as the sandbox helper in a mount namespace of its own, which sets up the
+// mounts and then executes the command in place of itself, keeping its PID.
+// Without a sandbox cmd is left alone.
+func (w *Workspace) Confine(cmd *exec.Cmd) error {
+	if !w.Sandboxed() {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the server executable for the sandbox: %v", err)
+	}
+
+	cmd.Args = append([]string{exe, helperArg, w.sandbox, w.dir, cmd.Path}, cmd.Args...)
+	cmd.Path = exe
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	return nil
+}
+
+// RunHelper acts as the sandbox helper when the server binary was started as
+// one, and never returns then. Otherwise it returns at once. It must be called
+// first thing in main.
+func RunHelper() {
+	if len(os.Args) < 6 || os.Args[1] != helperArg {
+		return
+	}
+	mode, dir, path, argv := os.Args[2], os.Args[3], os.Args[4], os.Args[5:]
+
+	if err := enter(mode, dir); err != nil {
+		fmt.Fprintf(os.Stderr, "workspace sandbox: %v\n", err)
+		os.Exit(126)
+	}
+	err := syscall.Exec(path, argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "workspace sandbox: failed to run %s: %v\n", path, err)
+	os.Exit(127)
+}
+
+// enter sets up the mounts of the sandbox in the helper's own namespace
+func enter(mode, dir string) error {
+	// Nothing done here may leak back into the host's mounts
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %v", err)
+	}
+
+	switch mode {
+	case SandboxMount:
+		return enterMount(dir)
+	case SandboxChroot:
+		return enterChroot(dir)
+	}
+	return fmt.Errorf("unknown sandbox mode %q", mode)
+}
+
+// enterMount makes every mount read-only except the workspace and /dev, and
+// gives the command a private, empty temporary directory
+func enterMount(dir string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get the working directory: %v", err)
+	}
+
+	writable := []string{dir, "/dev"}
+	for _, path := range writable {
+		// A mount of its own, so it can be made writable again below
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind %s: %v", path, err)
+		}
+	}
+
+	if err := readOnly("/"); err != nil {
+		return err
+	}
+	for _, path := range writable {
+		if err := unix.MountSetattr(-1, path, unix.AT_RECURSIVE, &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}); err != nil {
+			return fmt.Errorf("failed to make %s writable: %v", path, err)
+		}
+	}
+
+	// A workspace inside the temporary directory would be hidden by it
+	if tmp := os.TempDir(); !(&Workspace{dir: tmp}).Contains(dir) {
+		if err := unix.Mount("tmpfs", tmp, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("failed to mount a private %s: %v", tmp, err)
+		}
+	}
+
+	// The working directory still refers to the mounts that were covered
+	return os.Chdir(cwd)
+}
+
+// enterChroot builds a root on a private tmpfs from the system directories,
+// /dev, /proc and the workspace, and changes into it. The command keeps its
+// working directory when it is inside the workspace.
+func enterChroot(dir string) error {
+	cwd, _ := os.Getwd()
+
+	// The workspace may be inside the temporary directory the new root is built in
+	workspace, err := os.OpenFile(dir, unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open the workspace: %v", err)
+	}
+	defer workspace.Close()
+
+	base := os.TempDir()
+	if err := unix.Mount("tmpfs", base, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("failed to mount the sandbox root: %v", err)
+	}
+	root := filepath.Join(base, "root")
+
+	for _, path := range systemDirs {
+		info, err := os.Lstat(path)
+		switch {
+		case err != nil:
+			continue
+		case info.Mode()&os.ModeSymlink != 0:
+			// Merged /usr systems link /bin and /lib into /usr
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("failed to read link %s: %v", path, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(root+path), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(target, root+path); err != nil {
+				return fmt.Errorf("failed to link %s: %v", path, err)
+			}
+		case info.IsDir():
+			if err := bind(path, root+path); err != nil {
+				return err
+			}
+			if err := readOnly(root + path); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, path := range []string{"/dev", "/proc"} {
+		if err := bind(path, root+path); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(root+"/tmp", 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(root+"/tmp", 01777); err != nil {
+		return err
+	}
+	if err := bind(fmt.Sprintf("/proc/self/fd/%d", workspace.Fd()), root+dir); err != nil {
+		return err
+	}
+
+	if err := unix.Chroot(root); err != nil {
+		return fmt.Errorf("failed to change root: %v", err)
+	}
+	if cwd == "" || !(&Workspace{dir: dir}).Contains(cwd) {
+		cwd = dir
+	}
+	return os.Chdir(cwd)
+}
+
+// bind mounts source with its submounts at target, creating target first
+func bind(source, target string) error {
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", target, err)
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind %s: %v", source, err)
+	}
+	return nil
+}
+
+// readOnly makes the mount at path and those below it read-only. Kernels
+// before 5.12 cannot do so recursively, and only the mount itself is changed.
+func readOnly(path string) error {
+	err := unix.MountSetattr(-1, path, unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY})
+	if err == nil {
+		return nil
+	}
+	if err := unix.Mount("", path, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("failed to make %s read-only: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package workspace
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Confine refuses to start commands in a sandbox, which needs Linux mount
+// namespaces, rather than run them unconfined
+func (w *Workspace) Confine(cmd *exec.Cmd) error {
+	if !w.Sandboxed() {
+		return nil
+	}
+	return fmt.Errorf("the %s workspace sandbox is not supported on %s", w.sandbox, runtime.GOOS)
+}
+
+// RunHelper returns at once; there is no sandbox helper outside Linux
+func RunHelper() {}
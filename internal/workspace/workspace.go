@@ -0,0 +1,94 @@
+package workspace
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"mcp-terminal-server/internal/config"
+)
+
+// Sandbox modes
+const (
+	// SandboxNone only makes the workspace the starting directory
+	SandboxNone = "none"
+	// SandboxMount runs commands with the whole file system read-only except
+	// the workspace, /dev and a private temporary directory
+	SandboxMount = "mount"
+	// SandboxChroot runs commands in a root holding only the workspace, the
+	// system directories (read-only), /dev, /proc and a private /tmp
+	SandboxChroot = "chroot"
+)
+
+// helperArg makes the server binary act as the sandbox helper, which sets up
+// the mounts of a command's namespace and then runs the command
+const helperArg = "__workspace-sandbox"
+
+// Workspace is the directory agents work in. Sessions and commands start in
+// it, relative paths are resolved against it and, with a sandbox, commands
+// are confined to it.
+type Workspace struct {
+	dir     string
+	sandbox string
+}
+
+// New returns the configured workspace, or nil when there is none
+func New(cfg *config.Config) *Workspace {
+	if cfg.Workspace == "" {
+		return nil
+	}
+	dir := filepath.Clean(cfg.Workspace)
+	// Compare against resolved paths, as the working directories of commands are
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return &Workspace{dir: dir, sandbox: cfg.WorkspaceSandbox}
+}
+
+// Dir returns the workspace directory, or "" without a workspace
+func (w *Workspace) Dir() string {
+	if w == nil {
+		return ""
+	}
+	return w.dir
+}
+
+// Sandboxed reports whether commands are confined to the workspace
+func (w *Workspace) Sandboxed() bool {
+	return w != nil && w.sandbox != SandboxNone
+}
+
+// Sandbox returns the sandbox mode
+func (w *Workspace) Sandbox() string {
+	if w == nil {
+		return SandboxNone
+	}
+	return w.sandbox
+}
+
+// Abs resolves a relative path against the workspace. Absolute paths, and
+// all paths without a workspace, are returned unchanged.
+func (w *Workspace) Abs(path string) string {
+	if w == nil || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(w.dir, path)
+}
+
+// Check refuses a working directory outside a sandboxed workspace, where
+// commands could not reach it or write to it
+func (w *Workspace) Check(dir string) error {
+	if !w.Sandboxed() || dir == "" || w.Contains(dir) {
+		return nil
+	}
+	return fmt.Errorf("%s is outside the workspace %s", dir, w.dir)
+}
+
+// Contains reports whether path is the workspace or inside it
+func (w *Workspace) Contains(path string) bool {
+	if w == nil {
+		return true
+	}
+	path = filepath.Clean(path)
+	return path == w.dir || w.dir == "/" || strings.HasPrefix(path, w.dir+"/")
+}
@@ -1,61 +1,176 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
 	"mcp-terminal-server/internal/config"
-	"mcp-terminal-server/internal/executor"
-	"mcp-terminal-server/internal/session"
-	"mcp-terminal-server/internal/tools"
+	"mcp-terminal-server/internal/listener"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/tracing"
+	"mcp-terminal-server/pkg/terminal"
 )
 
+// shutdownTimeout is how long requests in flight have to finish on shutdown
+const shutdownTimeout = 5 * time.Second
+
 func main() {
+	// Sandboxed commands start as the server binary, which sets up the sandbox
+	terminal.RunHelper()
+
 	// Initialize configuration
 	cfg := config.NewConfig()
 	cfg.ParseFlags()
 
+	// Export traces if an OTLP endpoint is configured
+	logger := logging.For("server")
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		logger.Warn("Tracing disabled", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize components
-	sessionManager := session.NewManager(cfg)
-	exec := executor.New(cfg)
-	toolsRegistry := tools.NewRegistry(cfg, sessionManager, exec)
+	term, err := terminal.New(cfg)
+	if err != nil {
+		logger.Error("Failed to set up the terminal tools", "error", err)
+		os.Exit(1)
+	}
+	defer term.Close()
+	if cfg.Workspace != "" {
+		logger.Info("Using workspace", "workspace", cfg.Workspace, "sandbox", cfg.WorkspaceSandbox)
+	}
 
 	// Create MCP server
 	mcpServer := server.NewMCPServer(
 		"Terminal Command Executor",
 		"1.0.0",
-		server.WithToolCapabilities(false),
-		server.WithRecovery(),
+		append(term.ServerOptions(), server.WithRecovery())...,
 	)
 
-	// Register tools
-	toolsRegistry.RegisterTools(mcpServer)
+	// Register tools, and publish session transcripts as resources
+	term.Register(mcpServer)
 
 	// Log startup information
-	log.Printf("Starting MCP Terminal Server on platform: %s", cfg.Platform)
-	log.Printf("Default timeout: %v", cfg.DefaultTimeout)
-	log.Printf("Default shell: %s", cfg.Shell)
+	logger.Info("Starting MCP Terminal Server", "platform", cfg.Platform, "timeout", cfg.DefaultTimeout.String(), "shell", cfg.Shell)
 
-	if cfg.HTTPMode {
-		// HTTP mode with StreamableHTTP transport
-		addr := fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
-		log.Printf("Starting StreamableHTTP server on %s", addr)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer stop()
 
-		// Create StreamableHTTP server
-		streamableServer := server.NewStreamableHTTPServer(mcpServer)
-
-		log.Printf("Server endpoint:")
-		log.Printf("  MCP: http://%s/mcp (StreamableHTTP transport)", addr)
+	if cfg.GRPCAddr != "" {
+		// The gRPC API runs alongside either transport
+		go func() {
+			if err := serveGRPC(ctx, cfg, term, mcpServer); err != nil {
+				logger.Error("gRPC server error", "error", err)
+				stop()
+			}
+		}()
+	}
 
-		if err := streamableServer.Start(addr); err != nil {
-			log.Fatalf("StreamableHTTP server error: %v", err)
+	if !cfg.HTTPMode {
+		if err := serveStdio(ctx, term, mcpServer); err != nil {
+			logger.Error("STDIO server error", "error", err)
+			term.Close()
+			os.Exit(1)
 		}
-	} else {
-		// STDIO mode
-		log.Printf("Starting STDIO server")
-		if err := server.ServeStdio(mcpServer); err != nil {
-			log.Fatalf("STDIO server error: %v", err)
+		return
+	}
+
+	if cfg.StdioMode {
+		// The client that started the server shares its sessions with the
+		// HTTP clients. The server stops when that client goes away.
+		go func() {
+			err := serveStdio(ctx, term, mcpServer)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.Error("STDIO server error", "error", err)
+			}
+			logger.Info("STDIO client disconnected; stopping")
+			stop()
+		}()
+	}
+	if err := serveHTTP(ctx, cfg, term, mcpServer); err != nil {
+		logger.Error("StreamableHTTP server error", "error", err)
+		term.Close()
+		os.Exit(1)
+	}
+}
+
+// serveStdio serves MCP on stdin and stdout until they are closed or ctx is done
+func serveStdio(ctx context.Context, term *terminal.Terminal, mcpServer *server.MCPServer) error {
+	logging.For("server").Info("Starting STDIO server")
+	stdioServer := server.NewStdioServer(mcpServer)
+	stdioServer.SetContextFunc(term.StdioContextFunc())
+
+	// Subscription requests are answered before reaching the server
+	stdin, stdout := term.Stdio(os.Stdin, os.Stdout)
+	return stdioServer.Listen(ctx, stdin, stdout)
+}
+
+// serveHTTP serves MCP with the StreamableHTTP transport, and the HTTP API,
+// until ctx is done
+func serveHTTP(ctx context.Context, cfg *config.Config, term *terminal.Terminal, mcpServer *server.MCPServer) error {
+	logger := logging.For("server")
+	l, addr, err := listener.Listen(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	endpoint := fmt.Sprintf("http://%s/mcp", addr)
+	if cfg.UnixSocket != "" {
+		endpoint = "/mcp on " + addr
+	}
+	logger.Info("Starting StreamableHTTP server", "addr", addr, "endpoint", endpoint)
+
+	// Create StreamableHTTP server
+	streamableServer := server.NewStreamableHTTPServer(mcpServer,
+		server.WithHTTPContextFunc(term.HTTPContextFunc()))
+
+	httpServer := term.HTTPServer(streamableServer)
+
+	// Stop accepting connections when done, which also removes a Unix socket
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			httpServer.Close()
 		}
+	}()
+
+	if err := httpServer.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
-}
\ No newline at end of file
+	<-stopped
+	return nil
+}
+
+// serveGRPC serves the gRPC API until ctx is done
+func serveGRPC(ctx context.Context, cfg *config.Config, term *terminal.Terminal, mcpServer *server.MCPServer) error {
+	l, addr, err := listener.ListenGRPC(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	logging.For("server").Info("Starting gRPC server", "addr", addr)
+
+	grpcServer := term.GRPCServer(mcpServer)
+	go func() {
+		<-ctx.Done()
+		// Streams such as Attach run until their client leaves, so they are
+		// cut off after the shutdown timeout
+		timer := time.AfterFunc(shutdownTimeout, grpcServer.Stop)
+		defer timer.Stop()
+		grpcServer.GracefulStop()
+	}()
+	return grpcServer.Serve(l)
+}
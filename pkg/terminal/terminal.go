@@ -0,0 +1,241 @@
+// Package terminal embeds the terminal tools in another Go program's MCP
+// server, instead of running the terminal server as a separate process.
+//
+// A program builds a Terminal from a Config, passes its ServerOptions to the
+// MCP server it creates and registers the tools on it:
+//
+//	func main() {
+//		terminal.RunHelper()
+//
+//		t, err := terminal.New(terminal.ConfigFromEnv())
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		defer t.Close()
+//
+//		s := server.NewMCPServer("my-server", "1.0.0", t.ServerOptions()...)
+//		t.Register(s)
+//		// register the program's own tools on s
+//
+//		stdio := server.NewStdioServer(s)
+//		stdio.SetContextFunc(t.StdioContextFunc())
+//		in, out := t.Stdio(os.Stdin, os.Stdout)
+//		stdio.Listen(context.Background(), in, out)
+//	}
+//
+// The tools behave as they do in the terminal server, with the same settings,
+// policy, audit log, redaction and result formats. Over HTTP, Handler serves
+// the server's REST API around the program's MCP handler.
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/mark3labs/mcp-go/server"
+	"google.golang.org/grpc"
+	"mcp-terminal-server/internal/access"
+	"mcp-terminal-server/internal/audit"
+	"mcp-terminal-server/internal/backends"
+	"mcp-terminal-server/internal/config"
+	"mcp-terminal-server/internal/executor"
+	"mcp-terminal-server/internal/handlers"
+	"mcp-terminal-server/internal/idempotency"
+	"mcp-terminal-server/internal/labels"
+	"mcp-terminal-server/internal/logging"
+	"mcp-terminal-server/internal/plugins"
+	"mcp-terminal-server/internal/policy"
+	"mcp-terminal-server/internal/profiles"
+	"mcp-terminal-server/internal/receipt"
+	"mcp-terminal-server/internal/redact"
+	"mcp-terminal-server/internal/render"
+	"mcp-terminal-server/internal/resources"
+	"mcp-terminal-server/internal/rpc"
+	"mcp-terminal-server/internal/schedule"
+	"mcp-terminal-server/internal/session"
+	"mcp-terminal-server/internal/templates"
+	"mcp-terminal-server/internal/tools"
+	"mcp-terminal-server/internal/tracing"
+	"mcp-terminal-server/internal/webhook"
+	"mcp-terminal-server/internal/workspace"
+)
+
+// Config holds the settings of the tools. Each field is documented where it
+// is declared, and most have an MCP_* environment variable described in the
+// README.
+type Config = config.Config
+
+// NewConfig returns the default settings, with the shell detected for the
+// platform
+func NewConfig() *Config {
+	return config.NewConfig()
+}
+
+// ConfigFromEnv returns the default settings overridden by the MCP_*
+// environment variables, as the terminal server reads them. The command line
+// is left alone.
+func ConfigFromEnv() *Config {
+	cfg := config.NewConfig()
+	cfg.ParseEnv()
+	return cfg
+}
+
+// RunHelper acts as the workspace sandbox helper when the program was started
+// as one, and never returns then. Programs that enable the sandbox must call
+// it first thing in main, since sandboxed commands start as the program's
+// own binary.
+func RunHelper() {
+	workspace.RunHelper()
+}
+
+// Terminal is the tool registry with everything its tools run on: the
+// persistent sessions, the executor, the command policy, the audit log, the
+// scheduler, the profiles and the receipt signer
+type Terminal struct {
+	cfg       *Config
+	redactor  *redact.Redactor
+	sessions  *session.Manager
+	policy    *policy.Engine
+	audit     *audit.Log
+	scheduler *schedule.Scheduler
+	profiles  *profiles.Store
+	receipts  *receipt.Signer
+	registry  *tools.Registry
+	resources *resources.Service
+}
+
+// New sets up the tools from cfg. It loads the files cfg names, such as the
+// policy, templates, profiles and receipt key, opens the audit log, and starts the
+// webhooks and the checks of required backends. Close releases what New
+// opened.
+func New(cfg *Config) (*Terminal, error) {
+	if cfg.Workspace != "" {
+		if info, err := os.Stat(cfg.Workspace); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("workspace %s is not a directory", cfg.Workspace)
+		}
+	}
+
+	t := &Terminal{cfg: cfg, redactor: redact.New(cfg)}
+	if t.redactor != nil {
+		// Keep secrets out of the logs
+		logging.SetFilter(t.redactor.String)
+	}
+	webhook.Setup(cfg)
+	backends.Check(cfg)
+
+	var err error
+	if t.audit, err = audit.Open(cfg); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	t.sessions = session.NewManager(cfg, t.audit)
+	exec := executor.New(cfg)
+	t.policy = policy.New(cfg)
+	t.scheduler = schedule.New(cfg, exec, t.policy)
+	if t.profiles, err = profiles.Load(cfg); err != nil {
+		t.audit.Close()
+		return nil, fmt.Errorf("failed to load profiles file %s: %v", cfg.ProfilesFile, err)
+	}
+	if t.receipts, err = receipt.Load(cfg); err != nil {
+		t.audit.Close()
+		return nil, fmt.Errorf("failed to load receipt key %s: %v", cfg.ReceiptKeyFile, err)
+	}
+	t.registry = tools.NewRegistry(cfg, t.sessions, exec, t.policy, t.scheduler, t.profiles)
+	customTools, err := templates.Load(cfg.ToolsFile)
+	if err == nil {
+		err = t.registry.AddTemplates(customTools)
+	}
+	if err != nil {
+		t.audit.Close()
+		return nil, fmt.Errorf("failed to load tools file %s: %v", cfg.ToolsFile, err)
+	}
+	if err := t.registry.AddPlugins(plugins.Discover(cfg)); err != nil {
+		t.audit.Close()
+		return nil, fmt.Errorf("failed to load plugins from %s: %v", cfg.PluginDir, err)
+	}
+	t.resources = resources.New(t.sessions)
+	return t, nil
+}
+
+// ServerOptions returns the options an MCP server needs to serve the tools:
+// its tool and resource capabilities, the hook that gives clients their
+// profiles, the tool middleware and the policy's tool filter. Pass them to
+// server.NewMCPServer before any options of the program's own; the
+// middleware then also covers the program's tools.
+func (t *Terminal) ServerOptions() []server.ServerOption {
+	return []server.ServerOption{
+		server.WithToolCapabilities(false),
+		server.WithResourceCapabilities(true, true),
+		server.WithHooks(t.profiles.Hooks()),
+		server.WithToolHandlerMiddleware(labels.ToolMiddleware()),
+		server.WithToolHandlerMiddleware(tracing.ToolMiddleware()),
+		server.WithToolHandlerMiddleware(idempotency.New(t.cfg).ToolMiddleware()),
+		server.WithToolHandlerMiddleware(t.receipts.ToolMiddleware()),
+		server.WithToolHandlerMiddleware(render.ToolMiddleware(t.cfg.ResultFormat, t.cfg.ResultVerbosity)),
+		server.WithToolHandlerMiddleware(t.profiles.ToolMiddleware()),
+		server.WithToolHandlerMiddleware(t.audit.ToolMiddleware()),
+		server.WithToolHandlerMiddleware(t.redactor.ToolMiddleware()),
+		server.WithToolHandlerMiddleware(t.policy.ToolMiddleware()),
+		server.WithToolFilter(t.policy.ToolFilter()),
+	}
+}
+
+// Register adds the tools to s, and the transcripts of the sessions as
+// resources
+func (t *Terminal) Register(s *server.MCPServer) {
+	t.registry.RegisterTools(s)
+	t.resources.Register(s)
+}
+
+// HTTPContextFunc tells the tools which client, identity and idempotency key
+// an HTTP request carries. Pass it to server.WithHTTPContextFunc.
+func (t *Terminal) HTTPContextFunc() server.HTTPContextFunc {
+	return idempotency.HTTPContextFunc(access.HTTPContextFunc(t.cfg.AdminToken))
+}
+
+// StdioContextFunc tells the tools the client on stdio started the program,
+// which makes it an administrator. Pass it to the stdio server's
+// SetContextFunc.
+func (t *Terminal) StdioContextFunc() server.StdioContextFunc {
+	return access.StdioContextFunc()
+}
+
+// Stdio wraps the streams of a stdio server so that resource subscriptions
+// are answered, since the MCP server does not handle them itself
+func (t *Terminal) Stdio(in io.Reader, out io.Writer) (io.Reader, io.Writer) {
+	return t.resources.Stdio(in, out)
+}
+
+// Handler serves the terminal server's HTTP API, such as /healthz,
+// /sessions/observe and the admin endpoints, with mcpHandler, usually the
+// program's StreamableHTTP server, at /mcp
+func (t *Terminal) Handler(mcpHandler http.Handler) http.Handler {
+	return handlers.New(t.cfg, t.sessions, t.policy, t.audit, t.scheduler, t.receipts, t.profiles, t.resources.Handler(t.cfg.AdminToken, mcpHandler))
+}
+
+// HTTPServer returns an HTTP server for Handler(mcpHandler) with the timeouts
+// the settings give
+func (t *Terminal) HTTPServer(mcpHandler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           t.Handler(mcpHandler),
+		ReadHeaderTimeout: t.cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       t.cfg.HTTPReadTimeout,
+		WriteTimeout:      t.cfg.HTTPWriteTimeout,
+		IdleTimeout:       t.cfg.HTTPIdleTimeout,
+	}
+}
+
+// GRPCServer returns a gRPC server for the API in pkg/terminalpb. Its calls
+// run the tools registered on mcpServer, so they pass through the same
+// middleware as MCP clients' calls.
+func (t *Terminal) GRPCServer(mcpServer *server.MCPServer) *grpc.Server {
+	return rpc.New(t.cfg, mcpServer, t.sessions, t.policy, t.profiles, t.audit)
+}
+
+// Close closes the persistent sessions, running the teardown commands of
+// their profiles, and then the audit log those are recorded in
+func (t *Terminal) Close() error {
+	t.sessions.Close()
+	return t.audit.Close()
+}
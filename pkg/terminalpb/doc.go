@@ -0,0 +1,7 @@
+// Package terminalpb is the gRPC API of the terminal server, generated from
+// terminal.proto. Programs that are not MCP clients use it to run commands and
+// manage sessions with typed results and streamed output; see the README for
+// how to enable the gRPC listener.
+package terminalpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative terminal.proto